@@ -0,0 +1,96 @@
+// Command fake-metabase serves an in-memory Metabase, loaded from a JSON
+// fixture, for running the MCP server end to end without a real Metabase.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase/metabasefake"
+	"github.com/anaryk/metabase-mcp-server/internal/metabase/metabasetest"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	fs := flag.NewFlagSet("fake-metabase", flag.ContinueOnError)
+	addr := fs.String("addr", "127.0.0.1:3000", "Address to listen on")
+	fixture := fs.String("fixture", "", "JSON fixture to load (default: the built-in sample)")
+	version := fs.String("version", "", "Metabase version to report, overriding the fixture's (e.g. v0.46.6)")
+	logLevel := fs.String("log-level", "info", "Log level: debug logs every request")
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+
+	level, err := zerolog.ParseLevel(*logLevel)
+	if err != nil {
+		level = zerolog.InfoLevel
+	}
+	logger := zerolog.New(os.Stderr).
+		With().
+		Timestamp().
+		Str("component", "fake-metabase").
+		Logger().
+		Level(level)
+
+	fx := metabasetest.SampleFixture()
+	if *fixture != "" {
+		if fx, err = metabasetest.ReadFixture(*fixture); err != nil {
+			return err
+		}
+	}
+	if *version != "" {
+		fx.Version = *version
+	}
+	server, err := metabasefake.New(fx, logger)
+	if err != nil {
+		return fmt.Errorf("load fixture: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Handler: server}
+	errCh := make(chan error, 1)
+	go func() {
+		if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	ev := logger.Info().Str("url", "http://"+ln.Addr().String()).Strs("api_keys", fx.APIKeys)
+	var users []string
+	for _, u := range fx.Users {
+		if u.Password != "" {
+			users = append(users, u.Email)
+		}
+	}
+	ev.Strs("users", users).Msg("fake metabase ready")
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("fake metabase server error: %w", err)
+	case <-ctx.Done():
+		logger.Info().Msg("shutting down fake metabase")
+		return httpServer.Close()
+	}
+}
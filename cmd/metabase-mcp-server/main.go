@@ -6,13 +6,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rs/zerolog"
 
 	"github.com/anaryk/metabase-mcp-server/internal/config"
+	"github.com/anaryk/metabase-mcp-server/internal/httpauth"
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+	"github.com/anaryk/metabase-mcp-server/internal/percaller"
 	"github.com/anaryk/metabase-mcp-server/internal/tools"
 )
 
@@ -45,46 +49,221 @@ func run() error {
 
 	logger.Info().
 		Str("version", version).
-		Str("metabase_url", cfg.MetabaseURL).
 		Str("transport", cfg.Transport).
+		Str("profile", cfg.Profile).
+		Int("instances", len(cfg.Instances)).
 		Msg("starting metabase MCP server")
 
-	client, err := metabase.NewClient(cfg.MetabaseURL, cfg.APIKey, cfg.Username, cfg.Password, logger)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	toolOpts := tools.Options{
+		RowLimit:     cfg.RowLimit,
+		MaxRowLimit:  cfg.MaxRowLimit,
+		EnableTools:  cfg.EnableTools,
+		DisableTools: cfg.DisableTools,
+		ReadOnly:     cfg.ReadOnly,
+		Shutdown:     ctx,
+		Jobs:         tools.NewJobs(cfg.JobWorkers, cfg.JobTTL),
+	}
+	if cfg.PromptsDir != "" {
+		prompts, err := tools.LoadPrompts(cfg.PromptsDir)
+		if err != nil {
+			return err
+		}
+		toolOpts.Prompts = prompts
+		logger.Info().Str("dir", cfg.PromptsDir).Int("count", len(prompts)).Msg("prompts loaded")
+	}
+	enabled, err := tools.EnabledTools(toolOpts)
 	if err != nil {
-		return fmt.Errorf("creating metabase client: %w", err)
+		return err
 	}
+	if len(enabled) == 0 {
+		return fmt.Errorf("no tools enabled; check --enable-tools, --disable-tools and --read-only")
+	}
+	logger.Info().
+		Bool("read_only", cfg.ReadOnly).
+		Int("count", len(enabled)).
+		Strs("tools", enabled).
+		Msg("tools enabled")
 
-	server := mcp.NewServer(&mcp.Implementation{
-		Name:    "metabase-mcp-server",
-		Version: version,
-	}, &mcp.ServerOptions{
-		Instructions: "Metabase MCP Server provides tools to interact with a Metabase instance. " +
-			"You can manage dashboards, cards (saved questions), collections, run queries, and more. " +
-			"SQL queries are restricted to read-only (SELECT) operations for safety.",
-	})
+	newServer := func(instances *tools.Instances) *mcp.Server {
+		opts := &mcp.ServerOptions{
+			Instructions: "Metabase MCP Server provides tools to interact with a Metabase instance. " +
+				"You can manage dashboards, cards (saved questions), collections, run queries, and more. " +
+				"SQL queries are restricted to read-only (SELECT) operations for safety. " +
+				"Database schemas are available as metabase://database/{id}/schema resources.",
+		}
+		tools.EnableResourceSubscriptions(opts)
+		server := mcp.NewServer(&mcp.Implementation{
+			Name:    "metabase-mcp-server",
+			Version: version,
+		}, opts)
+		tools.RegisterAll(server, instances, logger, toolOpts)
+		return server
+	}
 
-	tools.RegisterAll(server, client, logger)
+	if cfg.PerCallerAuth {
+		verifier, err := newVerifier(cfg, logger)
+		if err != nil {
+			return err
+		}
+		logger.Info().Dur("session_timeout", cfg.SessionTimeout).Msg("per-caller Metabase authentication enabled")
+		return runSSE(ctx, percaller.NewHandler(percaller.Options{
+			Instances:       cfg.Instances,
+			DefaultInstance: cfg.DefaultInstance,
+			NewServer:       newServer,
+			SessionTimeout:  cfg.SessionTimeout,
+			ClientOptions:   clientOptions(cfg),
+			Logger:          logger,
+		}), cfg.Port, verifier, logger)
+	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	instances, err := connectInstances(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer logout(instances, logger)
+	server := newServer(instances)
 
 	switch cfg.Transport {
 	case "sse":
-		return runSSE(ctx, server, cfg.Port, logger)
+		verifier, err := newVerifier(cfg, logger)
+		if err != nil {
+			return err
+		}
+		return runSSE(ctx, mcp.NewStreamableHTTPHandler(func(_ *http.Request) *mcp.Server {
+			return server
+		}, nil), cfg.Port, verifier, logger)
 	default:
 		return runStdio(ctx, server, logger)
 	}
 }
 
+// clientOptions returns the Metabase client options shared by all
+// instances.
+func clientOptions(cfg *config.Config) []metabase.Option {
+	opts := []metabase.Option{
+		metabase.WithRetry(metabase.RetryPolicy{
+			MaxRetries: cfg.MaxRetries,
+			MinWait:    min(metabase.DefaultRetryPolicy.MinWait, cfg.RetryMaxWait),
+			MaxWait:    cfg.RetryMaxWait,
+		}),
+		metabase.WithCircuitBreaker(metabase.BreakerPolicy{
+			Threshold: cfg.BreakerThreshold,
+			Cooldown:  cfg.BreakerCooldown,
+		}),
+	}
+	if cfg.SessionCacheDir != "" {
+		opts = append(opts, metabase.WithSessionCache(cfg.SessionCacheDir))
+	}
+	return opts
+}
+
+// connectInstances creates a client per configured Metabase instance and
+// checks each one. Unavailable instances are logged and kept, so that they
+// can be used once they come back; startup fails only if none is available.
+func connectInstances(ctx context.Context, cfg *config.Config, logger zerolog.Logger) (*tools.Instances, error) {
+	instances := tools.NewInstances()
+	var lastErr error
+	available := 0
+	for _, inst := range cfg.Instances {
+		instLogger := logger.With().Str("instance", inst.Name).Logger()
+		opts := append(clientOptions(cfg), metabase.WithoutStartupCheck())
+		switch {
+		case cfg.RecordDir != "":
+			dir := filepath.Join(cfg.RecordDir, inst.Name)
+			instLogger.Warn().Str("dir", dir).Msg("recording metabase traffic")
+			opts = append(opts, metabase.WithRecording(dir))
+		case cfg.ReplayDir != "":
+			dir := filepath.Join(cfg.ReplayDir, inst.Name)
+			instLogger.Info().Str("dir", dir).Msg("replaying recorded metabase traffic")
+			opts = append(opts, metabase.WithReplay(dir))
+		}
+		client, err := metabase.NewClient(inst.MetabaseURL, inst.APIKey, inst.Username, inst.Password, instLogger, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("creating metabase client for instance %q: %w", inst.Name, err)
+		}
+		instances.Add(inst.Name, client)
+
+		if err := client.HealthCheck(ctx); err != nil {
+			lastErr = fmt.Errorf("metabase health check failed for instance %q: %w", inst.Name, err)
+			instLogger.Error().Err(err).Str("metabase_url", inst.MetabaseURL).Msg("metabase instance unavailable")
+			continue
+		}
+		available++
+		ev := instLogger.Info().Str("metabase_url", inst.MetabaseURL)
+		if info, err := client.ServerInfo(ctx); err != nil {
+			instLogger.Warn().Err(err).Msg("detecting metabase version failed, will retry on first use")
+		} else {
+			ev = ev.Str("version", info.Version.String()).Strs("features", info.Features)
+		}
+		ev.Msg("connected to metabase instance")
+	}
+	if available == 0 {
+		return nil, lastErr
+	}
+	if err := instances.SetDefault(cfg.DefaultInstance); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// logout ends the Metabase sessions the server logged in with, unless they
+// are cached for the next start.
+func logout(instances *tools.Instances, logger zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, name := range instances.Names() {
+		api, _ := instances.Get(name)
+		client, ok := api.(*metabase.Client)
+		if !ok {
+			continue
+		}
+		if err := client.Logout(ctx); err != nil {
+			logger.Warn().Err(err).Str("instance", name).Msg("metabase logout failed")
+		}
+	}
+}
+
 func runStdio(ctx context.Context, server *mcp.Server, logger zerolog.Logger) error {
 	logger.Info().Msg("MCP server ready, listening on stdio")
 	return server.Run(ctx, &mcp.StdioTransport{})
 }
 
-func runSSE(ctx context.Context, server *mcp.Server, port int, logger zerolog.Logger) error {
-	handler := mcp.NewStreamableHTTPHandler(func(_ *http.Request) *mcp.Server {
-		return server
-	}, nil)
+// newVerifier builds the bearer token verifier for the HTTP transport from
+// the configured token and JWKS files. It returns nil if neither is set.
+func newVerifier(cfg *config.Config, logger zerolog.Logger) (*httpauth.Verifier, error) {
+	var tokens *httpauth.StaticTokens
+	var jwt *httpauth.JWTVerifier
+	var err error
+	if cfg.AuthTokensFile != "" {
+		if tokens, err = httpauth.LoadStaticTokens(cfg.AuthTokensFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWKSFile != "" {
+		jwt, err = httpauth.LoadJWKS(cfg.JWKSFile, httpauth.JWTOptions{
+			Issuer:    cfg.JWTIssuer,
+			Audience:  cfg.JWTAudience,
+			NameClaim: cfg.JWTNameClaim,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tokens == nil && jwt == nil {
+		logger.Warn().Msg("HTTP transport has no authentication configured; anyone who can reach the port can use every tool")
+		return nil, nil
+	}
+	logger.Info().Bool("static_tokens", tokens != nil).Bool("jwt", jwt != nil).Msg("HTTP bearer authentication enabled")
+	return httpauth.NewVerifier(tokens, jwt, logger), nil
+}
+
+func runSSE(ctx context.Context, handler http.Handler, port int, verifier *httpauth.Verifier, logger zerolog.Logger) error {
+	if verifier != nil {
+		handler = verifier.Middleware(handler)
+	}
 
 	addr := fmt.Sprintf(":%d", port)
 	httpServer := &http.Server{
@@ -3,9 +3,12 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Config holds all configuration for the Metabase MCP server.
@@ -17,10 +20,163 @@ type Config struct {
 	LogLevel    string
 	Transport   string
 	Port        int
+	// RowLimit is the default number of rows query tools return.
+	RowLimit int
+	// MaxRowLimit caps the per-call max_rows argument of query tools.
+	MaxRowLimit int
+
+	// AuthTokensFile holds named static bearer tokens for the HTTP transport.
+	AuthTokensFile string
+	// JWKSFile holds public keys for validating JWT bearer tokens on the
+	// HTTP transport; JWTIssuer and JWTAudience optionally restrict the
+	// accepted tokens, and JWTNameClaim names the caller in logs.
+	JWKSFile     string
+	JWTIssuer    string
+	JWTAudience  string
+	JWTNameClaim string
+
+	// PerCallerAuth makes the HTTP transport authenticate to Metabase with
+	// credentials supplied by each caller instead of the configured ones.
+	PerCallerAuth bool
+	// SessionTimeout closes idle HTTP sessions, and with them the
+	// per-caller Metabase clients, in PerCallerAuth mode.
+	SessionTimeout time.Duration
+
+	// EnableTools, if set, restricts the tools offered to those matching one
+	// of its patterns, which are tool categories or globs on tool names.
+	// DisableTools removes the tools matching any of its patterns, and
+	// ReadOnly removes every tool that modifies Metabase.
+	EnableTools  []string
+	DisableTools []string
+	ReadOnly     bool
+
+	// MaxRetries and RetryMaxWait control how transient Metabase failures
+	// are retried. BreakerThreshold consecutive failures make calls fail
+	// fast for BreakerCooldown; a threshold of zero disables the breaker.
+	MaxRetries       int
+	RetryMaxWait     time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// SessionCacheDir, if set, keeps the Metabase sessions obtained with
+	// username and password across restarts.
+	SessionCacheDir string
+
+	// RecordDir, if set, records the Metabase traffic of each instance, with
+	// credentials scrubbed, to cassettes in per-instance subdirectories.
+	// ReplayDir serves Metabase responses from such cassettes instead.
+	RecordDir string
+	ReplayDir string
+
+	// PromptsDir, if set, holds YAML files defining prompts to offer
+	// besides the built-in ones.
+	PromptsDir string
+
+	// JobWorkers is the number of async tool calls run at once; JobTTL is
+	// how long a finished job's result is kept.
+	JobWorkers int
+	JobTTL     time.Duration
+
+	// Instances lists the Metabase instances to serve. Without instances in
+	// the config file profile, it holds a single instance named "default"
+	// built from MetabaseURL and the credentials above.
+	Instances []Instance
+	// DefaultInstance is the instance tools use when none is given.
+	DefaultInstance string
+
+	// ConfigFile and Profile identify the config file profile the
+	// configuration was read from, if any.
+	ConfigFile string
+	Profile    string
+
+	// sources records where each setting that did not come from its
+	// default was read from, keyed by flag name.
+	sources map[string]string
+}
+
+// Instance holds the connection settings of one Metabase instance.
+type Instance struct {
+	Name        string
+	MetabaseURL string
+	APIKey      string
+	Username    string
+	Password    string
 }
 
-// Load parses configuration from command-line flags and environment variables.
-// Flags take precedence over environment variables.
+// setting ties a flag to the environment variable and config file key that
+// can also provide its value. The config file value of a list setting may
+// be a YAML sequence.
+type setting struct {
+	flag string
+	env  string
+	key  string
+	list bool
+	// path marks a file or directory, which a config file gives relative
+	// to itself.
+	path bool
+}
+
+// settings lists every value that can be provided by flag, environment
+// variable or config file profile.
+var settings = []setting{
+	{flag: "metabase-url", env: "METABASE_URL", key: "metabase_url"},
+	{flag: "api-key", env: "METABASE_API_KEY", key: "api_key"},
+	{flag: "username", env: "METABASE_USERNAME", key: "username"},
+	{flag: "password", env: "METABASE_PASSWORD", key: "password"},
+	{flag: "log-level", env: "LOG_LEVEL", key: "log_level"},
+	{flag: "transport", env: "TRANSPORT", key: "transport"},
+	{flag: "port", env: "PORT", key: "port"},
+	{flag: "row-limit", env: "ROW_LIMIT", key: "row_limit"},
+	{flag: "max-row-limit", env: "MAX_ROW_LIMIT", key: "max_row_limit"},
+	{flag: "auth-tokens-file", env: "AUTH_TOKENS_FILE", key: "auth_tokens_file", path: true},
+	{flag: "jwt-jwks-file", env: "JWT_JWKS_FILE", key: "jwt_jwks_file", path: true},
+	{flag: "jwt-issuer", env: "JWT_ISSUER", key: "jwt_issuer"},
+	{flag: "jwt-audience", env: "JWT_AUDIENCE", key: "jwt_audience"},
+	{flag: "jwt-name-claim", env: "JWT_NAME_CLAIM", key: "jwt_name_claim"},
+	{flag: "per-caller-auth", env: "PER_CALLER_AUTH", key: "per_caller_auth"},
+	{flag: "session-timeout", env: "SESSION_TIMEOUT", key: "session_timeout"},
+	{flag: "enable-tools", env: "ENABLE_TOOLS", key: "enable_tools", list: true},
+	{flag: "disable-tools", env: "DISABLE_TOOLS", key: "disable_tools", list: true},
+	{flag: "read-only", env: "READ_ONLY", key: "read_only"},
+	{flag: "session-cache-dir", env: "SESSION_CACHE_DIR", key: "session_cache_dir", path: true},
+	{flag: "max-retries", env: "MAX_RETRIES", key: "max_retries"},
+	{flag: "retry-max-wait", env: "RETRY_MAX_WAIT", key: "retry_max_wait"},
+	{flag: "breaker-threshold", env: "BREAKER_THRESHOLD", key: "breaker_threshold"},
+	{flag: "breaker-cooldown", env: "BREAKER_COOLDOWN", key: "breaker_cooldown"},
+	{flag: "record", env: "RECORD_DIR", key: "record_dir", path: true},
+	{flag: "replay", env: "REPLAY_DIR", key: "replay_dir", path: true},
+	{flag: "prompts-dir", env: "PROMPTS_DIR", key: "prompts_dir", path: true},
+	{flag: "job-workers", env: "JOB_WORKERS", key: "job_workers"},
+	{flag: "job-ttl", env: "JOB_TTL", key: "job_ttl"},
+}
+
+// listFlag is a flag holding a comma-separated list.
+type listFlag struct {
+	values *[]string
+}
+
+func (f listFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+// Set replaces the list, so that a flag overrides rather than extends the
+// environment or config file.
+func (f listFlag) Set(s string) error {
+	*f.values = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f.values = append(*f.values, v)
+		}
+	}
+	return nil
+}
+
+// Load parses configuration from command-line flags, environment variables
+// and an optional config file profile. Flags take precedence over
+// environment variables, which take precedence over the config file.
 func Load(args []string) (*Config, error) {
 	fs := flag.NewFlagSet("metabase-mcp-server", flag.ContinueOnError)
 
@@ -32,60 +188,217 @@ func Load(args []string) (*Config, error) {
 	fs.StringVar(&cfg.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
 	fs.StringVar(&cfg.Transport, "transport", "stdio", "Transport type: stdio or sse")
 	fs.IntVar(&cfg.Port, "port", 8808, "Port for SSE transport")
+	fs.IntVar(&cfg.RowLimit, "row-limit", 200, "Default maximum rows returned by query tools")
+	fs.IntVar(&cfg.MaxRowLimit, "max-row-limit", 2000, "Upper bound for the per-call max_rows argument")
+	fs.StringVar(&cfg.AuthTokensFile, "auth-tokens-file", "", "File of name:token lines accepted as bearer tokens on the HTTP transport")
+	fs.StringVar(&cfg.JWKSFile, "jwt-jwks-file", "", "JWKS file with public keys for validating JWT bearer tokens on the HTTP transport")
+	fs.StringVar(&cfg.JWTIssuer, "jwt-issuer", "", "Required iss claim of JWT bearer tokens")
+	fs.StringVar(&cfg.JWTAudience, "jwt-audience", "", "Required aud claim of JWT bearer tokens")
+	fs.StringVar(&cfg.JWTNameClaim, "jwt-name-claim", "sub", "JWT claim identifying the caller in logs")
+	fs.BoolVar(&cfg.PerCallerAuth, "per-caller-auth", false, "On the HTTP transport, use each caller's Metabase API key or session (X-Metabase-Api-Key or X-Metabase-Session header)")
+	fs.DurationVar(&cfg.SessionTimeout, "session-timeout", 30*time.Minute, "Idle timeout for HTTP sessions with per-caller auth")
+	fs.Var(listFlag{&cfg.EnableTools}, "enable-tools", "Comma-separated tool names, globs or categories to offer (default: all)")
+	fs.Var(listFlag{&cfg.DisableTools}, "disable-tools", "Comma-separated tool names, globs or categories to leave out")
+	fs.BoolVar(&cfg.ReadOnly, "read-only", false, "Offer only tools that do not modify Metabase")
+	fs.StringVar(&cfg.SessionCacheDir, "session-cache-dir", "", "Directory to keep Metabase sessions in across restarts (username/password auth)")
+	fs.IntVar(&cfg.MaxRetries, "max-retries", 3, "Retries of Metabase calls that failed transiently (0 disables)")
+	fs.DurationVar(&cfg.RetryMaxWait, "retry-max-wait", 5*time.Second, "Longest wait between retries of a Metabase call")
+	fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", 5, "Consecutive Metabase failures that make calls fail fast (0 disables)")
+	fs.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", 30*time.Second, "How long calls fail fast before Metabase is tried again")
+	fs.StringVar(&cfg.RecordDir, "record", "", "Directory to record Metabase requests and responses to, with credentials scrubbed")
+	fs.StringVar(&cfg.ReplayDir, "replay", "", "Directory of recorded Metabase responses to serve instead of contacting Metabase")
+	fs.StringVar(&cfg.PromptsDir, "prompts-dir", "", "Directory of YAML prompt definitions to offer besides the built-in prompts")
+	fs.IntVar(&cfg.JobWorkers, "job-workers", 4, "Number of async query and sync jobs run at once")
+	fs.DurationVar(&cfg.JobTTL, "job-ttl", time.Hour, "How long the result of a finished async job is kept")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "Path to a YAML config file with named profiles")
+	fs.StringVar(&cfg.Profile, "profile", "", "Config file profile to use")
 
 	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
 
-	// Environment variables as fallback
-	if cfg.MetabaseURL == "" {
-		cfg.MetabaseURL = os.Getenv("METABASE_URL")
-	}
-	if cfg.APIKey == "" {
-		cfg.APIKey = os.Getenv("METABASE_API_KEY")
-	}
-	if cfg.Username == "" {
-		cfg.Username = os.Getenv("METABASE_USERNAME")
+	cfg.sources = make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		cfg.sources[f.Name] = "flag --" + f.Name
+	})
+
+	if cfg.ConfigFile == "" {
+		cfg.ConfigFile = os.Getenv("METABASE_MCP_CONFIG")
 	}
-	if cfg.Password == "" {
-		cfg.Password = os.Getenv("METABASE_PASSWORD")
+	if cfg.Profile == "" {
+		cfg.Profile = os.Getenv("METABASE_MCP_PROFILE")
 	}
-	if cfg.LogLevel == "info" {
-		if envLevel := os.Getenv("LOG_LEVEL"); envLevel != "" {
-			cfg.LogLevel = envLevel
+
+	var prof *profile
+	if cfg.ConfigFile != "" {
+		var err error
+		prof, err = loadProfile(cfg.ConfigFile, cfg.Profile)
+		if err != nil {
+			return nil, err
 		}
+		cfg.Profile = prof.name
+	} else if cfg.Profile != "" {
+		return nil, errors.New("--profile requires a config file (--config or METABASE_MCP_CONFIG)")
 	}
-	if cfg.Transport == "stdio" {
-		if envTransport := os.Getenv("TRANSPORT"); envTransport != "" {
-			cfg.Transport = envTransport
+
+	for _, s := range settings {
+		if _, ok := cfg.sources[s.flag]; ok {
+			continue
 		}
-	}
-	if cfg.Port == 8808 {
-		if envPort := os.Getenv("PORT"); envPort != "" {
-			if p, err := strconv.Atoi(envPort); err == nil {
-				cfg.Port = p
+		if v := os.Getenv(s.env); v != "" {
+			if err := fs.Set(s.flag, v); err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s: %w", v, s.env, err)
 			}
+			cfg.sources[s.flag] = "env " + s.env
+			continue
+		}
+		if v, ok := prof.value(s.key); ok {
+			// Paths in the config file are relative to the file.
+			if s.path && !filepath.IsAbs(v.value) {
+				v.value = filepath.Join(filepath.Dir(prof.file), v.value)
+			}
+			if err := fs.Set(s.flag, v.value); err != nil {
+				return nil, prof.errorf(v, s.key, "invalid value %q", v.value)
+			}
+			cfg.sources[s.flag] = prof.describe(v, s.key)
 		}
 	}
 
 	cfg.MetabaseURL = strings.TrimRight(cfg.MetabaseURL, "/")
 
+	if prof != nil && len(prof.instances) > 0 {
+		if err := cfg.loadInstances(prof); err != nil {
+			return nil, err
+		}
+		if err := cfg.validateSettings(); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
+	}
+
 	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
+	cfg.Instances = []Instance{{
+		Name:        "default",
+		MetabaseURL: cfg.MetabaseURL,
+		APIKey:      cfg.APIKey,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+	}}
+	cfg.DefaultInstance = "default"
 
 	return &cfg, nil
 }
 
+// loadInstances fills Instances from the instances of a config file profile.
+// Instances without credentials of their own inherit the top-level ones.
+func (c *Config) loadInstances(prof *profile) error {
+	if c.MetabaseURL != "" {
+		return fmt.Errorf("metabase URL%s cannot be combined with instances in profile %q of %s; set metabase_url per instance", c.origin("metabase-url"), prof.name, prof.file)
+	}
+	for _, fi := range prof.instances {
+		inst := Instance{
+			Name:        fi.name,
+			MetabaseURL: strings.TrimRight(fi.values["metabase_url"].value, "/"),
+			APIKey:      fi.values["api_key"].value,
+			Username:    fi.values["username"].value,
+			Password:    fi.values["password"].value,
+		}
+		if inst.APIKey == "" && inst.Username == "" && inst.Password == "" {
+			inst.APIKey, inst.Username, inst.Password = c.APIKey, c.Username, c.Password
+		}
+		where := fmt.Sprintf("%s:%d: profiles.%s.instances.%s", prof.file, fi.line, prof.name, fi.name)
+		if inst.MetabaseURL == "" {
+			return fmt.Errorf("%s: metabase_url is required", where)
+		}
+		if inst.APIKey == "" && (inst.Username == "" || inst.Password == "") && !c.PerCallerAuth {
+			return fmt.Errorf("%s: either api_key or username/password is required", where)
+		}
+		c.Instances = append(c.Instances, inst)
+	}
+
+	c.DefaultInstance = c.Instances[0].Name
+	if v := prof.defaultInstance; v.value != "" {
+		if !slices.ContainsFunc(c.Instances, func(i Instance) bool { return i.Name == v.value }) {
+			return prof.errorf(v, "default_instance", "unknown instance %q", v.value)
+		}
+		c.DefaultInstance = v.value
+	}
+	return nil
+}
+
+// origin describes where a setting was read from, for error messages. It is
+// empty for defaults.
+func (c *Config) origin(flagName string) string {
+	if src, ok := c.sources[flagName]; ok {
+		return " (" + src + ")"
+	}
+	return ""
+}
+
+// fileHint names the config file key that could provide a missing value,
+// when a config file is in use.
+func (c *Config) fileHint(key string) string {
+	if c.ConfigFile == "" {
+		return ""
+	}
+	return fmt.Sprintf(", or %s in profile %q of %s", key, c.Profile, c.ConfigFile)
+}
+
 func (c *Config) validate() error {
 	if c.MetabaseURL == "" {
-		return errors.New("metabase URL is required (--metabase-url or METABASE_URL)")
+		return errors.New("metabase URL is required (--metabase-url or METABASE_URL" + c.fileHint("metabase_url") + ")")
 	}
-	if c.APIKey == "" && (c.Username == "" || c.Password == "") {
-		return errors.New("either API key (--api-key or METABASE_API_KEY) or username/password (--username/--password or METABASE_USERNAME/METABASE_PASSWORD) is required")
+	if c.APIKey == "" && (c.Username == "" || c.Password == "") && !c.PerCallerAuth {
+		return errors.New("either API key (--api-key or METABASE_API_KEY) or username/password (--username/--password or METABASE_USERNAME/METABASE_PASSWORD) is required" + c.fileHint("api_key"))
 	}
+	return c.validateSettings()
+}
+
+// validateSettings checks the settings that do not depend on the instances.
+func (c *Config) validateSettings() error {
 	if c.Transport != "stdio" && c.Transport != "sse" {
-		return errors.New("transport must be 'stdio' or 'sse'")
+		return errors.New("transport must be 'stdio' or 'sse'" + c.origin("transport"))
+	}
+	if c.RowLimit < 1 {
+		return errors.New("row limit must be at least 1" + c.origin("row-limit"))
+	}
+	if c.MaxRowLimit < c.RowLimit {
+		return errors.New("max row limit must not be lower than the row limit" + c.origin("max-row-limit"))
+	}
+	if c.PerCallerAuth && c.Transport != "sse" {
+		return errors.New("per-caller auth requires the sse transport" + c.origin("per-caller-auth"))
+	}
+	if c.SessionTimeout < 0 {
+		return errors.New("session timeout must not be negative" + c.origin("session-timeout"))
+	}
+	if c.MaxRetries < 0 {
+		return errors.New("max retries must not be negative" + c.origin("max-retries"))
+	}
+	if c.RetryMaxWait < 0 {
+		return errors.New("retry max wait must not be negative" + c.origin("retry-max-wait"))
+	}
+	if c.BreakerThreshold < 0 {
+		return errors.New("breaker threshold must not be negative" + c.origin("breaker-threshold"))
+	}
+	if c.BreakerCooldown < 0 {
+		return errors.New("breaker cooldown must not be negative" + c.origin("breaker-cooldown"))
+	}
+	if c.JobWorkers < 1 {
+		return errors.New("job workers must be at least 1" + c.origin("job-workers"))
+	}
+	if c.JobTTL <= 0 {
+		return errors.New("job TTL must be positive" + c.origin("job-ttl"))
+	}
+	if c.RecordDir != "" && c.ReplayDir != "" {
+		return errors.New("--record and --replay cannot be combined")
+	}
+	if c.PerCallerAuth && (c.RecordDir != "" || c.ReplayDir != "") {
+		return errors.New("--record and --replay cannot be used with per-caller auth" + c.origin("per-caller-auth"))
+	}
+	if c.JWKSFile == "" && (c.JWTIssuer != "" || c.JWTAudience != "") {
+		return errors.New("JWT issuer and audience require a JWKS file (--jwt-jwks-file or JWT_JWKS_FILE)")
 	}
 	return nil
 }
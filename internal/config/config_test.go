@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -137,3 +138,176 @@ func TestLoad_InvalidTransport(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "transport must be")
 }
+
+func TestLoad_RowLimits(t *testing.T) {
+	cfg, err := Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200, cfg.RowLimit)
+	assert.Equal(t, 2000, cfg.MaxRowLimit)
+
+	t.Setenv("ROW_LIMIT", "50")
+	t.Setenv("MAX_ROW_LIMIT", "500")
+	cfg, err = Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.RowLimit)
+	assert.Equal(t, 500, cfg.MaxRowLimit)
+
+	cfg, err = Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+		"--row-limit", "100",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 100, cfg.RowLimit)
+}
+
+func TestLoad_InvalidRowLimits(t *testing.T) {
+	_, err := Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+		"--row-limit", "0",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "row limit must be at least 1")
+
+	_, err = Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+		"--row-limit", "500",
+		"--max-row-limit", "100",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max row limit")
+}
+
+func TestLoad_HTTPAuth(t *testing.T) {
+	t.Setenv("JWT_AUDIENCE", "metabase-mcp")
+	cfg, err := Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+		"--auth-tokens-file", "/etc/mcp/tokens",
+		"--jwt-jwks-file", "/etc/mcp/jwks.json",
+		"--jwt-name-claim", "email",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/mcp/tokens", cfg.AuthTokensFile)
+	assert.Equal(t, "/etc/mcp/jwks.json", cfg.JWKSFile)
+	assert.Equal(t, "metabase-mcp", cfg.JWTAudience)
+	assert.Equal(t, "email", cfg.JWTNameClaim)
+
+	_, err = Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+		"--jwt-issuer", "https://idp",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "require a JWKS file")
+}
+
+func TestLoad_PerCallerAuth(t *testing.T) {
+	cfg, err := Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--transport", "sse",
+		"--per-caller-auth",
+		"--session-timeout", "10m",
+	})
+	require.NoError(t, err, "credentials are optional with per-caller auth")
+	assert.True(t, cfg.PerCallerAuth)
+	assert.Equal(t, 10*time.Minute, cfg.SessionTimeout)
+
+	t.Setenv("PER_CALLER_AUTH", "true")
+	_, err = Load([]string{"--metabase-url", "http://localhost:3000"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "per-caller auth requires the sse transport (env PER_CALLER_AUTH)")
+}
+
+func TestLoad_ToolFilter(t *testing.T) {
+	t.Setenv("DISABLE_TOOLS", "delete_*")
+	cfg, err := Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+		"--enable-tools", "cards, get_*,",
+		"--read-only",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cards", "get_*"}, cfg.EnableTools)
+	assert.Equal(t, []string{"delete_*"}, cfg.DisableTools)
+	assert.True(t, cfg.ReadOnly)
+}
+
+func TestLoad_Resilience(t *testing.T) {
+	cfg, err := Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, cfg.MaxRetries)
+	assert.Equal(t, 5*time.Second, cfg.RetryMaxWait)
+	assert.Equal(t, 5, cfg.BreakerThreshold)
+	assert.Equal(t, 30*time.Second, cfg.BreakerCooldown)
+
+	t.Setenv("BREAKER_COOLDOWN", "1m")
+	cfg, err = Load([]string{
+		"--metabase-url", "http://localhost:3000",
+		"--api-key", "key",
+		"--max-retries", "0",
+		"--breaker-threshold", "2",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, cfg.MaxRetries)
+	assert.Equal(t, 2, cfg.BreakerThreshold)
+	assert.Equal(t, time.Minute, cfg.BreakerCooldown)
+
+	_, err = Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key", "--max-retries", "-1"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max retries must not be negative (flag --max-retries)")
+}
+
+func TestLoad_SessionCacheDir(t *testing.T) {
+	t.Setenv("SESSION_CACHE_DIR", "/var/cache/metabase-mcp")
+	cfg, err := Load([]string{"--metabase-url", "http://localhost:3000", "--username", "u", "--password", "p"})
+	require.NoError(t, err)
+	assert.Equal(t, "/var/cache/metabase-mcp", cfg.SessionCacheDir)
+}
+
+func TestLoad_PromptsDir(t *testing.T) {
+	t.Setenv("PROMPTS_DIR", "/etc/metabase-mcp/prompts")
+	cfg, err := Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key"})
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/metabase-mcp/prompts", cfg.PromptsDir)
+}
+
+func TestLoad_Jobs(t *testing.T) {
+	cfg, err := Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, cfg.JobWorkers)
+	assert.Equal(t, time.Hour, cfg.JobTTL)
+
+	t.Setenv("JOB_TTL", "15m")
+	cfg, err = Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key", "--job-workers", "2"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, cfg.JobWorkers)
+	assert.Equal(t, 15*time.Minute, cfg.JobTTL)
+
+	_, err = Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key", "--job-workers", "0"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "job workers must be at least 1 (flag --job-workers)")
+}
+
+func TestLoad_RecordReplay(t *testing.T) {
+	t.Setenv("REPLAY_DIR", "testdata/cassettes")
+	cfg, err := Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key"})
+	require.NoError(t, err)
+	assert.Equal(t, "testdata/cassettes", cfg.ReplayDir)
+
+	_, err = Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key", "--record", "out"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--record and --replay cannot be combined")
+
+	_, err = Load([]string{"--metabase-url", "http://localhost:3000", "--transport", "sse", "--per-caller-auth", "--replay", "in"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be used with per-caller auth")
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profile holds the settings of one named profile from a config file.
+type profile struct {
+	file   string
+	name   string
+	values map[string]fileValue
+
+	instances       []fileInstance
+	defaultInstance fileValue
+}
+
+// fileInstance holds the connection settings of one Metabase instance of a
+// profile.
+type fileInstance struct {
+	name   string
+	line   int
+	values map[string]fileValue
+}
+
+// instanceKeys lists the settings an entry under instances may have.
+var instanceKeys = []string{"metabase_url", "api_key", "username", "password"}
+
+// fileValue is a scalar read from a config file, with its position.
+type fileValue struct {
+	value string
+	line  int
+}
+
+// loadProfile reads a YAML config file of the form
+//
+//	default_profile: staging
+//	profiles:
+//	  staging:
+//	    metabase_url: https://metabase.staging.example.com
+//	    api_key: mb_...
+//	  production:
+//	    ...
+//
+// and returns the named profile. An empty name selects default_profile, or
+// the only profile if there is just one.
+func loadProfile(path, name string) (*profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("config file %s is empty", path)
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: config file must be a mapping", path, doc.Line)
+	}
+
+	var defaultProfile string
+	var profiles *yaml.Node
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		key, val := doc.Content[i], doc.Content[i+1]
+		switch key.Value {
+		case "default_profile":
+			if val.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("%s:%d: default_profile must be a string", path, val.Line)
+			}
+			defaultProfile = val.Value
+		case "profiles":
+			if val.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%s:%d: profiles must be a mapping of profile names to settings", path, val.Line)
+			}
+			profiles = val
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown key %q", path, key.Line, key.Value)
+		}
+	}
+	if profiles == nil || len(profiles.Content) == 0 {
+		return nil, fmt.Errorf("config file %s defines no profiles", path)
+	}
+
+	var names []string
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		names = append(names, profiles.Content[i].Value)
+	}
+	if name == "" {
+		name = defaultProfile
+	}
+	if name == "" {
+		if len(names) > 1 {
+			return nil, fmt.Errorf("config file %s has several profiles (%s); select one with --profile or default_profile", path, strings.Join(names, ", "))
+		}
+		name = names[0]
+	}
+	idx := slices.Index(names, name)
+	if idx < 0 {
+		return nil, fmt.Errorf("config file %s: profile %q not found (available: %s)", path, name, strings.Join(names, ", "))
+	}
+
+	node := profiles.Content[2*idx+1]
+	p := &profile{file: path, name: name, values: make(map[string]fileValue)}
+	if node.Kind != yaml.MappingNode {
+		if node.Tag == "!!null" {
+			return p, nil
+		}
+		return nil, fmt.Errorf("%s:%d: profiles.%s must be a mapping of settings", path, node.Line, name)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		switch {
+		case key.Value == "instances":
+			if err := p.parseInstances(val); err != nil {
+				return nil, err
+			}
+			continue
+		case key.Value == "default_instance":
+		case !slices.ContainsFunc(settings, func(s setting) bool { return s.key == key.Value }):
+			return nil, fmt.Errorf("%s:%d: profiles.%s.%s: unknown setting", path, key.Line, name, key.Value)
+		}
+		var v fileValue
+		var ok bool
+		var err error
+		if val.Kind == yaml.SequenceNode && isList(key.Value) {
+			v, ok, err = list(val)
+		} else {
+			v, ok, err = scalar(val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: profiles.%s.%s: %w", path, val.Line, name, key.Value, err)
+		}
+		if !ok {
+			continue
+		}
+		if key.Value == "default_instance" {
+			p.defaultInstance = v
+			continue
+		}
+		p.values[key.Value] = v
+	}
+	return p, nil
+}
+
+// parseInstances reads the instances mapping of a profile.
+func (p *profile) parseInstances(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: profiles.%s.instances must be a mapping of instance names to settings", p.file, node.Line, p.name)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		inst := fileInstance{name: key.Value, line: key.Line, values: make(map[string]fileValue)}
+		if val.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s:%d: profiles.%s.instances.%s must be a mapping of settings", p.file, val.Line, p.name, inst.name)
+		}
+		for j := 0; j+1 < len(val.Content); j += 2 {
+			k, v := val.Content[j], val.Content[j+1]
+			if !slices.Contains(instanceKeys, k.Value) {
+				return fmt.Errorf("%s:%d: profiles.%s.instances.%s.%s: unknown setting (expected one of %s)",
+					p.file, k.Line, p.name, inst.name, k.Value, strings.Join(instanceKeys, ", "))
+			}
+			fv, ok, err := scalar(v)
+			if err != nil {
+				return fmt.Errorf("%s:%d: profiles.%s.instances.%s.%s: %w", p.file, v.Line, p.name, inst.name, k.Value, err)
+			}
+			if ok {
+				inst.values[k.Value] = fv
+			}
+		}
+		p.instances = append(p.instances, inst)
+	}
+	return nil
+}
+
+// scalar converts a YAML value node to a fileValue. ok is false for null.
+func scalar(node *yaml.Node) (v fileValue, ok bool, err error) {
+	if node.Kind != yaml.ScalarNode {
+		return fileValue{}, false, errors.New("must be a single value")
+	}
+	if node.Tag == "!!null" {
+		return fileValue{}, false, nil
+	}
+	return fileValue{value: node.Value, line: node.Line}, true, nil
+}
+
+// list converts a YAML sequence of scalars to a comma-separated fileValue.
+func list(node *yaml.Node) (fileValue, bool, error) {
+	items := make([]string, 0, len(node.Content))
+	for _, item := range node.Content {
+		v, ok, err := scalar(item)
+		if err != nil {
+			return fileValue{}, false, errors.New("must be a list of values")
+		}
+		if ok {
+			items = append(items, v.value)
+		}
+	}
+	return fileValue{value: strings.Join(items, ","), line: node.Line}, true, nil
+}
+
+// isList reports whether key names a list setting.
+func isList(key string) bool {
+	return slices.ContainsFunc(settings, func(s setting) bool { return s.key == key && s.list })
+}
+
+// value returns the setting for key, if the profile sets it. It is safe to
+// call on a nil profile.
+func (p *profile) value(key string) (fileValue, bool) {
+	if p == nil {
+		return fileValue{}, false
+	}
+	v, ok := p.values[key]
+	return v, ok
+}
+
+// describe names the file position of a setting, e.g.
+// "profiles.prod.port at metabase.yaml:7".
+func (p *profile) describe(v fileValue, key string) string {
+	return fmt.Sprintf("profiles.%s.%s at %s:%d", p.name, key, p.file, v.line)
+}
+
+// errorf returns an error pointing at the file position of a setting.
+func (p *profile) errorf(v fileValue, key, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: profiles.%s.%s: %s", p.file, v.line, p.name, key, fmt.Sprintf(format, args...))
+}
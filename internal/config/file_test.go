@@ -0,0 +1,277 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigFile = `default_profile: staging
+profiles:
+  staging:
+    metabase_url: http://staging:3000/
+    api_key: staging_key
+    log_level: debug
+    row_limit: 50
+  production:
+    metabase_url: http://prod:3000
+    username: bot@example.com
+    password: secret
+    transport: sse
+    port: 9000
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "metabase.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_ConfigFileDefaultProfile(t *testing.T) {
+	path := writeConfig(t, testConfigFile)
+
+	cfg, err := Load([]string{"--config", path})
+	require.NoError(t, err)
+	assert.Equal(t, "staging", cfg.Profile)
+	assert.Equal(t, "http://staging:3000", cfg.MetabaseURL)
+	assert.Equal(t, "staging_key", cfg.APIKey)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 50, cfg.RowLimit)
+	assert.Equal(t, "stdio", cfg.Transport)
+}
+
+func TestLoad_ConfigFileSelectedProfile(t *testing.T) {
+	path := writeConfig(t, testConfigFile)
+
+	cfg, err := Load([]string{"--config", path, "--profile", "production"})
+	require.NoError(t, err)
+	assert.Equal(t, "production", cfg.Profile)
+	assert.Equal(t, "http://prod:3000", cfg.MetabaseURL)
+	assert.Equal(t, "bot@example.com", cfg.Username)
+	assert.Equal(t, "sse", cfg.Transport)
+	assert.Equal(t, 9000, cfg.Port)
+	assert.Equal(t, 200, cfg.RowLimit)
+}
+
+func TestLoad_ConfigFileEnvSelection(t *testing.T) {
+	t.Setenv("METABASE_MCP_CONFIG", writeConfig(t, testConfigFile))
+	t.Setenv("METABASE_MCP_PROFILE", "production")
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "production", cfg.Profile)
+}
+
+func TestLoad_ConfigFilePrecedence(t *testing.T) {
+	path := writeConfig(t, testConfigFile)
+	t.Setenv("METABASE_API_KEY", "env_key")
+	t.Setenv("LOG_LEVEL", "warn")
+
+	cfg, err := Load([]string{"--config", path, "--log-level", "error", "--row-limit", "200"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://staging:3000", cfg.MetabaseURL, "file value")
+	assert.Equal(t, "env_key", cfg.APIKey, "env overrides file")
+	assert.Equal(t, "error", cfg.LogLevel, "flag overrides env")
+	assert.Equal(t, 200, cfg.RowLimit, "flag set to its default still overrides file")
+}
+
+func TestLoad_ConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		errMsg  string
+	}{
+		{
+			name:    "unknown top-level key",
+			content: "profile:\n  a: {}\n",
+			errMsg:  `metabase.yaml:1: unknown key "profile"`,
+		},
+		{
+			name:    "unknown setting",
+			content: "profiles:\n  a:\n    metabase_url: http://a\n    transprt: sse\n",
+			errMsg:  "metabase.yaml:4: profiles.a.transprt: unknown setting",
+		},
+		{
+			name:    "invalid integer",
+			content: "profiles:\n  a:\n    metabase_url: http://a\n    api_key: k\n    port: abc\n",
+			errMsg:  `metabase.yaml:5: profiles.a.port: invalid value "abc"`,
+		},
+		{
+			name:    "invalid transport",
+			content: "profiles:\n  a:\n    metabase_url: http://a\n    api_key: k\n    transport: grpc\n",
+			errMsg:  "transport must be 'stdio' or 'sse' (profiles.a.transport at ",
+		},
+		{
+			name:    "nested value",
+			content: "profiles:\n  a:\n    api_key: [x]\n",
+			errMsg:  "metabase.yaml:3: profiles.a.api_key: must be a single value",
+		},
+		{
+			name:    "missing profile",
+			content: testConfigFile,
+			args:    []string{"--profile", "dev"},
+			errMsg:  `profile "dev" not found (available: staging, production)`,
+		},
+		{
+			name:    "ambiguous profile",
+			content: "profiles:\n  a: {}\n  b: {}\n",
+			errMsg:  "has several profiles (a, b)",
+		},
+		{
+			name:    "no profiles",
+			content: "default_profile: a\n",
+			errMsg:  "defines no profiles",
+		},
+		{
+			name:    "missing url",
+			content: "profiles:\n  a:\n    api_key: k\n",
+			errMsg:  `or metabase_url in profile "a" of `,
+		},
+		{
+			name:    "invalid yaml",
+			content: "profiles: [\n",
+			errMsg:  "parsing config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			_, err := Load(append([]string{"--config", path}, tt.args...))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestLoad_ProfileWithoutConfigFile(t *testing.T) {
+	_, err := Load([]string{"--metabase-url", "http://a", "--api-key", "k", "--profile", "x"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--profile requires a config file")
+}
+
+func TestLoad_MissingConfigFile(t *testing.T) {
+	_, err := Load([]string{"--config", filepath.Join(t.TempDir(), "missing.yaml")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "reading config file")
+}
+
+const testInstancesFile = `profiles:
+  regions:
+    api_key: shared_key
+    default_instance: us
+    instances:
+      eu:
+        metabase_url: http://eu:3000/
+      us:
+        metabase_url: http://us:3000
+        username: bot@example.com
+        password: secret
+`
+
+func TestLoad_ConfigFileInstances(t *testing.T) {
+	cfg, err := Load([]string{"--config", writeConfig(t, testInstancesFile)})
+	require.NoError(t, err)
+	assert.Equal(t, "us", cfg.DefaultInstance)
+	assert.Equal(t, []Instance{
+		{Name: "eu", MetabaseURL: "http://eu:3000", APIKey: "shared_key"},
+		{Name: "us", MetabaseURL: "http://us:3000", Username: "bot@example.com", Password: "secret"},
+	}, cfg.Instances)
+}
+
+func TestLoad_SingleInstance(t *testing.T) {
+	cfg, err := Load([]string{"--metabase-url", "http://localhost:3000", "--api-key", "key"})
+	require.NoError(t, err)
+	assert.Equal(t, "default", cfg.DefaultInstance)
+	assert.Equal(t, []Instance{{Name: "default", MetabaseURL: "http://localhost:3000", APIKey: "key"}}, cfg.Instances)
+}
+
+func TestLoad_ConfigFileInstanceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		errMsg  string
+	}{
+		{
+			name:    "missing url",
+			content: "profiles:\n  a:\n    instances:\n      eu:\n        api_key: k\n",
+			errMsg:  "metabase.yaml:4: profiles.a.instances.eu: metabase_url is required",
+		},
+		{
+			name:    "missing auth",
+			content: "profiles:\n  a:\n    instances:\n      eu:\n        metabase_url: http://eu\n",
+			errMsg:  "profiles.a.instances.eu: either api_key or username/password is required",
+		},
+		{
+			name:    "unknown key",
+			content: "profiles:\n  a:\n    instances:\n      eu:\n        url: http://eu\n",
+			errMsg:  "metabase.yaml:5: profiles.a.instances.eu.url: unknown setting",
+		},
+		{
+			name:    "unknown default",
+			content: "profiles:\n  a:\n    api_key: k\n    default_instance: us\n    instances:\n      eu:\n        metabase_url: http://eu\n",
+			errMsg:  `metabase.yaml:4: profiles.a.default_instance: unknown instance "us"`,
+		},
+		{
+			name:    "combined with url",
+			content: testInstancesFile,
+			args:    []string{"--metabase-url", "http://other"},
+			errMsg:  "metabase URL (flag --metabase-url) cannot be combined with instances",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(append([]string{"--config", writeConfig(t, tt.content)}, tt.args...))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestLoad_ConfigFileRelativePaths(t *testing.T) {
+	path := writeConfig(t, "profiles:\n  a:\n    metabase_url: http://a\n    api_key: k\n    auth_tokens_file: tokens.txt\n    jwt_jwks_file: /etc/mcp/jwks.json\n"+
+		"    session_cache_dir: cache\n    record_dir: ../cassettes\n    prompts_dir: /etc/mcp/prompts\n")
+
+	cfg, err := Load([]string{"--config", path})
+	require.NoError(t, err)
+	dir := filepath.Dir(path)
+	assert.Equal(t, filepath.Join(dir, "tokens.txt"), cfg.AuthTokensFile)
+	assert.Equal(t, "/etc/mcp/jwks.json", cfg.JWKSFile)
+	assert.Equal(t, filepath.Join(dir, "cache"), cfg.SessionCacheDir)
+	assert.Equal(t, filepath.Join(dir, "..", "cassettes"), cfg.RecordDir)
+	assert.Equal(t, "/etc/mcp/prompts", cfg.PromptsDir)
+	assert.Equal(t, "sub", cfg.JWTNameClaim)
+
+	// Paths given by flag or environment are left to the working directory.
+	t.Setenv("PROMPTS_DIR", "prompts")
+	cfg, err = Load([]string{"--config", path, "--session-cache-dir", "cache"})
+	require.NoError(t, err)
+	assert.Equal(t, "cache", cfg.SessionCacheDir)
+	assert.Equal(t, "prompts", cfg.PromptsDir)
+}
+
+func TestLoad_ConfigFileToolLists(t *testing.T) {
+	path := writeConfig(t, "profiles:\n  a:\n    metabase_url: http://a\n    api_key: k\n    read_only: true\n    enable_tools: [cards, dashboards]\n    disable_tools: delete_*,sync_database\n")
+
+	cfg, err := Load([]string{"--config", path})
+	require.NoError(t, err)
+	assert.True(t, cfg.ReadOnly)
+	assert.Equal(t, []string{"cards", "dashboards"}, cfg.EnableTools)
+	assert.Equal(t, []string{"delete_*", "sync_database"}, cfg.DisableTools)
+
+	cfg, err = Load([]string{"--config", path, "--enable-tools", "search"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"search"}, cfg.EnableTools, "flag replaces the file's list")
+
+	path = writeConfig(t, "profiles:\n  a:\n    metabase_url: http://a\n    api_key: k\n    enable_tools: [[cards]]\n")
+	_, err = Load([]string{"--config", path})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "profiles.a.enable_tools: must be a list of values")
+}
@@ -0,0 +1,313 @@
+package httpauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is the leeway allowed when checking exp and nbf.
+const clockSkew = time.Minute
+
+// JWTOptions configures the claims a JWT must carry.
+type JWTOptions struct {
+	// Issuer, if set, must equal the iss claim.
+	Issuer string
+	// Audience, if set, must appear in the aud claim.
+	Audience string
+	// NameClaim is the claim identifying the caller in logs. Defaults to "sub".
+	NameClaim string
+}
+
+// JWTVerifier validates JWTs against the public keys of a JWKS file.
+type JWTVerifier struct {
+	keys []jwk
+	opts JWTOptions
+}
+
+// jwk is a parsed public key from a JWKS file.
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// jwkMember is a key of a JWKS file. Only the members needed to verify
+// signatures are decoded; others, such as x5c or key_ops, are ignored.
+type jwkMember struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Claims are the validated claims of a JWT.
+type Claims struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt time.Time
+	Raw       map[string]any
+}
+
+// LoadJWKS reads a JWKS file ({"keys": [...]}) holding RSA, EC (P-256,
+// P-384, P-521) or Ed25519 public keys.
+func LoadJWKS(path string, opts JWTOptions) (*JWTVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS file: %w", err)
+	}
+	var set struct {
+		Keys []jwkMember `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS file %s: %w", path, err)
+	}
+	if opts.NameClaim == "" {
+		opts.NameClaim = "sub"
+	}
+
+	v := &JWTVerifier{opts: opts}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(k)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS file %s: key %d (kid %q): %w", path, i, k.Kid, err)
+		}
+		v.keys = append(v.keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("JWKS file %s contains no signing keys", path)
+	}
+	return v, nil
+}
+
+func parseJWK(k jwkMember) (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key of %d bits is too small", n.BitLen())
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := decodeBigInt(k.X)
+		y, errY := decodeBigInt(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid coordinates")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := pub.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return pub, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// LooksLikeJWT reports whether token has the three-part shape of a JWT.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify checks the signature and claims of a compact JWT. The exp claim
+// is required.
+func (v *JWTVerifier) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed JWT signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range v.keys {
+		if header.Kid != "" && k.kid != "" && k.kid != header.Kid {
+			continue
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+		if verifySignature(header.Alg, k.key, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("JWT signature not valid for any key (alg %q, kid %q)", header.Alg, header.Kid)
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+	return v.checkClaims(raw, now)
+}
+
+func (v *JWTVerifier) checkClaims(raw map[string]any, now time.Time) (*Claims, error) {
+	exp, ok := raw["exp"].(float64)
+	if !ok {
+		return nil, errors.New("JWT has no exp claim")
+	}
+	expiresAt := time.Unix(int64(exp), 0)
+	if now.After(expiresAt.Add(clockSkew)) {
+		return nil, errors.New("JWT has expired")
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("JWT is not valid yet")
+	}
+	if v.opts.Issuer != "" && raw["iss"] != v.opts.Issuer {
+		return nil, fmt.Errorf("JWT issuer %v is not accepted", raw["iss"])
+	}
+	if v.opts.Audience != "" && !hasAudience(raw["aud"], v.opts.Audience) {
+		return nil, errors.New("JWT is not intended for this audience")
+	}
+
+	name, _ := raw[v.opts.NameClaim].(string)
+	if name == "" {
+		return nil, fmt.Errorf("JWT has no %s claim", v.opts.NameClaim)
+	}
+	var scopes []string
+	if s, ok := raw["scope"].(string); ok {
+		scopes = strings.Fields(s)
+	}
+	return &Claims{Name: name, Scopes: scopes, ExpiresAt: expiresAt, Raw: raw}, nil
+}
+
+func hasAudience(aud any, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []any:
+		return slices.Contains(a, any(want))
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks sig over signed for the JWS algorithm alg. Only
+// asymmetric algorithms are accepted, and the key type must match.
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) bool {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(k, signed, sig)
+	default:
+		return false
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+		case "PS":
+			return rsa.VerifyPSS(k, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size || k.Curve.Params().BitSize != curveBits(alg) {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	}
+	return false
+}
+
+// curveBits returns the curve size required by an ES* algorithm.
+func curveBits(alg string) int {
+	switch alg {
+	case "ES256":
+		return 256
+	case "ES384":
+		return 384
+	default:
+		return 521
+	}
+}
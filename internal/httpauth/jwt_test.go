@@ -0,0 +1,209 @@
+package httpauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var b64 = base64.RawURLEncoding
+
+// testKeys generates one key of each supported type, with its JWK form.
+type testKeys struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	ed      ed25519.PrivateKey
+	jwksDoc string
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecPoint, err := ecKey.PublicKey.Bytes()
+	require.NoError(t, err)
+	doc, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64.EncodeToString(rsaKey.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64.EncodeToString(ecPoint[1:33]), "y": b64.EncodeToString(ecPoint[33:])},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64.EncodeToString(edPub)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	require.NoError(t, err)
+	return &testKeys{rsa: rsaKey, ec: ecKey, ed: edKey, jwksDoc: string(doc)}
+}
+
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		digest := sha256Sum(signed)
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest)
+	case "PS256":
+		digest := sha256Sum(signed)
+		sig, err = rsa.SignPSS(rand.Reader, k.rsa, crypto.SHA256, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ec, sha256Sum(signed))
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case "EdDSA":
+		sig = ed25519.Sign(k.ed, []byte(signed))
+	case "none":
+	}
+	require.NoError(t, err)
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func sha256Sum(s string) []byte {
+	h := crypto.SHA256.New()
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Unix(1_800_000_000, 0)
+	v, err := LoadJWKS(writeFile(t, "jwks.json", keys.jwksDoc), JWTOptions{Issuer: "https://idp", Audience: "metabase-mcp"})
+	require.NoError(t, err)
+	assert.Len(t, v.keys, 3, "encryption keys are skipped")
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"sub": "alice@example.com", "iss": "https://idp", "aud": []any{"other", "metabase-mcp"},
+			"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(-time.Minute).Unix(), "scope": "mcp:read mcp:write",
+		}
+	}
+	with := func(key string, value any) map[string]any {
+		c := valid()
+		if value == nil {
+			delete(c, key)
+		} else {
+			c[key] = value
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		errMsg string
+	}{
+		{name: "rs256", token: keys.sign(t, "RS256", "rsa", valid())},
+		{name: "ps256", token: keys.sign(t, "PS256", "rsa", valid())},
+		{name: "es256", token: keys.sign(t, "ES256", "ec", valid())},
+		{name: "eddsa", token: keys.sign(t, "EdDSA", "ed", valid())},
+		{name: "no kid", token: keys.sign(t, "ES256", "", valid())},
+		{name: "within clock skew", token: keys.sign(t, "RS256", "rsa", with("exp", now.Add(-30*time.Second).Unix()))},
+		{name: "wrong kid", token: keys.sign(t, "RS256", "ec", valid()), errMsg: "signature not valid"},
+		{name: "alg none", token: keys.sign(t, "none", "rsa", valid()), errMsg: "signature not valid"},
+		{name: "tampered", token: strings.Replace(keys.sign(t, "RS256", "rsa", valid()), ".", ".e30", 1), errMsg: "signature not valid"},
+		{name: "expired", token: keys.sign(t, "RS256", "rsa", with("exp", now.Add(-time.Hour).Unix())), errMsg: "expired"},
+		{name: "no exp", token: keys.sign(t, "RS256", "rsa", with("exp", nil)), errMsg: "no exp claim"},
+		{name: "not yet valid", token: keys.sign(t, "RS256", "rsa", with("nbf", now.Add(time.Hour).Unix())), errMsg: "not valid yet"},
+		{name: "wrong issuer", token: keys.sign(t, "RS256", "rsa", with("iss", "https://evil")), errMsg: "issuer"},
+		{name: "wrong audience", token: keys.sign(t, "RS256", "rsa", with("aud", "other")), errMsg: "audience"},
+		{name: "no subject", token: keys.sign(t, "RS256", "rsa", with("sub", nil)), errMsg: "no sub claim"},
+		{name: "malformed", token: "a.b", errMsg: "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(tt.token, now)
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "alice@example.com", claims.Name)
+			assert.Equal(t, []string{"mcp:read", "mcp:write"}, claims.Scopes)
+		})
+	}
+}
+
+func TestJWTVerifier_NameClaim(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	v, err := LoadJWKS(writeFile(t, "jwks.json", keys.jwksDoc), JWTOptions{NameClaim: "email"})
+	require.NoError(t, err)
+
+	claims, err := v.Verify(keys.sign(t, "EdDSA", "ed", map[string]any{"sub": "123", "email": "bob@example.com", "exp": now.Add(time.Hour).Unix()}), now)
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", claims.Name)
+}
+
+func TestLoadJWKS_ProviderShape(t *testing.T) {
+	// Identity providers such as Auth0, Azure AD and Okta publish keys with
+	// certificate chains, thumbprints and key_ops besides the key itself.
+	keys := newTestKeys(t)
+	doc, err := json.Marshal(map[string]any{"keys": []map[string]any{{
+		"kty":     "RSA",
+		"use":     "sig",
+		"alg":     "RS256",
+		"kid":     "provider",
+		"n":       b64.EncodeToString(keys.rsa.N.Bytes()),
+		"e":       "AQAB",
+		"x5t":     "dGh1bWJwcmludA",
+		"x5c":     []string{"MIIDBTCCAe2gAwIBAgIQ", "MIIDCzCCAfOgAwIBAgIQ"},
+		"key_ops": []string{"verify"},
+		"issuer":  "https://login.example.com/tenant/v2.0",
+	}}})
+	require.NoError(t, err)
+
+	v, err := LoadJWKS(writeFile(t, "jwks.json", string(doc)), JWTOptions{})
+	require.NoError(t, err)
+	require.Len(t, v.keys, 1)
+
+	now := time.Unix(1_800_000_000, 0)
+	token := keys.sign(t, "RS256", "provider", map[string]any{"sub": "alice", "exp": now.Add(time.Hour).Unix()})
+	claims, err := v.Verify(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Name)
+}
+
+func TestLoadJWKS_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{name: "invalid json", content: "{", errMsg: "parsing JWKS file"},
+		{name: "no keys", content: `{"keys":[]}`, errMsg: "no signing keys"},
+		{name: "symmetric key", content: `{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`, errMsg: `unsupported key type "oct"`},
+		{name: "small rsa key", content: `{"keys":[{"kty":"RSA","kid":"a","n":"AQAB","e":"AQAB"}]}`, errMsg: `(kid "a"): RSA key of 17 bits is too small`},
+		{name: "bad curve", content: `{"keys":[{"kty":"EC","crv":"P-192","x":"AA","y":"AA"}]}`, errMsg: "unsupported curve"},
+		{name: "point not on curve", content: `{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`, errMsg: "invalid EC key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadJWKS(writeFile(t, "jwks.json", tt.content), JWTOptions{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
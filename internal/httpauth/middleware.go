@@ -0,0 +1,95 @@
+package httpauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/rs/zerolog"
+)
+
+// staticTokenLifetime is the expiration reported for static tokens, which do
+// not expire themselves; the MCP SDK requires one.
+const staticTokenLifetime = 24 * time.Hour
+
+// Verifier authenticates bearer tokens as static tokens or JWTs.
+type Verifier struct {
+	tokens *StaticTokens
+	jwt    *JWTVerifier
+	logger zerolog.Logger
+	now    func() time.Time
+}
+
+// NewVerifier creates a Verifier. Either tokens or jwt may be nil, but not
+// both.
+func NewVerifier(tokens *StaticTokens, jwt *JWTVerifier, logger zerolog.Logger) *Verifier {
+	return &Verifier{tokens: tokens, jwt: jwt, logger: logger, now: time.Now}
+}
+
+// VerifyToken implements auth.TokenVerifier. The caller's name is reported as
+// TokenInfo.UserID, which the MCP SDK also uses to tie sessions to callers.
+func (v *Verifier) VerifyToken(_ context.Context, token string, r *http.Request) (*auth.TokenInfo, error) {
+	now := v.now()
+	if v.tokens != nil {
+		if name, ok := v.tokens.Verify(token); ok {
+			v.logger.Debug().Str("caller", name).Str("method", "token").Msg("authenticated request")
+			return &auth.TokenInfo{
+				UserID:     name,
+				Expiration: now.Add(staticTokenLifetime),
+				Extra:      map[string]any{"auth_method": "token"},
+			}, nil
+		}
+	}
+	if v.jwt != nil && LooksLikeJWT(token) {
+		claims, err := v.jwt.Verify(token, now)
+		if err == nil {
+			v.logger.Debug().Str("caller", claims.Name).Str("method", "jwt").Msg("authenticated request")
+			return &auth.TokenInfo{
+				UserID:     claims.Name,
+				Scopes:     claims.Scopes,
+				Expiration: claims.ExpiresAt,
+				Extra:      map[string]any{"auth_method": "jwt", "claims": claims.Raw},
+			}, nil
+		}
+		v.logger.Warn().Err(err).Str("remote_addr", r.RemoteAddr).Msg("rejected JWT")
+		return nil, fmt.Errorf("%w: %v", auth.ErrInvalidToken, err)
+	}
+	v.logger.Warn().Str("remote_addr", r.RemoteAddr).Msg("rejected unknown bearer token")
+	return nil, auth.ErrInvalidToken
+}
+
+// Middleware rejects requests without a valid bearer token with 401 before
+// they reach next, and makes the caller's identity available to MCP handlers
+// through the request's TokenInfo.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	protected := auth.RequireBearerToken(v.VerifyToken, nil)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protected.ServeHTTP(&challengeWriter{ResponseWriter: w}, r)
+	})
+}
+
+// challengeWriter adds the WWW-Authenticate header required on 401 responses.
+type challengeWriter struct {
+	http.ResponseWriter
+}
+
+func (w *challengeWriter) WriteHeader(code int) {
+	if code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metabase-mcp-server"`)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets streaming responses through the wrapper.
+func (w *challengeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *challengeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
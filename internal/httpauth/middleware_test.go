@@ -0,0 +1,63 @@
+package httpauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	tokens, err := LoadStaticTokens(writeFile(t, "tokens", "alice:alice-0123456789abcdef\n"))
+	require.NoError(t, err)
+	keys := newTestKeys(t)
+	jwt, err := LoadJWKS(writeFile(t, "jwks.json", keys.jwksDoc), JWTOptions{})
+	require.NoError(t, err)
+
+	var caller string
+	handler := NewVerifier(tokens, jwt, zerolog.Nop()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller = auth.TokenInfoFromContext(r.Context()).UserID
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantCaller string
+	}{
+		{name: "no header", wantStatus: http.StatusUnauthorized},
+		{name: "basic auth", header: "Basic YTpi", wantStatus: http.StatusUnauthorized},
+		{name: "unknown token", header: "Bearer nope-0123456789abcdef", wantStatus: http.StatusUnauthorized},
+		{name: "static token", header: "Bearer alice-0123456789abcdef", wantStatus: http.StatusOK, wantCaller: "alice"},
+		{name: "jwt", header: "Bearer " + keys.sign(t, "ES256", "ec", map[string]any{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()}),
+			wantStatus: http.StatusOK, wantCaller: "bob"},
+		{name: "expired jwt", header: "Bearer " + keys.sign(t, "ES256", "ec", map[string]any{"sub": "bob", "exp": time.Now().Add(-time.Hour).Unix()}),
+			wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller = ""
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantCaller, caller)
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="metabase-mcp-server"`, rec.Header().Get("WWW-Authenticate"))
+			} else {
+				assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
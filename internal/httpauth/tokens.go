@@ -0,0 +1,84 @@
+// Package httpauth authenticates callers of the HTTP transport with bearer
+// tokens: named static tokens and JWTs signed by keys from a local JWKS file.
+package httpauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// minTokenLength is the shortest static token accepted, to keep tokens from
+// being guessable.
+const minTokenLength = 16
+
+// StaticTokens holds named bearer tokens. Tokens are kept as SHA-256 digests
+// and compared in constant time.
+type StaticTokens struct {
+	tokens []namedToken
+}
+
+type namedToken struct {
+	name   string
+	digest [sha256.Size]byte
+}
+
+// LoadStaticTokens reads a token file. Each non-empty line that does not
+// start with # has the form "name:token"; the name identifies the caller in
+// logs.
+func LoadStaticTokens(path string) (*StaticTokens, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading token file: %w", err)
+	}
+
+	s := &StaticTokens{}
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, token, ok := strings.Cut(text, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected name:token", path, line)
+		}
+		if len(token) < minTokenLength {
+			return nil, fmt.Errorf("%s:%d: token for %q is shorter than %d characters", path, line, name, minTokenLength)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("%s:%d: duplicate token name %q", path, line, name)
+		}
+		if _, dup := s.Verify(token); dup {
+			return nil, fmt.Errorf("%s:%d: token for %q is already used by another name", path, line, name)
+		}
+		names[name] = true
+		s.tokens = append(s.tokens, namedToken{name: name, digest: sha256.Sum256([]byte(token))})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading token file: %w", err)
+	}
+	if len(s.tokens) == 0 {
+		return nil, fmt.Errorf("token file %s contains no tokens", path)
+	}
+	return s, nil
+}
+
+// Verify returns the name of the token matching token. Every stored token
+// is compared, so the time taken does not depend on which one matches.
+func (s *StaticTokens) Verify(token string) (string, bool) {
+	digest := sha256.Sum256([]byte(token))
+	var name string
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare(digest[:], t.digest[:]) == 1 {
+			name = t.name
+		}
+	}
+	return name, name != ""
+}
@@ -0,0 +1,60 @@
+package httpauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadStaticTokens(t *testing.T) {
+	path := writeFile(t, "tokens", "# team tokens\nalice: alice-0123456789abcdef\n\nci-bot:bot:0123456789abcdef\n")
+
+	tokens, err := LoadStaticTokens(path)
+	require.NoError(t, err)
+
+	name, ok := tokens.Verify("alice-0123456789abcdef")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", name)
+
+	name, ok = tokens.Verify("bot:0123456789abcdef")
+	assert.True(t, ok)
+	assert.Equal(t, "ci-bot", name)
+
+	_, ok = tokens.Verify("alice-0123456789abcdeX")
+	assert.False(t, ok)
+	_, ok = tokens.Verify("")
+	assert.False(t, ok)
+}
+
+func TestLoadStaticTokens_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{name: "missing separator", content: "alice\n", errMsg: "tokens:1: expected name:token"},
+		{name: "empty name", content: ":0123456789abcdef\n", errMsg: "tokens:1: expected name:token"},
+		{name: "short token", content: "# c\nalice:short\n", errMsg: `tokens:2: token for "alice" is shorter than 16 characters`},
+		{name: "duplicate name", content: "a:0123456789abcdef\na:0123456789abcdeX\n", errMsg: `tokens:2: duplicate token name "a"`},
+		{name: "duplicate token", content: "a:0123456789abcdef\nb:0123456789abcdef\n", errMsg: "already used by another name"},
+		{name: "empty", content: "# nothing\n", errMsg: "contains no tokens"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadStaticTokens(writeFile(t, "tokens", tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
@@ -1,11 +1,15 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListActions returns actions for a model.
-func (c *Client) ListActions(modelID int) ([]Action, error) {
+func (c *Client) ListActions(ctx context.Context, modelID int) ([]Action, error) {
 	var result []Action
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		SetQueryParam("model-id", fmt.Sprintf("%d", modelID)).
 		Get("/api/action")
@@ -19,9 +23,10 @@ func (c *Client) ListActions(modelID int) ([]Action, error) {
 }
 
 // GetAction returns an action by ID.
-func (c *Client) GetAction(id int) (*Action, error) {
+func (c *Client) GetAction(ctx context.Context, id int) (*Action, error) {
 	var result Action
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/action/%d", id))
 	if err != nil {
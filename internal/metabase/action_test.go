@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -20,7 +21,7 @@ func TestListActions(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	actions, err := client.ListActions(1)
+	actions, err := client.ListActions(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Len(t, actions, 1)
 }
@@ -33,7 +34,7 @@ func TestGetAction(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	action, err := client.GetAction(1)
+	action, err := client.GetAction(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "Create User", action.Name)
 }
@@ -1,11 +1,16 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
-// GetActivity returns the recent activity log.
-func (c *Client) GetActivity() ([]ActivityItem, error) {
+// GetActivity returns a page of the recent activity log. Metabase does not
+// paginate it, so the page is cut out of the whole log.
+func (c *Client) GetActivity(ctx context.Context, page Page) (*Paged[ActivityItem], error) {
 	var result []ActivityItem
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/activity")
 	if err != nil {
@@ -14,13 +19,14 @@ func (c *Client) GetActivity() ([]ActivityItem, error) {
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
-	return result, nil
+	return SlicePage(result, page), nil
 }
 
 // GetRecentViews returns recently viewed items.
-func (c *Client) GetRecentViews() ([]RecentItem, error) {
+func (c *Client) GetRecentViews(ctx context.Context) ([]RecentItem, error) {
 	var result []RecentItem
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/activity/recent_views")
 	if err != nil {
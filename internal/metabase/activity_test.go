@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -19,9 +20,10 @@ func TestGetActivity(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	items, err := client.GetActivity()
+	items, err := client.GetActivity(context.Background(), Page{})
 	require.NoError(t, err)
-	assert.Len(t, items, 1)
+	assert.Len(t, items.Data, 1)
+	assert.Equal(t, 1, items.Total)
 }
 
 func TestGetRecentViews(t *testing.T) {
@@ -34,7 +36,7 @@ func TestGetRecentViews(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	items, err := client.GetRecentViews()
+	items, err := client.GetRecentViews(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, items, 1)
 }
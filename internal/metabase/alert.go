@@ -1,11 +1,18 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListAlerts returns all alerts.
-func (c *Client) ListAlerts() ([]Alert, error) {
+func (c *Client) ListAlerts(ctx context.Context) ([]Alert, error) {
+	if err := c.requireLegacyAlerts(ctx); err != nil {
+		return nil, err
+	}
 	var result []Alert
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/alert")
 	if err != nil {
@@ -18,9 +25,13 @@ func (c *Client) ListAlerts() ([]Alert, error) {
 }
 
 // GetAlert returns an alert by ID.
-func (c *Client) GetAlert(id int) (*Alert, error) {
+func (c *Client) GetAlert(ctx context.Context, id int) (*Alert, error) {
+	if err := c.requireLegacyAlerts(ctx); err != nil {
+		return nil, err
+	}
 	var result Alert
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/alert/%d", id))
 	if err != nil {
@@ -33,9 +44,13 @@ func (c *Client) GetAlert(id int) (*Alert, error) {
 }
 
 // CreateAlert creates a new alert.
-func (c *Client) CreateAlert(alert *Alert) (*Alert, error) {
+func (c *Client) CreateAlert(ctx context.Context, alert *Alert) (*Alert, error) {
+	if err := c.requireLegacyAlerts(ctx); err != nil {
+		return nil, err
+	}
 	var result Alert
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(alert).
 		SetResult(&result).
 		Post("/api/alert")
@@ -47,3 +62,9 @@ func (c *Client) CreateAlert(alert *Alert) (*Alert, error) {
 	}
 	return &result, nil
 }
+
+// requireLegacyAlerts fails on Metabase releases that replaced /api/alert
+// with the notification API.
+func (c *Client) requireLegacyAlerts(ctx context.Context) error {
+	return c.require(ctx, CapLegacyAlerts, "the alert API", "manage alerts in Metabase's notification settings")
+}
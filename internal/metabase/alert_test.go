@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -16,7 +17,7 @@ func TestListAlerts(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	alerts, err := client.ListAlerts()
+	alerts, err := client.ListAlerts(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, alerts, 1)
 }
@@ -29,7 +30,7 @@ func TestGetAlert(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	alert, err := client.GetAlert(1)
+	alert, err := client.GetAlert(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "rows", alert.AlertCondition)
 }
@@ -42,7 +43,18 @@ func TestCreateAlert(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	alert, err := client.CreateAlert(&Alert{CardID: 5, AlertCondition: "rows"})
+	alert, err := client.CreateAlert(context.Background(), &Alert{CardID: 5, AlertCondition: "rows"})
 	require.NoError(t, err)
 	assert.Equal(t, 10, alert.ID)
 }
+
+func TestAlerts_UnsupportedVersion(t *testing.T) {
+	_, client := newVersionedTestServer(t, "v0.55.1", func(http.ResponseWriter, *http.Request) {
+		t.Error("no alert request is sent")
+	})
+
+	_, err := client.ListAlerts(context.Background())
+	var unsupported *UnsupportedError
+	require.ErrorAs(t, err, &unsupported)
+	assert.Equal(t, "the alert API is not supported on Metabase v0.55.1; manage alerts in Metabase's notification settings", err.Error())
+}
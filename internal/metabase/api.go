@@ -0,0 +1,158 @@
+package metabase
+
+import "context"
+
+// API is the Metabase API as used by the MCP tools. Client implements it
+// over HTTP; package metabasetest provides an in-memory fake.
+//
+// Implementations report Metabase errors as *APIError, so that IsNotFound
+// and the other helpers work on any of them.
+type API interface {
+	ServerAPI
+	CardAPI
+	DashboardAPI
+	CollectionAPI
+	DatabaseAPI
+	TableAPI
+	FieldAPI
+	DatasetAPI
+	UserAPI
+	PermissionAPI
+	SearchAPI
+	AlertAPI
+	SettingAPI
+	ActivityAPI
+	ActionAPI
+	TimelineAPI
+	CacheAPI
+}
+
+var _ API = (*Client)(nil)
+
+// ServerAPI describes the Metabase instance itself.
+type ServerAPI interface {
+	BaseURL() string
+	HealthCheck(ctx context.Context) error
+	ServerInfo(ctx context.Context) (*ServerInfo, error)
+}
+
+// CardAPI manages saved questions.
+type CardAPI interface {
+	ListCards(ctx context.Context, page Page) (*Paged[Card], error)
+	GetCard(ctx context.Context, id int) (*Card, error)
+	CreateCard(ctx context.Context, card *Card) (*Card, error)
+	UpdateCard(ctx context.Context, id int, card *Card) (*Card, error)
+	DeleteCard(ctx context.Context, id int) error
+	ExecuteCardQuery(ctx context.Context, id int, parameters map[string]any) (*DatasetQueryResponse, error)
+}
+
+// DashboardAPI manages dashboards and the cards on them.
+type DashboardAPI interface {
+	ListDashboards(ctx context.Context) ([]Dashboard, error)
+	GetDashboard(ctx context.Context, id int) (*Dashboard, error)
+	CreateDashboard(ctx context.Context, dashboard *Dashboard) (*Dashboard, error)
+	UpdateDashboard(ctx context.Context, id int, dashboard *Dashboard) (*Dashboard, error)
+	DeleteDashboard(ctx context.Context, id int) error
+	AddCardToDashboard(ctx context.Context, dashboardID int, dashCard *DashCard) (*DashCard, error)
+	RemoveCardFromDashboard(ctx context.Context, dashboardID, dashCardID int) error
+	UpdateDashboardCards(ctx context.Context, dashboardID int, cards []DashCard) error
+	CopyDashboard(ctx context.Context, id int, name string, description *string, collectionID *int) (*Dashboard, error)
+}
+
+// CollectionAPI manages collections.
+type CollectionAPI interface {
+	ListCollections(ctx context.Context, namespace string) ([]Collection, error)
+	GetCollection(ctx context.Context, id string) (*Collection, error)
+	CreateCollection(ctx context.Context, collection *Collection) (*Collection, error)
+	UpdateCollection(ctx context.Context, id int, collection *Collection) (*Collection, error)
+	ListCollectionItems(ctx context.Context, id string, models []string, page Page) (*Paged[CollectionItem], error)
+}
+
+// DatabaseAPI manages database connections.
+type DatabaseAPI interface {
+	ListDatabases(ctx context.Context) ([]Database, error)
+	GetDatabase(ctx context.Context, id int) (*Database, error)
+	GetDatabaseMetadata(ctx context.Context, id int) (*Database, error)
+	SyncDatabase(ctx context.Context, id int) error
+	// DatabaseEngine returns the engine of a database, such as "postgres".
+	DatabaseEngine(ctx context.Context, id int) (string, error)
+}
+
+// TableAPI reads table metadata.
+type TableAPI interface {
+	ListTables(ctx context.Context, databaseID int) ([]Table, error)
+	GetTable(ctx context.Context, id int) (*Table, error)
+	GetTableMetadata(ctx context.Context, id int) (*Table, error)
+	GetTableForeignKeys(ctx context.Context, id int) ([]ForeignKey, error)
+}
+
+// FieldAPI reads field metadata and values.
+type FieldAPI interface {
+	GetField(ctx context.Context, id int) (*Field, error)
+	GetFieldValues(ctx context.Context, id int) (*FieldValues, error)
+	SearchFieldValues(ctx context.Context, id int, query string, limit int) (*FieldValues, error)
+}
+
+// DatasetAPI runs ad-hoc queries.
+type DatasetAPI interface {
+	ExecuteQuery(ctx context.Context, req *DatasetQueryRequest) (*DatasetQueryResponse, error)
+	ExportQueryResults(ctx context.Context, req *DatasetQueryRequest, format string) ([]byte, error)
+	// CompileNativeQuery returns the SQL Metabase runs for a query, with
+	// template tags substituted.
+	CompileNativeQuery(ctx context.Context, req *DatasetQueryRequest) (*NativeForm, error)
+}
+
+// UserAPI reads users.
+type UserAPI interface {
+	ListUsers(ctx context.Context, page Page) (*Paged[User], error)
+	GetUser(ctx context.Context, id int) (*User, error)
+	GetCurrentUser(ctx context.Context) (*User, error)
+}
+
+// PermissionAPI reads permission groups and the permissions graph.
+type PermissionAPI interface {
+	ListPermissionGroups(ctx context.Context) ([]PermissionGroup, error)
+	GetPermissionGroup(ctx context.Context, id int) (*PermissionGroup, error)
+	GetPermissionsGraph(ctx context.Context) (map[string]any, error)
+}
+
+// SearchAPI searches across Metabase objects.
+type SearchAPI interface {
+	Search(ctx context.Context, query string, models []string, page Page) (*Paged[SearchResult], error)
+}
+
+// AlertAPI manages alerts.
+type AlertAPI interface {
+	ListAlerts(ctx context.Context) ([]Alert, error)
+	GetAlert(ctx context.Context, id int) (*Alert, error)
+	CreateAlert(ctx context.Context, alert *Alert) (*Alert, error)
+}
+
+// SettingAPI reads settings.
+type SettingAPI interface {
+	ListSettings(ctx context.Context) ([]Setting, error)
+	GetSetting(ctx context.Context, key string) (any, error)
+}
+
+// ActivityAPI reads the activity log.
+type ActivityAPI interface {
+	GetActivity(ctx context.Context, page Page) (*Paged[ActivityItem], error)
+	GetRecentViews(ctx context.Context) ([]RecentItem, error)
+}
+
+// ActionAPI reads model actions.
+type ActionAPI interface {
+	ListActions(ctx context.Context, modelID int) ([]Action, error)
+	GetAction(ctx context.Context, id int) (*Action, error)
+}
+
+// TimelineAPI reads timelines.
+type TimelineAPI interface {
+	ListTimelines(ctx context.Context, collectionID *int) ([]Timeline, error)
+	GetTimeline(ctx context.Context, id int) (*Timeline, error)
+}
+
+// CacheAPI manages the query cache.
+type CacheAPI interface {
+	InvalidateCache(ctx context.Context) error
+}
@@ -1,27 +1,72 @@
 package metabase
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog"
 )
 
+// defaultSessionLifetime is how long Metabase keeps a session when its
+// session-timeout setting is unset (the MAX_SESSION_AGE default).
+const defaultSessionLifetime = 14 * 24 * time.Hour
+
+// refreshAt is the fraction of a session's lifetime after which it is
+// replaced before Metabase expires it.
+const refreshAt = 0.9
+
+// WithSessionCache keeps the session obtained with username/password in a
+// file in dir, readable only by the current user, and reuses it across
+// restarts instead of logging in again. Without it, Logout ends the session.
+func WithSessionCache(dir string) Option {
+	return func(o *clientOptions) {
+		o.sessionCacheDir = dir
+	}
+}
+
 // sessionResponse represents the response from POST /api/session.
 type sessionResponse struct {
 	ID string `json:"id"`
 }
 
+// cachedSession is the session cache file content.
+type cachedSession struct {
+	BaseURL   string    `json:"base_url"`
+	Username  string    `json:"username"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// ExpiresAt is zero if the session lifetime is unknown.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
 // sessionAuth manages Metabase session-based authentication.
 type sessionAuth struct {
 	baseURL    string
 	username   string
 	password   string
-	sessionID  string
-	mu         sync.RWMutex
+	cacheFile  string
 	authClient *resty.Client // separate client to avoid middleware loops
 	logger     zerolog.Logger
+	now        func() time.Time
+
+	// loginMu serializes logins, so that requests failing with the same
+	// expired session trigger a single one.
+	loginMu sync.Mutex
+
+	mu        sync.RWMutex
+	sessionID string
+	// refreshAfter is when the session should be replaced; zero if unknown.
+	refreshAfter time.Time
 }
 
 func newSessionAuth(baseURL, username, password string, logger zerolog.Logger) *sessionAuth {
@@ -34,18 +79,52 @@ func newSessionAuth(baseURL, username, password string, logger zerolog.Logger) *
 		password:   password,
 		authClient: authClient,
 		logger:     logger,
+		now:        time.Now,
 	}
 }
 
+// setCacheDir enables the session cache in dir. The file name is derived
+// from the Metabase URL and username, so instances can share a directory.
+func (s *sessionAuth) setCacheDir(dir string) {
+	sum := sha256.Sum256([]byte(s.baseURL + "\x00" + s.username))
+	s.cacheFile = filepath.Join(dir, "session-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// start uses the cached session if there is a usable one, and logs in
+// otherwise.
+func (s *sessionAuth) start(ctx context.Context) error {
+	if s.loadCache() {
+		return nil
+	}
+	return s.authenticate(ctx)
+}
+
 // authenticate creates a new Metabase session.
-func (s *sessionAuth) authenticate() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *sessionAuth) authenticate(ctx context.Context) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	return s.login(ctx)
+}
+
+// renew replaces the session stale, which Metabase rejected or which is
+// about to expire. If another request has already replaced it, renew
+// returns at once.
+func (s *sessionAuth) renew(ctx context.Context, stale string) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	if s.getSessionID() != stale {
+		return nil
+	}
+	return s.login(ctx)
+}
 
+// login creates a new session. s.loginMu must be held.
+func (s *sessionAuth) login(ctx context.Context) error {
 	s.logger.Info().Msg("authenticating with Metabase session")
 
 	var result sessionResponse
 	resp, err := s.authClient.R().
+		SetContext(ctx).
 		SetBody(map[string]string{
 			"username": s.username,
 			"password": s.password,
@@ -60,14 +139,174 @@ func (s *sessionAuth) authenticate() error {
 		return fmt.Errorf("session auth failed with status %d: %s", resp.StatusCode(), resp.String())
 	}
 
-	s.sessionID = result.ID
+	session := cachedSession{BaseURL: s.baseURL, Username: s.username, ID: result.ID, CreatedAt: s.now()}
+	if lifetime, err := s.sessionLifetime(ctx, result.ID); err != nil {
+		s.logger.Warn().Err(err).Msg("reading metabase session timeout failed, session will be renewed when rejected")
+	} else {
+		session.ExpiresAt = session.CreatedAt.Add(lifetime)
+	}
+	s.use(session)
 	s.logger.Info().Msg("metabase session created successfully")
+	s.saveCache(session)
 	return nil
 }
 
+// use makes session the current one.
+func (s *sessionAuth) use(session cachedSession) {
+	var refreshAfter time.Time
+	if !session.ExpiresAt.IsZero() {
+		lifetime := session.ExpiresAt.Sub(session.CreatedAt)
+		refreshAfter = session.CreatedAt.Add(time.Duration(float64(lifetime) * refreshAt))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessionID = session.ID
+	s.refreshAfter = refreshAfter
+}
+
+// sessionLifetime reads Metabase's session-timeout setting with session id.
+func (s *sessionAuth) sessionLifetime(ctx context.Context, id string) (time.Duration, error) {
+	var props struct {
+		SessionTimeout *struct {
+			Amount int    `json:"amount"`
+			Unit   string `json:"unit"`
+		} `json:"session-timeout"`
+	}
+	resp, err := s.authClient.R().
+		SetContext(ctx).
+		SetHeader("X-Metabase-Session", id).
+		SetResult(&props).
+		Get("/api/session/properties")
+	if err != nil {
+		return 0, fmt.Errorf("get session properties: %w", err)
+	}
+	if err := checkResponse(resp); err != nil {
+		return 0, err
+	}
+	timeout := props.SessionTimeout
+	if timeout == nil || timeout.Amount <= 0 {
+		return defaultSessionLifetime, nil
+	}
+	switch timeout.Unit {
+	case "minutes":
+		return time.Duration(timeout.Amount) * time.Minute, nil
+	case "hours":
+		return time.Duration(timeout.Amount) * time.Hour, nil
+	}
+	return 0, fmt.Errorf("unknown session-timeout unit %q", timeout.Unit)
+}
+
+// current returns the session ID to send, first replacing the session if it
+// is about to expire. A failed refresh is logged and the old session used.
+func (s *sessionAuth) current(ctx context.Context) string {
+	s.mu.RLock()
+	id, refreshAfter := s.sessionID, s.refreshAfter
+	s.mu.RUnlock()
+	if id == "" || refreshAfter.IsZero() || s.now().Before(refreshAfter) {
+		return id
+	}
+	if err := s.renew(ctx, id); err != nil {
+		s.logger.Warn().Err(err).Msg("refreshing metabase session failed")
+		return id
+	}
+	return s.getSessionID()
+}
+
 // getSessionID returns the current session ID.
 func (s *sessionAuth) getSessionID() string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.sessionID
 }
+
+// logout ends the current session.
+func (s *sessionAuth) logout(ctx context.Context) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	id := s.getSessionID()
+	if id == "" {
+		return nil
+	}
+	resp, err := s.authClient.R().
+		SetContext(ctx).
+		SetHeader("X-Metabase-Session", id).
+		Delete("/api/session")
+	if err != nil {
+		return fmt.Errorf("logout: %w", err)
+	}
+	if err := checkResponse(resp); err != nil && !IsUnauthorized(err) {
+		return err
+	}
+	s.use(cachedSession{})
+	s.logger.Info().Msg("metabase session closed")
+	return nil
+}
+
+// loadCache takes the session from the cache file if it belongs to this
+// Metabase URL and user and has not expired.
+func (s *sessionAuth) loadCache() bool {
+	if s.cacheFile == "" {
+		return false
+	}
+	data, err := os.ReadFile(s.cacheFile)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.logger.Warn().Err(err).Str("file", s.cacheFile).Msg("reading metabase session cache failed")
+		}
+		return false
+	}
+	var cached cachedSession
+	if err := json.Unmarshal(data, &cached); err != nil {
+		s.logger.Warn().Err(err).Str("file", s.cacheFile).Msg("ignoring malformed metabase session cache")
+		return false
+	}
+	if cached.ID == "" || cached.BaseURL != s.baseURL || cached.Username != s.username {
+		return false
+	}
+
+	if !cached.ExpiresAt.IsZero() && !s.now().Before(cached.ExpiresAt) {
+		return false
+	}
+	s.use(cached)
+	s.logger.Info().Str("file", s.cacheFile).Msg("reusing cached metabase session")
+	return true
+}
+
+// saveCache writes the session to the cache file, if enabled.
+func (s *sessionAuth) saveCache(cached cachedSession) {
+	if s.cacheFile == "" {
+		return
+	}
+	if err := writeSessionCache(s.cacheFile, cached); err != nil {
+		s.logger.Warn().Err(err).Str("file", s.cacheFile).Msg("writing metabase session cache failed")
+	}
+}
+
+// writeSessionCache atomically replaces file with cached, readable only by
+// the current user.
+func writeSessionCache(file string, cached cachedSession) error {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
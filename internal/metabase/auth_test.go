@@ -1,10 +1,17 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -32,7 +39,7 @@ func TestSessionAuth_Authenticate(t *testing.T) {
 	logger := zerolog.Nop()
 	sa := newSessionAuth(server.URL, "admin@test.com", "password123", logger)
 
-	err := sa.authenticate()
+	err := sa.authenticate(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, "test-session-id", sa.getSessionID())
 }
@@ -47,7 +54,175 @@ func TestSessionAuth_AuthenticateFailure(t *testing.T) {
 	logger := zerolog.Nop()
 	sa := newSessionAuth(server.URL, "admin@test.com", "wrong", logger)
 
-	err := sa.authenticate()
+	err := sa.authenticate(context.Background())
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "401")
 }
+
+// fakeSessionServer is a Metabase that issues numbered sessions and accepts
+// only the latest one. timeout is the session-timeout setting it reports.
+type fakeSessionServer struct {
+	*httptest.Server
+	logins  atomic.Int32
+	logouts atomic.Int32
+	timeout string
+}
+
+func newFakeSessionServer(t *testing.T, timeout string) *fakeSessionServer {
+	t.Helper()
+	f := &fakeSessionServer{timeout: timeout}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := fmt.Sprintf("sess-%d", f.logins.Load())
+		switch {
+		case r.URL.Path == "/api/session" && r.Method == http.MethodPost:
+			time.Sleep(10 * time.Millisecond) // lets concurrent 401s pile up
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(sessionResponse{ID: fmt.Sprintf("sess-%d", f.logins.Add(1))})
+			return
+		case r.Header.Get("X-Metabase-Session") != current:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		case r.URL.Path == "/api/session" && r.Method == http.MethodDelete:
+			f.logouts.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case r.URL.Path == "/api/session/properties":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"session-timeout":%s}`, f.timeout)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(User{ID: 1, Email: "test@test.com"})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestSessionAuth_Lifetime(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "unset", timeout: "null", want: defaultSessionLifetime},
+		{name: "minutes", timeout: `{"amount":30,"unit":"minutes"}`, want: 30 * time.Minute},
+		{name: "hours", timeout: `{"amount":2,"unit":"hours"}`, want: 2 * time.Hour},
+		{name: "unknown unit", timeout: `{"amount":2,"unit":"fortnights"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSessionServer(t, tt.timeout)
+			sa := newSessionAuth(f.URL, "admin@test.com", "pass", zerolog.Nop())
+			require.NoError(t, sa.authenticate(context.Background()))
+
+			got, err := sa.sessionLifetime(context.Background(), sa.getSessionID())
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSessionAuth_SingleFlightRenewal(t *testing.T) {
+	f := newFakeSessionServer(t, "null")
+	client, err := NewClient(f.URL, "", "admin@test.com", "pass", zerolog.Nop(), fastRetry)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), f.logins.Load())
+
+	// Metabase forgets the session, e.g. after a restart.
+	f.logins.Add(1)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			_, err := client.GetCurrentUser(context.Background())
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int32(3), f.logins.Load(), "concurrent 401s trigger a single login")
+}
+
+func TestSessionAuth_ProactiveRefresh(t *testing.T) {
+	f := newFakeSessionServer(t, `{"amount":60,"unit":"minutes"}`)
+	now := time.Now()
+	sa := newSessionAuth(f.URL, "admin@test.com", "pass", zerolog.Nop())
+	sa.now = func() time.Time { return now }
+	require.NoError(t, sa.authenticate(context.Background()))
+
+	now = now.Add(50 * time.Minute)
+	assert.Equal(t, "sess-1", sa.current(context.Background()))
+
+	now = now.Add(5 * time.Minute)
+	assert.Equal(t, "sess-2", sa.current(context.Background()), "the session is replaced before it expires")
+	assert.Equal(t, int32(2), f.logins.Load())
+}
+
+func TestSessionAuth_Cache(t *testing.T) {
+	f := newFakeSessionServer(t, `{"amount":60,"unit":"minutes"}`)
+	dir := filepath.Join(t.TempDir(), "sessions")
+
+	client, err := NewClient(f.URL, "", "admin@test.com", "pass", zerolog.Nop(), WithSessionCache(dir))
+	require.NoError(t, err)
+	require.Equal(t, int32(1), f.logins.Load())
+	require.NoError(t, client.Logout(context.Background()))
+	assert.Zero(t, f.logouts.Load(), "a cached session is kept on shutdown")
+
+	info, err := os.Stat(client.sessionAuth.cacheFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	_, err = NewClient(f.URL, "", "admin@test.com", "pass", zerolog.Nop(), WithSessionCache(dir))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), f.logins.Load(), "the cached session is reused after a restart")
+
+	_, err = NewClient(f.URL, "", "other@test.com", "pass", zerolog.Nop(), WithSessionCache(dir))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), f.logins.Load(), "another user's session is not reused")
+
+	// A cached session Metabase no longer accepts is replaced.
+	f.logins.Add(1)
+	client, err = NewClient(f.URL, "", "admin@test.com", "pass", zerolog.Nop(), WithSessionCache(dir))
+	require.NoError(t, err)
+	assert.Equal(t, int32(4), f.logins.Load())
+	data, err := os.ReadFile(client.sessionAuth.cacheFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"id":"sess-4"`)
+}
+
+func TestSessionAuth_CacheExpired(t *testing.T) {
+	f := newFakeSessionServer(t, "null")
+	dir := t.TempDir()
+	sa := newSessionAuth(f.URL, "admin@test.com", "pass", zerolog.Nop())
+	sa.setCacheDir(dir)
+	require.NoError(t, writeSessionCache(sa.cacheFile, cachedSession{
+		BaseURL:   f.URL,
+		Username:  "admin@test.com",
+		ID:        "sess-0",
+		CreatedAt: time.Now().Add(-2 * time.Hour),
+		ExpiresAt: time.Now().Add(-time.Hour),
+	}))
+
+	require.NoError(t, sa.start(context.Background()))
+	assert.Equal(t, "sess-1", sa.getSessionID())
+}
+
+func TestClient_Logout(t *testing.T) {
+	f := newFakeSessionServer(t, "null")
+	client, err := NewClient(f.URL, "", "admin@test.com", "pass", zerolog.Nop())
+	require.NoError(t, err)
+
+	require.NoError(t, client.Logout(context.Background()))
+	assert.Equal(t, int32(1), f.logouts.Load())
+	require.NoError(t, client.Logout(context.Background()), "logging out twice is harmless")
+	assert.Equal(t, int32(1), f.logouts.Load())
+
+	_, apiKeyClient := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("API key clients have no session to end")
+	})
+	require.NoError(t, apiKeyClient.Logout(context.Background()))
+}
@@ -0,0 +1,188 @@
+package metabase
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrCircuitOpen is returned without contacting Metabase while the circuit
+// breaker considers it down.
+var ErrCircuitOpen = errors.New("metabase unavailable: circuit breaker open")
+
+// BreakerPolicy controls the circuit breaker. After Threshold consecutive
+// failed requests (connection errors, 502, 503, 504), requests fail with
+// ErrCircuitOpen for Cooldown. Then a single request is let through: if it
+// succeeds the breaker closes, otherwise it stays open for another Cooldown.
+type BreakerPolicy struct {
+	// Threshold is the number of consecutive failures that opens the
+	// breaker. Zero disables the breaker.
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// DefaultBreakerPolicy is used unless WithCircuitBreaker is given.
+var DefaultBreakerPolicy = BreakerPolicy{
+	Threshold: 5,
+	Cooldown:  30 * time.Second,
+}
+
+// WithCircuitBreaker sets the circuit breaker policy.
+func WithCircuitBreaker(p BreakerPolicy) Option {
+	return func(o *clientOptions) {
+		o.breaker = p
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker is a circuit breaker for one Metabase instance.
+type breaker struct {
+	policy BreakerPolicy
+	logger zerolog.Logger
+	now    func() time.Time
+
+	mu    sync.Mutex
+	state breakerState
+	// generation counts state changes, so that requests sent in an earlier
+	// state do not decide the current one.
+	generation uint64
+	failures   int
+	openedAt   time.Time
+	probing    bool
+}
+
+// breakerTicket is what a request let through by allow carries back to
+// record or release.
+type breakerTicket struct {
+	generation uint64
+	probe      bool
+}
+
+func newBreaker(policy BreakerPolicy, logger zerolog.Logger) *breaker {
+	return &breaker{policy: policy, logger: logger, now: time.Now}
+}
+
+// allow reports whether a request may be sent. In the half-open state only
+// one probe request is in flight at a time.
+func (b *breaker) allow() (breakerTicket, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.policy.Cooldown {
+			return breakerTicket{}, false
+		}
+		b.setState(breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return breakerTicket{}, false
+		}
+		b.probing = true
+		return breakerTicket{generation: b.generation, probe: true}, true
+	}
+	return breakerTicket{generation: b.generation}, true
+}
+
+// record updates the breaker with the outcome of a request. Outcomes of
+// requests sent before the last state change are ignored: a slow request
+// started while the breaker was closed cannot close it again once it has
+// opened, which only a probe can.
+func (b *breaker) record(t breakerTicket, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.probe {
+		b.probing = false
+	}
+	if t.generation != b.generation {
+		return
+	}
+	if !failed {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.policy.Threshold {
+		b.openedAt = b.now()
+		if b.state != breakerOpen {
+			b.setState(breakerOpen)
+		}
+	}
+}
+
+// release ends a request without judging Metabase by it.
+func (b *breaker) release(t breakerTicket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.probe {
+		b.probing = false
+	}
+}
+
+// setState changes the state and logs the transition. b.mu must be held.
+func (b *breaker) setState(s breakerState) {
+	prev := b.state
+	b.state = s
+	b.generation++
+	ev := b.logger.Info()
+	if s == breakerOpen {
+		ev = b.logger.Warn().Int("failures", b.failures).Dur("cooldown", b.policy.Cooldown)
+	}
+	ev.Str("from", prev.String()).Str("to", s.String()).Msg("metabase circuit breaker state changed")
+}
+
+// breakerTransport applies a breaker to every HTTP request, including each
+// retry attempt.
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *breaker
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ticket, ok := t.breaker.allow()
+	if !ok {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// A request cancelled by the caller says nothing about Metabase.
+		t.breaker.release(ticket)
+	case err != nil:
+		t.breaker.record(ticket, true)
+	default:
+		t.breaker.record(ticket, unavailableStatus(resp.StatusCode))
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the base transport.
+func (t *breakerTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
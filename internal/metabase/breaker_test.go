@@ -0,0 +1,116 @@
+package metabase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker_States(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(BreakerPolicy{Threshold: 2, Cooldown: time.Minute}, zerolog.Nop())
+	b.now = func() time.Time { return now }
+	send := func(failed bool) {
+		t.Helper()
+		ticket, ok := b.allow()
+		require.True(t, ok)
+		b.record(ticket, failed)
+	}
+
+	send(true)
+	_, ok := b.allow()
+	require.True(t, ok, "one failure stays below the threshold")
+	send(true)
+	assert.Equal(t, breakerOpen, b.state)
+	_, ok = b.allow()
+	assert.False(t, ok)
+
+	now = now.Add(time.Minute)
+	probe, ok := b.allow()
+	assert.True(t, ok, "a probe is let through after the cooldown")
+	assert.Equal(t, breakerHalfOpen, b.state)
+	_, ok = b.allow()
+	assert.False(t, ok, "only one probe at a time")
+	b.record(probe, true)
+	assert.Equal(t, breakerOpen, b.state, "a failed probe reopens the breaker")
+	_, ok = b.allow()
+	assert.False(t, ok)
+
+	now = now.Add(time.Minute)
+	probe, ok = b.allow()
+	require.True(t, ok)
+	b.release(probe)
+	assert.Equal(t, breakerHalfOpen, b.state, "a cancelled probe decides nothing")
+	send(false)
+	assert.Equal(t, breakerClosed, b.state)
+
+	send(true)
+	send(false)
+	send(true)
+	assert.Equal(t, breakerClosed, b.state, "only consecutive failures count")
+}
+
+func TestBreaker_StaleOutcomes(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(BreakerPolicy{Threshold: 1, Cooldown: time.Minute}, zerolog.Nop())
+	b.now = func() time.Time { return now }
+
+	slow, ok := b.allow()
+	require.True(t, ok)
+	failing, ok := b.allow()
+	require.True(t, ok)
+	b.record(failing, true)
+	require.Equal(t, breakerOpen, b.state)
+
+	b.record(slow, false)
+	assert.Equal(t, breakerOpen, b.state, "a request sent before the breaker opened cannot close it")
+	_, ok = b.allow()
+	assert.False(t, ok)
+
+	now = now.Add(time.Minute)
+	probe, ok := b.allow()
+	require.True(t, ok)
+	b.record(slow, false)
+	assert.Equal(t, breakerHalfOpen, b.state, "only the probe decides the half-open breaker")
+	b.record(probe, false)
+	assert.Equal(t, breakerClosed, b.state)
+
+	b.record(failing, true)
+	assert.Equal(t, breakerClosed, b.state, "failures from before the breaker closed are ignored")
+}
+
+func TestBreaker_FailsFast(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	var logs bytes.Buffer
+	client, err := NewClient(server.URL, "key", "", "", zerolog.New(&logs), WithoutStartupCheck(),
+		WithRetry(RetryPolicy{}),
+		WithCircuitBreaker(BreakerPolicy{Threshold: 3, Cooldown: time.Minute}))
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err := client.ListCards(context.Background(), Page{})
+		assert.True(t, IsRetryable(err))
+	}
+	assert.Contains(t, logs.String(), `"to":"open"`)
+
+	_, err = client.ListCards(context.Background(), Page{})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.False(t, IsRetryable(err))
+	assert.Equal(t, int32(3), calls.Load(), "no request is sent while the breaker is open")
+}
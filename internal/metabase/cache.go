@@ -1,10 +1,14 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // InvalidateCache invalidates the Metabase cache.
-func (c *Client) InvalidateCache() error {
+func (c *Client) InvalidateCache(ctx context.Context) error {
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		Post("/api/cache/invalidate")
 	if err != nil {
 		return fmt.Errorf("invalidate cache: %w", err)
@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
@@ -15,6 +16,6 @@ func TestInvalidateCache(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	err := client.InvalidateCache()
+	err := client.InvalidateCache(context.Background())
 	require.NoError(t, err)
 }
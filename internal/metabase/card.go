@@ -1,11 +1,16 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
-// ListCards returns all saved questions/cards.
-func (c *Client) ListCards() ([]Card, error) {
+// ListCards returns a page of the saved questions/cards. Metabase does not
+// paginate cards, so all of them are fetched and the page is cut out here.
+func (c *Client) ListCards(ctx context.Context, page Page) (*Paged[Card], error) {
 	var result []Card
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/card")
 	if err != nil {
@@ -14,13 +19,14 @@ func (c *Client) ListCards() ([]Card, error) {
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
-	return result, nil
+	return SlicePage(result, page), nil
 }
 
 // GetCard returns a card by ID.
-func (c *Client) GetCard(id int) (*Card, error) {
+func (c *Client) GetCard(ctx context.Context, id int) (*Card, error) {
 	var result Card
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/card/%d", id))
 	if err != nil {
@@ -33,9 +39,10 @@ func (c *Client) GetCard(id int) (*Card, error) {
 }
 
 // CreateCard creates a new saved question/card.
-func (c *Client) CreateCard(card *Card) (*Card, error) {
+func (c *Client) CreateCard(ctx context.Context, card *Card) (*Card, error) {
 	var result Card
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(card).
 		SetResult(&result).
 		Post("/api/card")
@@ -49,9 +56,10 @@ func (c *Client) CreateCard(card *Card) (*Card, error) {
 }
 
 // UpdateCard updates an existing card.
-func (c *Client) UpdateCard(id int, card *Card) (*Card, error) {
+func (c *Client) UpdateCard(ctx context.Context, id int, card *Card) (*Card, error) {
 	var result Card
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(card).
 		SetResult(&result).
 		Put(fmt.Sprintf("/api/card/%d", id))
@@ -65,8 +73,9 @@ func (c *Client) UpdateCard(id int, card *Card) (*Card, error) {
 }
 
 // DeleteCard archives/deletes a card.
-func (c *Client) DeleteCard(id int) error {
+func (c *Client) DeleteCard(ctx context.Context, id int) error {
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		Delete(fmt.Sprintf("/api/card/%d", id))
 	if err != nil {
 		return fmt.Errorf("delete card: %w", err)
@@ -75,9 +84,9 @@ func (c *Client) DeleteCard(id int) error {
 }
 
 // ExecuteCardQuery runs a card's saved query and returns results.
-func (c *Client) ExecuteCardQuery(id int, parameters map[string]any) (*DatasetQueryResponse, error) {
+func (c *Client) ExecuteCardQuery(ctx context.Context, id int, parameters map[string]any) (*DatasetQueryResponse, error) {
 	var result DatasetQueryResponse
-	req := c.httpClient.R().SetResult(&result)
+	req := c.httpClient.R().SetContext(ctx).SetResult(&result)
 	if len(parameters) > 0 {
 		req.SetBody(parameters)
 	}
@@ -88,5 +97,8 @@ func (c *Client) ExecuteCardQuery(id int, parameters map[string]any) (*DatasetQu
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
+	if err := checkQueryResult(resp, &result); err != nil {
+		return nil, err
+	}
 	return &result, nil
 }
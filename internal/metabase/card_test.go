@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -20,9 +21,15 @@ func TestListCards(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	cards, err := client.ListCards()
+	cards, err := client.ListCards(context.Background(), Page{})
 	require.NoError(t, err)
-	assert.Len(t, cards, 2)
+	assert.Len(t, cards.Data, 2)
+
+	cards, err = client.ListCards(context.Background(), Page{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, cards.Data, 1)
+	assert.Equal(t, "Revenue", cards.Data[0].Name)
+	assert.Equal(t, 2, cards.Total)
 }
 
 func TestGetCard(t *testing.T) {
@@ -33,7 +40,7 @@ func TestGetCard(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	card, err := client.GetCard(1)
+	card, err := client.GetCard(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "Users Count", card.Name)
 }
@@ -48,7 +55,7 @@ func TestCreateCard(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	card, err := client.CreateCard(&Card{Name: "New Card"})
+	card, err := client.CreateCard(context.Background(), &Card{Name: "New Card"})
 	require.NoError(t, err)
 	assert.Equal(t, 10, card.ID)
 }
@@ -62,7 +69,7 @@ func TestUpdateCard(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	card, err := client.UpdateCard(1, &Card{Name: "Updated"})
+	card, err := client.UpdateCard(context.Background(), 1, &Card{Name: "Updated"})
 	require.NoError(t, err)
 	assert.Equal(t, "Updated", card.Name)
 }
@@ -74,7 +81,7 @@ func TestDeleteCard(t *testing.T) {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	err := client.DeleteCard(1)
+	err := client.DeleteCard(context.Background(), 1)
 	require.NoError(t, err)
 }
 
@@ -91,7 +98,7 @@ func TestExecuteCardQuery(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	result, err := client.ExecuteCardQuery(1, nil)
+	result, err := client.ExecuteCardQuery(context.Background(), 1, nil)
 	require.NoError(t, err)
 	assert.Equal(t, "completed", result.Status)
 }
@@ -0,0 +1,327 @@
+package metabase
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrNotRecorded is returned in replay mode for requests the cassette has
+// no response to.
+var ErrNotRecorded = errors.New("request not recorded in cassette")
+
+// redacted replaces credentials in cassettes.
+const redacted = "REDACTED"
+
+// WithRecording writes every request the client sends to Metabase, with its
+// response, to a cassette: a directory holding one JSON file per exchange.
+// API keys, session IDs, passwords and secret settings are replaced by
+// REDACTED. Failed recordings are logged and do not fail the request.
+func WithRecording(dir string) Option {
+	return func(o *clientOptions) {
+		o.recordDir = dir
+	}
+}
+
+// WithReplay serves the client's requests from a cassette written by
+// WithRecording instead of contacting Metabase. A request is answered with
+// the responses recorded for the same method, URL and body, in recorded
+// order, repeating the last one once they are used up. Other requests fail
+// with ErrNotRecorded.
+func WithReplay(dir string) Option {
+	return func(o *clientOptions) {
+		o.replayDir = dir
+	}
+}
+
+// exchange is a cassette file.
+type exchange struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string `json:"method"`
+	// URL is the path and query.
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	recordedBody
+}
+
+type recordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	recordedBody
+}
+
+// recordedBody holds a JSON body as is, for readable cassettes, and any
+// other body as text.
+type recordedBody struct {
+	JSON json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+func (b recordedBody) bytes() []byte {
+	if b.JSON != nil {
+		return b.JSON
+	}
+	return []byte(b.Text)
+}
+
+// newRecordedBody scrubs body, the body of a message to or from path.
+func newRecordedBody(path string, body []byte) recordedBody {
+	if len(body) == 0 {
+		return recordedBody{}
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return recordedBody{Text: string(body)}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(scrub(v, path == "/api/session")); err != nil {
+		return recordedBody{Text: string(body)}
+	}
+	return recordedBody{JSON: bytes.TrimSpace(buf.Bytes())}
+}
+
+// sensitiveHeaders are the headers that carry credentials.
+var sensitiveHeaders = []string{"X-Api-Key", "X-Metabase-Session", "Authorization", "Cookie", "Set-Cookie"}
+
+func scrubHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range sensitiveHeaders {
+		if len(h.Values(name)) > 0 {
+			h.Set(name, redacted)
+		}
+	}
+	return h
+}
+
+// sensitiveKey reports whether a JSON key or setting name holds a
+// credential.
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "api_key", "api-key", "session_id", "token":
+		return true
+	}
+	return strings.Contains(key, "password") || strings.Contains(key, "secret")
+}
+
+// scrub replaces the credentials in a decoded JSON value: values of
+// sensitive keys, the value of settings with a sensitive name, and for
+// session endpoints, the session ID.
+func scrub(v any, session bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		secretSetting := false
+		if key, ok := v["key"].(string); ok && sensitiveKey(key) {
+			secretSetting = true
+		}
+		for k, val := range v {
+			switch {
+			case val == nil:
+			case sensitiveKey(k), session && k == "id", secretSetting && k == "value":
+				v[k] = redacted
+			default:
+				v[k] = scrub(val, false)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = scrub(v[i], false)
+		}
+	}
+	return v
+}
+
+// readBody reads and restores the body of r.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// recordingTransport writes the exchanges of its base transport to a
+// cassette.
+type recordingTransport struct {
+	base   http.RoundTripper
+	dir    string
+	logger zerolog.Logger
+
+	mu sync.Mutex
+	n  int
+}
+
+func newRecordingTransport(base http.RoundTripper, dir string, logger zerolog.Logger) *recordingTransport {
+	return &recordingTransport{base: base, dir: dir, logger: logger}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	reqBody, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	path := req.URL.Path
+	if err := t.save(exchange{
+		Request: recordedRequest{
+			Method:       req.Method,
+			URL:          req.URL.RequestURI(),
+			Header:       scrubHeader(req.Header),
+			recordedBody: newRecordedBody(path, reqBody),
+		},
+		Response: recordedResponse{
+			Status:       resp.StatusCode,
+			Header:       scrubHeader(resp.Header),
+			recordedBody: newRecordedBody(path, respBody),
+		},
+	}); err != nil {
+		t.logger.Warn().Err(err).Str("method", req.Method).Str("path", path).Msg("recording metabase exchange failed")
+	}
+	return resp, nil
+}
+
+// unsafeName matches the characters left out of cassette file names.
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+func (t *recordingTransport) save(e exchange) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode exchange: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(t.dir, 0o700); err != nil {
+		return fmt.Errorf("create cassette directory: %w", err)
+	}
+	t.n++
+	path, _, _ := strings.Cut(e.Request.URL, "?")
+	name := fmt.Sprintf("%04d-%s-%s.json", t.n, e.Request.Method, strings.Trim(unsafeName.ReplaceAllString(path, "-"), "-"))
+	if err := os.WriteFile(filepath.Join(t.dir, name), append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	return nil
+}
+
+// CloseIdleConnections closes the idle connections of the base transport.
+func (t *recordingTransport) CloseIdleConnections() {
+	if c, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// replayTransport answers requests from a cassette.
+type replayTransport struct {
+	mu        sync.Mutex
+	responses map[string][]recordedResponse // see replayKey
+	served    map[string]int
+}
+
+func newReplayTransport(dir string) (*replayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("read cassette: no recorded exchanges in %s", dir)
+	}
+	slices.Sort(files)
+	t := &replayTransport{responses: make(map[string][]recordedResponse), served: make(map[string]int)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read cassette: %w", err)
+		}
+		var e exchange
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("read cassette %s: %w", filepath.Base(file), err)
+		}
+		key := replayKey(e.Request.Method, e.Request.URL, e.Request.recordedBody)
+		t.responses[key] = append(t.responses[key], e.Response)
+	}
+	return t, nil
+}
+
+// replayKey identifies a request by its method, URL and scrubbed body,
+// ignoring the indentation of cassette files.
+func replayKey(method, url string, body recordedBody) string {
+	data := body.bytes()
+	if body.JSON != nil {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, body.JSON); err == nil {
+			data = buf.Bytes()
+		}
+	}
+	return method + " " + url + "\n" + string(data)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	url := req.URL.RequestURI()
+	key := replayKey(req.Method, url, newRecordedBody(req.URL.Path, body))
+
+	t.mu.Lock()
+	responses := t.responses[key]
+	n := t.served[key]
+	t.served[key]++
+	t.mu.Unlock()
+	if len(responses) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, url)
+	}
+	rec := responses[min(n, len(responses)-1)]
+	data := rec.bytes()
+	header := rec.Header.Clone()
+	// The recorded body may differ in length from the original.
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        strconv.Itoa(rec.Status) + " " + http.StatusText(rec.Status),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
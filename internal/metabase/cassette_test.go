@@ -0,0 +1,143 @@
+package metabase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCassetteTestServer serves session login, the current user, a card
+// whose name changes with every update, and a setting holding a secret.
+func newCassetteTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	name := "Orders"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/session" && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"id":"real-session-id"}`))
+		case r.URL.Path == "/api/session" && r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Header.Get("X-Metabase-Session") != "real-session-id":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/api/user/current":
+			_, _ = w.Write([]byte(`{"id":1,"email":"admin@test.com"}`))
+		case r.URL.Path == "/api/session/properties":
+			_, _ = w.Write([]byte(`{"version":{"tag":"v0.50.0"}}`))
+		case r.URL.Path == "/api/card/1" && r.Method == http.MethodPut:
+			var card Card
+			_ = json.NewDecoder(r.Body).Decode(&card)
+			name = card.Name
+			fallthrough
+		case r.URL.Path == "/api/card/1":
+			_, _ = fmt.Fprintf(w, `{"id":1,"name":%q}`, name)
+		case r.URL.Path == "/api/setting":
+			_, _ = w.Write([]byte(`[{"key":"embedding-secret-key","value":"s3cr3t"},{"key":"site-name","value":"Acme"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	server := newCassetteTestServer(t)
+
+	client, err := NewClient(server.URL, "", "admin@test.com", "password123", zerolog.Nop(), WithRecording(dir))
+	require.NoError(t, err)
+	card, err := client.GetCard(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Orders", card.Name)
+	_, err = client.UpdateCard(ctx, 1, &Card{Name: "All orders"})
+	require.NoError(t, err)
+	card, err = client.GetCard(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "All orders", card.Name)
+	settings, err := client.ListSettings(ctx)
+	require.NoError(t, err)
+	require.NoError(t, client.Logout(ctx))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	assert.Equal(t, "0001-POST-api-session.json", filepath.Base(files[0]))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		for _, secret := range []string{"real-session-id", "password123", "s3cr3t"} {
+			assert.NotContains(t, string(data), secret, filepath.Base(file))
+		}
+	}
+
+	// Metabase is gone; the cassette answers in its place, in order.
+	server.Close()
+	replay, err := NewClient(server.URL, "", "admin@test.com", "another-password", zerolog.Nop(), WithReplay(dir))
+	require.NoError(t, err)
+	card, err = replay.GetCard(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Orders", card.Name)
+	_, err = replay.UpdateCard(ctx, 1, &Card{Name: "All orders"})
+	require.NoError(t, err)
+	card, err = replay.GetCard(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "All orders", card.Name)
+	card, err = replay.GetCard(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "All orders", card.Name, "the last response is repeated")
+	replayed, err := replay.ListSettings(ctx)
+	require.NoError(t, err)
+	require.Len(t, replayed, len(settings))
+	assert.Equal(t, "REDACTED", replayed[0].Value)
+	assert.Equal(t, "Acme", replayed[1].Value)
+
+	_, err = replay.UpdateCard(ctx, 1, &Card{Name: "Something else"})
+	require.ErrorIs(t, err, ErrNotRecorded)
+	assert.False(t, IsRetryable(err))
+}
+
+func TestCassette_ReplayEmpty(t *testing.T) {
+	_, err := NewClient("http://metabase.invalid", "key", "", "", zerolog.Nop(), WithReplay(t.TempDir()))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no recorded exchanges")
+}
+
+func TestScrub(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		want    string
+		wantRaw bool
+	}{
+		{name: "login", path: "/api/session", body: `{"username":"a@b.c","password":"pw"}`, want: `{"password":"REDACTED","username":"a@b.c"}`},
+		{name: "session", path: "/api/session", body: `{"id":"abc"}`, want: `{"id":"REDACTED"}`},
+		{name: "ids elsewhere", path: "/api/card/1", body: `{"id":1,"name":"<Orders>"}`, want: `{"id":1,"name":"<Orders>"}`},
+		{name: "nested", path: "/api/database/1", body: `{"details":{"host":"db","password":"pw","token":null}}`, want: `{"details":{"host":"db","password":"REDACTED","token":null}}`},
+		{name: "large number", path: "/api/card/1", body: `{"id":12345678901234567890}`, want: `{"id":12345678901234567890}`},
+		{name: "text", path: "/api/dataset/csv", body: "ID\n1\n", want: "ID\n1\n", wantRaw: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newRecordedBody(tt.path, []byte(tt.body))
+			if tt.wantRaw {
+				assert.Nil(t, b.JSON)
+				assert.Equal(t, tt.want, b.Text)
+				return
+			}
+			assert.Equal(t, tt.want, strings.TrimSpace(string(b.JSON)))
+		})
+	}
+}
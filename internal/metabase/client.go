@@ -1,7 +1,10 @@
 package metabase
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -15,10 +18,53 @@ type Client struct {
 	apiKey      string
 	sessionAuth *sessionAuth
 	logger      zerolog.Logger
+
+	enginesMu sync.Mutex
+	engines   map[int]string // database ID -> engine, see DatabaseEngine
+
+	infoMu sync.Mutex
+	info   *ServerInfo // see ServerInfo
 }
 
-// NewClient creates a new Metabase API client.
-func NewClient(baseURL, apiKey, username, password string, logger zerolog.Logger) (*Client, error) {
+// Option configures optional Client behavior.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	skipStartupCheck bool
+	sessionToken     string
+	sessionCacheDir  string
+	retry            RetryPolicy
+	breaker          BreakerPolicy
+	recordDir        string
+	replayDir        string
+}
+
+// WithSessionToken authenticates with an existing Metabase session ID
+// instead of an API key or username/password. The session is not renewed
+// when it expires.
+func WithSessionToken(token string) Option {
+	return func(o *clientOptions) {
+		o.sessionToken = token
+	}
+}
+
+// WithoutStartupCheck makes NewClient succeed even if Metabase is unreachable
+// or rejects the credentials. The initial session login, if any, is retried
+// on the first 401; use HealthCheck to find out whether the instance works.
+func WithoutStartupCheck() Option {
+	return func(o *clientOptions) {
+		o.skipStartupCheck = true
+	}
+}
+
+// NewClient creates a new Metabase API client. Unless WithoutStartupCheck is
+// given, it logs in (for session auth) and verifies the credentials.
+func NewClient(baseURL, apiKey, username, password string, logger zerolog.Logger, opts ...Option) (*Client, error) {
+	o := clientOptions{retry: DefaultRetryPolicy, breaker: DefaultBreakerPolicy}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	c := &Client{
 		baseURL: baseURL,
 		apiKey:  apiKey,
@@ -27,7 +73,40 @@ func NewClient(baseURL, apiKey, username, password string, logger zerolog.Logger
 
 	httpClient := resty.New().
 		SetBaseURL(baseURL).
-		SetTimeout(30 * time.Second)
+		SetTimeout(30 * time.Second).
+		SetRetryCount(o.retry.MaxRetries).
+		SetRetryWaitTime(o.retry.MinWait).
+		SetRetryMaxWaitTime(o.retry.MaxWait).
+		SetRetryAfter(retryAfter).
+		AddRetryCondition(o.retry.retryCondition()).
+		AddRetryHook(func(r *resty.Response, err error) {
+			ev := logger.Warn().Err(err).Int("attempt", r.Request.Attempt)
+			if r.RawResponse != nil {
+				ev = ev.Int("status", r.StatusCode())
+			}
+			ev.Str("method", r.Request.Method).Str("url", r.Request.URL).Msg("metabase API call failed, retrying")
+		})
+	// The cassette transport, if any, also carries the session logins.
+	var cassette http.RoundTripper
+	switch {
+	case o.replayDir != "":
+		rt, err := newReplayTransport(o.replayDir)
+		if err != nil {
+			return nil, err
+		}
+		cassette = rt
+	case o.recordDir != "":
+		cassette = newRecordingTransport(httpClient.GetClient().Transport, o.recordDir, logger)
+	}
+	if cassette != nil {
+		httpClient.SetTransport(cassette)
+	}
+	if o.breaker.Threshold > 0 {
+		httpClient.SetTransport(&breakerTransport{
+			base:    httpClient.GetClient().Transport,
+			breaker: newBreaker(o.breaker, logger),
+		})
+	}
 
 	httpClient.OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
 		logger.Debug().
@@ -49,54 +128,88 @@ func NewClient(baseURL, apiKey, username, password string, logger zerolog.Logger
 
 	if apiKey != "" {
 		httpClient.SetHeader("x-api-key", apiKey)
+	} else if o.sessionToken != "" {
+		httpClient.SetHeader("X-Metabase-Session", o.sessionToken)
 	} else if username != "" && password != "" {
 		sa := newSessionAuth(baseURL, username, password, logger)
+		if o.sessionCacheDir != "" {
+			sa.setCacheDir(o.sessionCacheDir)
+		}
+		if cassette != nil {
+			sa.authClient.SetTransport(cassette)
+		}
 		c.sessionAuth = sa
 
-		if err := sa.authenticate(); err != nil {
-			return nil, fmt.Errorf("initial authentication failed: %w", err)
+		if err := sa.start(context.Background()); err != nil {
+			if !o.skipStartupCheck {
+				return nil, fmt.Errorf("initial authentication failed: %w", err)
+			}
+			logger.Warn().Err(err).Msg("initial authentication failed, will retry on first request")
 		}
 
 		httpClient.OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
-			r.SetHeader("X-Metabase-Session", sa.getSessionID())
+			r.SetHeader("X-Metabase-Session", sa.current(r.Context()))
 			return nil
 		})
 
+		// A 401 on the first attempt is retried once with a new session,
+		// which another request may already have obtained.
 		httpClient.AddRetryCondition(func(r *resty.Response, _ error) bool {
-			if r != nil && r.StatusCode() == 401 {
-				logger.Warn().Msg("received 401, re-authenticating")
-				if err := sa.authenticate(); err != nil {
-					logger.Error().Err(err).Msg("re-authentication failed")
-					return false
-				}
-				return true
+			if r == nil || r.StatusCode() != 401 || r.Request.Attempt > 1 {
+				return false
 			}
-			return false
+			logger.Warn().Msg("received 401, re-authenticating")
+			if err := sa.renew(r.Request.Context(), r.Request.Header.Get("X-Metabase-Session")); err != nil {
+				logger.Error().Err(err).Msg("re-authentication failed")
+				return false
+			}
+			return true
 		})
-		httpClient.SetRetryCount(1)
+		// One attempt more than the policy allows leaves room for the
+		// re-authentication retry.
+		httpClient.SetRetryCount(o.retry.MaxRetries + 1)
 	} else {
 		return nil, fmt.Errorf("either API key or username/password must be provided")
 	}
 
 	c.httpClient = httpClient
 
-	if err := c.HealthCheck(); err != nil {
-		return nil, fmt.Errorf("metabase health check failed: %w", err)
+	if !o.skipStartupCheck {
+		if err := c.HealthCheck(context.Background()); err != nil {
+			return nil, fmt.Errorf("metabase health check failed: %w", err)
+		}
+		if _, err := c.ServerInfo(context.Background()); err != nil {
+			logger.Warn().Err(err).Msg("detecting metabase version failed, will retry on first use")
+		}
 	}
 
 	return c, nil
 }
 
-// HealthCheck validates that Metabase is reachable and credentials are valid.
-func (c *Client) HealthCheck() error {
-	_, err := c.GetCurrentUser()
-	return err
+// Close releases the client's idle HTTP connections. It does not end the
+// Metabase session; see Logout.
+func (c *Client) Close() {
+	c.httpClient.GetClient().CloseIdleConnections()
 }
 
-// checkResponse checks if the API response indicates an error.
-func checkResponse(resp *resty.Response) error {
-	if resp.IsError() {
-		return fmt.Errorf("metabase API error (status %d): %s", resp.StatusCode(), resp.String())
+// Logout ends the Metabase session the client logged in with using
+// username and password, unless the session is cached for reuse by
+// WithSessionCache. It does nothing for API key and caller-supplied
+// session authentication.
+func (c *Client) Logout(ctx context.Context) error {
+	if c.sessionAuth == nil || c.sessionAuth.cacheFile != "" {
+		return nil
 	}
-	return nil
+	return c.sessionAuth.logout(ctx)
+}
+
+// BaseURL returns the URL of the Metabase instance the client talks to.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// HealthCheck validates that Metabase is reachable and credentials are valid.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	_, err := c.GetCurrentUser(ctx)
+	return err
 }
@@ -1,10 +1,14 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog"
@@ -12,20 +16,38 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// fastRetry keeps retry waits short in tests.
+var fastRetry = WithRetry(RetryPolicy{MaxRetries: 3, MinWait: time.Millisecond, MaxWait: 5 * time.Millisecond})
+
+// testVersion is the Metabase version newTestServer reports. The endpoint
+// tests were written against it; newer releases are tested separately.
+const testVersion = "v0.46.6"
+
 func newTestServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *Client) {
+	t.Helper()
+	return newVersionedTestServer(t, testVersion, handler)
+}
+
+// newVersionedTestServer is newTestServer for Metabase version.
+func newVersionedTestServer(t *testing.T, version string, handler http.HandlerFunc) (*httptest.Server, *Client) {
 	t.Helper()
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/api/user/current" {
+		switch r.URL.Path {
+		case "/api/user/current":
 			w.Header().Set("Content-Type", "application/json")
 			_ = json.NewEncoder(w).Encode(User{ID: 1, Email: "test@test.com"})
 			return
+		case "/api/session/properties":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"version":{"tag":%q}}`, version)
+			return
 		}
 		handler(w, r)
 	}))
 	t.Cleanup(server.Close)
 
 	logger := zerolog.Nop()
-	client, err := NewClient(server.URL, "test-api-key", "", "", logger)
+	client, err := NewClient(server.URL, "test-api-key", "", "", logger, fastRetry)
 	require.NoError(t, err)
 
 	return server, client
@@ -95,7 +117,7 @@ func TestHealthCheck_Success(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	err := client.HealthCheck()
+	err := client.HealthCheck(context.Background())
 	require.NoError(t, err)
 }
 
@@ -118,7 +140,7 @@ func TestHealthCheck_Failure(t *testing.T) {
 	}
 	client.httpClient = resty.New().SetBaseURL(server.URL).SetHeader("x-api-key", "test-api-key")
 
-	err := client.HealthCheck()
+	err := client.HealthCheck(context.Background())
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "500")
 }
@@ -139,3 +161,87 @@ func TestNewClient_HealthCheckFails(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "metabase health check failed")
 }
+
+func TestNewClient_WithoutStartupCheck(t *testing.T) {
+	var logins int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/session" {
+			logins++
+			if logins == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(sessionResponse{ID: "sess-123"})
+			return
+		}
+		if r.Header.Get("X-Metabase-Session") != "sess-123" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(User{ID: 1, Email: "test@test.com"})
+	}))
+	defer server.Close()
+
+	logger := zerolog.Nop()
+	_, err := NewClient(server.URL, "", "admin@test.com", "pass", logger)
+	require.Error(t, err, "startup check fails without the option")
+
+	logins = 0
+	client, err := NewClient(server.URL, "", "admin@test.com", "pass", logger, WithoutStartupCheck())
+	require.NoError(t, err)
+	assert.Equal(t, server.URL, client.BaseURL())
+	assert.Equal(t, 1, logins)
+
+	// The failed login is retried when the first request gets a 401.
+	require.NoError(t, client.HealthCheck(context.Background()))
+	assert.Equal(t, 2, logins)
+}
+
+func TestNewClient_SessionToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, "/api/session", r.URL.Path, "an existing session must not log in")
+		assert.Equal(t, "caller-session", r.Header.Get("X-Metabase-Session"))
+		assert.Empty(t, r.Header.Get("x-api-key"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(User{ID: 7, Email: "caller@test.com"})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "", "", "", zerolog.Nop(), WithSessionToken("caller-session"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	user, err := client.GetCurrentUser(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 7, user.ID)
+}
+
+func TestClient_ContextCancellation(t *testing.T) {
+	aborted := make(chan struct{})
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// The server notices a closed connection once the body is read.
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			close(aborted)
+		case <-time.After(10 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.ExecuteQuery(ctx, &DatasetQueryRequest{Database: 1, Type: "native"})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metabase request was not aborted")
+	}
+}
@@ -1,11 +1,14 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListCollections returns all collections.
-func (c *Client) ListCollections(namespace string) ([]Collection, error) {
+func (c *Client) ListCollections(ctx context.Context, namespace string) ([]Collection, error) {
 	var result []Collection
-	req := c.httpClient.R().SetResult(&result)
+	req := c.httpClient.R().SetContext(ctx).SetResult(&result)
 	if namespace != "" {
 		req.SetQueryParam("namespace", namespace)
 	}
@@ -20,9 +23,10 @@ func (c *Client) ListCollections(namespace string) ([]Collection, error) {
 }
 
 // GetCollection returns a collection by ID.
-func (c *Client) GetCollection(id string) (*Collection, error) {
+func (c *Client) GetCollection(ctx context.Context, id string) (*Collection, error) {
 	var result Collection
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/collection/%s", id))
 	if err != nil {
@@ -35,9 +39,10 @@ func (c *Client) GetCollection(id string) (*Collection, error) {
 }
 
 // CreateCollection creates a new collection.
-func (c *Client) CreateCollection(collection *Collection) (*Collection, error) {
+func (c *Client) CreateCollection(ctx context.Context, collection *Collection) (*Collection, error) {
 	var result Collection
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(collection).
 		SetResult(&result).
 		Post("/api/collection")
@@ -51,9 +56,10 @@ func (c *Client) CreateCollection(collection *Collection) (*Collection, error) {
 }
 
 // UpdateCollection updates an existing collection.
-func (c *Client) UpdateCollection(id int, collection *Collection) (*Collection, error) {
+func (c *Client) UpdateCollection(ctx context.Context, id int, collection *Collection) (*Collection, error) {
 	var result Collection
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(collection).
 		SetResult(&result).
 		Put(fmt.Sprintf("/api/collection/%d", id))
@@ -66,15 +72,17 @@ func (c *Client) UpdateCollection(id int, collection *Collection) (*Collection,
 	return &result, nil
 }
 
-// ListCollectionItems returns items in a collection.
-func (c *Client) ListCollectionItems(id string, models []string) ([]CollectionItem, error) {
+// ListCollectionItems returns a page of the items in a collection.
+func (c *Client) ListCollectionItems(ctx context.Context, id string, models []string, page Page) (*Paged[CollectionItem], error) {
 	var result struct {
-		Data []CollectionItem `json:"data"`
+		Data  []CollectionItem `json:"data"`
+		Total int              `json:"total"`
 	}
-	req := c.httpClient.R().SetResult(&result)
+	req := c.httpClient.R().SetContext(ctx).SetResult(&result)
 	for _, m := range models {
-		req.SetQueryParam("models", m)
+		req.QueryParam.Add("models", m)
 	}
+	page.apply(req)
 	resp, err := req.Get(fmt.Sprintf("/api/collection/%s/items", id))
 	if err != nil {
 		return nil, fmt.Errorf("list collection items: %w", err)
@@ -82,5 +90,5 @@ func (c *Client) ListCollectionItems(id string, models []string) ([]CollectionIt
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
-	return result.Data, nil
+	return serverPage(result.Data, result.Total, page), nil
 }
@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -18,7 +19,7 @@ func TestListCollections(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	cols, err := client.ListCollections("")
+	cols, err := client.ListCollections(context.Background(), "")
 	require.NoError(t, err)
 	assert.Len(t, cols, 1)
 }
@@ -31,7 +32,7 @@ func TestGetCollection(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	col, err := client.GetCollection("root")
+	col, err := client.GetCollection(context.Background(), "root")
 	require.NoError(t, err)
 	assert.Equal(t, "Our analytics", col.Name)
 }
@@ -44,7 +45,7 @@ func TestCreateCollection(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	col, err := client.CreateCollection(&Collection{Name: "New Collection"})
+	col, err := client.CreateCollection(context.Background(), &Collection{Name: "New Collection"})
 	require.NoError(t, err)
 	assert.Equal(t, "New Collection", col.Name)
 }
@@ -52,17 +53,22 @@ func TestCreateCollection(t *testing.T) {
 func TestListCollectionItems(t *testing.T) {
 	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, "/api/collection/1/items", r.URL.Path)
+		assert.Equal(t, []string{"dashboard", "card"}, r.URL.Query()["models"])
+		assert.Equal(t, "1", r.URL.Query().Get("limit"))
+		assert.Equal(t, "2", r.URL.Query().Get("offset"))
 		w.Header().Set("Content-Type", "application/json")
 		err := json.NewEncoder(w).Encode(map[string]any{
 			"data": []CollectionItem{
 				{ID: 1, Name: "Dashboard 1", Model: "dashboard"},
 			},
+			"total": 5,
 		})
 		require.NoError(t, err)
 	})
 
-	items, err := client.ListCollectionItems("1", nil)
+	items, err := client.ListCollectionItems(context.Background(), "1", []string{"dashboard", "card"}, Page{Limit: 1, Offset: 2})
 	require.NoError(t, err)
-	assert.Len(t, items, 1)
-	assert.Equal(t, "dashboard", items[0].Model)
+	assert.Len(t, items.Data, 1)
+	assert.Equal(t, "dashboard", items.Data[0].Model)
+	assert.Equal(t, 5, items.Total)
 }
@@ -1,11 +1,17 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
 
 // ListDashboards returns all dashboards.
-func (c *Client) ListDashboards() ([]Dashboard, error) {
+func (c *Client) ListDashboards(ctx context.Context) ([]Dashboard, error) {
 	var result []Dashboard
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/dashboard")
 	if err != nil {
@@ -18,9 +24,10 @@ func (c *Client) ListDashboards() ([]Dashboard, error) {
 }
 
 // GetDashboard returns a dashboard by ID.
-func (c *Client) GetDashboard(id int) (*Dashboard, error) {
+func (c *Client) GetDashboard(ctx context.Context, id int) (*Dashboard, error) {
 	var result Dashboard
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/dashboard/%d", id))
 	if err != nil {
@@ -29,13 +36,17 @@ func (c *Client) GetDashboard(id int) (*Dashboard, error) {
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
+	if len(result.DashCards) == 0 {
+		result.DashCards, result.OrderedCards = result.OrderedCards, nil
+	}
 	return &result, nil
 }
 
 // CreateDashboard creates a new dashboard.
-func (c *Client) CreateDashboard(dashboard *Dashboard) (*Dashboard, error) {
+func (c *Client) CreateDashboard(ctx context.Context, dashboard *Dashboard) (*Dashboard, error) {
 	var result Dashboard
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(dashboard).
 		SetResult(&result).
 		Post("/api/dashboard")
@@ -49,9 +60,10 @@ func (c *Client) CreateDashboard(dashboard *Dashboard) (*Dashboard, error) {
 }
 
 // UpdateDashboard updates an existing dashboard.
-func (c *Client) UpdateDashboard(id int, dashboard *Dashboard) (*Dashboard, error) {
+func (c *Client) UpdateDashboard(ctx context.Context, id int, dashboard *Dashboard) (*Dashboard, error) {
 	var result Dashboard
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(dashboard).
 		SetResult(&result).
 		Put(fmt.Sprintf("/api/dashboard/%d", id))
@@ -65,8 +77,9 @@ func (c *Client) UpdateDashboard(id int, dashboard *Dashboard) (*Dashboard, erro
 }
 
 // DeleteDashboard deletes a dashboard.
-func (c *Client) DeleteDashboard(id int) error {
+func (c *Client) DeleteDashboard(ctx context.Context, id int) error {
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		Delete(fmt.Sprintf("/api/dashboard/%d", id))
 	if err != nil {
 		return fmt.Errorf("delete dashboard: %w", err)
@@ -75,9 +88,18 @@ func (c *Client) DeleteDashboard(id int) error {
 }
 
 // AddCardToDashboard adds a card to a dashboard.
-func (c *Client) AddCardToDashboard(dashboardID int, dashCard *DashCard) (*DashCard, error) {
+func (c *Client) AddCardToDashboard(ctx context.Context, dashboardID int, dashCard *DashCard) (*DashCard, error) {
+	info, err := c.ServerInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("add card to dashboard: %w", err)
+	}
+	if info.Has(CapDashcards) {
+		return c.addDashcard(ctx, dashboardID, dashCard)
+	}
+
 	var result DashCard
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(dashCard).
 		SetResult(&result).
 		Post(fmt.Sprintf("/api/dashboard/%d/cards", dashboardID))
@@ -91,8 +113,24 @@ func (c *Client) AddCardToDashboard(dashboardID int, dashCard *DashCard) (*DashC
 }
 
 // RemoveCardFromDashboard removes a dashcard from a dashboard.
-func (c *Client) RemoveCardFromDashboard(dashboardID, dashCardID int) error {
+func (c *Client) RemoveCardFromDashboard(ctx context.Context, dashboardID, dashCardID int) error {
+	info, err := c.ServerInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("remove card from dashboard: %w", err)
+	}
+	if info.Has(CapDashcards) {
+		_, err := c.editDashcards(ctx, dashboardID, func(cards []map[string]any) ([]map[string]any, error) {
+			kept := slices.DeleteFunc(cards, func(dc map[string]any) bool { return dashcardID(dc) == dashCardID })
+			if len(kept) == len(cards) {
+				return nil, fmt.Errorf("dashcard %d not found on dashboard %d", dashCardID, dashboardID)
+			}
+			return kept, nil
+		})
+		return err
+	}
+
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		Delete(fmt.Sprintf("/api/dashboard/%d/cards?dashcardId=%d", dashboardID, dashCardID))
 	if err != nil {
 		return fmt.Errorf("remove card from dashboard: %w", err)
@@ -101,9 +139,29 @@ func (c *Client) RemoveCardFromDashboard(dashboardID, dashCardID int) error {
 }
 
 // UpdateDashboardCards updates the layout/positions of cards on a dashboard.
-func (c *Client) UpdateDashboardCards(dashboardID int, cards []DashCard) error {
+// On Metabase v0.47 and later, cards not listed are left as they are.
+func (c *Client) UpdateDashboardCards(ctx context.Context, dashboardID int, cards []DashCard) error {
+	info, err := c.ServerInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("update dashboard cards: %w", err)
+	}
+	if info.Has(CapDashcards) {
+		_, err := c.editDashcards(ctx, dashboardID, func(existing []map[string]any) ([]map[string]any, error) {
+			for _, update := range cards {
+				i := slices.IndexFunc(existing, func(dc map[string]any) bool { return dashcardID(dc) == update.ID })
+				if i < 0 {
+					return nil, fmt.Errorf("dashcard %d not found on dashboard %d", update.ID, dashboardID)
+				}
+				mergeDashcard(existing[i], update)
+			}
+			return existing, nil
+		})
+		return err
+	}
+
 	body := map[string]any{"cards": cards}
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(body).
 		Put(fmt.Sprintf("/api/dashboard/%d/cards", dashboardID))
 	if err != nil {
@@ -112,8 +170,120 @@ func (c *Client) UpdateDashboardCards(dashboardID int, cards []DashCard) error {
 	return checkResponse(resp)
 }
 
+// addDashcard adds a card to a dashboard by updating the dashboard with a
+// new dashcard, which Metabase recognizes by its negative ID.
+func (c *Client) addDashcard(ctx context.Context, dashboardID int, dashCard *DashCard) (*DashCard, error) {
+	data, err := json.Marshal(dashCard)
+	if err != nil {
+		return nil, err
+	}
+	var added map[string]any
+	if err := json.Unmarshal(data, &added); err != nil {
+		return nil, err
+	}
+	added["id"] = -1
+
+	var before []int
+	updated, err := c.editDashcards(ctx, dashboardID, func(cards []map[string]any) ([]map[string]any, error) {
+		for _, dc := range cards {
+			before = append(before, dashcardID(dc))
+		}
+		return append(cards, added), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, dc := range updated {
+		if !slices.Contains(before, dashcardID(dc)) {
+			var result DashCard
+			data, _ := json.Marshal(dc)
+			if err := json.Unmarshal(data, &result); err != nil {
+				return nil, fmt.Errorf("add card to dashboard: %w", err)
+			}
+			return &result, nil
+		}
+	}
+	return nil, fmt.Errorf("add card to dashboard: new dashcard missing from dashboard %d", dashboardID)
+}
+
+// editDashcards changes the cards of a dashboard on Metabase v0.47 and
+// later: it passes the dashcards to edit and saves what edit returns with
+// PUT /api/dashboard/:id. Dashcards are kept as raw JSON objects so that
+// fields this package does not model, such as dashboard_tab_id, survive.
+// It returns the dashcards Metabase saved.
+func (c *Client) editDashcards(ctx context.Context, dashboardID int, edit func([]map[string]any) ([]map[string]any, error)) ([]map[string]any, error) {
+	var dash struct {
+		DashCards []map[string]any `json:"dashcards"`
+		Tabs      []map[string]any `json:"tabs"`
+	}
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetResult(&dash).
+		Get(fmt.Sprintf("/api/dashboard/%d", dashboardID))
+	if err != nil {
+		return nil, fmt.Errorf("get dashboard: %w", err)
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	cards, err := edit(dash.DashCards)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]any{"dashcards": cards}
+	if dash.Tabs != nil {
+		body["tabs"] = dash.Tabs
+	}
+	var updated struct {
+		DashCards []map[string]any `json:"dashcards"`
+	}
+	resp, err = c.httpClient.R().
+		SetContext(ctx).
+		SetBody(body).
+		SetResult(&updated).
+		Put(fmt.Sprintf("/api/dashboard/%d", dashboardID))
+	if err != nil {
+		return nil, fmt.Errorf("update dashboard: %w", err)
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return updated.DashCards, nil
+}
+
+// dashcardID returns the id of a raw dashcard.
+func dashcardID(dc map[string]any) int {
+	id, _ := dc["id"].(float64)
+	return int(id)
+}
+
+// mergeDashcard applies the layout and set fields of update to dc.
+func mergeDashcard(dc map[string]any, update DashCard) {
+	dc["row"] = update.Row
+	dc["col"] = update.Col
+	if update.SizeX != 0 {
+		dc["size_x"] = update.SizeX
+	}
+	if update.SizeY != 0 {
+		dc["size_y"] = update.SizeY
+	}
+	if update.CardID != nil {
+		dc["card_id"] = *update.CardID
+	}
+	if update.Series != nil {
+		dc["series"] = update.Series
+	}
+	if update.ParameterMappings != nil {
+		dc["parameter_mappings"] = update.ParameterMappings
+	}
+	if update.VisualizationSettings != nil {
+		dc["visualization_settings"] = update.VisualizationSettings
+	}
+}
+
 // CopyDashboard copies a dashboard to a new collection.
-func (c *Client) CopyDashboard(id int, name string, description *string, collectionID *int) (*Dashboard, error) {
+func (c *Client) CopyDashboard(ctx context.Context, id int, name string, description *string, collectionID *int) (*Dashboard, error) {
 	body := map[string]any{"name": name}
 	if description != nil {
 		body["description"] = *description
@@ -123,6 +293,7 @@ func (c *Client) CopyDashboard(id int, name string, description *string, collect
 	}
 	var result Dashboard
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(body).
 		SetResult(&result).
 		Post(fmt.Sprintf("/api/dashboard/%d/copy", id))
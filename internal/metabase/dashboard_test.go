@@ -1,8 +1,11 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
+	"slices"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,7 +22,7 @@ func TestListDashboards(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	dashboards, err := client.ListDashboards()
+	dashboards, err := client.ListDashboards(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, dashboards, 1)
 }
@@ -32,7 +35,7 @@ func TestGetDashboard(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	dash, err := client.GetDashboard(1)
+	dash, err := client.GetDashboard(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "Sales", dash.Name)
 	assert.Len(t, dash.DashCards, 1)
@@ -46,7 +49,7 @@ func TestCreateDashboard(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	dash, err := client.CreateDashboard(&Dashboard{Name: "New Dash"})
+	dash, err := client.CreateDashboard(context.Background(), &Dashboard{Name: "New Dash"})
 	require.NoError(t, err)
 	assert.Equal(t, 10, dash.ID)
 }
@@ -57,7 +60,7 @@ func TestDeleteDashboard(t *testing.T) {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	err := client.DeleteDashboard(1)
+	err := client.DeleteDashboard(context.Background(), 1)
 	require.NoError(t, err)
 }
 
@@ -72,7 +75,7 @@ func TestAddCardToDashboard(t *testing.T) {
 	})
 
 	cardID := 5
-	dc, err := client.AddCardToDashboard(1, &DashCard{CardID: &cardID, Row: 0, Col: 0, SizeX: 6, SizeY: 4})
+	dc, err := client.AddCardToDashboard(context.Background(), 1, &DashCard{CardID: &cardID, Row: 0, Col: 0, SizeX: 6, SizeY: 4})
 	require.NoError(t, err)
 	assert.Equal(t, 1, dc.ID)
 }
@@ -84,7 +87,7 @@ func TestRemoveCardFromDashboard(t *testing.T) {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
-	err := client.RemoveCardFromDashboard(1, 10)
+	err := client.RemoveCardFromDashboard(context.Background(), 1, 10)
 	require.NoError(t, err)
 }
 
@@ -97,7 +100,99 @@ func TestCopyDashboard(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	dash, err := client.CopyDashboard(1, "Copy of Sales", nil, nil)
+	dash, err := client.CopyDashboard(context.Background(), 1, "Copy of Sales", nil, nil)
 	require.NoError(t, err)
 	assert.Equal(t, 20, dash.ID)
 }
+
+func TestGetDashboard_OrderedCards(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"name":"Sales","ordered_cards":[{"id":10,"card_id":5,"row":0,"col":0}]}`))
+	})
+
+	dash, err := client.GetDashboard(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, dash.DashCards, 1)
+	assert.Equal(t, 10, dash.DashCards[0].ID)
+	assert.Nil(t, dash.OrderedCards)
+}
+
+// fakeDashcardServer serves a dashboard the way Metabase v0.47 and later
+// does, where cards change through PUT /api/dashboard/:id. It records the
+// dashcards of each PUT.
+func fakeDashcardServer(t *testing.T, puts *[][]map[string]any) *Client {
+	t.Helper()
+	dashcards := []map[string]any{
+		{"id": 10, "card_id": 5, "row": 0, "col": 0, "size_x": 6, "size_y": 4, "dashboard_tab_id": 7},
+		{"id": 11, "card_id": 6, "row": 0, "col": 6, "size_x": 6, "size_y": 4, "dashboard_tab_id": 7},
+	}
+	_, client := newVersionedTestServer(t, "v0.50.2", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/dashboard/1", r.URL.Path, "the /cards endpoints are gone")
+		if r.Method == http.MethodPut {
+			var body struct {
+				DashCards []map[string]any `json:"dashcards"`
+				Tabs      []map[string]any `json:"tabs"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Len(t, body.Tabs, 1, "tabs are passed through unchanged")
+			*puts = append(*puts, body.DashCards)
+			dashcards = slices.Clone(body.DashCards)
+			for i, dc := range dashcards {
+				if dc["id"].(float64) < 0 {
+					dashcards[i] = maps.Clone(dc)
+					dashcards[i]["id"] = 12
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id": 1, "dashcards": dashcards, "tabs": []map[string]any{{"id": 7, "name": "Overview"}},
+		})
+	})
+	return client
+}
+
+func TestDashcards_UpdateDashboard(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("add", func(t *testing.T) {
+		var puts [][]map[string]any
+		client := fakeDashcardServer(t, &puts)
+		cardID := 8
+		dc, err := client.AddCardToDashboard(ctx, 1, &DashCard{CardID: &cardID, Row: 4, Col: 0, SizeX: 12, SizeY: 6})
+		require.NoError(t, err)
+		assert.Equal(t, 12, dc.ID)
+		assert.Equal(t, 8, *dc.CardID)
+		require.Len(t, puts, 1)
+		require.Len(t, puts[0], 3)
+		assert.InDelta(t, -1, puts[0][2]["id"], 0)
+		assert.InDelta(t, 7, puts[0][0]["dashboard_tab_id"], 0, "unmodeled fields survive")
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		var puts [][]map[string]any
+		client := fakeDashcardServer(t, &puts)
+		require.NoError(t, client.RemoveCardFromDashboard(ctx, 1, 10))
+		require.Len(t, puts, 1)
+		require.Len(t, puts[0], 1)
+		assert.InDelta(t, 11, puts[0][0]["id"], 0)
+
+		err := client.RemoveCardFromDashboard(ctx, 1, 99)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "dashcard 99 not found on dashboard 1")
+	})
+
+	t.Run("update layout", func(t *testing.T) {
+		var puts [][]map[string]any
+		client := fakeDashcardServer(t, &puts)
+		require.NoError(t, client.UpdateDashboardCards(ctx, 1, []DashCard{{ID: 11, Row: 4, Col: 0}}))
+		require.Len(t, puts, 1)
+		moved := puts[0][1]
+		assert.InDelta(t, 4, moved["row"], 0)
+		assert.InDelta(t, 0, moved["col"], 0)
+		assert.InDelta(t, 6, moved["size_x"], 0, "unset sizes are kept")
+		assert.InDelta(t, 6, moved["card_id"], 0)
+		assert.InDelta(t, 0, puts[0][0]["row"], 0, "unlisted cards are kept")
+	})
+}
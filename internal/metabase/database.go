@@ -1,13 +1,17 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListDatabases returns all connected databases.
-func (c *Client) ListDatabases() ([]Database, error) {
+func (c *Client) ListDatabases(ctx context.Context) ([]Database, error) {
 	var result struct {
 		Data []Database `json:"data"`
 	}
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/database")
 	if err != nil {
@@ -20,9 +24,10 @@ func (c *Client) ListDatabases() ([]Database, error) {
 }
 
 // GetDatabase returns a database by ID.
-func (c *Client) GetDatabase(id int) (*Database, error) {
+func (c *Client) GetDatabase(ctx context.Context, id int) (*Database, error) {
 	var result Database
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/database/%d", id))
 	if err != nil {
@@ -35,9 +40,10 @@ func (c *Client) GetDatabase(id int) (*Database, error) {
 }
 
 // GetDatabaseMetadata returns full metadata for a database.
-func (c *Client) GetDatabaseMetadata(id int) (*Database, error) {
+func (c *Client) GetDatabaseMetadata(ctx context.Context, id int) (*Database, error) {
 	var result Database
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/database/%d/metadata", id))
 	if err != nil {
@@ -50,11 +56,36 @@ func (c *Client) GetDatabaseMetadata(id int) (*Database, error) {
 }
 
 // SyncDatabase triggers a schema sync for a database.
-func (c *Client) SyncDatabase(id int) error {
+func (c *Client) SyncDatabase(ctx context.Context, id int) error {
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		Post(fmt.Sprintf("/api/database/%d/sync_schema", id))
 	if err != nil {
 		return fmt.Errorf("sync database: %w", err)
 	}
 	return checkResponse(resp)
 }
+
+// DatabaseEngine returns the engine of a database (e.g. "postgres"). The
+// result is cached since the engine of a database connection never changes.
+func (c *Client) DatabaseEngine(ctx context.Context, id int) (string, error) {
+	c.enginesMu.Lock()
+	engine, ok := c.engines[id]
+	c.enginesMu.Unlock()
+	if ok {
+		return engine, nil
+	}
+
+	db, err := c.GetDatabase(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	c.enginesMu.Lock()
+	if c.engines == nil {
+		c.engines = make(map[int]string)
+	}
+	c.engines[id] = db.Engine
+	c.enginesMu.Unlock()
+	return db.Engine, nil
+}
@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -22,7 +23,7 @@ func TestListDatabases(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	dbs, err := client.ListDatabases()
+	dbs, err := client.ListDatabases(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, dbs, 2)
 	assert.Equal(t, "H2", dbs[0].Name)
@@ -36,7 +37,7 @@ func TestGetDatabase(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	db, err := client.GetDatabase(1)
+	db, err := client.GetDatabase(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, 1, db.ID)
 	assert.Equal(t, "H2", db.Name)
@@ -53,7 +54,7 @@ func TestGetDatabaseMetadata(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	db, err := client.GetDatabaseMetadata(1)
+	db, err := client.GetDatabaseMetadata(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Len(t, db.Tables, 1)
 	assert.Equal(t, "USERS", db.Tables[0].Name)
@@ -66,6 +67,6 @@ func TestSyncDatabase(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	err := client.SyncDatabase(1)
+	err := client.SyncDatabase(context.Background(), 1)
 	require.NoError(t, err)
 }
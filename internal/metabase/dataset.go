@@ -1,11 +1,15 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ExecuteQuery executes a dataset query (native SQL or MBQL).
-func (c *Client) ExecuteQuery(req *DatasetQueryRequest) (*DatasetQueryResponse, error) {
+func (c *Client) ExecuteQuery(ctx context.Context, req *DatasetQueryRequest) (*DatasetQueryResponse, error) {
 	var result DatasetQueryResponse
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(req).
 		SetResult(&result).
 		Post("/api/dataset")
@@ -15,12 +19,16 @@ func (c *Client) ExecuteQuery(req *DatasetQueryRequest) (*DatasetQueryResponse,
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
+	if err := checkQueryResult(resp, &result); err != nil {
+		return nil, err
+	}
 	return &result, nil
 }
 
 // ExportQueryResults exports query results in the given format (csv, json, xlsx).
-func (c *Client) ExportQueryResults(req *DatasetQueryRequest, format string) ([]byte, error) {
+func (c *Client) ExportQueryResults(ctx context.Context, req *DatasetQueryRequest, format string) ([]byte, error) {
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetBody(req).
 		Post(fmt.Sprintf("/api/dataset/%s", format))
 	if err != nil {
@@ -31,3 +39,21 @@ func (c *Client) ExportQueryResults(req *DatasetQueryRequest, format string) ([]
 	}
 	return resp.Body(), nil
 }
+
+// CompileNativeQuery returns the native form of a query as Metabase would run
+// it, with template tags (parameters, snippets and card references) substituted.
+func (c *Client) CompileNativeQuery(ctx context.Context, req *DatasetQueryRequest) (*NativeForm, error) {
+	var result NativeForm
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetBody(req).
+		SetResult(&result).
+		Post("/api/dataset/native")
+	if err != nil {
+		return nil, fmt.Errorf("compile native query: %w", err)
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
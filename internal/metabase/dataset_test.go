@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -32,7 +33,7 @@ func TestExecuteQuery(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	result, err := client.ExecuteQuery(&DatasetQueryRequest{
+	result, err := client.ExecuteQuery(context.Background(), &DatasetQueryRequest{
 		Database: 1,
 		Type:     "native",
 		Native:   &NativeQuery{Query: "SELECT id FROM users"},
@@ -49,7 +50,7 @@ func TestExportQueryResults(t *testing.T) {
 		_, _ = w.Write([]byte("ID\n1\n2\n"))
 	})
 
-	data, err := client.ExportQueryResults(&DatasetQueryRequest{
+	data, err := client.ExportQueryResults(context.Background(), &DatasetQueryRequest{
 		Database: 1,
 		Type:     "native",
 		Native:   &NativeQuery{Query: "SELECT id FROM users"},
@@ -57,3 +58,27 @@ func TestExportQueryResults(t *testing.T) {
 	require.NoError(t, err)
 	assert.Contains(t, string(data), "ID")
 }
+
+func TestCompileNativeQuery(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/dataset/native", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		var body DatasetQueryRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "SELECT * FROM {{snippet: active}}", body.Native.Query)
+		assert.Len(t, body.Parameters, 1)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(NativeForm{Query: "SELECT * FROM users WHERE active"})
+	})
+
+	form, err := client.CompileNativeQuery(context.Background(), &DatasetQueryRequest{
+		Database:   1,
+		Type:       "native",
+		Native:     &NativeQuery{Query: "SELECT * FROM {{snippet: active}}"},
+		Parameters: []any{map[string]any{"type": "category", "value": "x"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM users WHERE active", form.Query)
+}
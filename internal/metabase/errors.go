@@ -0,0 +1,254 @@
+package metabase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// maxMessageLen caps the length of a plain-text error body kept as message.
+const maxMessageLen = 300
+
+// APIError is a failed Metabase API call: a non-2xx response, or a query
+// that Metabase accepted but could not run.
+type APIError struct {
+	// StatusCode is the HTTP status of the response. Failed queries are
+	// reported with a 2xx status by Metabase.
+	StatusCode int
+	Method     string
+	// Endpoint is the request path, such as /api/card/42.
+	Endpoint string
+	// Message is Metabase's description of the error, if it gave one.
+	Message string
+	// Errors holds Metabase's per-field validation errors.
+	Errors map[string]string
+	// ErrorType is Metabase's classification of a failed query, such as
+	// "invalid-query" or "missing-required-permissions".
+	ErrorType string
+}
+
+// Error implements error.
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "metabase API error (status %d) %s %s", e.StatusCode, e.Method, e.Endpoint)
+	if e.Message != "" {
+		b.WriteString(": ")
+		b.WriteString(e.Message)
+	}
+	if len(e.Errors) > 0 {
+		b.WriteString(": ")
+		b.WriteString(e.FieldErrors())
+	}
+	return b.String()
+}
+
+// FieldErrors formats Errors as "field: message" pairs sorted by field.
+func (e *APIError) FieldErrors() string {
+	fields := make([]string, 0, len(e.Errors))
+	for f := range e.Errors {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f + ": " + e.Errors[f]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// QueryFailed reports whether Metabase accepted a query but could not run
+// it, e.g. because of a syntax error.
+func (e *APIError) QueryFailed() bool {
+	return e.StatusCode < 300
+}
+
+// Resource names the object the endpoint addresses, e.g. "card 42" for
+// /api/card/42/query. It is empty for endpoints without an object ID.
+func (e *APIError) Resource() string {
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(e.Endpoint, "/api/"), "/"), "/")
+	for i := 1; i < len(segs); i++ {
+		if isID(segs[i]) {
+			return segs[i-1] + " " + segs[i]
+		}
+	}
+	if len(segs) == 2 {
+		return segs[0] + " " + segs[1]
+	}
+	return ""
+}
+
+func isID(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsNotFound reports whether err is a Metabase 404 response.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsForbidden reports whether err is Metabase refusing an action the
+// credentials are not permitted to perform.
+func IsForbidden(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusForbidden || apiErr.ErrorType == "missing-required-permissions"
+}
+
+// IsUnauthorized reports whether err is Metabase rejecting the credentials.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsRetryable reports whether the call that failed with err may succeed if
+// repeated: Metabase was overloaded or unavailable, or the connection
+// failed. Cancelled and timed-out calls, calls refused by the circuit
+// breaker and calls missing from a replayed cassette are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrNotRecorded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.StatusCode)
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryableStatus reports whether a response status means that Metabase
+// may answer the same request later.
+func retryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || unavailableStatus(status)
+}
+
+// unavailableStatus reports whether a response status means that Metabase,
+// or the proxy in front of it, is down or overloaded.
+func unavailableStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// checkResponse returns an *APIError if the API response indicates an error.
+func checkResponse(resp *resty.Response) error {
+	if !resp.IsError() {
+		return nil
+	}
+	apiErr := newAPIError(resp)
+	parseErrorBody(apiErr, resp.Body())
+	if apiErr.Message == "" && len(apiErr.Errors) == 0 {
+		apiErr.Message = http.StatusText(resp.StatusCode())
+	}
+	return apiErr
+}
+
+// checkQueryResult returns an *APIError if Metabase reports that a query
+// it accepted failed.
+func checkQueryResult(resp *resty.Response, result *DatasetQueryResponse) error {
+	if result.Status != "failed" {
+		return nil
+	}
+	apiErr := newAPIError(resp)
+	var body struct {
+		ErrorType string `json:"error_type"`
+	}
+	_ = json.Unmarshal(resp.Body(), &body)
+	apiErr.ErrorType = body.ErrorType
+	if result.Error != nil {
+		apiErr.Message = *result.Error
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = "query failed"
+	}
+	return apiErr
+}
+
+func newAPIError(resp *resty.Response) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode()}
+	if req := resp.Request; req != nil {
+		apiErr.Method = req.Method
+		apiErr.Endpoint = req.URL
+		if req.RawRequest != nil {
+			apiErr.Endpoint = req.RawRequest.URL.Path
+		}
+	}
+	return apiErr
+}
+
+// parseErrorBody fills Message and Errors from a Metabase error body, which
+// is either JSON with message and errors fields or plain text. HTML error
+// pages, e.g. from a proxy, are ignored.
+func parseErrorBody(apiErr *APIError, body []byte) {
+	text := strings.TrimSpace(string(body))
+	if text == "" || strings.HasPrefix(text, "<") {
+		return
+	}
+
+	var parsed struct {
+		Message any `json:"message"`
+		Error   any `json:"error"`
+		Errors  any `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		apiErr.Message = truncate(text)
+		return
+	}
+	if s, ok := parsed.Message.(string); ok {
+		apiErr.Message = truncate(s)
+	} else if s, ok := parsed.Error.(string); ok {
+		apiErr.Message = truncate(s)
+	}
+	switch errs := parsed.Errors.(type) {
+	case string:
+		if apiErr.Message == "" {
+			apiErr.Message = truncate(errs)
+		}
+	case map[string]any:
+		apiErr.Errors = make(map[string]string, len(errs))
+		for field, v := range errs {
+			if s, ok := v.(string); ok {
+				apiErr.Errors[field] = truncate(s)
+			} else {
+				data, _ := json.Marshal(v)
+				apiErr.Errors[field] = truncate(string(data))
+			}
+		}
+	}
+}
+
+// truncate shortens s to maxMessageLen bytes without splitting a character.
+func truncate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= maxMessageLen {
+		return s
+	}
+	cut := maxMessageLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
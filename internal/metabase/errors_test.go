@@ -0,0 +1,166 @@
+package metabase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIError_FromResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		path        string
+		want        APIError
+		notFound    bool
+		forbidden   bool
+		retryable   bool
+	}{
+		{
+			name:     "plain text not found",
+			status:   http.StatusNotFound,
+			body:     "Not found.",
+			path:     "/api/card/42",
+			want:     APIError{StatusCode: 404, Method: "GET", Endpoint: "/api/card/42", Message: "Not found."},
+			notFound: true,
+		},
+		{
+			name:      "permission denied",
+			status:    http.StatusForbidden,
+			body:      "You don't have permissions to do that.",
+			path:      "/api/card/7",
+			want:      APIError{StatusCode: 403, Method: "GET", Endpoint: "/api/card/7", Message: "You don't have permissions to do that."},
+			forbidden: true,
+		},
+		{
+			name:        "json field errors",
+			status:      http.StatusBadRequest,
+			contentType: "application/json",
+			body:        `{"errors":{"name":"value must be a non-blank string.","display":"value must be one of: table, bar."},"specific-errors":{}}`,
+			path:        "/api/card/7",
+			want: APIError{StatusCode: 400, Method: "GET", Endpoint: "/api/card/7", Errors: map[string]string{
+				"name":    "value must be a non-blank string.",
+				"display": "value must be one of: table, bar.",
+			}},
+		},
+		{
+			name:        "json message",
+			status:      http.StatusInternalServerError,
+			contentType: "application/json",
+			body:        `{"message":"Column \"foo\" not found","via":[{"type":"java.lang.Exception"}],"trace":["a","b"]}`,
+			path:        "/api/database/1/metadata",
+			want:        APIError{StatusCode: 500, Method: "GET", Endpoint: "/api/database/1/metadata", Message: `Column "foo" not found`},
+		},
+		{
+			name:        "html from a proxy",
+			status:      http.StatusBadGateway,
+			contentType: "text/html",
+			body:        "<html><body><h1>502 Bad Gateway</h1></body></html>",
+			path:        "/api/card",
+			want:        APIError{StatusCode: 502, Method: "GET", Endpoint: "/api/card", Message: "Bad Gateway"},
+			retryable:   true,
+		},
+		{
+			name:      "rate limited without body",
+			status:    http.StatusTooManyRequests,
+			path:      "/api/search",
+			want:      APIError{StatusCode: 429, Method: "GET", Endpoint: "/api/search", Message: "Too Many Requests"},
+			retryable: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, client := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			})
+
+			resp, err := client.httpClient.R().Get(tt.path)
+			require.NoError(t, err)
+			err = checkResponse(resp)
+			require.Error(t, err)
+
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.want, *apiErr)
+			assert.Equal(t, tt.notFound, IsNotFound(err))
+			assert.Equal(t, tt.forbidden, IsForbidden(err))
+			assert.Equal(t, tt.retryable, IsRetryable(err))
+			assert.NotContains(t, err.Error(), "<html>")
+		})
+	}
+}
+
+func TestAPIError_LongBodyTruncated(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(strings.Repeat("é", 1000)))
+	})
+
+	_, err := client.ListCards(context.Background(), Page{})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.LessOrEqual(t, len(apiErr.Message), maxMessageLen+len("..."))
+	assert.True(t, strings.HasSuffix(apiErr.Message, "..."))
+	assert.True(t, strings.HasPrefix(apiErr.Message, "éé"))
+}
+
+func TestAPIError_QueryFailed(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"status":"failed","error":"ERROR: syntax error at or near \"SELEC\"","error_type":"invalid-query","row_count":0,"data":{"rows":[],"cols":[]}}`))
+	})
+
+	_, err := client.ExecuteQuery(context.Background(), &DatasetQueryRequest{Database: 1, Type: "native"})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.True(t, apiErr.QueryFailed())
+	assert.Equal(t, "invalid-query", apiErr.ErrorType)
+	assert.Equal(t, `ERROR: syntax error at or near "SELEC"`, apiErr.Message)
+	assert.Equal(t, "/api/dataset", apiErr.Endpoint)
+	assert.False(t, IsRetryable(err))
+}
+
+func TestAPIError_Resource(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"/api/card/42", "card 42"},
+		{"/api/card/42/query", "card 42"},
+		{"/api/dashboard/3/cards", "dashboard 3"},
+		{"/api/permissions/group/5", "group 5"},
+		{"/api/setting/site-name", "setting site-name"},
+		{"/api/collection/root/items", ""},
+		{"/api/dataset", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			assert.Equal(t, tt.want, (&APIError{Endpoint: tt.endpoint}).Resource())
+		})
+	}
+}
+
+func TestIsRetryable_TransportErrors(t *testing.T) {
+	connErr := fmt.Errorf("list cards: %w", &url.Error{Op: "Get", URL: "http://mb/api/card", Err: errors.New("connection refused")})
+	assert.True(t, IsRetryable(connErr))
+
+	cancelled := fmt.Errorf("list cards: %w", &url.Error{Op: "Get", URL: "http://mb/api/card", Err: context.Canceled})
+	assert.False(t, IsRetryable(cancelled))
+	assert.False(t, IsRetryable(errors.New("something else")))
+	assert.False(t, IsRetryable(nil))
+}
@@ -1,11 +1,15 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // GetField returns field details by ID.
-func (c *Client) GetField(id int) (*Field, error) {
+func (c *Client) GetField(ctx context.Context, id int) (*Field, error) {
 	var result Field
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/field/%d", id))
 	if err != nil {
@@ -18,9 +22,10 @@ func (c *Client) GetField(id int) (*Field, error) {
 }
 
 // GetFieldValues returns distinct values for a field.
-func (c *Client) GetFieldValues(id int) (*FieldValues, error) {
+func (c *Client) GetFieldValues(ctx context.Context, id int) (*FieldValues, error) {
 	var result FieldValues
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/field/%d/values", id))
 	if err != nil {
@@ -33,9 +38,10 @@ func (c *Client) GetFieldValues(id int) (*FieldValues, error) {
 }
 
 // SearchFieldValues searches distinct values for a field by prefix.
-func (c *Client) SearchFieldValues(id int, query string, limit int) (*FieldValues, error) {
+func (c *Client) SearchFieldValues(ctx context.Context, id int, query string, limit int) (*FieldValues, error) {
 	var result FieldValues
 	req := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		SetQueryParam("value", query)
 	if limit > 0 {
@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -17,7 +18,7 @@ func TestGetField(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	field, err := client.GetField(1)
+	field, err := client.GetField(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "EMAIL", field.Name)
 }
@@ -33,7 +34,7 @@ func TestGetFieldValues(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	fv, err := client.GetFieldValues(1)
+	fv, err := client.GetFieldValues(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, 1, fv.FieldID)
 	assert.Len(t, fv.Values, 2)
@@ -51,7 +52,7 @@ func TestSearchFieldValues(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	fv, err := client.SearchFieldValues(1, "alice", 10)
+	fv, err := client.SearchFieldValues(context.Background(), 1, "alice", 10)
 	require.NoError(t, err)
 	assert.Len(t, fv.Values, 1)
 }
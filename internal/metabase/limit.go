@@ -0,0 +1,191 @@
+package metabase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// limitableEngines lists the engines whose SQL accepts a query wrapped in a
+// derived table with a trailing LIMIT clause, CTEs included.
+var limitableEngines = map[string]bool{
+	"postgres":           true,
+	"redshift":           true,
+	"mysql":              true,
+	"bigquery":           true,
+	"bigquery-cloud-sdk": true,
+	"snowflake":          true,
+	"h2":                 true,
+	"sqlite":             true,
+}
+
+// LimitNativeSQL wraps a single SELECT or WITH statement so that it returns
+// at most limit rows. It reports false, returning sql unchanged, when the
+// engine has no known LIMIT syntax or the query cannot be wrapped safely
+// (multiple statements, SHOW/EXPLAIN, a select list naming a column twice,
+// or text that lexes differently under the engine's dialects). Trailing comments and semicolons are dropped so
+// they cannot swallow the closing parenthesis.
+func LimitNativeSQL(engine, sql string, limit int) (string, bool) {
+	engine = strings.ToLower(engine)
+	if !limitableEngines[engine] || limit <= 0 {
+		return sql, false
+	}
+
+	end := -1
+	for _, d := range PolicyForEngine(engine).dialects {
+		toks, lexErr := lexSQL(sql, d)
+		if lexErr != nil {
+			return sql, false
+		}
+		stmts := splitStatements(toks)
+		if len(stmts) != 1 || !isSelectStatement(stmts[0]) || hasDuplicateColumns(stmts[0]) {
+			return sql, false
+		}
+		last := stmts[0][len(stmts[0])-1]
+		stmtEnd := last.offset + len(last.text)
+		if end >= 0 && stmtEnd != end {
+			return sql, false
+		}
+		end = stmtEnd
+	}
+
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) AS mcp_limited LIMIT %d", sql[:end], limit), true
+}
+
+// isSelectStatement reports whether stmt is a query that can be used as a
+// derived table.
+func isSelectStatement(stmt []token) bool {
+	for _, t := range stmt {
+		if t.kind == tokPunct && t.text == "(" {
+			continue
+		}
+		return t.kind == tokWord && (strings.EqualFold(t.text, "SELECT") || strings.EqualFold(t.text, "WITH"))
+	}
+	return false
+}
+
+// selectListEnd are the keywords that end a select list.
+var selectListEnd = []string{"FROM", "INTO", "WHERE", "GROUP", "HAVING", "WINDOW", "ORDER", "LIMIT", "UNION", "INTERSECT", "EXCEPT"}
+
+// hasDuplicateColumns reports whether the outermost select list of stmt
+// names an output column twice, as in "SELECT a.id, b.id", which most
+// engines reject in a derived table. Only column names and aliases are
+// compared; the columns of * and unaliased expressions are unknown.
+func hasDuplicateColumns(stmt []token) bool {
+	start, depth := -1, 0
+	for i, t := range stmt {
+		if t.kind == tokPunct {
+			depth += parenDepth(t)
+		} else if depth == 0 && t.kind == tokWord && strings.EqualFold(t.text, "SELECT") {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return false
+	}
+
+	seen := make(map[string]bool)
+	var item []token
+	duplicate := func() bool {
+		name := columnName(item)
+		item = nil
+		if name == "" {
+			return false
+		}
+		if seen[name] {
+			return true
+		}
+		seen[name] = true
+		return false
+	}
+	depth = 0
+	for _, t := range stmt[start:] {
+		if t.kind == tokPunct {
+			if depth += parenDepth(t); depth < 0 {
+				break
+			}
+			if depth == 0 && t.text == "," {
+				if duplicate() {
+					return true
+				}
+				continue
+			}
+		}
+		if depth == 0 && t.kind == tokWord && containsFold(selectListEnd, t.text) {
+			break
+		}
+		item = append(item, t)
+	}
+	return duplicate()
+}
+
+// parenDepth returns how a punctuation token changes the nesting depth.
+func parenDepth(t token) int {
+	switch t.text {
+	case "(":
+		return 1
+	case ")":
+		return -1
+	}
+	return 0
+}
+
+// columnName returns the lower-cased output name of a select list item: its
+// alias, or the column it selects. It returns "" when the name is unknown.
+func columnName(item []token) string {
+	if len(item) == 0 {
+		return ""
+	}
+	last := item[len(item)-1]
+	// x::int is named after x, not the type.
+	if len(item) > 1 && strings.HasSuffix(item[len(item)-2].text, ":") {
+		return ""
+	}
+	switch last.kind {
+	case tokWord:
+		// CASE ... END is named by the engine, not after END.
+		if strings.EqualFold(last.text, "END") {
+			return ""
+		}
+		return strings.ToLower(last.text)
+	case tokQuotedIdent:
+		return strings.ToLower(unquoteIdent(last.text))
+	}
+	return ""
+}
+
+// IsLimitFailure reports whether err is a query failure that the derived
+// table of LimitNativeSQL can cause when the query itself runs: the engine
+// rejecting duplicate or ambiguous column names, such as those of
+// "SELECT * FROM a JOIN b".
+func IsLimitFailure(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.QueryFailed() {
+		return false
+	}
+	msg := strings.ToLower(apiErr.Message)
+	for _, s := range []string{"duplicate column", "ambiguous column", "is ambiguous", "specified more than once"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitNativeQuery is the package-level LimitNativeQuery for c.
+func (c *Client) LimitNativeQuery(ctx context.Context, databaseID int, sql string, limit int) (string, bool) {
+	return LimitNativeQuery(ctx, c, databaseID, sql, limit)
+}
+
+// LimitNativeQuery applies LimitNativeSQL using the engine of the given
+// database, looked up through api. It reports false if the engine cannot be
+// determined.
+func LimitNativeQuery(ctx context.Context, api API, databaseID int, sql string, limit int) (string, bool) {
+	engine, err := api.DatabaseEngine(ctx, databaseID)
+	if err != nil {
+		return sql, false
+	}
+	return LimitNativeSQL(engine, sql, limit)
+}
@@ -0,0 +1,99 @@
+package metabase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitNativeSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		engine string
+		sql    string
+		want   string
+		wantOK bool
+	}{
+		{name: "select", engine: "postgres", sql: "SELECT * FROM users",
+			want: "SELECT * FROM (\nSELECT * FROM users\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "trailing semicolon and comment", engine: "postgres", sql: "SELECT 1; -- done",
+			want: "SELECT * FROM (\nSELECT 1\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "mysql hash comment", engine: "mysql", sql: "SELECT 1 # note",
+			want: "SELECT * FROM (\nSELECT 1\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "cte", engine: "snowflake", sql: "WITH a AS (SELECT 1) SELECT * FROM a",
+			want: "SELECT * FROM (\nWITH a AS (SELECT 1) SELECT * FROM a\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "parenthesized union", engine: "bigquery-cloud-sdk", sql: "(SELECT 1) UNION ALL (SELECT 2)",
+			want: "SELECT * FROM (\n(SELECT 1) UNION ALL (SELECT 2)\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "engine case", engine: "H2", sql: "SELECT 1",
+			want: "SELECT * FROM (\nSELECT 1\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "distinct column names", engine: "mysql", sql: "SELECT a.id, b.id AS b_id FROM a JOIN b ON a.b_id = b.id",
+			want: "SELECT * FROM (\nSELECT a.id, b.id AS b_id FROM a JOIN b ON a.b_id = b.id\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "casts and expressions", engine: "postgres", sql: "SELECT a::int, b::int, count(*), count(*) FROM t GROUP BY 1, 2",
+			want: "SELECT * FROM (\nSELECT a::int, b::int, count(*), count(*) FROM t GROUP BY 1, 2\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "duplicates inside a cte", engine: "h2", sql: "WITH c AS (SELECT 1 a, 2 a) SELECT 1 FROM c",
+			want: "SELECT * FROM (\nWITH c AS (SELECT 1 a, 2 a) SELECT 1 FROM c\n) AS mcp_limited LIMIT 10", wantOK: true},
+		{name: "duplicate column names", engine: "mysql", sql: "SELECT a.id, b.id FROM a JOIN b ON a.b_id = b.id"},
+		{name: "duplicate aliases", engine: "h2", sql: "SELECT 1 AS x, 2 \"X\""},
+		{name: "duplicate quoted names", engine: "mysql", sql: "WITH c AS (SELECT 1) SELECT `a`.`id`, id FROM a"},
+		{name: "show", engine: "mysql", sql: "SHOW TABLES"},
+		{name: "explain", engine: "postgres", sql: "EXPLAIN SELECT 1"},
+		{name: "multiple statements", engine: "postgres", sql: "SELECT 1; SELECT 2"},
+		{name: "sql server", engine: "sqlserver", sql: "SELECT 1"},
+		{name: "unknown engine", engine: "oracle", sql: "SELECT 1"},
+		{name: "dialect dependent end", engine: "postgres", sql: `SELECT 'a\' -- '`},
+		{name: "unterminated", engine: "postgres", sql: "SELECT 'a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := LimitNativeSQL(tt.engine, tt.sql, 10)
+			require.Equal(t, tt.wantOK, ok)
+			if !ok {
+				assert.Equal(t, tt.sql, got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, PolicyForEngine(tt.engine).Validate(got))
+		})
+	}
+}
+
+func TestLimitNativeQuery(t *testing.T) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/database/1" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(Database{ID: 1, Engine: "postgres"})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	got, ok := client.LimitNativeQuery(context.Background(), 1, "SELECT 1", 5)
+	assert.True(t, ok)
+	assert.Contains(t, got, "LIMIT 5")
+
+	got, ok = client.LimitNativeQuery(context.Background(), 2, "SELECT 1", 5)
+	assert.False(t, ok)
+	assert.Equal(t, "SELECT 1", got)
+}
+
+func TestIsLimitFailure(t *testing.T) {
+	failed := func(msg string) error {
+		return &APIError{StatusCode: http.StatusAccepted, Message: msg, ErrorType: "invalid-query"}
+	}
+	assert.True(t, IsLimitFailure(failed("Duplicate column name 'id'")))
+	assert.True(t, IsLimitFailure(failed(`Duplicate column name "ID"; SQL statement:`)))
+	assert.True(t, IsLimitFailure(failed("ambiguous column name 'ID'")))
+	assert.True(t, IsLimitFailure(fmt.Errorf("run: %w", failed(`column reference "id" is ambiguous`))))
+
+	assert.False(t, IsLimitFailure(failed("You have an error in your SQL syntax")))
+	assert.False(t, IsLimitFailure(failed("Query cancelled")))
+	assert.False(t, IsLimitFailure(&APIError{StatusCode: http.StatusForbidden, Message: "Duplicate column name 'id'"}))
+	assert.False(t, IsLimitFailure(errors.New("duplicate column")))
+}
@@ -0,0 +1,484 @@
+package metabasefake
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// routes registers the Metabase API endpoints.
+func (s *Server) routes() {
+	s.handlePublic("GET /api/health", func(*http.Request) (any, error) {
+		return map[string]string{"status": "ok"}, nil
+	})
+	s.handlePublic("POST /api/session", s.login)
+	s.handlePublic("GET /api/session/properties", s.sessionProperties)
+	s.handleStatus("DELETE /api/session", http.StatusNoContent, s.logout)
+
+	s.cardRoutes()
+	s.dashboardRoutes()
+	s.collectionRoutes()
+	s.dataRoutes()
+	s.datasetRoutes()
+	s.miscRoutes()
+}
+
+func (s *Server) login(r *http.Request) (any, error) {
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := decode(r, &body); err != nil {
+		return nil, err
+	}
+	if want, ok := s.passwords[body.Username]; !ok || want != body.Password {
+		return nil, &metabase.APIError{StatusCode: http.StatusUnauthorized, Errors: map[string]string{"password": "did not match stored password"}}
+	}
+	id := newSessionID()
+	s.mu.Lock()
+	s.sessions[id] = body.Username
+	s.mu.Unlock()
+	return map[string]string{"id": id}, nil
+}
+
+func (s *Server) logout(r *http.Request) (any, error) {
+	s.mu.Lock()
+	delete(s.sessions, r.Header.Get("X-Metabase-Session"))
+	s.mu.Unlock()
+	return nil, nil
+}
+
+func (s *Server) sessionProperties(r *http.Request) (any, error) {
+	info, err := s.fake.ServerInfo(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	features := make(map[string]bool)
+	for _, f := range info.Features {
+		features[f] = true
+	}
+	return map[string]any{
+		"version":         map[string]string{"tag": info.Version.Tag},
+		"token-features":  features,
+		"session-timeout": nil,
+	}, nil
+}
+
+func (s *Server) cardRoutes() {
+	s.handle("GET /api/card", func(r *http.Request) (any, error) {
+		// Metabase does not paginate cards.
+		cards, err := s.fake.ListCards(r.Context(), metabase.Page{})
+		if err != nil {
+			return nil, err
+		}
+		return cards.Data, nil
+	})
+	s.handle("POST /api/card", func(r *http.Request) (any, error) {
+		var card metabase.Card
+		if err := decode(r, &card); err != nil {
+			return nil, err
+		}
+		return s.fake.CreateCard(r.Context(), &card)
+	})
+	s.handle("GET /api/card/{id}", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		return s.fake.GetCard(r.Context(), id)
+	})
+	s.handle("PUT /api/card/{id}", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		var card metabase.Card
+		if err := decode(r, &card); err != nil {
+			return nil, err
+		}
+		return s.fake.UpdateCard(r.Context(), id, &card)
+	})
+	s.handle("DELETE /api/card/{id}", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.fake.DeleteCard(r.Context(), id)
+	})
+	s.handleStatus("POST /api/card/{id}/query", http.StatusAccepted, func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		var params map[string]any
+		if err := decode(r, &params); err != nil {
+			return nil, err
+		}
+		return s.fake.ExecuteCardQuery(r.Context(), id, params)
+	})
+}
+
+func (s *Server) dashboardRoutes() {
+	s.handle("GET /api/dashboard", func(r *http.Request) (any, error) {
+		return s.fake.ListDashboards(r.Context())
+	})
+	s.handle("POST /api/dashboard", func(r *http.Request) (any, error) {
+		var dashboard metabase.Dashboard
+		if err := decode(r, &dashboard); err != nil {
+			return nil, err
+		}
+		return s.fake.CreateDashboard(r.Context(), &dashboard)
+	})
+	s.handle("GET /api/dashboard/{id}", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		dashboard, err := s.fake.GetDashboard(r.Context(), id)
+		if err != nil {
+			return nil, err
+		}
+		if !s.has(r, metabase.CapDashcards) {
+			// Before v0.47, Metabase called dashcards ordered_cards.
+			dashboard.OrderedCards, dashboard.DashCards = dashboard.DashCards, nil
+		}
+		return dashboard, nil
+	})
+	s.handle("PUT /api/dashboard/{id}", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		var dashboard metabase.Dashboard
+		if err := decode(r, &dashboard); err != nil {
+			return nil, err
+		}
+		return s.fake.UpdateDashboard(r.Context(), id, &dashboard)
+	})
+	s.handle("DELETE /api/dashboard/{id}", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.fake.DeleteDashboard(r.Context(), id)
+	})
+	s.handle("POST /api/dashboard/{id}/copy", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Name         string  `json:"name"`
+			Description  *string `json:"description"`
+			CollectionID *int    `json:"collection_id"`
+		}
+		if err := decode(r, &body); err != nil {
+			return nil, err
+		}
+		return s.fake.CopyDashboard(r.Context(), id, body.Name, body.Description, body.CollectionID)
+	})
+
+	// The dashcard endpoints of Metabase before v0.47.
+	s.handle("POST /api/dashboard/{id}/cards", func(r *http.Request) (any, error) {
+		id, err := s.legacyDashboardID(r)
+		if err != nil {
+			return nil, err
+		}
+		var dc metabase.DashCard
+		if err := decode(r, &dc); err != nil {
+			return nil, err
+		}
+		return s.fake.AddCardToDashboard(r.Context(), id, &dc)
+	})
+	s.handle("PUT /api/dashboard/{id}/cards", func(r *http.Request) (any, error) {
+		id, err := s.legacyDashboardID(r)
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Cards []metabase.DashCard `json:"cards"`
+		}
+		if err := decode(r, &body); err != nil {
+			return nil, err
+		}
+		if err := s.fake.UpdateDashboardCards(r.Context(), id, body.Cards); err != nil {
+			return nil, err
+		}
+		return map[string]string{"status": "ok"}, nil
+	})
+	s.handle("DELETE /api/dashboard/{id}/cards", func(r *http.Request) (any, error) {
+		id, err := s.legacyDashboardID(r)
+		if err != nil {
+			return nil, err
+		}
+		dashcardID, err := strconv.Atoi(r.URL.Query().Get("dashcardId"))
+		if err != nil {
+			return nil, &metabase.APIError{StatusCode: http.StatusBadRequest, Errors: map[string]string{"dashcardId": "value must be an integer greater than zero."}}
+		}
+		return nil, s.fake.RemoveCardFromDashboard(r.Context(), id, dashcardID)
+	})
+}
+
+// legacyDashboardID returns the dashboard ID of a request to a pre-v0.47
+// dashcard endpoint, which is not found on later versions.
+func (s *Server) legacyDashboardID(r *http.Request) (int, error) {
+	if s.has(r, metabase.CapDashcards) {
+		return 0, &metabase.APIError{StatusCode: http.StatusNotFound}
+	}
+	return pathID(r, "id")
+}
+
+// has reports whether the served Metabase version has capability c.
+func (s *Server) has(r *http.Request, c metabase.Capability) bool {
+	info, err := s.fake.ServerInfo(r.Context())
+	return err == nil && info.Has(c)
+}
+
+func (s *Server) collectionRoutes() {
+	s.handle("GET /api/collection", func(r *http.Request) (any, error) {
+		return s.fake.ListCollections(r.Context(), r.URL.Query().Get("namespace"))
+	})
+	s.handle("POST /api/collection", func(r *http.Request) (any, error) {
+		var c metabase.Collection
+		if err := decode(r, &c); err != nil {
+			return nil, err
+		}
+		return s.fake.CreateCollection(r.Context(), &c)
+	})
+	s.handle("GET /api/collection/{id}", func(r *http.Request) (any, error) {
+		return s.fake.GetCollection(r.Context(), r.PathValue("id"))
+	})
+	s.handle("PUT /api/collection/{id}", func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		var c metabase.Collection
+		if err := decode(r, &c); err != nil {
+			return nil, err
+		}
+		return s.fake.UpdateCollection(r.Context(), id, &c)
+	})
+	s.handle("GET /api/collection/{id}/items", func(r *http.Request) (any, error) {
+		page, err := pageParams(r)
+		if err != nil {
+			return nil, err
+		}
+		return s.fake.ListCollectionItems(r.Context(), r.PathValue("id"), r.URL.Query()["models"], page)
+	})
+}
+
+func (s *Server) dataRoutes() {
+	s.handle("GET /api/database", func(r *http.Request) (any, error) {
+		dbs, err := s.fake.ListDatabases(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"data": dbs, "total": len(dbs)}, nil
+	})
+	s.handle("GET /api/database/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetDatabase(r.Context(), id)
+	}))
+	s.handle("GET /api/database/{id}/metadata", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetDatabaseMetadata(r.Context(), id)
+	}))
+	s.handle("GET /api/database/{id}/metadata/tables", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.ListTables(r.Context(), id)
+	}))
+	s.handle("POST /api/database/{id}/sync_schema", s.byID(func(r *http.Request, id int) (any, error) {
+		return map[string]string{"status": "ok"}, s.fake.SyncDatabase(r.Context(), id)
+	}))
+	s.handle("GET /api/table/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetTable(r.Context(), id)
+	}))
+	s.handle("GET /api/table/{id}/query_metadata", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetTableMetadata(r.Context(), id)
+	}))
+	s.handle("GET /api/table/{id}/fks", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetTableForeignKeys(r.Context(), id)
+	}))
+	s.handle("GET /api/field/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetField(r.Context(), id)
+	}))
+	s.handle("GET /api/field/{id}/values", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetFieldValues(r.Context(), id)
+	}))
+	s.handle("GET /api/field/{id}/search/{searchID}", s.byID(func(r *http.Request, id int) (any, error) {
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		return s.fake.SearchFieldValues(r.Context(), id, r.URL.Query().Get("value"), limit)
+	}))
+}
+
+// pageParams returns the page selected by the limit and offset query
+// parameters of r.
+func pageParams(r *http.Request) (metabase.Page, error) {
+	var page metabase.Page
+	for name, v := range map[string]*int{"limit": &page.Limit, "offset": &page.Offset} {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return page, &metabase.APIError{StatusCode: http.StatusBadRequest, Errors: map[string]string{name: "value must be an integer greater than or equal to zero."}}
+		}
+		*v = n
+	}
+	return page, nil
+}
+
+// byID adapts h to the handlers of /api/<kind>/{id} endpoints.
+func (s *Server) byID(h func(r *http.Request, id int) (any, error)) handler {
+	return func(r *http.Request) (any, error) {
+		id, err := pathID(r, "id")
+		if err != nil {
+			return nil, err
+		}
+		return h(r, id)
+	}
+}
+
+func (s *Server) datasetRoutes() {
+	s.handleStatus("POST /api/dataset", http.StatusAccepted, func(r *http.Request) (any, error) {
+		var req metabase.DatasetQueryRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return s.fake.ExecuteQuery(r.Context(), &req)
+	})
+	s.handle("POST /api/dataset/native", func(r *http.Request) (any, error) {
+		var req metabase.DatasetQueryRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		return s.fake.CompileNativeQuery(r.Context(), &req)
+	})
+	s.handle("POST /api/dataset/{format}", func(r *http.Request) (any, error) {
+		var req metabase.DatasetQueryRequest
+		if err := decode(r, &req); err != nil {
+			return nil, err
+		}
+		format := r.PathValue("format")
+		data, err := s.fake.ExportQueryResults(r.Context(), &req, format)
+		if err != nil {
+			return nil, err
+		}
+		contentType := "application/json"
+		if format == "csv" {
+			contentType = "text/csv"
+		}
+		return rawBody{contentType: contentType, data: data}, nil
+	})
+}
+
+func (s *Server) miscRoutes() {
+	s.handle("GET /api/user", func(r *http.Request) (any, error) {
+		page, err := pageParams(r)
+		if err != nil {
+			return nil, err
+		}
+		return s.fake.ListUsers(r.Context(), page)
+	})
+	s.handle("GET /api/user/current", s.currentUser)
+	s.handle("GET /api/user/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetUser(r.Context(), id)
+	}))
+
+	s.handle("GET /api/permissions/group", func(r *http.Request) (any, error) {
+		return s.fake.ListPermissionGroups(r.Context())
+	})
+	s.handle("GET /api/permissions/group/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetPermissionGroup(r.Context(), id)
+	}))
+	s.handle("GET /api/permissions/graph", func(r *http.Request) (any, error) {
+		return s.fake.GetPermissionsGraph(r.Context())
+	})
+
+	s.handle("GET /api/search", func(r *http.Request) (any, error) {
+		page, err := pageParams(r)
+		if err != nil {
+			return nil, err
+		}
+		return s.fake.Search(r.Context(), r.URL.Query().Get("q"), r.URL.Query()["models"], page)
+	})
+
+	s.handle("GET /api/alert", func(r *http.Request) (any, error) {
+		return s.fake.ListAlerts(r.Context())
+	})
+	s.handle("POST /api/alert", func(r *http.Request) (any, error) {
+		var alert metabase.Alert
+		if err := decode(r, &alert); err != nil {
+			return nil, err
+		}
+		return s.fake.CreateAlert(r.Context(), &alert)
+	})
+	s.handle("GET /api/alert/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetAlert(r.Context(), id)
+	}))
+
+	s.handle("GET /api/setting", func(r *http.Request) (any, error) {
+		return s.fake.ListSettings(r.Context())
+	})
+	s.handle("GET /api/setting/{key}", func(r *http.Request) (any, error) {
+		return s.fake.GetSetting(r.Context(), r.PathValue("key"))
+	})
+
+	s.handle("GET /api/activity", func(r *http.Request) (any, error) {
+		// Metabase does not paginate the activity log.
+		activity, err := s.fake.GetActivity(r.Context(), metabase.Page{})
+		if err != nil {
+			return nil, err
+		}
+		return activity.Data, nil
+	})
+	s.handle("GET /api/activity/recent_views", func(r *http.Request) (any, error) {
+		return s.fake.GetRecentViews(r.Context())
+	})
+
+	s.handle("GET /api/action", func(r *http.Request) (any, error) {
+		modelID, _ := strconv.Atoi(r.URL.Query().Get("model-id"))
+		return s.fake.ListActions(r.Context(), modelID)
+	})
+	s.handle("GET /api/action/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetAction(r.Context(), id)
+	}))
+
+	s.handle("GET /api/timeline", func(r *http.Request) (any, error) {
+		var collectionID *int
+		if v := r.URL.Query().Get("collection_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, &metabase.APIError{StatusCode: http.StatusBadRequest, Errors: map[string]string{"collection_id": "value must be an integer."}}
+			}
+			collectionID = &id
+		}
+		return s.fake.ListTimelines(r.Context(), collectionID)
+	})
+	s.handle("GET /api/timeline/{id}", s.byID(func(r *http.Request, id int) (any, error) {
+		return s.fake.GetTimeline(r.Context(), id)
+	}))
+
+	s.handle("POST /api/cache/invalidate", func(r *http.Request) (any, error) {
+		return map[string]string{"message": "Invalidated cache"}, s.fake.InvalidateCache(r.Context())
+	})
+}
+
+// currentUser returns the user of the request's session, or the Fake's
+// current user for API keys.
+func (s *Server) currentUser(r *http.Request) (any, error) {
+	email, _ := r.Context().Value(userKey{}).(string)
+	if email == "" {
+		return s.fake.GetCurrentUser(r.Context())
+	}
+	users, err := s.fake.ListUsers(r.Context(), metabase.Page{})
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users.Data {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, &metabase.APIError{StatusCode: http.StatusNotFound}
+}
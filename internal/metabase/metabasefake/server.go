@@ -0,0 +1,230 @@
+// Package metabasefake serves a metabasetest.Fake over the subset of the
+// Metabase REST API that metabase.Client uses, so that the MCP server can
+// run end to end, in tests, CI and demos, without a real Metabase.
+//
+// The server authenticates like Metabase: with an API key in the
+// X-API-Key header, or with a session created by POST /api/session and
+// sent in the X-Metabase-Session header. Errors are reported with the
+// status codes and bodies Metabase uses, so that metabase.Client turns
+// them into the same *metabase.APIError.
+package metabasefake
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+	"github.com/anaryk/metabase-mcp-server/internal/metabase/metabasetest"
+)
+
+// Server is a fake Metabase HTTP server. It implements http.Handler.
+type Server struct {
+	fake      *metabasetest.Fake
+	apiKeys   map[string]bool
+	passwords map[string]string // email -> password
+	mux       *http.ServeMux
+	logger    zerolog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]string // session ID -> email
+}
+
+// New returns a Server for the Metabase instance fx describes. It accepts
+// the API keys of fx and the emails and passwords of its users.
+func New(fx *metabasetest.Fixture, logger zerolog.Logger) (*Server, error) {
+	fake, err := metabasetest.NewFromFixture(fx)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		fake:      fake,
+		apiKeys:   make(map[string]bool),
+		passwords: make(map[string]string),
+		mux:       http.NewServeMux(),
+		logger:    logger,
+		sessions:  make(map[string]string),
+	}
+	for _, key := range fx.APIKeys {
+		s.apiKeys[key] = true
+	}
+	for _, u := range fx.Users {
+		if u.Password != "" {
+			s.passwords[u.Email] = u.Password
+		}
+	}
+	s.routes()
+	return s, nil
+}
+
+// NewTestServer serves fx, or the sample fixture if fx is nil, on a local
+// port until t ends. Clients authenticate with one of the fixture's API
+// keys, such as "mb_fake_api_key" for the sample.
+func NewTestServer(t testing.TB, fx *metabasetest.Fixture) (*Server, *httptest.Server) {
+	t.Helper()
+	if fx == nil {
+		fx = metabasetest.SampleFixture()
+	}
+	s, err := New(fx, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("metabasefake: %v", err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// Fake returns the in-memory Metabase the server serves, to seed or
+// inspect it.
+func (s *Server) Fake() *metabasetest.Fake {
+	return s.fake
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.logger.Debug().Str("method", r.Method).Str("path", r.URL.Path).Msg("fake metabase request")
+	s.mux.ServeHTTP(w, r)
+}
+
+// handler handles a request, returning the response body or an error.
+type handler func(r *http.Request) (any, error)
+
+// userKey is the context key of the email of a request's session user;
+// requests authenticated with an API key have none.
+type userKey struct{}
+
+// handle registers h for pattern, behind authentication.
+func (s *Server) handle(pattern string, h handler) {
+	s.handleStatus(pattern, http.StatusOK, h)
+}
+
+// handleStatus registers h for pattern, behind authentication, responding
+// with status on success.
+func (s *Server) handleStatus(pattern string, status int, h handler) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		email, ok := s.authenticate(r)
+		if !ok {
+			http.Error(w, "Unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		if email != "" {
+			r = r.WithContext(context.WithValue(r.Context(), userKey{}, email))
+		}
+		s.respond(w, r, status, h)
+	})
+}
+
+// handlePublic registers h for pattern without authentication.
+func (s *Server) handlePublic(pattern string, h handler) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, r, http.StatusOK, h)
+	})
+}
+
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, status int, h handler) {
+	body, err := h(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	switch body := body.(type) {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case rawBody:
+		w.Header().Set("Content-Type", body.contentType)
+		w.WriteHeader(status)
+		_, _ = w.Write(body.data)
+	default:
+		writeJSON(w, status, body)
+	}
+}
+
+// rawBody is a response body that is not JSON-encoded.
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+// authenticate returns whether r carries a valid API key or session, and
+// for a session, the email of its user.
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return "", s.apiKeys[key]
+	}
+	if id := r.Header.Get("X-Metabase-Session"); id != "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		email, ok := s.sessions[id]
+		return email, ok
+	}
+	return "", false
+}
+
+// writeError writes err as Metabase would.
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	var apiErr *metabase.APIError
+	var unsupported *metabase.UnsupportedError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.QueryFailed():
+		writeJSON(w, apiErr.StatusCode, map[string]any{
+			"status":     "failed",
+			"error":      apiErr.Message,
+			"error_type": apiErr.ErrorType,
+			"row_count":  0,
+			"data":       map[string]any{"rows": []any{}, "cols": []any{}},
+		})
+	case errors.As(err, &apiErr) && len(apiErr.Errors) > 0:
+		writeJSON(w, apiErr.StatusCode, map[string]any{"errors": apiErr.Errors})
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+		http.Error(w, "Not found.", http.StatusNotFound)
+	case errors.As(err, &apiErr):
+		writeJSON(w, apiErr.StatusCode, map[string]any{"message": apiErr.Message})
+	case errors.As(err, &unsupported):
+		// The endpoint does not exist in this Metabase version.
+		http.Error(w, "Not found.", http.StatusNotFound)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// decode decodes the JSON body of r, if any, into v.
+func decode(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return &metabase.APIError{StatusCode: http.StatusBadRequest, Message: "invalid JSON body: " + err.Error()}
+	}
+	return nil
+}
+
+// pathID returns the integer path value name of r.
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id <= 0 {
+		return 0, &metabase.APIError{StatusCode: http.StatusBadRequest, Errors: map[string]string{name: "value must be an integer greater than zero."}}
+	}
+	return id, nil
+}
+
+// newSessionID returns a random session ID shaped like Metabase's UUIDs.
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	h := hex.EncodeToString(b)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[:8], h[8:12], h[12:16], h[16:20], h[20:])
+}
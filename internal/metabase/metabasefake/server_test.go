@@ -0,0 +1,163 @@
+package metabasefake
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+	"github.com/anaryk/metabase-mcp-server/internal/metabase/metabasetest"
+)
+
+func newClient(t *testing.T, fx *metabasetest.Fixture) (*Server, *metabase.Client) {
+	t.Helper()
+	s, ts := NewTestServer(t, fx)
+	client, err := metabase.NewClient(ts.URL, "mb_fake_api_key", "", "", zerolog.Nop())
+	require.NoError(t, err)
+	return s, client
+}
+
+func TestServer_Auth(t *testing.T) {
+	_, ts := NewTestServer(t, nil)
+	ctx := context.Background()
+
+	t.Run("api key", func(t *testing.T) {
+		client, err := metabase.NewClient(ts.URL, "mb_fake_api_key", "", "", zerolog.Nop())
+		require.NoError(t, err)
+		user, err := client.GetCurrentUser(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "admin@example.com", user.Email)
+	})
+
+	t.Run("bad api key", func(t *testing.T) {
+		_, err := metabase.NewClient(ts.URL, "wrong", "", "", zerolog.Nop())
+		var apiErr *metabase.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		client, err := metabase.NewClient(ts.URL, "", "analyst@example.com", "fake-password", zerolog.Nop())
+		require.NoError(t, err)
+		user, err := client.GetCurrentUser(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "analyst@example.com", user.Email)
+		require.NoError(t, client.Logout(ctx))
+	})
+
+	t.Run("bad password", func(t *testing.T) {
+		_, err := metabase.NewClient(ts.URL, "", "analyst@example.com", "wrong", zerolog.Nop())
+		assert.Error(t, err)
+	})
+
+	t.Run("no credentials", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/api/card")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
+
+func TestServer_Cards(t *testing.T) {
+	_, client := newClient(t, nil)
+	ctx := context.Background()
+
+	cards, err := client.ListCards(ctx, metabase.Page{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, cards.Data, 1)
+	assert.Equal(t, 2, cards.Total)
+
+	created, err := client.CreateCard(ctx, &metabase.Card{
+		Name:         "People",
+		Display:      "table",
+		DatasetQuery: map[string]any{"database": 1, "type": "native", "native": map[string]any{"query": "SELECT * FROM PEOPLE"}},
+	})
+	require.NoError(t, err)
+
+	result, err := client.ExecuteCardQuery(ctx, created.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.RowCount)
+
+	name := "All people"
+	updated, err := client.UpdateCard(ctx, created.ID, &metabase.Card{Name: name})
+	require.NoError(t, err)
+	assert.Equal(t, name, updated.Name)
+
+	require.NoError(t, client.DeleteCard(ctx, created.ID))
+	_, err = client.GetCard(ctx, created.ID)
+	assert.True(t, metabase.IsNotFound(err))
+
+	_, err = client.CreateCard(ctx, &metabase.Card{Name: "Broken"})
+	var apiErr *metabase.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Contains(t, apiErr.FieldErrors(), "display")
+}
+
+func TestServer_Dashcards(t *testing.T) {
+	for _, version := range []string{"v0.50.0", "v0.46.6"} {
+		t.Run(version, func(t *testing.T) {
+			fx := metabasetest.SampleFixture()
+			fx.Version = version
+			_, client := newClient(t, fx)
+			ctx := context.Background()
+
+			dashboard, err := client.GetDashboard(ctx, 1)
+			require.NoError(t, err)
+			require.Len(t, dashboard.DashCards, 2)
+
+			cardID := 2
+			added, err := client.AddCardToDashboard(ctx, 1, &metabase.DashCard{CardID: &cardID, Row: 6, SizeX: 6, SizeY: 4})
+			require.NoError(t, err)
+			assert.Positive(t, added.ID)
+
+			require.NoError(t, client.RemoveCardFromDashboard(ctx, 1, dashboard.DashCards[0].ID))
+			dashboard, err = client.GetDashboard(ctx, 1)
+			require.NoError(t, err)
+			assert.Len(t, dashboard.DashCards, 2)
+		})
+	}
+}
+
+func TestServer_Queries(t *testing.T) {
+	_, client := newClient(t, nil)
+	ctx := context.Background()
+
+	result, err := client.ExecuteQuery(ctx, &metabase.DatasetQueryRequest{
+		Database: 1, Type: "native", Native: &metabase.NativeQuery{Query: "SELECT TITLE FROM PRODUCTS LIMIT 2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.RowCount)
+
+	_, err = client.ExecuteQuery(ctx, &metabase.DatasetQueryRequest{
+		Database: 1, Type: "native", Native: &metabase.NativeQuery{Query: "SELECT * FROM INVOICES"},
+	})
+	var apiErr *metabase.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.True(t, apiErr.QueryFailed())
+	assert.Equal(t, `table "INVOICES" not found`, apiErr.Message)
+
+	data, err := client.ExportQueryResults(ctx, &metabase.DatasetQueryRequest{
+		Database: 1, Type: "native", Native: &metabase.NativeQuery{Query: "SELECT ID, STATE FROM PEOPLE LIMIT 1"},
+	}, "csv")
+	require.NoError(t, err)
+	assert.Equal(t, "ID,STATE\n1,TX\n", string(data))
+
+	users, err := client.ListUsers(ctx, metabase.Page{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, users.Data, 1)
+	assert.Equal(t, "analyst@example.com", users.Data[0].Email)
+	assert.Equal(t, 2, users.Total)
+
+	tables, err := client.ListTables(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, tables, 3)
+
+	info, err := client.ServerInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.50.0", info.Version.Tag)
+}
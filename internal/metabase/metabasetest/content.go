@@ -0,0 +1,550 @@
+package metabasetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// rootCollection is the collection Metabase calls "root": the items that
+// are in no collection.
+var rootCollection = metabase.Collection{ID: "root", Name: "Our analytics"}
+
+// ListCards implements metabase.CardAPI. Archived cards are left out.
+func (f *Fake) ListCards(ctx context.Context, page metabase.Page) (*metabase.Paged[metabase.Card], error) {
+	cards, err := list(ctx, f, f.cards, func(c *metabase.Card) bool { return !isArchived(c.Archived) })
+	if err != nil {
+		return nil, err
+	}
+	return metabase.SlicePage(cards, page), nil
+}
+
+// GetCard implements metabase.CardAPI.
+func (f *Fake) GetCard(ctx context.Context, id int) (*metabase.Card, error) {
+	return get(ctx, f, f.cards, id, "card")
+}
+
+// CreateCard implements metabase.CardAPI. Like Metabase, it requires a
+// name, a display and a dataset_query, and derives the database and query
+// type from the query.
+func (f *Fake) CreateCard(ctx context.Context, card *metabase.Card) (*metabase.Card, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	const endpoint = "/api/card"
+	switch {
+	case strings.TrimSpace(card.Name) == "":
+		return nil, invalid(http.MethodPost, endpoint, "name", "value must be a non-blank string.")
+	case strings.TrimSpace(card.Display) == "":
+		return nil, invalid(http.MethodPost, endpoint, "display", "value must be a non-blank string.")
+	case card.DatasetQuery == nil:
+		return nil, invalid(http.MethodPost, endpoint, "dataset_query", "value must be a map.")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkCollection(http.MethodPost, endpoint, card.CollectionID); err != nil {
+		return nil, err
+	}
+	c := clone(card)
+	c.ID = f.nextID("card")
+	c.CreatorID = ptr(f.current)
+	now := f.now()
+	c.CreatedAt, c.UpdatedAt = &now, &now
+	if c.Archived == nil {
+		c.Archived = ptr(false)
+	}
+	f.deriveQueryFields(c)
+	f.cards[c.ID] = c
+	return clone(c), nil
+}
+
+// UpdateCard implements metabase.CardAPI. Only the fields set in card are
+// changed.
+func (f *Fake) UpdateCard(ctx context.Context, id int, card *metabase.Card) (*metabase.Card, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("/api/card/%d", id)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, ok := f.cards[id]
+	if !ok {
+		return nil, notFound(http.MethodPut, endpoint)
+	}
+	if err := f.checkCollection(http.MethodPut, endpoint, card.CollectionID); err != nil {
+		return nil, err
+	}
+	c := merge(existing, card)
+	c.ID = id
+	c.UpdatedAt = ptr(f.now())
+	f.deriveQueryFields(c)
+	f.cards[id] = c
+	return clone(c), nil
+}
+
+// DeleteCard implements metabase.CardAPI. The card is also removed from
+// the dashboards it is on.
+func (f *Fake) DeleteCard(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.cards[id]; !ok {
+		return notFound(http.MethodDelete, fmt.Sprintf("/api/card/%d", id))
+	}
+	delete(f.cards, id)
+	for _, d := range f.dashboards {
+		d.DashCards = slices.DeleteFunc(d.DashCards, func(dc metabase.DashCard) bool {
+			return dc.CardID != nil && *dc.CardID == id
+		})
+	}
+	return nil
+}
+
+// ExecuteCardQuery implements metabase.CardAPI. The "parameters" entry of
+// parameters fills in the template tags of native queries.
+func (f *Fake) ExecuteCardQuery(ctx context.Context, id int, parameters map[string]any) (*metabase.DatasetQueryResponse, error) {
+	card, err := f.GetCard(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	req, err := datasetQuery(card.DatasetQuery)
+	if err != nil {
+		return nil, err
+	}
+	if values, ok := parameters["parameters"].([]any); ok {
+		req.Parameters = values
+	}
+	return f.run(ctx, req, fmt.Sprintf("/api/card/%d/query", id))
+}
+
+// deriveQueryFields sets the database, table and query type of a card from
+// its dataset_query. f.mu must be held.
+func (f *Fake) deriveQueryFields(c *metabase.Card) {
+	req, err := datasetQuery(c.DatasetQuery)
+	if err != nil {
+		return
+	}
+	c.DatabaseID = ptr(req.Database)
+	c.QueryType = ptr(req.Type)
+	if id, ok := sourceTable(req.Query); ok {
+		c.TableID = ptr(id)
+	}
+}
+
+// checkCollection fails unless id is nil (the root collection) or names an
+// existing collection. f.mu must be held.
+func (f *Fake) checkCollection(method, endpoint string, id *int) error {
+	if id == nil {
+		return nil
+	}
+	if _, ok := f.collections[*id]; !ok {
+		return invalid(method, endpoint, "collection_id", fmt.Sprintf("collection %d does not exist", *id))
+	}
+	return nil
+}
+
+// ListDashboards implements metabase.DashboardAPI. Archived dashboards are
+// left out and, as in Metabase, the listing carries no dashcards.
+func (f *Fake) ListDashboards(ctx context.Context) ([]metabase.Dashboard, error) {
+	dashboards, err := list(ctx, f, f.dashboards, func(d *metabase.Dashboard) bool { return !isArchived(d.Archived) })
+	for i := range dashboards {
+		dashboards[i].DashCards = nil
+	}
+	return dashboards, err
+}
+
+// GetDashboard implements metabase.DashboardAPI.
+func (f *Fake) GetDashboard(ctx context.Context, id int) (*metabase.Dashboard, error) {
+	return get(ctx, f, f.dashboards, id, "dashboard")
+}
+
+// CreateDashboard implements metabase.DashboardAPI.
+func (f *Fake) CreateDashboard(ctx context.Context, dashboard *metabase.Dashboard) (*metabase.Dashboard, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	const endpoint = "/api/dashboard"
+	if strings.TrimSpace(dashboard.Name) == "" {
+		return nil, invalid(http.MethodPost, endpoint, "name", "value must be a non-blank string.")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.checkCollection(http.MethodPost, endpoint, dashboard.CollectionID); err != nil {
+		return nil, err
+	}
+	d := clone(dashboard)
+	d.ID = f.nextID("dashboard")
+	d.CreatorID = ptr(f.current)
+	now := f.now()
+	d.CreatedAt, d.UpdatedAt = &now, &now
+	if d.Archived == nil {
+		d.Archived = ptr(false)
+	}
+	d.DashCards = nil
+	f.dashboards[d.ID] = d
+	return clone(d), nil
+}
+
+// UpdateDashboard implements metabase.DashboardAPI. Only the fields set in
+// dashboard are changed; dashcards, if given, replace the existing ones,
+// and new dashcards (with an ID of zero or less) are given IDs.
+func (f *Fake) UpdateDashboard(ctx context.Context, id int, dashboard *metabase.Dashboard) (*metabase.Dashboard, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("/api/dashboard/%d", id)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, ok := f.dashboards[id]
+	if !ok {
+		return nil, notFound(http.MethodPut, endpoint)
+	}
+	if err := f.checkCollection(http.MethodPut, endpoint, dashboard.CollectionID); err != nil {
+		return nil, err
+	}
+	d := merge(existing, dashboard)
+	d.ID = id
+	d.UpdatedAt = ptr(f.now())
+	if dashboard.DashCards != nil {
+		// merge drops an empty list, which removes all cards.
+		d.DashCards = slices.Clone(dashboard.DashCards)
+	}
+	for i := range d.DashCards {
+		if err := f.placeDashcard(http.MethodPut, endpoint, id, &d.DashCards[i]); err != nil {
+			return nil, err
+		}
+	}
+	f.dashboards[id] = d
+	return clone(d), nil
+}
+
+// DeleteDashboard implements metabase.DashboardAPI.
+func (f *Fake) DeleteDashboard(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.dashboards[id]; !ok {
+		return notFound(http.MethodDelete, fmt.Sprintf("/api/dashboard/%d", id))
+	}
+	delete(f.dashboards, id)
+	return nil
+}
+
+// AddCardToDashboard implements metabase.DashboardAPI.
+func (f *Fake) AddCardToDashboard(ctx context.Context, dashboardID int, dashCard *metabase.DashCard) (*metabase.DashCard, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("/api/dashboard/%d", dashboardID)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.dashboards[dashboardID]
+	if !ok {
+		return nil, notFound(http.MethodGet, endpoint)
+	}
+	dc := *clone(dashCard)
+	dc.ID = 0
+	if err := f.placeDashcard(http.MethodPut, endpoint, dashboardID, &dc); err != nil {
+		return nil, err
+	}
+	d.DashCards = append(d.DashCards, dc)
+	return clone(&dc), nil
+}
+
+// RemoveCardFromDashboard implements metabase.DashboardAPI.
+func (f *Fake) RemoveCardFromDashboard(ctx context.Context, dashboardID, dashCardID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.dashboards[dashboardID]
+	if !ok {
+		return notFound(http.MethodGet, fmt.Sprintf("/api/dashboard/%d", dashboardID))
+	}
+	i := slices.IndexFunc(d.DashCards, func(dc metabase.DashCard) bool { return dc.ID == dashCardID })
+	if i < 0 {
+		return fmt.Errorf("remove card from dashboard: dashcard %d not found on dashboard %d", dashCardID, dashboardID)
+	}
+	d.DashCards = slices.Delete(d.DashCards, i, i+1)
+	return nil
+}
+
+// UpdateDashboardCards implements metabase.DashboardAPI. Each card is
+// matched to a dashcard by ID, whose layout and set fields it replaces.
+func (f *Fake) UpdateDashboardCards(ctx context.Context, dashboardID int, cards []metabase.DashCard) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.dashboards[dashboardID]
+	if !ok {
+		return notFound(http.MethodGet, fmt.Sprintf("/api/dashboard/%d", dashboardID))
+	}
+	updated := slices.Clone(d.DashCards)
+	for _, update := range cards {
+		i := slices.IndexFunc(updated, func(dc metabase.DashCard) bool { return dc.ID == update.ID })
+		if i < 0 {
+			return fmt.Errorf("update dashboard cards: dashcard %d not found on dashboard %d", update.ID, dashboardID)
+		}
+		dc := merge(&updated[i], &update)
+		dc.Row, dc.Col = update.Row, update.Col
+		updated[i] = *dc
+	}
+	d.DashCards = updated
+	return nil
+}
+
+// CopyDashboard implements metabase.DashboardAPI. The copy refers to the
+// same cards through new dashcards.
+func (f *Fake) CopyDashboard(ctx context.Context, id int, name string, description *string, collectionID *int) (*metabase.Dashboard, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("/api/dashboard/%d/copy", id)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	src, ok := f.dashboards[id]
+	if !ok {
+		return nil, notFound(http.MethodPost, endpoint)
+	}
+	if err := f.checkCollection(http.MethodPost, endpoint, collectionID); err != nil {
+		return nil, err
+	}
+	d := clone(src)
+	d.ID = f.nextID("dashboard")
+	if name != "" {
+		d.Name = name
+	}
+	if description != nil {
+		d.Description = description
+	}
+	d.CollectionID = collectionID
+	d.CreatorID = ptr(f.current)
+	now := f.now()
+	d.CreatedAt, d.UpdatedAt = &now, &now
+	d.Archived = ptr(false)
+	for i := range d.DashCards {
+		d.DashCards[i].ID = 0
+		if err := f.placeDashcard(http.MethodPost, endpoint, d.ID, &d.DashCards[i]); err != nil {
+			return nil, err
+		}
+	}
+	f.dashboards[d.ID] = d
+	return clone(d), nil
+}
+
+// placeDashcard checks that the card of dc exists and, if dc is new, gives
+// it an ID and a default size. f.mu must be held.
+func (f *Fake) placeDashcard(method, endpoint string, dashboardID int, dc *metabase.DashCard) error {
+	if dc.CardID != nil {
+		if _, ok := f.cards[*dc.CardID]; !ok {
+			return invalid(method, endpoint, "card_id", fmt.Sprintf("card %d does not exist", *dc.CardID))
+		}
+	}
+	dc.DashboardID = dashboardID
+	if dc.ID > 0 {
+		return nil
+	}
+	dc.ID = f.nextID("dashcard")
+	if dc.SizeX == 0 {
+		dc.SizeX = 4
+	}
+	if dc.SizeY == 0 {
+		dc.SizeY = 4
+	}
+	return nil
+}
+
+// ListCollections implements metabase.CollectionAPI. As in Metabase, the
+// root collection comes first, and collections without a namespace are
+// listed when namespace is empty.
+func (f *Fake) ListCollections(ctx context.Context, namespace string) ([]metabase.Collection, error) {
+	collections, err := list(ctx, f, f.collections, func(c *metabase.Collection) bool {
+		ns := ""
+		if c.Namespace != nil {
+			ns = *c.Namespace
+		}
+		return !isArchived(c.Archived) && ns == namespace
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range collections {
+		collections[i].ID = intID(collections[i].ID)
+	}
+	if namespace == "" {
+		collections = append([]metabase.Collection{rootCollection}, collections...)
+	}
+	return collections, nil
+}
+
+// GetCollection implements metabase.CollectionAPI. id is a collection ID
+// or "root".
+func (f *Fake) GetCollection(ctx context.Context, id string) (*metabase.Collection, error) {
+	if id == "root" {
+		root := rootCollection
+		return &root, ctx.Err()
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, invalid(http.MethodGet, "/api/collection/"+id, "id", "value must be an integer greater than zero.")
+	}
+	c, err := get(ctx, f, f.collections, n, "collection")
+	if err != nil {
+		return nil, err
+	}
+	c.ID = n
+	return c, nil
+}
+
+// CreateCollection implements metabase.CollectionAPI.
+func (f *Fake) CreateCollection(ctx context.Context, collection *metabase.Collection) (*metabase.Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	const endpoint = "/api/collection"
+	if strings.TrimSpace(collection.Name) == "" {
+		return nil, invalid(http.MethodPost, endpoint, "name", "value must be a non-blank string.")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if collection.ParentID != nil {
+		if _, ok := f.collections[*collection.ParentID]; !ok {
+			return nil, invalid(http.MethodPost, endpoint, "parent_id", fmt.Sprintf("collection %d does not exist", *collection.ParentID))
+		}
+	}
+	c := clone(collection)
+	c.ID = f.nextID("collection")
+	if c.Archived == nil {
+		c.Archived = ptr(false)
+	}
+	f.collections[c.ID.(int)] = c
+	result := clone(c)
+	result.ID = c.ID
+	return result, nil
+}
+
+// UpdateCollection implements metabase.CollectionAPI. Only the fields set
+// in collection are changed.
+func (f *Fake) UpdateCollection(ctx context.Context, id int, collection *metabase.Collection) (*metabase.Collection, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("/api/collection/%d", id)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, ok := f.collections[id]
+	if !ok {
+		return nil, notFound(http.MethodPut, endpoint)
+	}
+	if collection.ParentID != nil && *collection.ParentID == id {
+		return nil, invalid(http.MethodPut, endpoint, "parent_id", "a collection cannot be its own parent")
+	}
+	c := merge(existing, collection)
+	c.ID = id
+	f.collections[id] = c
+	result := clone(c)
+	result.ID = id
+	return result, nil
+}
+
+// ListCollectionItems implements metabase.CollectionAPI. models filters
+// the items by kind: "card", "dashboard" or "collection".
+func (f *Fake) ListCollectionItems(ctx context.Context, id string, models []string, page metabase.Page) (*metabase.Paged[metabase.CollectionItem], error) {
+	if _, err := f.GetCollection(ctx, id); err != nil {
+		return nil, err
+	}
+	var parent *int
+	if id != "root" {
+		n, _ := strconv.Atoi(id)
+		parent = &n
+	}
+	in := func(collectionID *int, archived *bool) bool {
+		if isArchived(archived) {
+			return false
+		}
+		if parent == nil || collectionID == nil {
+			return parent == nil && collectionID == nil
+		}
+		return *parent == *collectionID
+	}
+	want := func(model string) bool {
+		return len(models) == 0 || slices.Contains(models, model)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	items := []metabase.CollectionItem{}
+	if want("collection") {
+		for _, c := range sorted(f.collections) {
+			if in(c.ParentID, c.Archived) {
+				items = append(items, metabase.CollectionItem{ID: c.ID.(int), Name: c.Name, Description: c.Description, Model: "collection"})
+			}
+		}
+	}
+	if want("dashboard") {
+		for _, d := range sorted(f.dashboards) {
+			if in(d.CollectionID, d.Archived) {
+				items = append(items, metabase.CollectionItem{ID: d.ID, Name: d.Name, Description: d.Description, Model: "dashboard"})
+			}
+		}
+	}
+	if want("card") {
+		for _, c := range sorted(f.cards) {
+			if in(c.CollectionID, c.Archived) {
+				items = append(items, metabase.CollectionItem{ID: c.ID, Name: c.Name, Description: c.Description, Model: "card"})
+			}
+		}
+	}
+	return metabase.SlicePage(items, page), nil
+}
+
+// intID returns a collection ID decoded from JSON as an int.
+func intID(id any) any {
+	if n, ok := toInt(id); ok {
+		return n
+	}
+	return id
+}
+
+// merge returns a copy of existing with the fields set in update, as
+// Metabase applies a PUT body.
+func merge[T any](existing, update *T) *T {
+	fields := make(map[string]any)
+	for _, v := range []*T{existing, update} {
+		data, _ := json.Marshal(v)
+		_ = json.Unmarshal(data, &fields)
+	}
+	data, _ := json.Marshal(fields)
+	var merged T
+	if err := json.Unmarshal(data, &merged); err != nil {
+		panic(fmt.Sprintf("metabasetest: merging %T: %v", existing, err))
+	}
+	return &merged
+}
+
+// sorted returns the objects ordered by ID.
+func sorted[T any](objects map[int]*T) []*T {
+	ids := make([]int, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	result := make([]*T, len(ids))
+	for i, id := range ids {
+		result[i] = objects[id]
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package metabasetest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+func TestFake_Cards(t *testing.T) {
+	f, s := NewSample()
+	ctx := context.Background()
+
+	card, err := f.CreateCard(ctx, &metabase.Card{
+		Name:         "Order count",
+		Display:      "scalar",
+		DatasetQuery: map[string]any{"database": s.Database.ID, "type": "query", "query": map[string]any{"source-table": s.Orders.ID}},
+	})
+	require.NoError(t, err)
+	assert.Positive(t, card.ID)
+	assert.Equal(t, s.Database.ID, *card.DatabaseID)
+	assert.Equal(t, s.Orders.ID, *card.TableID)
+	assert.Equal(t, "query", *card.QueryType)
+
+	updated, err := f.UpdateCard(ctx, card.ID, &metabase.Card{Description: ptr("Orders so far")})
+	require.NoError(t, err)
+	assert.Equal(t, "Order count", updated.Name, "unset fields are kept")
+	assert.Equal(t, "Orders so far", *updated.Description)
+
+	_, err = f.UpdateCard(ctx, card.ID, &metabase.Card{Archived: ptr(true)})
+	require.NoError(t, err)
+	cards, err := f.ListCards(ctx, metabase.Page{})
+	require.NoError(t, err)
+	assert.Len(t, cards.Data, 2, "archived cards are not listed")
+
+	// Deleting a card takes it off its dashboards.
+	require.NoError(t, f.DeleteCard(ctx, s.NativeCard.ID))
+	dashboard, err := f.GetDashboard(ctx, s.Dashboard.ID)
+	require.NoError(t, err)
+	require.Len(t, dashboard.DashCards, 1)
+	assert.Equal(t, s.QueryCard.ID, *dashboard.DashCards[0].CardID)
+
+	_, err = f.GetCard(ctx, s.NativeCard.ID)
+	assert.True(t, metabase.IsNotFound(err))
+	var apiErr *metabase.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "/api/card/"+strconv.Itoa(s.NativeCard.ID), apiErr.Endpoint)
+}
+
+func TestFake_CardValidation(t *testing.T) {
+	f, s := NewSample()
+	collectionID := 99
+	tests := []struct {
+		name string
+		card metabase.Card
+		want string
+	}{
+		{
+			name: "missing name",
+			card: metabase.Card{Display: "table", DatasetQuery: map[string]any{}},
+			want: "name: value must be a non-blank string.",
+		},
+		{
+			name: "missing query",
+			card: metabase.Card{Name: "x", Display: "table"},
+			want: "dataset_query: value must be a map.",
+		},
+		{
+			name: "unknown collection",
+			card: metabase.Card{Name: "x", Display: "table", DatasetQuery: map[string]any{"database": s.Database.ID}, CollectionID: &collectionID},
+			want: "collection_id: collection 99 does not exist",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.CreateCard(context.Background(), &tt.card)
+			var apiErr *metabase.APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, 400, apiErr.StatusCode)
+			assert.Equal(t, tt.want, apiErr.FieldErrors())
+		})
+	}
+}
+
+func TestFake_Dashboards(t *testing.T) {
+	f, s := NewSample()
+	ctx := context.Background()
+	require.Len(t, s.Dashboard.DashCards, 2)
+
+	dc, err := f.AddCardToDashboard(ctx, s.Dashboard.ID, &metabase.DashCard{CardID: &s.QueryCard.ID, Row: 6})
+	require.NoError(t, err)
+	assert.Positive(t, dc.ID)
+	assert.Equal(t, 4, dc.SizeX, "new dashcards get a default size")
+
+	require.NoError(t, f.UpdateDashboardCards(ctx, s.Dashboard.ID, []metabase.DashCard{{ID: dc.ID, Row: 8, Col: 2}}))
+	dashboard, err := f.GetDashboard(ctx, s.Dashboard.ID)
+	require.NoError(t, err)
+	require.Len(t, dashboard.DashCards, 3)
+	assert.Equal(t, 8, dashboard.DashCards[2].Row)
+	assert.Equal(t, 2, dashboard.DashCards[2].Col)
+	assert.Equal(t, s.QueryCard.ID, *dashboard.DashCards[2].CardID)
+
+	require.NoError(t, f.RemoveCardFromDashboard(ctx, s.Dashboard.ID, dc.ID))
+	assert.EqualError(t, f.RemoveCardFromDashboard(ctx, s.Dashboard.ID, dc.ID),
+		"remove card from dashboard: dashcard "+strconv.Itoa(dc.ID)+" not found on dashboard "+strconv.Itoa(s.Dashboard.ID))
+
+	copied, err := f.CopyDashboard(ctx, s.Dashboard.ID, "Copy", nil, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, s.Dashboard.ID, copied.ID)
+	assert.Equal(t, "Copy", copied.Name)
+	assert.Nil(t, copied.CollectionID)
+	require.Len(t, copied.DashCards, 2)
+	for i, dc := range copied.DashCards {
+		assert.NotEqual(t, s.Dashboard.DashCards[i].ID, dc.ID, "copies get new dashcards")
+		assert.Equal(t, copied.ID, dc.DashboardID)
+		assert.Equal(t, *s.Dashboard.DashCards[i].CardID, *dc.CardID)
+	}
+
+	dashboards, err := f.ListDashboards(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dashboards, 2)
+	assert.Empty(t, dashboards[0].DashCards)
+}
+
+func TestFake_Collections(t *testing.T) {
+	f, s := NewSample()
+	ctx := context.Background()
+	collectionID := s.Collection.ID.(int)
+
+	child, err := f.CreateCollection(ctx, &metabase.Collection{Name: "Drafts", ParentID: &collectionID})
+	require.NoError(t, err)
+
+	root, err := f.GetCollection(ctx, "root")
+	require.NoError(t, err)
+	assert.Equal(t, "Our analytics", root.Name)
+
+	collections, err := f.ListCollections(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, collections, 3)
+	assert.Equal(t, "root", collections[0].ID)
+	assert.Equal(t, collectionID, collections[1].ID)
+
+	tests := []struct {
+		id     string
+		models []string
+		want   []string
+	}{
+		{id: "root", want: []string{"collection:Examples"}},
+		{id: strconv.Itoa(collectionID), want: []string{"collection:Drafts", "dashboard:Sales overview", "card:Recent orders", "card:Products"}},
+		{id: strconv.Itoa(collectionID), models: []string{"card"}, want: []string{"card:Recent orders", "card:Products"}},
+		{id: strconv.Itoa(child.ID.(int)), want: []string{}},
+	}
+	for _, tt := range tests {
+		items, err := f.ListCollectionItems(ctx, tt.id, tt.models, metabase.Page{})
+		require.NoError(t, err)
+		got := []string{}
+		for _, item := range items.Data {
+			got = append(got, item.Model+":"+item.Name)
+		}
+		assert.Equal(t, tt.want, got, "collection %s, models %v", tt.id, tt.models)
+	}
+
+	items, err := f.ListCollectionItems(ctx, strconv.Itoa(collectionID), nil, metabase.Page{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 4, items.Total)
+	require.Len(t, items.Data, 2)
+	assert.Equal(t, "Sales overview", items.Data[0].Name)
+
+	_, err = f.GetCollection(ctx, "404")
+	assert.True(t, metabase.IsNotFound(err))
+}
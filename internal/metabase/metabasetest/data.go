@@ -0,0 +1,254 @@
+package metabasetest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// AddDatabase adds a database with its tables and their fields, assigning
+// IDs to all of them, and returns it. Rows for the tables are set with
+// SetRows.
+func (f *Fake) AddDatabase(db metabase.Database) *metabase.Database {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d := clone(&db)
+	d.ID = f.nextID("database")
+	if d.NativePermissions == "" {
+		d.NativePermissions = "write"
+	}
+	for i := range d.Tables {
+		t := &d.Tables[i]
+		t.ID = f.nextID("table")
+		t.DBID = d.ID
+		if t.EntityType == nil {
+			t.EntityType = ptr("entity/GenericTable")
+		}
+		for j := range t.Fields {
+			field := &t.Fields[j]
+			field.ID = f.nextID("field")
+			field.TableID = t.ID
+			if field.Visibility == "" {
+				field.Visibility = "normal"
+			}
+			f.fields[field.ID] = clone(field)
+		}
+		f.tables[t.ID] = clone(t)
+	}
+	f.databases[d.ID] = d
+	return clone(d)
+}
+
+// SetRows replaces the rows of a table. Each row holds one value per field,
+// in field order.
+func (f *Fake) SetRows(tableID int, rows ...[]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.tables[tableID]; !ok {
+		panic(fmt.Sprintf("metabasetest: SetRows: no table %d", tableID))
+	}
+	f.rows[tableID] = slices.Clone(rows)
+	n := len(rows)
+	f.tables[tableID].Rows = &n
+}
+
+// tableFields returns the fields of a table in the order they were added.
+// f.mu must be held.
+func (f *Fake) tableFields(tableID int) []metabase.Field {
+	var fields []metabase.Field
+	for _, field := range sorted(f.fields) {
+		if field.TableID == tableID {
+			fields = append(fields, *field)
+		}
+	}
+	return fields
+}
+
+// ListDatabases implements metabase.DatabaseAPI. Databases are listed
+// without their tables.
+func (f *Fake) ListDatabases(ctx context.Context) ([]metabase.Database, error) {
+	dbs, err := list(ctx, f, f.databases, func(*metabase.Database) bool { return true })
+	for i := range dbs {
+		dbs[i].Tables = nil
+	}
+	return dbs, err
+}
+
+// GetDatabase implements metabase.DatabaseAPI. The database is returned
+// without its tables.
+func (f *Fake) GetDatabase(ctx context.Context, id int) (*metabase.Database, error) {
+	db, err := get(ctx, f, f.databases, id, "database")
+	if err != nil {
+		return nil, err
+	}
+	db.Tables = nil
+	return db, nil
+}
+
+// GetDatabaseMetadata implements metabase.DatabaseAPI. The database is
+// returned with its tables and their fields.
+func (f *Fake) GetDatabaseMetadata(ctx context.Context, id int) (*metabase.Database, error) {
+	db, err := get(ctx, f, f.databases, id, "database")
+	if err != nil {
+		return nil, err
+	}
+	db.Tables, _ = f.ListTables(ctx, id)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range db.Tables {
+		db.Tables[i].Fields = f.tableFields(db.Tables[i].ID)
+	}
+	return db, nil
+}
+
+// SyncDatabase implements metabase.DatabaseAPI. There is nothing to sync,
+// so it only checks that the database exists.
+func (f *Fake) SyncDatabase(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.databases[id]; !ok {
+		return notFound(http.MethodPost, fmt.Sprintf("/api/database/%d/sync_schema", id))
+	}
+	return nil
+}
+
+// DatabaseEngine implements metabase.DatabaseAPI.
+func (f *Fake) DatabaseEngine(ctx context.Context, id int) (string, error) {
+	db, err := f.GetDatabase(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return db.Engine, nil
+}
+
+// ListTables implements metabase.TableAPI. Tables are listed without their
+// fields.
+func (f *Fake) ListTables(ctx context.Context, databaseID int) ([]metabase.Table, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	_, ok := f.databases[databaseID]
+	f.mu.Unlock()
+	if !ok {
+		return nil, notFound(http.MethodGet, fmt.Sprintf("/api/database/%d/metadata/tables", databaseID))
+	}
+	tables, err := list(ctx, f, f.tables, func(t *metabase.Table) bool { return t.DBID == databaseID })
+	for i := range tables {
+		tables[i].Fields = nil
+	}
+	return tables, err
+}
+
+// GetTable implements metabase.TableAPI. The table is returned without its
+// fields.
+func (f *Fake) GetTable(ctx context.Context, id int) (*metabase.Table, error) {
+	t, err := get(ctx, f, f.tables, id, "table")
+	if err != nil {
+		return nil, err
+	}
+	t.Fields = nil
+	return t, nil
+}
+
+// GetTableMetadata implements metabase.TableAPI. The table is returned with
+// its fields.
+func (f *Fake) GetTableMetadata(ctx context.Context, id int) (*metabase.Table, error) {
+	t, err := get(ctx, f, f.tables, id, "table")
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t.Fields = f.tableFields(id)
+	return t, nil
+}
+
+// GetTableForeignKeys implements metabase.TableAPI. It lists the foreign
+// keys of other tables that point at this one, as Metabase does.
+func (f *Fake) GetTableForeignKeys(ctx context.Context, id int) ([]metabase.ForeignKey, error) {
+	if _, err := f.GetTable(ctx, id); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fks := []metabase.ForeignKey{}
+	for _, origin := range sorted(f.fields) {
+		if origin.FKTargetFieldID == nil {
+			continue
+		}
+		dest, ok := f.fields[*origin.FKTargetFieldID]
+		if !ok || dest.TableID != id {
+			continue
+		}
+		fks = append(fks, metabase.ForeignKey{
+			Origin:       &metabase.FKField{ID: origin.ID, Name: origin.Name, TableID: origin.TableID, Table: clone(f.tables[origin.TableID])},
+			Destination:  &metabase.FKField{ID: dest.ID, Name: dest.Name, TableID: dest.TableID, Table: clone(f.tables[dest.TableID])},
+			Relationship: "Mt1",
+		})
+	}
+	return fks, nil
+}
+
+// GetField implements metabase.FieldAPI.
+func (f *Fake) GetField(ctx context.Context, id int) (*metabase.Field, error) {
+	return get(ctx, f, f.fields, id, "field")
+}
+
+// GetFieldValues implements metabase.FieldAPI. The values are the distinct
+// values of the field in the table's rows, sorted.
+func (f *Fake) GetFieldValues(ctx context.Context, id int) (*metabase.FieldValues, error) {
+	if _, err := f.GetField(ctx, id); err != nil {
+		return nil, err
+	}
+	return &metabase.FieldValues{FieldID: id, Values: f.distinctValues(id, "", 0)}, nil
+}
+
+// SearchFieldValues implements metabase.FieldAPI. It returns up to limit
+// distinct values containing query, case-insensitively; a limit of zero or
+// less means no limit.
+func (f *Fake) SearchFieldValues(ctx context.Context, id int, query string, limit int) (*metabase.FieldValues, error) {
+	if _, err := f.GetField(ctx, id); err != nil {
+		return nil, err
+	}
+	return &metabase.FieldValues{FieldID: id, Values: f.distinctValues(id, query, limit)}, nil
+}
+
+// distinctValues returns the sorted distinct values of a field containing
+// query, one per row as Metabase formats them.
+func (f *Fake) distinctValues(fieldID int, query string, limit int) [][]any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	field := f.fields[fieldID]
+	col := slices.IndexFunc(f.tableFields(field.TableID), func(tf metabase.Field) bool { return tf.ID == fieldID })
+	seen := make(map[string]any)
+	for _, row := range f.rows[field.TableID] {
+		if col >= len(row) || row[col] == nil {
+			continue
+		}
+		key := fmt.Sprint(row[col])
+		if strings.Contains(strings.ToLower(key), strings.ToLower(query)) {
+			seen[key] = row[col]
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	values := make([][]any, len(keys))
+	for i, k := range keys {
+		values[i] = []any{seen[k]}
+	}
+	return values
+}
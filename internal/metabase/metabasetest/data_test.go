@@ -0,0 +1,62 @@
+package metabasetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+func TestFake_Metadata(t *testing.T) {
+	f, s := NewSample()
+	ctx := context.Background()
+
+	dbs, err := f.ListDatabases(ctx)
+	require.NoError(t, err)
+	require.Len(t, dbs, 1)
+	assert.Equal(t, "Sample Database", dbs[0].Name)
+	assert.Empty(t, dbs[0].Tables)
+
+	engine, err := f.DatabaseEngine(ctx, s.Database.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "h2", engine)
+
+	db, err := f.GetDatabaseMetadata(ctx, s.Database.ID)
+	require.NoError(t, err)
+	require.Len(t, db.Tables, 3)
+	assert.Len(t, db.Tables[2].Fields, 5)
+
+	table, err := f.GetTableMetadata(ctx, s.Orders.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5, *table.Rows)
+	assert.Equal(t, "USER_ID", table.Fields[1].Name)
+	assert.Equal(t, s.People.Fields[0].ID, *table.Fields[1].FKTargetFieldID)
+
+	fks, err := f.GetTableForeignKeys(ctx, s.Products.ID)
+	require.NoError(t, err)
+	require.Len(t, fks, 1)
+	assert.Equal(t, "PRODUCT_ID", fks[0].Origin.Name)
+	assert.Equal(t, "ORDERS", fks[0].Origin.Table.Name)
+
+	_, err = f.GetTable(ctx, 404)
+	assert.True(t, metabase.IsNotFound(err))
+	var apiErr *metabase.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "table 404", apiErr.Resource())
+}
+
+func TestFake_FieldValues(t *testing.T) {
+	f, s := NewSample()
+	category := s.Products.Fields[2].ID
+
+	values, err := f.GetFieldValues(context.Background(), category)
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"Doohickey"}, {"Gadget"}, {"Gizmo"}}, values.Values)
+
+	values, err = f.SearchFieldValues(context.Background(), category, "g", 1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{"Gadget"}}, values.Values)
+}
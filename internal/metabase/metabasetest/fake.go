@@ -0,0 +1,476 @@
+// Package metabasetest provides an in-memory implementation of
+// metabase.API for tests.
+//
+// Fake keeps cards, dashboards, collections, databases and table rows in
+// memory and behaves like Metabase where tools can tell the difference:
+// IDs are assigned on creation, missing objects and invalid input fail with
+// the *metabase.APIError Metabase would return, archived objects are left
+// out of listings, and queries run against the rows of the seeded tables.
+package metabasetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// DefaultVersion is the Metabase version a Fake reports unless SetVersion
+// is called.
+const DefaultVersion = "v0.50.0"
+
+// Fake is an in-memory metabase.API. The zero value is not usable; create
+// one with New or NewSample. It is safe for concurrent use.
+type Fake struct {
+	mu sync.Mutex
+
+	version  string
+	now      func() time.Time
+	lastID   map[string]int
+	current  int
+	users    map[int]*metabase.User
+	groups   map[int]*metabase.PermissionGroup
+	settings map[string]metabase.Setting
+
+	collections map[int]*metabase.Collection
+	cards       map[int]*metabase.Card
+	dashboards  map[int]*metabase.Dashboard
+	alerts      map[int]*metabase.Alert
+
+	databases map[int]*metabase.Database
+	tables    map[int]*metabase.Table
+	fields    map[int]*metabase.Field
+	rows      map[int][][]any // table ID -> rows, in field order
+
+	nativeResults map[string]*metabase.DatasetQueryResponse
+}
+
+var _ metabase.API = (*Fake)(nil)
+
+// New returns an empty Fake with an administrator as the current user and
+// the All Users and Administrators permission groups.
+func New() *Fake {
+	f := &Fake{
+		version:       DefaultVersion,
+		now:           time.Now,
+		lastID:        make(map[string]int),
+		users:         make(map[int]*metabase.User),
+		groups:        make(map[int]*metabase.PermissionGroup),
+		settings:      make(map[string]metabase.Setting),
+		collections:   make(map[int]*metabase.Collection),
+		cards:         make(map[int]*metabase.Card),
+		dashboards:    make(map[int]*metabase.Dashboard),
+		alerts:        make(map[int]*metabase.Alert),
+		databases:     make(map[int]*metabase.Database),
+		tables:        make(map[int]*metabase.Table),
+		fields:        make(map[int]*metabase.Field),
+		rows:          make(map[int][][]any),
+		nativeResults: make(map[string]*metabase.DatasetQueryResponse),
+	}
+	f.groups[f.nextID("group")] = &metabase.PermissionGroup{ID: 1, Name: "All Users"}
+	f.groups[f.nextID("group")] = &metabase.PermissionGroup{ID: 2, Name: "Administrators"}
+	f.current = f.AddUser(metabase.User{
+		Email:       "admin@example.com",
+		FirstName:   ptr("Ada"),
+		LastName:    ptr("Admin"),
+		IsSuperuser: ptr(true),
+		GroupIDs:    []int{1, 2},
+	}).ID
+	f.settings["site-name"] = metabase.Setting{Key: "site-name", Value: "Metabase", Default: "Metabase", Description: "The name used for this instance of Metabase."}
+	return f
+}
+
+// SetVersion sets the Metabase version tag ServerInfo reports.
+func (f *Fake) SetVersion(tag string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version = tag
+}
+
+// AddUser adds a user and returns it with its ID.
+func (f *Fake) AddUser(u metabase.User) *metabase.User {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	u.ID = f.nextID("user")
+	if u.IsActive == nil {
+		u.IsActive = ptr(true)
+	}
+	if u.CommonName == nil && u.FirstName != nil && u.LastName != nil {
+		u.CommonName = ptr(*u.FirstName + " " + *u.LastName)
+	}
+	if u.CreatedAt == nil {
+		u.CreatedAt = ptr(f.now())
+	}
+	f.users[u.ID] = &u
+	return clone(&u)
+}
+
+// SetSetting sets the value of a setting.
+func (f *Fake) SetSetting(key string, value any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.settings[key]
+	s.Key = key
+	s.Value = value
+	f.settings[key] = s
+}
+
+// nextID returns the next ID for objects of kind. f.mu must be held.
+func (f *Fake) nextID(kind string) int {
+	f.lastID[kind]++
+	return f.lastID[kind]
+}
+
+// BaseURL implements metabase.ServerAPI.
+func (f *Fake) BaseURL() string {
+	return "fake://metabase"
+}
+
+// HealthCheck implements metabase.ServerAPI.
+func (f *Fake) HealthCheck(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// ServerInfo implements metabase.ServerAPI.
+func (f *Fake) ServerInfo(ctx context.Context) (*metabase.ServerInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	version := metabase.ParseVersion(f.version)
+	var caps []metabase.Capability
+	for _, c := range []metabase.Capability{metabase.CapDashcards, metabase.CapLegacyAlerts, metabase.CapNotifications} {
+		if capable(version, c) {
+			caps = append(caps, c)
+		}
+	}
+	return &metabase.ServerInfo{Version: version, Capabilities: caps, Features: []string{}}, nil
+}
+
+// capable mirrors the capabilities metabase.Client derives from a version.
+func capable(v metabase.Version, c metabase.Capability) bool {
+	switch c {
+	case metabase.CapDashcards:
+		return v.AtLeast(47)
+	case metabase.CapNotifications:
+		return v.AtLeast(54)
+	case metabase.CapLegacyAlerts:
+		return !v.AtLeast(54)
+	}
+	return false
+}
+
+// ListUsers implements metabase.UserAPI.
+func (f *Fake) ListUsers(ctx context.Context, page metabase.Page) (*metabase.Paged[metabase.User], error) {
+	users, err := list(ctx, f, f.users, func(*metabase.User) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	return metabase.SlicePage(users, page), nil
+}
+
+// GetUser implements metabase.UserAPI.
+func (f *Fake) GetUser(ctx context.Context, id int) (*metabase.User, error) {
+	return get(ctx, f, f.users, id, "user")
+}
+
+// GetCurrentUser implements metabase.UserAPI.
+func (f *Fake) GetCurrentUser(ctx context.Context) (*metabase.User, error) {
+	return get(ctx, f, f.users, f.current, "user")
+}
+
+// ListPermissionGroups implements metabase.PermissionAPI.
+func (f *Fake) ListPermissionGroups(ctx context.Context) ([]metabase.PermissionGroup, error) {
+	return list(ctx, f, f.groups, func(*metabase.PermissionGroup) bool { return true })
+}
+
+// GetPermissionGroup implements metabase.PermissionAPI. The group lists
+// its members.
+func (f *Fake) GetPermissionGroup(ctx context.Context, id int) (*metabase.PermissionGroup, error) {
+	group, err := get(ctx, f, f.groups, id, "permissions/group")
+	if err != nil {
+		return nil, err
+	}
+	users, _ := f.ListUsers(ctx, metabase.Page{})
+	for _, u := range users.Data {
+		if slices.Contains(u.GroupIDs, id) {
+			group.Members = append(group.Members, u)
+		}
+	}
+	return group, nil
+}
+
+// GetPermissionsGraph implements metabase.PermissionAPI. Administrators
+// have full access to every database; other groups have none.
+func (f *Fake) GetPermissionsGraph(ctx context.Context) (map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	groups := make(map[string]any)
+	for id := range f.groups {
+		dbs := make(map[string]any)
+		for dbID := range f.databases {
+			access := map[string]any{"view-data": "blocked", "create-queries": "no"}
+			if id == 2 {
+				access = map[string]any{"view-data": "unrestricted", "create-queries": "query-builder-and-native"}
+			}
+			dbs[fmt.Sprint(dbID)] = access
+		}
+		groups[fmt.Sprint(id)] = dbs
+	}
+	return map[string]any{"revision": 1, "groups": groups}, nil
+}
+
+// ListSettings implements metabase.SettingAPI.
+func (f *Fake) ListSettings(ctx context.Context) ([]metabase.Setting, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	settings := make([]metabase.Setting, 0, len(f.settings))
+	for _, s := range f.settings {
+		settings = append(settings, s)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings, nil
+}
+
+// GetSetting implements metabase.SettingAPI.
+func (f *Fake) GetSetting(ctx context.Context, key string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.settings[key]
+	if !ok {
+		return nil, apiError(http.StatusNotFound, http.MethodGet, "/api/setting/"+key, "Unknown setting: "+key)
+	}
+	return s.Value, nil
+}
+
+// GetActivity implements metabase.ActivityAPI. The fake records no
+// activity.
+func (f *Fake) GetActivity(ctx context.Context, page metabase.Page) (*metabase.Paged[metabase.ActivityItem], error) {
+	return metabase.SlicePage([]metabase.ActivityItem{}, page), ctx.Err()
+}
+
+// GetRecentViews implements metabase.ActivityAPI. The fake records no
+// views.
+func (f *Fake) GetRecentViews(ctx context.Context) ([]metabase.RecentItem, error) {
+	return []metabase.RecentItem{}, ctx.Err()
+}
+
+// ListActions implements metabase.ActionAPI. The fake has no actions.
+func (f *Fake) ListActions(ctx context.Context, _ int) ([]metabase.Action, error) {
+	return []metabase.Action{}, ctx.Err()
+}
+
+// GetAction implements metabase.ActionAPI. The fake has no actions.
+func (f *Fake) GetAction(ctx context.Context, id int) (*metabase.Action, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, notFound(http.MethodGet, fmt.Sprintf("/api/action/%d", id))
+}
+
+// ListTimelines implements metabase.TimelineAPI. The fake has no
+// timelines.
+func (f *Fake) ListTimelines(ctx context.Context, _ *int) ([]metabase.Timeline, error) {
+	return []metabase.Timeline{}, ctx.Err()
+}
+
+// GetTimeline implements metabase.TimelineAPI. The fake has no timelines.
+func (f *Fake) GetTimeline(ctx context.Context, id int) (*metabase.Timeline, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return nil, notFound(http.MethodGet, fmt.Sprintf("/api/timeline/%d", id))
+}
+
+// InvalidateCache implements metabase.CacheAPI. The fake caches nothing.
+func (f *Fake) InvalidateCache(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Search implements metabase.SearchAPI. It matches the query against the
+// names of cards, dashboards, collections and tables, case-insensitively.
+func (f *Fake) Search(ctx context.Context, query string, models []string, page metabase.Page) (*metabase.Paged[metabase.SearchResult], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := strings.ToLower(query)
+	want := func(model, name string) bool {
+		return (len(models) == 0 || slices.Contains(models, model)) && strings.Contains(strings.ToLower(name), q)
+	}
+
+	var results []metabase.SearchResult
+	for _, c := range f.cards {
+		if !isArchived(c.Archived) && want("card", c.Name) {
+			results = append(results, metabase.SearchResult{ID: c.ID, Name: c.Name, Description: c.Description, Model: "card", CollectionID: c.CollectionID, DatabaseID: c.DatabaseID})
+		}
+	}
+	for _, d := range f.dashboards {
+		if !isArchived(d.Archived) && want("dashboard", d.Name) {
+			results = append(results, metabase.SearchResult{ID: d.ID, Name: d.Name, Description: d.Description, Model: "dashboard", CollectionID: d.CollectionID})
+		}
+	}
+	for _, c := range f.collections {
+		if !isArchived(c.Archived) && want("collection", c.Name) {
+			id := c.ID.(int)
+			results = append(results, metabase.SearchResult{ID: id, Name: c.Name, Description: c.Description, Model: "collection", CollectionID: c.ParentID})
+		}
+	}
+	for _, t := range f.tables {
+		if want("table", t.Name) {
+			id, db := t.ID, t.DBID
+			results = append(results, metabase.SearchResult{ID: t.ID, Name: t.Name, Description: t.Description, Model: "table", TableID: &id, DatabaseID: &db})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Model != results[j].Model {
+			return results[i].Model < results[j].Model
+		}
+		return results[i].ID < results[j].ID
+	})
+	if results == nil {
+		results = []metabase.SearchResult{}
+	}
+	return metabase.SlicePage(results, page), nil
+}
+
+// ListAlerts implements metabase.AlertAPI.
+func (f *Fake) ListAlerts(ctx context.Context) ([]metabase.Alert, error) {
+	if err := f.requireLegacyAlerts(); err != nil {
+		return nil, err
+	}
+	return list(ctx, f, f.alerts, func(*metabase.Alert) bool { return true })
+}
+
+// GetAlert implements metabase.AlertAPI.
+func (f *Fake) GetAlert(ctx context.Context, id int) (*metabase.Alert, error) {
+	if err := f.requireLegacyAlerts(); err != nil {
+		return nil, err
+	}
+	return get(ctx, f, f.alerts, id, "alert")
+}
+
+// CreateAlert implements metabase.AlertAPI. The card must exist.
+func (f *Fake) CreateAlert(ctx context.Context, alert *metabase.Alert) (*metabase.Alert, error) {
+	if err := f.requireLegacyAlerts(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	card, ok := f.cards[alert.CardID]
+	if !ok {
+		return nil, invalid(http.MethodPost, "/api/alert", "card", fmt.Sprintf("card %d does not exist", alert.CardID))
+	}
+	if alert.AlertCondition != "rows" && alert.AlertCondition != "goal" {
+		return nil, invalid(http.MethodPost, "/api/alert", "alert_condition", `value must be one of: "goal", "rows".`)
+	}
+	a := clone(alert)
+	a.ID = f.nextID("alert")
+	a.Card = clone(card)
+	a.Creator = clone(f.users[f.current])
+	a.CreatedAt = ptr(f.now())
+	f.alerts[a.ID] = a
+	return clone(a), nil
+}
+
+func (f *Fake) requireLegacyAlerts() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	version := metabase.ParseVersion(f.version)
+	if !capable(version, metabase.CapLegacyAlerts) {
+		return &metabase.UnsupportedError{Operation: "the alert API", Version: version, Hint: "manage alerts in Metabase's notification settings"}
+	}
+	return nil
+}
+
+// get returns a copy of the object with the given ID, or a 404 error for
+// /api/<kind>/<id>.
+func get[T any](ctx context.Context, f *Fake, objects map[int]*T, id int, kind string) (*T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := objects[id]
+	if !ok {
+		return nil, notFound(http.MethodGet, fmt.Sprintf("/api/%s/%d", kind, id))
+	}
+	return clone(obj), nil
+}
+
+// list returns copies of the objects keep accepts, ordered by ID.
+func list[T any](ctx context.Context, f *Fake, objects map[int]*T, keep func(*T) bool) ([]T, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]int, 0, len(objects))
+	for id, obj := range objects {
+		if keep(obj) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	result := make([]T, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, *clone(objects[id]))
+	}
+	return result, nil
+}
+
+// clone deep-copies v through JSON, as Metabase responses are fresh
+// objects.
+func clone[T any](v *T) *T {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("metabasetest: cloning %T: %v", v, err))
+	}
+	var c T
+	if err := json.Unmarshal(data, &c); err != nil {
+		panic(fmt.Sprintf("metabasetest: cloning %T: %v", v, err))
+	}
+	return &c
+}
+
+func apiError(status int, method, endpoint, message string) *metabase.APIError {
+	return &metabase.APIError{StatusCode: status, Method: method, Endpoint: endpoint, Message: message}
+}
+
+func notFound(method, endpoint string) *metabase.APIError {
+	return apiError(http.StatusNotFound, method, endpoint, "Not found.")
+}
+
+// invalid returns the 400 error Metabase gives for an invalid field.
+func invalid(method, endpoint, field, message string) *metabase.APIError {
+	return &metabase.APIError{StatusCode: http.StatusBadRequest, Method: method, Endpoint: endpoint, Errors: map[string]string{field: message}}
+}
+
+func isArchived(b *bool) bool {
+	return b != nil && *b
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
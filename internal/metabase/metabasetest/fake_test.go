@@ -0,0 +1,90 @@
+package metabasetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+func TestFake_ServerInfo(t *testing.T) {
+	tests := []struct {
+		version string
+		want    []metabase.Capability
+	}{
+		{version: "v0.46.6", want: []metabase.Capability{metabase.CapLegacyAlerts}},
+		{version: DefaultVersion, want: []metabase.Capability{metabase.CapDashcards, metabase.CapLegacyAlerts}},
+		{version: "v1.54.1", want: []metabase.Capability{metabase.CapDashcards, metabase.CapNotifications}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			f := New()
+			f.SetVersion(tt.version)
+			info, err := f.ServerInfo(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, info.Version.Tag)
+			assert.Equal(t, tt.want, info.Capabilities)
+		})
+	}
+}
+
+func TestFake_Alerts(t *testing.T) {
+	f, s := NewSample()
+	ctx := context.Background()
+
+	alert, err := f.CreateAlert(ctx, &metabase.Alert{CardID: s.NativeCard.ID, AlertCondition: "rows"})
+	require.NoError(t, err)
+	assert.Equal(t, "Recent orders", alert.Card.Name)
+	assert.Equal(t, "admin@example.com", alert.Creator.Email)
+
+	_, err = f.CreateAlert(ctx, &metabase.Alert{CardID: 404, AlertCondition: "rows"})
+	assert.Error(t, err)
+
+	f.SetVersion("v0.54.0")
+	_, err = f.ListAlerts(ctx)
+	var unsupported *metabase.UnsupportedError
+	assert.ErrorAs(t, err, &unsupported)
+}
+
+func TestFake_Search(t *testing.T) {
+	f, _ := NewSample()
+	result, err := f.Search(context.Background(), "product", nil, metabase.Page{})
+	require.NoError(t, err)
+	var got []string
+	for _, r := range result.Data {
+		got = append(got, r.Model+":"+r.Name)
+	}
+	assert.Equal(t, []string{"card:Products", "table:PRODUCTS"}, got)
+
+	result, err = f.Search(context.Background(), "product", []string{"table"}, metabase.Page{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Total)
+
+	result, err = f.Search(context.Background(), "product", nil, metabase.Page{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Total)
+	require.Len(t, result.Data, 1)
+	assert.Equal(t, "PRODUCTS", result.Data[0].Name)
+}
+
+func TestFake_Users(t *testing.T) {
+	f := New()
+	ctx := context.Background()
+
+	me, err := f.GetCurrentUser(ctx)
+	require.NoError(t, err)
+	assert.True(t, *me.IsSuperuser)
+
+	analyst := f.AddUser(metabase.User{Email: "analyst@example.com", GroupIDs: []int{1}})
+	group, err := f.GetPermissionGroup(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, group.Members, 2)
+
+	group, err = f.GetPermissionGroup(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, group.Members, 1)
+	assert.NotEqual(t, analyst.ID, group.Members[0].ID)
+}
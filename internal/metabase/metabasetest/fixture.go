@@ -0,0 +1,365 @@
+package metabasetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// Fixture is the JSON description of a Metabase instance that Load seeds a
+// Fake with. Objects refer to each other by name, since their IDs are only
+// assigned when they are loaded.
+type Fixture struct {
+	// Version is the Metabase version tag; DefaultVersion if empty.
+	Version string `json:"version,omitempty"`
+	// APIKeys and the users' passwords are the credentials an HTTP server
+	// for the fixture accepts. The Fake itself does not authenticate.
+	APIKeys       []string              `json:"api_keys,omitempty"`
+	Users         []FixtureUser         `json:"users,omitempty"`
+	Databases     []FixtureDatabase     `json:"databases,omitempty"`
+	Collections   []FixtureCollection   `json:"collections,omitempty"`
+	Cards         []FixtureCard         `json:"cards,omitempty"`
+	Dashboards    []FixtureDashboard    `json:"dashboards,omitempty"`
+	NativeResults []FixtureNativeResult `json:"native_results,omitempty"`
+	Settings      map[string]any        `json:"settings,omitempty"`
+}
+
+// FixtureUser is a user of a Fixture. The user with the email of the
+// Fake's administrator, admin@example.com, updates it instead of adding one.
+type FixtureUser struct {
+	metabase.User
+	Password string `json:"password,omitempty"`
+}
+
+// FixtureDatabase is a database of a Fixture.
+type FixtureDatabase struct {
+	Name     string         `json:"name"`
+	Engine   string         `json:"engine"`
+	Features []string       `json:"features,omitempty"`
+	Tables   []FixtureTable `json:"tables"`
+}
+
+// FixtureTable is a table of a FixtureDatabase and its rows, which hold one
+// value per field, in field order.
+type FixtureTable struct {
+	Name        string         `json:"name"`
+	DisplayName string         `json:"display_name,omitempty"`
+	Schema      string         `json:"schema,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Fields      []FixtureField `json:"fields"`
+	Rows        [][]any        `json:"rows,omitempty"`
+}
+
+// FixtureField is a field of a FixtureTable.
+type FixtureField struct {
+	Name         string `json:"name"`
+	DisplayName  string `json:"display_name,omitempty"`
+	BaseType     string `json:"base_type"`
+	DatabaseType string `json:"database_type,omitempty"`
+	SemanticType string `json:"semantic_type,omitempty"`
+	// ForeignKey names the field this one refers to as TABLE.FIELD, in the
+	// same database.
+	ForeignKey string `json:"foreign_key,omitempty"`
+}
+
+// FixtureCollection is a collection of a Fixture.
+type FixtureCollection struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parent names the parent collection; empty for the root collection.
+	Parent string `json:"parent,omitempty"`
+}
+
+// FixtureCard is a card of a Fixture. In its dataset_query, "database" and
+// the "source-table" of an MBQL query may be given by name.
+type FixtureCard struct {
+	Name         string         `json:"name"`
+	Description  string         `json:"description,omitempty"`
+	Display      string         `json:"display"`
+	Collection   string         `json:"collection,omitempty"`
+	DatasetQuery map[string]any `json:"dataset_query"`
+}
+
+// FixtureDashboard is a dashboard of a Fixture.
+type FixtureDashboard struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Collection  string            `json:"collection,omitempty"`
+	Cards       []FixtureDashCard `json:"cards,omitempty"`
+}
+
+// FixtureDashCard places a card, by name, on a FixtureDashboard.
+type FixtureDashCard struct {
+	Card  string `json:"card"`
+	Row   int    `json:"row"`
+	Col   int    `json:"col"`
+	SizeX int    `json:"size_x,omitempty"`
+	SizeY int    `json:"size_y,omitempty"`
+}
+
+// FixtureNativeResult is the result of a native query the Fake cannot run
+// itself; see SetNativeResult.
+type FixtureNativeResult struct {
+	SQL  string                `json:"sql"`
+	Cols []metabase.DatasetCol `json:"cols"`
+	Rows [][]any               `json:"rows"`
+}
+
+// ReadFixture reads a Fixture from a JSON file.
+func ReadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture: %w", err)
+	}
+	return ParseFixture(data)
+}
+
+// ParseFixture parses a JSON Fixture. Unknown fields are rejected, so that
+// typos do not silently leave objects out.
+func ParseFixture(data []byte) (*Fixture, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var fx Fixture
+	if err := dec.Decode(&fx); err != nil {
+		return nil, fmt.Errorf("parse fixture: %w", err)
+	}
+	return &fx, nil
+}
+
+// NewFromFixture returns a Fake seeded with fx.
+func NewFromFixture(fx *Fixture) (*Fake, error) {
+	f := New()
+	if err := f.Load(fx); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Load adds the objects of fx to the Fake.
+func (f *Fake) Load(fx *Fixture) error {
+	ctx := context.Background()
+	if fx.Version != "" {
+		f.SetVersion(fx.Version)
+	}
+	for key, value := range fx.Settings {
+		f.SetSetting(key, value)
+	}
+	if err := f.loadUsers(ctx, fx.Users); err != nil {
+		return err
+	}
+
+	databases := make(map[string]*metabase.Database)
+	for _, fdb := range fx.Databases {
+		db, err := f.loadDatabase(fdb)
+		if err != nil {
+			return fmt.Errorf("database %q: %w", fdb.Name, err)
+		}
+		databases[db.Name] = db
+	}
+
+	collections := make(map[string]int)
+	for _, fc := range fx.Collections {
+		c := &metabase.Collection{Name: fc.Name, Description: nonEmpty(fc.Description)}
+		if fc.Parent != "" {
+			parent, ok := collections[fc.Parent]
+			if !ok {
+				return fmt.Errorf("collection %q: unknown parent %q", fc.Name, fc.Parent)
+			}
+			c.ParentID = &parent
+		}
+		created, err := f.CreateCollection(ctx, c)
+		if err != nil {
+			return fmt.Errorf("collection %q: %w", fc.Name, err)
+		}
+		collections[fc.Name] = created.ID.(int)
+	}
+	collection := func(name string) (*int, error) {
+		if name == "" {
+			return nil, nil
+		}
+		id, ok := collections[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown collection %q", name)
+		}
+		return &id, nil
+	}
+
+	cards := make(map[string]int)
+	for _, fc := range fx.Cards {
+		collectionID, err := collection(fc.Collection)
+		if err != nil {
+			return fmt.Errorf("card %q: %w", fc.Name, err)
+		}
+		query, err := resolveQuery(fc.DatasetQuery, databases)
+		if err != nil {
+			return fmt.Errorf("card %q: %w", fc.Name, err)
+		}
+		card, err := f.CreateCard(ctx, &metabase.Card{
+			Name:         fc.Name,
+			Description:  nonEmpty(fc.Description),
+			Display:      fc.Display,
+			CollectionID: collectionID,
+			DatasetQuery: query,
+		})
+		if err != nil {
+			return fmt.Errorf("card %q: %w", fc.Name, err)
+		}
+		cards[fc.Name] = card.ID
+	}
+
+	for _, fd := range fx.Dashboards {
+		collectionID, err := collection(fd.Collection)
+		if err != nil {
+			return fmt.Errorf("dashboard %q: %w", fd.Name, err)
+		}
+		dashboard, err := f.CreateDashboard(ctx, &metabase.Dashboard{Name: fd.Name, Description: nonEmpty(fd.Description), CollectionID: collectionID})
+		if err != nil {
+			return fmt.Errorf("dashboard %q: %w", fd.Name, err)
+		}
+		for _, dc := range fd.Cards {
+			cardID, ok := cards[dc.Card]
+			if !ok {
+				return fmt.Errorf("dashboard %q: unknown card %q", fd.Name, dc.Card)
+			}
+			if _, err := f.AddCardToDashboard(ctx, dashboard.ID, &metabase.DashCard{CardID: &cardID, Row: dc.Row, Col: dc.Col, SizeX: dc.SizeX, SizeY: dc.SizeY}); err != nil {
+				return fmt.Errorf("dashboard %q: %w", fd.Name, err)
+			}
+		}
+	}
+
+	for _, r := range fx.NativeResults {
+		f.SetNativeResult(r.SQL, r.Cols, r.Rows)
+	}
+	return nil
+}
+
+func (f *Fake) loadUsers(ctx context.Context, users []FixtureUser) error {
+	page, err := f.ListUsers(ctx, metabase.Page{})
+	if err != nil {
+		return err
+	}
+	existing := page.Data
+	for _, fu := range users {
+		if fu.Email == "" {
+			return fmt.Errorf("user without email")
+		}
+		if len(existing) > 0 && fu.Email == existing[0].Email {
+			f.mu.Lock()
+			u := merge(f.users[existing[0].ID], &fu.User)
+			u.ID = existing[0].ID
+			f.users[u.ID] = u
+			f.mu.Unlock()
+			continue
+		}
+		f.AddUser(fu.User)
+	}
+	return nil
+}
+
+func (f *Fake) loadDatabase(fdb FixtureDatabase) (*metabase.Database, error) {
+	db := metabase.Database{Name: fdb.Name, Engine: fdb.Engine, Features: fdb.Features}
+	for _, ft := range fdb.Tables {
+		t := metabase.Table{Name: ft.Name, DisplayName: nonEmpty(ft.DisplayName), Schema: nonEmpty(ft.Schema), Description: nonEmpty(ft.Description)}
+		for _, ff := range ft.Fields {
+			t.Fields = append(t.Fields, metabase.Field{
+				Name:         ff.Name,
+				DisplayName:  nonEmpty(ff.DisplayName),
+				BaseType:     ff.BaseType,
+				DatabaseType: ff.DatabaseType,
+				SemanticType: nonEmpty(ff.SemanticType),
+			})
+		}
+		db.Tables = append(db.Tables, t)
+	}
+	added := f.AddDatabase(db)
+
+	for i, ft := range fdb.Tables {
+		table := &added.Tables[i]
+		for j, ff := range ft.Fields {
+			if ff.ForeignKey == "" {
+				continue
+			}
+			target, ok := findField(added, ff.ForeignKey)
+			if !ok {
+				return nil, fmt.Errorf("field %s.%s: unknown foreign key %q", ft.Name, ff.Name, ff.ForeignKey)
+			}
+			table.Fields[j].FKTargetFieldID = &target
+			f.mu.Lock()
+			f.fields[table.Fields[j].ID].FKTargetFieldID = &target
+			f.mu.Unlock()
+		}
+		for _, row := range ft.Rows {
+			if len(row) != len(ft.Fields) {
+				return nil, fmt.Errorf("table %s: row %v has %d values for %d fields", ft.Name, row, len(row), len(ft.Fields))
+			}
+		}
+		f.SetRows(table.ID, ft.Rows...)
+		n := len(ft.Rows)
+		table.Rows = &n
+	}
+	return added, nil
+}
+
+// findField returns the ID of the field named TABLE.FIELD in db.
+func findField(db *metabase.Database, name string) (int, bool) {
+	table, field, ok := strings.Cut(name, ".")
+	if !ok {
+		return 0, false
+	}
+	for _, t := range db.Tables {
+		if !strings.EqualFold(t.Name, table) {
+			continue
+		}
+		for _, f := range t.Fields {
+			if strings.EqualFold(f.Name, field) {
+				return f.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// resolveQuery replaces a database and source-table given by name in a
+// fixture dataset_query with their IDs.
+func resolveQuery(query map[string]any, databases map[string]*metabase.Database) (map[string]any, error) {
+	query = clonedMap(query)
+	name, ok := query["database"].(string)
+	if !ok {
+		return query, nil
+	}
+	db, ok := databases[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown database %q", name)
+	}
+	query["database"] = db.ID
+	mbql, _ := query["query"].(map[string]any)
+	if table, ok := mbql["source-table"].(string); ok {
+		for _, t := range db.Tables {
+			if strings.EqualFold(t.Name, table) {
+				mbql["source-table"] = t.ID
+				return query, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+	return query, nil
+}
+
+func clonedMap(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	return *clone(&m)
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
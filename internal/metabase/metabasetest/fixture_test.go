@@ -0,0 +1,88 @@
+package metabasetest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+func TestReadFixture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"version": "v0.46.2",
+		"databases": [{"name": "Shop", "engine": "postgres", "tables": [
+			{"name": "items", "fields": [{"name": "id", "base_type": "type/Integer"}, {"name": "sku", "base_type": "type/Text"}],
+			 "rows": [[1, "A-1"], [2, "B-2"]]}
+		]}],
+		"collections": [{"name": "Team"}, {"name": "Drafts", "parent": "Team"}],
+		"cards": [{"name": "Items", "display": "table", "collection": "Drafts",
+			"dataset_query": {"database": "Shop", "type": "query", "query": {"source-table": "items"}}}]
+	}`), 0o600))
+
+	fx, err := ReadFixture(path)
+	require.NoError(t, err)
+	f, err := NewFromFixture(fx)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	info, err := f.ServerInfo(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 46, info.Version.Release)
+
+	cards, err := f.ListCards(ctx, metabase.Page{})
+	require.NoError(t, err)
+	require.Len(t, cards.Data, 1)
+	assert.Equal(t, 2, *cards.Data[0].CollectionID)
+	result, err := f.ExecuteCardQuery(ctx, cards.Data[0].ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{float64(1), "A-1"}, {float64(2), "B-2"}}, result.Data.Rows)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		want    string
+	}{
+		{
+			name:    "unknown field",
+			fixture: `{"dashbords": []}`,
+			want:    `parse fixture: json: unknown field "dashbords"`,
+		},
+		{
+			name:    "unknown foreign key",
+			fixture: `{"databases": [{"name": "Shop", "engine": "h2", "tables": [{"name": "T", "fields": [{"name": "F", "base_type": "type/Integer", "foreign_key": "U.ID"}]}]}]}`,
+			want:    `database "Shop": field T.F: unknown foreign key "U.ID"`,
+		},
+		{
+			name:    "short row",
+			fixture: `{"databases": [{"name": "Shop", "engine": "h2", "tables": [{"name": "T", "fields": [{"name": "F", "base_type": "type/Integer"}], "rows": [[]]}]}]}`,
+			want:    `database "Shop": table T: row [] has 0 values for 1 fields`,
+		},
+		{
+			name:    "unknown collection",
+			fixture: `{"cards": [{"name": "C", "display": "table", "collection": "Nope", "dataset_query": {}}]}`,
+			want:    `card "C": unknown collection "Nope"`,
+		},
+		{
+			name:    "unknown card",
+			fixture: `{"dashboards": [{"name": "D", "cards": [{"card": "Nope"}]}]}`,
+			want:    `dashboard "D": unknown card "Nope"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fx, err := ParseFixture([]byte(tt.fixture))
+			if err == nil {
+				_, err = NewFromFixture(fx)
+			}
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package metabasetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// SetNativeResult makes native queries whose SQL is sql, ignoring case,
+// whitespace and a trailing semicolon, return cols and rows. Queries the
+// fake cannot run itself need one.
+func (f *Fake) SetNativeResult(sql string, cols []metabase.DatasetCol, rows [][]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nativeResults[normalizeSQL(sql)] = &metabase.DatasetQueryResponse{
+		Data:     metabase.DatasetData{Cols: slices.Clone(cols), Rows: slices.Clone(rows)},
+		Status:   "completed",
+		RowCount: len(rows),
+	}
+}
+
+// ExecuteQuery implements metabase.DatasetAPI.
+//
+// Native queries return the result registered with SetNativeResult or, for
+// "SELECT * | columns | COUNT(*) FROM table [LIMIT n]" and the limit
+// wrapper of metabase.LimitNativeSQL, the rows of the table. MBQL queries
+// support source-table, fields, a count aggregation and limit. Anything else
+// fails as an invalid query.
+func (f *Fake) ExecuteQuery(ctx context.Context, req *metabase.DatasetQueryRequest) (*metabase.DatasetQueryResponse, error) {
+	return f.run(ctx, req, "/api/dataset")
+}
+
+// ExportQueryResults implements metabase.DatasetAPI for the "csv" and
+// "json" formats.
+func (f *Fake) ExportQueryResults(ctx context.Context, req *metabase.DatasetQueryRequest, format string) ([]byte, error) {
+	endpoint := "/api/dataset/" + format
+	if format != "csv" && format != "json" {
+		return nil, invalid(http.MethodPost, endpoint, "export-format", `value must be one of: "csv", "json".`)
+	}
+	result, err := f.run(ctx, req, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if format == "json" {
+		records := make([]map[string]any, len(result.Data.Rows))
+		for i, row := range result.Data.Rows {
+			records[i] = make(map[string]any)
+			for j, col := range result.Data.Cols {
+				records[i][col.DisplayName] = row[j]
+			}
+		}
+		return json.Marshal(records)
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := make([]string, len(result.Data.Cols))
+	for i, col := range result.Data.Cols {
+		header[i] = col.DisplayName
+	}
+	_ = w.Write(header)
+	for _, row := range result.Data.Rows {
+		record := make([]string, len(row))
+		for i, v := range row {
+			if v != nil {
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		_ = w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// CompileNativeQuery implements metabase.DatasetAPI. Template tags are
+// replaced with the values of req.Parameters, quoted as SQL literals, card
+// references ({{#12}}) with the card's SQL as a subquery, and optional
+// clauses ([[...]]) whose tags have no value are dropped.
+func (f *Fake) CompileNativeQuery(ctx context.Context, req *metabase.DatasetQueryRequest) (*metabase.NativeForm, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.Native == nil {
+		return nil, invalid(http.MethodPost, "/api/dataset/native", "native", "value must be a map.")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sql, err := f.compile(req.Native.Query, parameterValues(req.Parameters))
+	if err != nil {
+		return nil, &metabase.APIError{StatusCode: http.StatusBadRequest, Method: http.MethodPost, Endpoint: "/api/dataset/native", Message: err.Error()}
+	}
+	return &metabase.NativeForm{Query: sql}, nil
+}
+
+var (
+	optionalClause = regexp.MustCompile(`(?s)\[\[(.*?)\]\]`)
+	templateTag    = regexp.MustCompile(`\{\{\s*([^}]+?)\s*\}\}`)
+)
+
+// compile substitutes the template tags of sql. f.mu must be held.
+func (f *Fake) compile(sql string, values map[string]any) (string, error) {
+	sql = optionalClause.ReplaceAllStringFunc(sql, func(clause string) string {
+		for _, m := range templateTag.FindAllStringSubmatch(clause, -1) {
+			if _, ok := values[m[1]]; !ok && !strings.HasPrefix(m[1], "#") {
+				return ""
+			}
+		}
+		return clause[2 : len(clause)-2]
+	})
+	var missing []string
+	sql = templateTag.ReplaceAllStringFunc(sql, func(tag string) string {
+		name := templateTag.FindStringSubmatch(tag)[1]
+		if ref, ok := strings.CutPrefix(name, "#"); ok {
+			id, _ := strconv.Atoi(strings.SplitN(ref, "-", 2)[0])
+			if card, ok := f.cards[id]; ok {
+				if req, err := datasetQuery(card.DatasetQuery); err == nil && req.Native != nil {
+					return "(" + req.Native.Query + ")"
+				}
+			}
+			missing = append(missing, name)
+			return tag
+		}
+		v, ok := values[name]
+		if !ok {
+			missing = append(missing, name)
+			return tag
+		}
+		return sqlLiteral(v)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing required parameters: %s", strings.Join(missing, ", "))
+	}
+	return sql, nil
+}
+
+// parameterValues maps template tag names to the values of Metabase query
+// parameters, whose targets look like ["variable", ["template-tag", name]].
+func parameterValues(parameters []any) map[string]any {
+	values := make(map[string]any)
+	for _, p := range parameters {
+		param, _ := p.(map[string]any)
+		target, _ := param["target"].([]any)
+		if len(target) < 2 {
+			continue
+		}
+		tag, _ := target[1].([]any)
+		if len(tag) < 2 || tag[0] != "template-tag" {
+			continue
+		}
+		name, _ := tag[1].(string)
+		if v, ok := param["value"]; ok && v != nil {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = sqlLiteral(e)
+		}
+		return strings.Join(parts, ", ")
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	}
+	return fmt.Sprint(v)
+}
+
+// run executes req, reporting failures as Metabase does for endpoint.
+func (f *Fake) run(ctx context.Context, req *metabase.DatasetQueryRequest, endpoint string) (*metabase.DatasetQueryResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fail := func(format string, args ...any) error {
+		return &metabase.APIError{
+			StatusCode: http.StatusAccepted,
+			Method:     http.MethodPost,
+			Endpoint:   endpoint,
+			Message:    fmt.Sprintf(format, args...),
+			ErrorType:  "invalid-query",
+		}
+	}
+	if _, ok := f.databases[req.Database]; !ok {
+		return nil, fail("Database %d does not exist.", req.Database)
+	}
+
+	var result *metabase.DatasetQueryResponse
+	switch req.Type {
+	case "native":
+		if req.Native == nil {
+			return nil, fail("Native query is missing.")
+		}
+		sql, err := f.compile(req.Native.Query, parameterValues(req.Parameters))
+		if err != nil {
+			return nil, fail("%s", err)
+		}
+		if result, err = f.runNative(req.Database, sql); err != nil {
+			return nil, fail("%s", err)
+		}
+		result.Data.NativeForm = &metabase.NativeForm{Query: sql}
+	case "query":
+		var err error
+		if result, err = f.runMBQL(req.Database, req.Query); err != nil {
+			return nil, fail("%s", err)
+		}
+	default:
+		return nil, fail("Invalid query type: %q", req.Type)
+	}
+	result.Status = "completed"
+	result.DatabaseID = req.Database
+	result.RowCount = len(result.Data.Rows)
+	return clone(result), nil
+}
+
+var (
+	limitWrapper = regexp.MustCompile(`(?is)^SELECT \* FROM \(\s*(.*?)\s*\) AS mcp_limited LIMIT (\d+)$`)
+	simpleSelect = regexp.MustCompile(`(?is)^SELECT\s+(.+?)\s+FROM\s+([\w."]+)(?:\s+LIMIT\s+(\d+))?$`)
+)
+
+// runNative runs sql against the rows of database dbID. f.mu must be held.
+func (f *Fake) runNative(dbID int, sql string) (*metabase.DatasetQueryResponse, error) {
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	if canned, ok := f.nativeResults[normalizeSQL(sql)]; ok {
+		return clone(canned), nil
+	}
+	if m := limitWrapper.FindStringSubmatch(sql); m != nil {
+		result, err := f.runNative(dbID, m[1])
+		if err != nil {
+			return nil, err
+		}
+		limit, _ := strconv.Atoi(m[2])
+		result.Data.Rows = result.Data.Rows[:min(limit, len(result.Data.Rows))]
+		return result, nil
+	}
+	m := simpleSelect.FindStringSubmatch(sql)
+	if m == nil {
+		return nil, fmt.Errorf("the fake cannot run this query; register its result with SetNativeResult")
+	}
+	name := strings.ReplaceAll(m[2], `"`, "")
+	name = name[strings.LastIndex(name, ".")+1:]
+	var table *metabase.Table
+	for _, t := range sorted(f.tables) {
+		if t.DBID == dbID && strings.EqualFold(t.Name, name) {
+			table = t
+			break
+		}
+	}
+	if table == nil {
+		return nil, fmt.Errorf("table %q not found", name)
+	}
+
+	fields := f.tableFields(table.ID)
+	var ids []int
+	if columns := strings.TrimSpace(m[1]); strings.EqualFold(strings.ReplaceAll(columns, " ", ""), "count(*)") {
+		return countResult(len(f.rows[table.ID])), nil
+	} else if columns != "*" {
+		for _, c := range strings.Split(columns, ",") {
+			c = strings.Trim(strings.TrimSpace(c), `"`)
+			i := slices.IndexFunc(fields, func(field metabase.Field) bool { return strings.EqualFold(field.Name, c) })
+			if i < 0 {
+				return nil, fmt.Errorf("column %q not found", c)
+			}
+			ids = append(ids, fields[i].ID)
+		}
+	}
+	result := f.selectRows(table.ID, ids)
+	if m[3] != "" {
+		limit, _ := strconv.Atoi(m[3])
+		result.Data.Rows = result.Data.Rows[:min(limit, len(result.Data.Rows))]
+	}
+	return result, nil
+}
+
+// runMBQL runs a structured query. f.mu must be held.
+func (f *Fake) runMBQL(dbID int, query map[string]any) (*metabase.DatasetQueryResponse, error) {
+	tableID, ok := sourceTable(query)
+	if !ok {
+		return nil, fmt.Errorf("query is missing a source-table")
+	}
+	if t, ok := f.tables[tableID]; !ok || t.DBID != dbID {
+		return nil, fmt.Errorf("table %d not found", tableID)
+	}
+	if aggregation, ok := query["aggregation"].([]any); ok && len(aggregation) > 0 {
+		agg, _ := aggregation[0].([]any)
+		if len(aggregation) != 1 || len(agg) != 1 || agg[0] != "count" {
+			return nil, fmt.Errorf("the fake supports only the count aggregation")
+		}
+		return countResult(len(f.rows[tableID])), nil
+	}
+	var ids []int
+	if fieldRefs, ok := query["fields"].([]any); ok {
+		for _, ref := range fieldRefs {
+			id, ok := fieldID(ref)
+			if !ok || f.fields[id] == nil || f.fields[id].TableID != tableID {
+				return nil, fmt.Errorf("invalid field reference %v", ref)
+			}
+			ids = append(ids, id)
+		}
+	}
+	result := f.selectRows(tableID, ids)
+	if limit, ok := toInt(query["limit"]); ok {
+		result.Data.Rows = result.Data.Rows[:min(limit, len(result.Data.Rows))]
+	}
+	return result, nil
+}
+
+// selectRows returns the rows of a table with the given fields, or all of
+// them if ids is empty. f.mu must be held.
+func (f *Fake) selectRows(tableID int, ids []int) *metabase.DatasetQueryResponse {
+	fields := f.tableFields(tableID)
+	var columns []int
+	if len(ids) == 0 {
+		for i := range fields {
+			columns = append(columns, i)
+		}
+	} else {
+		for _, id := range ids {
+			columns = append(columns, slices.IndexFunc(fields, func(field metabase.Field) bool { return field.ID == id }))
+		}
+	}
+	result := &metabase.DatasetQueryResponse{Data: metabase.DatasetData{Cols: []metabase.DatasetCol{}, Rows: [][]any{}}}
+	for _, i := range columns {
+		field := fields[i]
+		display := field.Name
+		if field.DisplayName != nil {
+			display = *field.DisplayName
+		}
+		result.Data.Cols = append(result.Data.Cols, metabase.DatasetCol{
+			Name:        field.Name,
+			DisplayName: display,
+			BaseType:    field.BaseType,
+			FieldRef:    []any{"field", field.ID, nil},
+		})
+	}
+	for _, row := range f.rows[tableID] {
+		out := make([]any, len(columns))
+		for j, i := range columns {
+			if i < len(row) {
+				out[j] = row[i]
+			}
+		}
+		result.Data.Rows = append(result.Data.Rows, out)
+	}
+	return result
+}
+
+func countResult(n int) *metabase.DatasetQueryResponse {
+	return &metabase.DatasetQueryResponse{Data: metabase.DatasetData{
+		Cols: []metabase.DatasetCol{{Name: "count", DisplayName: "Count", BaseType: "type/BigInteger", FieldRef: []any{"aggregation", 0}}},
+		Rows: [][]any{{n}},
+	}}
+}
+
+// datasetQuery decodes the dataset_query of a card.
+func datasetQuery(query map[string]any) (*metabase.DatasetQueryRequest, error) {
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	var req metabase.DatasetQueryRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("decode dataset_query: %w", err)
+	}
+	return &req, nil
+}
+
+// sourceTable returns the source-table of an MBQL query.
+func sourceTable(query map[string]any) (int, bool) {
+	return toInt(query["source-table"])
+}
+
+// fieldID returns the ID of a field reference such as ["field", 12, null].
+func fieldID(ref any) (int, bool) {
+	r, _ := ref.([]any)
+	if len(r) < 2 || r[0] != "field" {
+		return 0, false
+	}
+	return toInt(r[1])
+}
+
+func toInt(v any) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), n == float64(int(n))
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	}
+	return 0, false
+}
+
+func normalizeSQL(sql string) string {
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	return strings.ToLower(strings.Join(strings.Fields(sql), " "))
+}
@@ -0,0 +1,178 @@
+package metabasetest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+func TestFake_ExecuteQuery(t *testing.T) {
+	f, s := NewSample()
+	f.SetNativeResult("SELECT CATEGORY, COUNT(*) FROM PRODUCTS GROUP BY CATEGORY",
+		[]metabase.DatasetCol{{Name: "CATEGORY"}, {Name: "count"}},
+		[][]any{{"Doohickey", 2}, {"Gadget", 1}, {"Gizmo", 1}})
+	native := func(sql string) *metabase.DatasetQueryRequest {
+		return &metabase.DatasetQueryRequest{Database: s.Database.ID, Type: "native", Native: &metabase.NativeQuery{Query: sql}}
+	}
+	mbql := func(query map[string]any) *metabase.DatasetQueryRequest {
+		return &metabase.DatasetQueryRequest{Database: s.Database.ID, Type: "query", Query: query}
+	}
+
+	tests := []struct {
+		name     string
+		req      *metabase.DatasetQueryRequest
+		wantCols []string
+		wantRows int
+	}{
+		{name: "select star", req: native("SELECT * FROM ORDERS"), wantCols: []string{"ID", "USER_ID", "PRODUCT_ID", "TOTAL", "CREATED_AT"}, wantRows: 5},
+		{name: "columns and limit", req: native(`select "TITLE", price from PUBLIC.PRODUCTS limit 2;`), wantCols: []string{"TITLE", "PRICE"}, wantRows: 2},
+		{name: "count", req: native("SELECT COUNT(*) FROM PEOPLE"), wantCols: []string{"count"}, wantRows: 1},
+		{name: "limit wrapper", req: native("SELECT * FROM (\nSELECT * FROM ORDERS\n) AS mcp_limited LIMIT 3"), wantCols: []string{"ID", "USER_ID", "PRODUCT_ID", "TOTAL", "CREATED_AT"}, wantRows: 3},
+		{name: "registered result", req: native("select category, count(*)\nfrom products group by category"), wantCols: []string{"CATEGORY", "count"}, wantRows: 3},
+		{name: "mbql", req: mbql(map[string]any{"source-table": s.Products.ID, "fields": []any{[]any{"field", s.Products.Fields[1].ID, nil}}, "limit": 1}), wantCols: []string{"TITLE"}, wantRows: 1},
+		{name: "mbql count", req: mbql(map[string]any{"source-table": s.Orders.ID, "aggregation": []any{[]any{"count"}}}), wantCols: []string{"count"}, wantRows: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := f.ExecuteQuery(context.Background(), tt.req)
+			require.NoError(t, err)
+			assert.Equal(t, "completed", result.Status)
+			assert.Equal(t, tt.wantRows, result.RowCount)
+			assert.Len(t, result.Data.Rows, tt.wantRows)
+			var cols []string
+			for _, col := range result.Data.Cols {
+				cols = append(cols, col.Name)
+			}
+			assert.Equal(t, tt.wantCols, cols)
+		})
+	}
+}
+
+func TestFake_ExecuteQuery_Failures(t *testing.T) {
+	f, s := NewSample()
+	tests := []struct {
+		name string
+		req  *metabase.DatasetQueryRequest
+		want string
+	}{
+		{
+			name: "unknown table",
+			req:  &metabase.DatasetQueryRequest{Database: s.Database.ID, Type: "native", Native: &metabase.NativeQuery{Query: "SELECT * FROM INVOICES"}},
+			want: `table "INVOICES" not found`,
+		},
+		{
+			name: "unsupported SQL",
+			req:  &metabase.DatasetQueryRequest{Database: s.Database.ID, Type: "native", Native: &metabase.NativeQuery{Query: "SELECT 1"}},
+			want: "the fake cannot run this query; register its result with SetNativeResult",
+		},
+		{
+			name: "unknown database",
+			req:  &metabase.DatasetQueryRequest{Database: 99, Type: "query", Query: map[string]any{"source-table": 1}},
+			want: "Database 99 does not exist.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.ExecuteQuery(context.Background(), tt.req)
+			var apiErr *metabase.APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.True(t, apiErr.QueryFailed())
+			assert.Equal(t, "invalid-query", apiErr.ErrorType)
+			assert.Equal(t, tt.want, apiErr.Message)
+		})
+	}
+}
+
+func TestFake_CompileNativeQuery(t *testing.T) {
+	f, s := NewSample()
+	param := func(name string, value any) map[string]any {
+		return map[string]any{"type": "category", "target": []any{"variable", []any{"template-tag", name}}, "value": value}
+	}
+	tests := []struct {
+		name       string
+		sql        string
+		parameters []any
+		want       string
+		wantErr    string
+	}{
+		{
+			name:       "values",
+			sql:        "SELECT * FROM PEOPLE WHERE STATE = {{state}} AND ID > {{id}}",
+			parameters: []any{param("state", "O'Neil"), param("id", 2)},
+			want:       "SELECT * FROM PEOPLE WHERE STATE = 'O''Neil' AND ID > 2",
+		},
+		{
+			name: "optional clause without value",
+			sql:  "SELECT * FROM PEOPLE WHERE 1 = 1 [[AND STATE = {{state}}]]",
+			want: "SELECT * FROM PEOPLE WHERE 1 = 1 ",
+		},
+		{
+			name:       "optional clause with value",
+			sql:        "SELECT * FROM PEOPLE WHERE 1 = 1 [[AND STATE = {{state}}]]",
+			parameters: []any{param("state", "TX")},
+			want:       "SELECT * FROM PEOPLE WHERE 1 = 1 AND STATE = 'TX'",
+		},
+		{
+			name: "card reference",
+			sql:  "SELECT COUNT(*) FROM {{#" + strconv.Itoa(s.NativeCard.ID) + "-recent-orders}} AS o",
+			want: "SELECT COUNT(*) FROM (SELECT * FROM ORDERS LIMIT 10) AS o",
+		},
+		{
+			name:    "missing value",
+			sql:     "SELECT * FROM PEOPLE WHERE STATE = {{state}}",
+			wantErr: "missing required parameters: state",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form, err := f.CompileNativeQuery(context.Background(), &metabase.DatasetQueryRequest{
+				Database: s.Database.ID, Type: "native",
+				Native:     &metabase.NativeQuery{Query: tt.sql},
+				Parameters: tt.parameters,
+			})
+			if tt.wantErr != "" {
+				var apiErr *metabase.APIError
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+				assert.Equal(t, tt.wantErr, apiErr.Message)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, form.Query)
+		})
+	}
+}
+
+func TestFake_ExecuteCardQuery(t *testing.T) {
+	f, s := NewSample()
+	result, err := f.ExecuteCardQuery(context.Background(), s.NativeCard.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.RowCount)
+	assert.Equal(t, "SELECT * FROM ORDERS LIMIT 10", result.Data.NativeForm.Query)
+
+	result, err = f.ExecuteCardQuery(context.Background(), s.QueryCard.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.RowCount)
+}
+
+func TestFake_ExportQueryResults(t *testing.T) {
+	f, s := NewSample()
+	req := &metabase.DatasetQueryRequest{Database: s.Database.ID, Type: "native", Native: &metabase.NativeQuery{Query: "SELECT ID, STATE FROM PEOPLE LIMIT 2"}}
+
+	data, err := f.ExportQueryResults(context.Background(), req, "csv")
+	require.NoError(t, err)
+	assert.Equal(t, "ID,STATE\n1,TX\n2,TX\n", string(data))
+
+	data, err = f.ExportQueryResults(context.Background(), req, "json")
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"ID":1,"STATE":"TX"},{"ID":2,"STATE":"TX"}]`, string(data))
+
+	_, err = f.ExportQueryResults(context.Background(), req, "xlsx")
+	assert.Error(t, err)
+}
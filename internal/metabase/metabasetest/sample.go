@@ -0,0 +1,67 @@
+package metabasetest
+
+import (
+	"context"
+	_ "embed"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+//go:embed fixtures/sample.json
+var sampleFixture []byte
+
+// SampleFixture returns the fixture NewSample loads: an H2 "Sample
+// Database" with PRODUCTS, PEOPLE and ORDERS tables and a few rows each, an
+// "Examples" collection with a native and an MBQL card, and a dashboard
+// showing both. It accepts the API key mb_fake_api_key, and
+// admin@example.com and analyst@example.com with the password
+// fake-password.
+func SampleFixture() *Fixture {
+	fx, err := ParseFixture(sampleFixture)
+	if err != nil {
+		panic("metabasetest: " + err.Error())
+	}
+	return fx
+}
+
+// Sample is what NewSample seeds a Fake with.
+type Sample struct {
+	Database   *metabase.Database
+	Products   *metabase.Table
+	People     *metabase.Table
+	Orders     *metabase.Table
+	Collection *metabase.Collection
+	// NativeCard runs SQL against ORDERS; QueryCard is an MBQL question on
+	// PRODUCTS.
+	NativeCard *metabase.Card
+	QueryCard  *metabase.Card
+	Dashboard  *metabase.Dashboard
+}
+
+// NewSample returns a Fake loaded with SampleFixture, and the objects it
+// holds.
+func NewSample() (*Fake, *Sample) {
+	f, err := NewFromFixture(SampleFixture())
+	must(err)
+
+	ctx := context.Background()
+	s := &Sample{}
+	s.Database, err = f.GetDatabaseMetadata(ctx, 1)
+	must(err)
+	s.Products, s.People, s.Orders = &s.Database.Tables[0], &s.Database.Tables[1], &s.Database.Tables[2]
+	s.Collection, err = f.GetCollection(ctx, "1")
+	must(err)
+	s.NativeCard, err = f.GetCard(ctx, 1)
+	must(err)
+	s.QueryCard, err = f.GetCard(ctx, 2)
+	must(err)
+	s.Dashboard, err = f.GetDashboard(ctx, 1)
+	must(err)
+	return f, s
+}
+
+func must(err error) {
+	if err != nil {
+		panic("metabasetest: loading sample: " + err.Error())
+	}
+}
@@ -0,0 +1,66 @@
+package metabase
+
+import (
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Page selects part of a list: Limit items starting at Offset. A zero Limit
+// selects every item from Offset on.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// Paged is one page of a list, with the length of the whole list.
+type Paged[T any] struct {
+	Data   []T `json:"data"`
+	Total  int `json:"total"`
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset"`
+}
+
+// Next returns the page following p, and false if p is the last one.
+func (p *Paged[T]) Next() (Page, bool) {
+	next := p.Offset + len(p.Data)
+	if next >= p.Total || len(p.Data) == 0 {
+		return Page{}, false
+	}
+	return Page{Limit: p.Limit, Offset: next}, true
+}
+
+// apply sets the limit and offset query parameters Metabase paginates with.
+func (p Page) apply(req *resty.Request) {
+	if p.Limit > 0 {
+		req.SetQueryParam("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Offset > 0 {
+		req.SetQueryParam("offset", strconv.Itoa(p.Offset))
+	}
+}
+
+// SlicePage cuts page out of items, a whole list, for lists that Metabase
+// does not paginate.
+func SlicePage[T any](items []T, page Page) *Paged[T] {
+	start := min(max(page.Offset, 0), len(items))
+	end := len(items)
+	if page.Limit > 0 {
+		end = min(start+page.Limit, end)
+	}
+	return &Paged[T]{Data: items[start:end], Total: len(items), Limit: page.Limit, Offset: start}
+}
+
+// serverPage returns page of a list Metabase was asked to paginate. Versions
+// that ignore limit and offset return the list from its start, which is then
+// sliced here. Such a response is recognised by holding more items than the
+// limit or than the total leaves after the offset, or by lacking a total
+// (zero), which Metabase reports for every list it paginates.
+func serverPage[T any](data []T, total int, page Page) *Paged[T] {
+	ignoredLimit := page.Limit > 0 && len(data) > page.Limit
+	ignoredOffset := page.Offset > 0 && page.Offset+len(data) > total
+	if total == 0 || ignoredLimit || ignoredOffset {
+		return SlicePage(data, page)
+	}
+	return &Paged[T]{Data: data, Total: total, Limit: page.Limit, Offset: page.Offset}
+}
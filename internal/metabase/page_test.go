@@ -0,0 +1,74 @@
+package metabase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlicePage(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		name     string
+		page     Page
+		want     []int
+		wantNext Page
+		wantMore bool
+	}{
+		{name: "all", page: Page{}, want: items},
+		{name: "first", page: Page{Limit: 2}, want: []int{1, 2}, wantNext: Page{Limit: 2, Offset: 2}, wantMore: true},
+		{name: "middle", page: Page{Limit: 2, Offset: 2}, want: []int{3, 4}, wantNext: Page{Limit: 2, Offset: 4}, wantMore: true},
+		{name: "last", page: Page{Limit: 2, Offset: 4}, want: []int{5}},
+		{name: "beyond the end", page: Page{Limit: 2, Offset: 9}, want: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := SlicePage(items, tt.page)
+			assert.Equal(t, tt.want, p.Data)
+			assert.Equal(t, 5, p.Total)
+			next, more := p.Next()
+			assert.Equal(t, tt.wantMore, more)
+			assert.Equal(t, tt.wantNext, next)
+		})
+	}
+}
+
+func TestServerPage(t *testing.T) {
+	// Metabase honoured the page.
+	p := serverPage([]int{3, 4}, 10, Page{Limit: 2, Offset: 2})
+	assert.Equal(t, []int{3, 4}, p.Data)
+	assert.Equal(t, 10, p.Total)
+
+	// Metabase ignored it and returned the whole list.
+	p = serverPage([]int{1, 2, 3, 4, 5}, 0, Page{Limit: 2, Offset: 2})
+	assert.Equal(t, []int{3, 4}, p.Data)
+	assert.Equal(t, 5, p.Total)
+
+	// Metabase reported no total, as it does not paginate the list.
+	p = serverPage([]int{1, 2}, 0, Page{Limit: 2, Offset: 2})
+	assert.Empty(t, p.Data)
+	assert.Equal(t, 2, p.Total)
+	p = serverPage([]int{1, 2, 3}, 0, Page{Limit: 2, Offset: 2})
+	assert.Equal(t, []int{3}, p.Data)
+	assert.Equal(t, 3, p.Total)
+	_, ok := p.Next()
+	assert.False(t, ok, "paging through the list ends")
+
+	// Metabase ignored the offset and returned no more than the limit.
+	p = serverPage([]int{1, 2, 3}, 3, Page{Limit: 5, Offset: 2})
+	assert.Equal(t, []int{3}, p.Data)
+	assert.Equal(t, 3, p.Total)
+	assert.Equal(t, 2, p.Offset)
+	_, ok = p.Next()
+	assert.False(t, ok)
+
+	// The whole list, shorter than the limit, from an offset past its end.
+	p = serverPage([]int{1, 2}, 2, Page{Limit: 5, Offset: 4})
+	assert.Empty(t, p.Data)
+	assert.Equal(t, 2, p.Total)
+
+	// A last page Metabase honoured is kept as is.
+	p = serverPage([]int{5}, 5, Page{Limit: 2, Offset: 4})
+	assert.Equal(t, []int{5}, p.Data)
+	assert.Equal(t, 4, p.Offset)
+}
@@ -1,11 +1,15 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListPermissionGroups returns all permission groups.
-func (c *Client) ListPermissionGroups() ([]PermissionGroup, error) {
+func (c *Client) ListPermissionGroups(ctx context.Context) ([]PermissionGroup, error) {
 	var result []PermissionGroup
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/permissions/group")
 	if err != nil {
@@ -18,9 +22,10 @@ func (c *Client) ListPermissionGroups() ([]PermissionGroup, error) {
 }
 
 // GetPermissionGroup returns a permission group by ID.
-func (c *Client) GetPermissionGroup(id int) (*PermissionGroup, error) {
+func (c *Client) GetPermissionGroup(ctx context.Context, id int) (*PermissionGroup, error) {
 	var result PermissionGroup
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/permissions/group/%d", id))
 	if err != nil {
@@ -33,9 +38,10 @@ func (c *Client) GetPermissionGroup(id int) (*PermissionGroup, error) {
 }
 
 // GetPermissionsGraph returns the full permissions graph.
-func (c *Client) GetPermissionsGraph() (map[string]any, error) {
+func (c *Client) GetPermissionsGraph(ctx context.Context) (map[string]any, error) {
 	var result map[string]any
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/permissions/graph")
 	if err != nil {
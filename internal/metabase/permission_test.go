@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -19,7 +20,7 @@ func TestListPermissionGroups(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	groups, err := client.ListPermissionGroups()
+	groups, err := client.ListPermissionGroups(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, groups, 2)
 }
@@ -35,7 +36,7 @@ func TestGetPermissionGroup(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	group, err := client.GetPermissionGroup(1)
+	group, err := client.GetPermissionGroup(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "All Users", group.Name)
 	assert.Len(t, group.Members, 1)
@@ -51,7 +52,7 @@ func TestGetPermissionsGraph(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	graph, err := client.GetPermissionsGraph()
+	graph, err := client.GetPermissionsGraph(context.Background())
 	require.NoError(t, err)
 	assert.Contains(t, graph, "revision")
 }
@@ -0,0 +1,94 @@
+package metabase
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// RetryPolicy controls how failed Metabase calls are repeated. Calls are
+// retried when Metabase is unavailable (429, 502, 503, 504) or the
+// connection fails, with jittered exponential backoff between MinWait and
+// MaxWait, or the wait Metabase asks for in Retry-After.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a call is repeated. Zero disables
+	// retries.
+	MaxRetries int
+	MinWait    time.Duration
+	MaxWait    time.Duration
+}
+
+// DefaultRetryPolicy is used unless WithRetry is given.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinWait:    250 * time.Millisecond,
+	MaxWait:    5 * time.Second,
+}
+
+// WithRetry sets the retry policy.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retry = p
+	}
+}
+
+// repeatablePOST matches POST endpoints that only read data, and so can be
+// repeated like GETs: query execution, export and compilation.
+var repeatablePOST = regexp.MustCompile(`^/api/(dataset(/[a-z]+)?|card/\d+/query(/[a-z]+)?)$`)
+
+// repeatable reports whether a request can be sent again after it may have
+// reached Metabase.
+func repeatable(r *resty.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return r.RawRequest != nil && repeatablePOST.MatchString(r.RawRequest.URL.Path)
+	}
+	return false
+}
+
+// notSent reports whether err shows that the request never reached
+// Metabase, so that even a mutating request can be sent again.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryCondition returns the resty retry condition for transient failures.
+func (p RetryPolicy) retryCondition() resty.RetryConditionFunc {
+	return func(resp *resty.Response, err error) bool {
+		if resp == nil || resp.Request == nil || resp.Request.Attempt > p.MaxRetries {
+			return false
+		}
+		req := resp.Request
+		if err != nil {
+			if !IsRetryable(err) {
+				return false
+			}
+			return repeatable(req) || notSent(err)
+		}
+		return retryableStatus(resp.StatusCode()) && repeatable(req)
+	}
+}
+
+// retryAfter returns the wait Metabase asks for in a Retry-After header, in
+// seconds or as an HTTP date, or zero to use the backoff.
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	v := resp.Header().Get("Retry-After")
+	if v == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second, nil
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,190 @@
+package metabase
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetry_TransientFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(*Client) error
+		failures int
+		status   int
+		attempts int32
+		wantErr  bool
+	}{
+		{
+			name:     "GET retried until success",
+			call:     func(c *Client) error { _, err := c.GetCard(context.Background(), 1); return err },
+			failures: 2,
+			status:   http.StatusServiceUnavailable,
+			attempts: 3,
+		},
+		{
+			name:     "GET gives up after max retries",
+			call:     func(c *Client) error { _, err := c.ListCards(context.Background(), Page{}); return err },
+			failures: 10,
+			status:   http.StatusBadGateway,
+			attempts: 4,
+			wantErr:  true,
+		},
+		{
+			name: "query POST retried",
+			call: func(c *Client) error {
+				_, err := c.ExecuteQuery(context.Background(), &DatasetQueryRequest{Database: 1, Type: "native"})
+				return err
+			},
+			failures: 1,
+			status:   http.StatusGatewayTimeout,
+			attempts: 2,
+		},
+		{
+			name:     "mutating POST not retried",
+			call:     func(c *Client) error { _, err := c.CreateCard(context.Background(), &Card{Name: "x"}); return err },
+			failures: 1,
+			status:   http.StatusServiceUnavailable,
+			attempts: 1,
+			wantErr:  true,
+		},
+		{
+			name:     "DELETE not retried",
+			call:     func(c *Client) error { return c.DeleteCard(context.Background(), 1) },
+			failures: 1,
+			status:   http.StatusBadGateway,
+			attempts: 1,
+			wantErr:  true,
+		},
+		{
+			name:     "client errors not retried",
+			call:     func(c *Client) error { _, err := c.GetCard(context.Background(), 1); return err },
+			failures: 1,
+			status:   http.StatusNotFound,
+			attempts: 1,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			_, client := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+				if int(attempts.Add(1)) <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]any{"id": 1, "status": "completed"})
+			})
+
+			err := tt.call(client)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.attempts, attempts.Load())
+		})
+	}
+}
+
+func TestRetry_ConnectionReset(t *testing.T) {
+	var attempts atomic.Int32
+	_, client := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		if attempts.Add(1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			_ = conn.Close()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	})
+
+	_, err := client.ListCards(context.Background(), Page{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestRetry_NotSent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	client, err := NewClient("http://"+addr, "key", "", "", zerolog.Nop(), WithoutStartupCheck(), fastRetry,
+		WithCircuitBreaker(BreakerPolicy{}))
+	require.NoError(t, err)
+
+	var retries atomic.Int32
+	client.httpClient.AddRetryHook(func(*resty.Response, error) { retries.Add(1) })
+	_, err = client.CreateCard(context.Background(), &Card{Name: "x"})
+	require.Error(t, err)
+	assert.True(t, notSent(err))
+	assert.Equal(t, int32(3), retries.Load(), "a refused connection is retried even for a mutating request")
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "none", want: 0},
+		{name: "seconds", header: "7", want: 7 * time.Second},
+		{name: "past date", header: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0},
+		{name: "garbage", header: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if tt.header != "" {
+				rec.Header().Set("Retry-After", tt.header)
+			}
+			got, err := retryAfter(nil, &resty.Response{RawResponse: rec.Result()})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	got, err := retryAfter(nil, &resty.Response{RawResponse: rec.Result()})
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute.Seconds(), got.Seconds(), 2)
+}
+
+func TestRetry_HonoursRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	var first time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if attempts.Add(1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		assert.GreaterOrEqual(t, time.Since(first), 900*time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "key", "", "", zerolog.Nop(), WithoutStartupCheck(),
+		WithRetry(RetryPolicy{MaxRetries: 1, MinWait: time.Millisecond, MaxWait: 5 * time.Second}))
+	require.NoError(t, err)
+	_, err = client.ListCards(context.Background(), Page{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), attempts.Load())
+}
@@ -1,12 +1,77 @@
 package metabase
 
 import (
+	"context"
 	"fmt"
-	"regexp"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-// blockedOperations lists SQL operations that are not allowed through the MCP server.
+// ViolationReason identifies why a query was rejected by the read-only check.
+type ViolationReason string
+
+// Reasons reported in ReadOnlyViolation.
+const (
+	ReasonEmpty             ViolationReason = "empty_query"
+	ReasonStatementType     ViolationReason = "statement_type"
+	ReasonBlockedKeyword    ViolationReason = "blocked_keyword"
+	ReasonBlockedFunction   ViolationReason = "blocked_function"
+	ReasonUnterminated      ViolationReason = "unterminated"
+	ReasonUnsupportedSyntax ViolationReason = "unsupported_syntax"
+)
+
+// ReadOnlyViolation is returned by ValidateReadOnlySQL when a query is not
+// provably read-only.
+type ReadOnlyViolation struct {
+	Reason ViolationReason
+	// Token is the offending keyword, function name or construct.
+	Token string
+	// Statement is the 1-based index of the offending statement, or 0 if the
+	// query could not be split into statements.
+	Statement int
+	// Offset is the byte offset of the offending token in the query.
+	Offset int
+	// Dialect is the lexical dialect under which the violation was found.
+	Dialect string
+}
+
+func (v *ReadOnlyViolation) Error() string {
+	var msg string
+	switch v.Reason {
+	case ReasonEmpty:
+		return "query is empty"
+	case ReasonBlockedFunction:
+		msg = fmt.Sprintf("query calls blocked function: %s", v.Token)
+	case ReasonUnterminated:
+		msg = fmt.Sprintf("query contains an unterminated %s at offset %d", v.Token, v.Offset)
+	case ReasonUnsupportedSyntax:
+		msg = fmt.Sprintf("query contains unsupported syntax (%s) at offset %d", v.Token, v.Offset)
+	default:
+		msg = fmt.Sprintf("query contains blocked operation: %s", v.Token)
+	}
+	if v.Statement > 1 {
+		msg += fmt.Sprintf(" (statement %d)", v.Statement)
+	}
+	return msg + ". Only read-only (SELECT) queries are allowed"
+}
+
+// readOnlyStatements lists the keywords a read-only statement may start with.
+var readOnlyStatements = []string{
+	"SELECT",
+	"WITH",
+	"EXPLAIN",
+	"SHOW",
+	"DESCRIBE",
+	"DESC",
+	"VALUES",
+}
+
+// blockedOperations lists SQL keywords that are rejected wherever they appear
+// outside of literals, quoted identifiers and comments. This catches write
+// statements embedded in otherwise read-only ones, such as data-modifying
+// CTEs or EXPLAIN ANALYZE.
 var blockedOperations = []string{
 	"INSERT",
 	"UPDATE",
@@ -23,42 +88,506 @@ var blockedOperations = []string{
 	"CALL",
 }
 
-// singleLineComment matches -- style comments.
-var singleLineComment = regexp.MustCompile(`--[^\n]*`)
+// SQLPolicy is the set of read-only rules applied to native queries for one
+// database engine: the lexical dialects a query is tokenized under, and the
+// keywords and functions that are rejected in addition to blockedOperations.
+type SQLPolicy struct {
+	// Name identifies the policy in logs and errors.
+	Name string
+
+	dialects         []lexDialect
+	blockedKeywords  []string
+	blockedFunctions []string
+	// blockedFunctionPrefixes rejects whole families of functions, such as
+	// Snowflake's SYSTEM$ functions.
+	blockedFunctionPrefixes []string
+}
+
+var (
+	postgresPolicy = &SQLPolicy{
+		Name:     "postgres",
+		dialects: []lexDialect{postgresDialect, postgresLegacyDialect},
+		// SELECT ... INTO creates a table.
+		blockedKeywords: []string{"INTO"},
+		blockedFunctions: []string{
+			"pg_sleep", "pg_sleep_for", "pg_sleep_until",
+			"pg_terminate_backend", "pg_cancel_backend",
+			"pg_reload_conf", "pg_rotate_logfile",
+			"pg_read_file", "pg_read_binary_file", "pg_ls_dir", "pg_stat_file",
+			"lo_import", "lo_export", "lo_unlink",
+			"set_config", "nextval", "setval",
+			"pg_advisory_lock", "pg_advisory_xact_lock",
+			"dblink", "dblink_exec", "dblink_connect", "dblink_send_query",
+			// These execute the query text passed as an argument.
+			"query_to_xml", "query_to_xmlschema", "query_to_xml_and_xmlschema",
+		},
+	}
 
-// multiLineComment matches /* ... */ style comments.
-var multiLineComment = regexp.MustCompile(`/\*[\s\S]*?\*/`)
+	mysqlPolicy = &SQLPolicy{
+		Name:     "mysql",
+		dialects: []lexDialect{mysqlDialect, mysqlANSIDialect},
+		// SELECT ... INTO OUTFILE/DUMPFILE writes files on the server.
+		blockedKeywords: []string{"INTO", "OUTFILE", "DUMPFILE"},
+		blockedFunctions: []string{
+			"sleep", "benchmark", "load_file",
+			"get_lock", "release_lock", "release_all_locks",
+			"sys_exec", "sys_eval",
+		},
+	}
 
-// buildBlockPattern builds a regex for a given SQL keyword.
-// Matches the keyword at word boundary, case-insensitive.
-func buildBlockPattern(op string) *regexp.Regexp {
-	return regexp.MustCompile(`(?i)\b` + op + `\b`)
+	bigqueryPolicy = &SQLPolicy{
+		Name:     "bigquery",
+		dialects: []lexDialect{bigqueryDialect},
+		// EXPORT DATA writes query results to Cloud Storage; it is also
+		// reserved, so it cannot be an unquoted column name.
+		blockedKeywords: []string{"EXPORT", "INTO"},
+	}
+
+	snowflakePolicy = &SQLPolicy{
+		Name:     "snowflake",
+		dialects: []lexDialect{snowflakeDialect},
+		// PUT, GET, REMOVE and COPY INTO move files to and from stages and
+		// are rejected as statement types; INTO also covers SELECT ... INTO
+		// in Snowflake Scripting.
+		blockedKeywords:         []string{"INTO"},
+		blockedFunctionPrefixes: []string{"system$"},
+	}
+
+	sqlserverPolicy = &SQLPolicy{
+		Name:            "sqlserver",
+		dialects:        []lexDialect{ansiDialect, tsqlDialect},
+		blockedKeywords: []string{"INTO", "WAITFOR"},
+		blockedFunctions: []string{
+			"xp_cmdshell", "openrowset", "opendatasource", "openquery",
+		},
+	}
+
+	h2Policy = &SQLPolicy{
+		Name:     "h2",
+		dialects: []lexDialect{ansiDialect, h2Dialect},
+		blockedFunctions: []string{
+			"file_read", "file_write", "csvwrite", "csvread", "link_schema",
+		},
+	}
+
+	sqlitePolicy = &SQLPolicy{
+		Name:             "sqlite",
+		dialects:         []lexDialect{ansiDialect},
+		blockedFunctions: []string{"load_extension", "writefile", "readfile"},
+	}
+
+	// strictPolicy is applied when the engine is unknown. It combines the
+	// rules of every engine-specific policy and lexes under every dialect.
+	strictPolicy = mergePolicies("strict", allLexDialects,
+		postgresPolicy, mysqlPolicy, bigqueryPolicy, snowflakePolicy,
+		sqlserverPolicy, h2Policy, sqlitePolicy)
+)
+
+// enginePolicies maps Metabase database engines to their read-only policy.
+var enginePolicies = map[string]*SQLPolicy{
+	"postgres":           postgresPolicy,
+	"redshift":           postgresPolicy,
+	"mysql":              mysqlPolicy,
+	"bigquery":           bigqueryPolicy,
+	"bigquery-cloud-sdk": bigqueryPolicy,
+	"snowflake":          snowflakePolicy,
+	"sqlserver":          sqlserverPolicy,
+	"h2":                 h2Policy,
+	"sqlite":             sqlitePolicy,
 }
 
-var blockedPatterns []*regexp.Regexp
+// PolicyForEngine returns the read-only policy for a Metabase database
+// engine (Database.Engine). Unknown or empty engines get the strictest policy.
+func PolicyForEngine(engine string) *SQLPolicy {
+	if p, ok := enginePolicies[strings.ToLower(engine)]; ok {
+		return p
+	}
+	return strictPolicy
+}
 
-func init() {
-	blockedPatterns = make([]*regexp.Regexp, len(blockedOperations))
-	for i, op := range blockedOperations {
-		blockedPatterns[i] = buildBlockPattern(op)
+func mergePolicies(name string, dialects []lexDialect, policies ...*SQLPolicy) *SQLPolicy {
+	merged := &SQLPolicy{Name: name, dialects: dialects}
+	for _, p := range policies {
+		merged.blockedKeywords = appendMissing(merged.blockedKeywords, p.blockedKeywords...)
+		merged.blockedFunctions = appendMissing(merged.blockedFunctions, p.blockedFunctions...)
+		merged.blockedFunctionPrefixes = appendMissing(merged.blockedFunctionPrefixes, p.blockedFunctionPrefixes...)
 	}
+	return merged
 }
 
-// ValidateReadOnlySQL checks that a SQL query does not contain write operations.
-// It returns an error if a write operation is detected.
+func appendMissing(list []string, items ...string) []string {
+	for _, item := range items {
+		if !containsFold(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// ValidateReadOnlySQL checks that a SQL query consists only of read-only
+// statements, using the strictest policy because the engine is unknown.
+// It returns a *ReadOnlyViolation describing the first problem found.
 func ValidateReadOnlySQL(sql string) error {
-	cleaned := stripComments(sql)
-	for i, pattern := range blockedPatterns {
-		if pattern.MatchString(cleaned) {
-			return fmt.Errorf("query contains blocked operation: %s. Only read-only (SELECT) queries are allowed", blockedOperations[i])
+	return strictPolicy.Validate(sql)
+}
+
+// ValidateNativeQuery is the package-level ValidateNativeQuery for c.
+func (c *Client) ValidateNativeQuery(ctx context.Context, databaseID int, native *NativeQuery, parameters []any) error {
+	return ValidateNativeQuery(ctx, c, databaseID, native, parameters)
+}
+
+// ValidateNativeQuery checks a native query against the read-only policy of
+// its database, looked up through api; if the engine cannot be determined,
+// the strictest policy is applied. If the query has template tags, the text
+// Metabase produces after substituting them (snippets, referenced cards and
+// parameter values) is validated as well, since it can differ arbitrarily
+// from the raw text. A query whose substituted text cannot be obtained is
+// rejected.
+func ValidateNativeQuery(ctx context.Context, api API, databaseID int, native *NativeQuery, parameters []any) error {
+	policy := policyForDatabase(ctx, api, databaseID)
+	if err := policy.Validate(native.Query); err != nil {
+		return err
+	}
+	if len(native.TemplateTags) == 0 {
+		return nil
+	}
+
+	form, err := api.CompileNativeQuery(ctx, &DatasetQueryRequest{
+		Database:   databaseID,
+		Type:       "native",
+		Native:     native,
+		Parameters: parameters,
+	})
+	if err != nil {
+		return fmt.Errorf("could not verify query after template tag substitution: %w", err)
+	}
+	return policy.Validate(form.Query)
+}
+
+// policyForDatabase returns the policy of the engine behind a database, or
+// the strictest policy if the engine cannot be determined.
+func policyForDatabase(ctx context.Context, api API, databaseID int) *SQLPolicy {
+	engine, err := api.DatabaseEngine(ctx, databaseID)
+	if err != nil {
+		return strictPolicy
+	}
+	return PolicyForEngine(engine)
+}
+
+// NativeQueryFromDatasetQuery extracts the database ID and native query from
+// a dataset query as stored in Card.DatasetQuery. It understands both the
+// legacy {"type": "native", "native": {...}} shape and the stage-based shape
+// used by newer Metabase versions. ok is false for non-native queries.
+func NativeQueryFromDatasetQuery(datasetQuery map[string]any) (databaseID int, native *NativeQuery, ok bool) {
+	if f, isNum := datasetQuery["database"].(float64); isNum {
+		databaseID = int(f)
+	}
+
+	if n, isMap := datasetQuery["native"].(map[string]any); isMap {
+		query, _ := n["query"].(string)
+		tags, _ := n["template-tags"].(map[string]any)
+		return databaseID, &NativeQuery{Query: query, TemplateTags: tags}, true
+	}
+
+	stages, _ := datasetQuery["stages"].([]any)
+	for _, s := range stages {
+		stage, _ := s.(map[string]any)
+		if query, isStr := stage["native"].(string); isStr {
+			tags, _ := stage["template-tags"].(map[string]any)
+			return databaseID, &NativeQuery{Query: query, TemplateTags: tags}, true
+		}
+	}
+	return databaseID, nil, false
+}
+
+// maxSourceCardDepth bounds how deep ValidateDatasetQuery follows saved
+// questions used as the source of other questions.
+const maxSourceCardDepth = 10
+
+// ValidateDatasetQuery checks every native query that running a dataset
+// query, as stored in Card.DatasetQuery, executes: its own native query,
+// native source queries nested in MBQL at any depth, and, recursively, the
+// queries of the saved questions it uses as source tables ("card__N" or a
+// stage's "source-card"). parameters apply to the query's own native
+// queries. A source card that cannot be fetched is an error.
+func ValidateDatasetQuery(ctx context.Context, api API, datasetQuery map[string]any, parameters []any) error {
+	var databaseID int
+	if f, isNum := datasetQuery["database"].(float64); isNum {
+		databaseID = int(f)
+	}
+	return validateQuerySources(ctx, api, databaseID, datasetQuery, parameters, map[int]bool{}, 0)
+}
+
+// ValidateMBQLQuery is ValidateDatasetQuery for the inner MBQL query of a
+// structured query on the given database, as in DatasetQueryRequest.Query.
+func ValidateMBQLQuery(ctx context.Context, api API, databaseID int, query map[string]any) error {
+	return validateQuerySources(ctx, api, databaseID, query, nil, map[int]bool{}, 0)
+}
+
+func validateQuerySources(ctx context.Context, api API, databaseID int, query map[string]any, parameters []any, seen map[int]bool, depth int) error {
+	natives, cards := querySources(query)
+	for _, native := range natives {
+		if err := ValidateNativeQuery(ctx, api, databaseID, native, parameters); err != nil {
+			return err
+		}
+	}
+	for _, id := range cards {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if depth >= maxSourceCardDepth {
+			return fmt.Errorf("could not verify source card %d: questions are nested more than %d deep", id, maxSourceCardDepth)
+		}
+		card, err := api.GetCard(ctx, id)
+		if err != nil {
+			return fmt.Errorf("could not verify source card %d: %w", id, err)
+		}
+		cardDatabase := databaseID
+		if card.DatabaseID != nil {
+			cardDatabase = *card.DatabaseID
+		}
+		if f, isNum := card.DatasetQuery["database"].(float64); isNum {
+			cardDatabase = int(f)
+		}
+		if err := validateQuerySources(ctx, api, cardDatabase, card.DatasetQuery, nil, seen, depth+1); err != nil {
+			return fmt.Errorf("source card %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// querySources collects the native queries and the IDs of source cards
+// anywhere in a dataset or MBQL query: top-level and stage "native" queries,
+// MBQL "source-query" native queries, including those of joins, and
+// "card__N" source tables and "source-card" references.
+func querySources(query any) (natives []*NativeQuery, cards []int) {
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]any:
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				value := v[key]
+				switch key {
+				case "native":
+					switch n := value.(type) {
+					case string:
+						tags, _ := v["template-tags"].(map[string]any)
+						natives = append(natives, &NativeQuery{Query: n, TemplateTags: tags})
+						continue
+					case map[string]any:
+						if q, isStr := n["query"].(string); isStr {
+							tags, _ := n["template-tags"].(map[string]any)
+							natives = append(natives, &NativeQuery{Query: q, TemplateTags: tags})
+							continue
+						}
+					}
+				case "source-table":
+					if table, isStr := value.(string); isStr {
+						if id, found := strings.CutPrefix(table, "card__"); found {
+							if n, err := strconv.Atoi(id); err == nil {
+								cards = append(cards, n)
+							}
+						}
+					}
+				case "source-card":
+					if f, isNum := value.(float64); isNum {
+						cards = append(cards, int(f))
+					}
+				}
+				walk(value)
+			}
+		}
+	}
+	walk(query)
+	return natives, cards
+}
+
+// Validate checks that sql consists only of read-only statements. The query
+// is tokenized (so keywords inside string literals, quoted identifiers and
+// comments are ignored), split into statements, and each statement is
+// classified. The query must pass under every lexical dialect of the policy.
+// It returns a *ReadOnlyViolation describing the first problem found.
+func (p *SQLPolicy) Validate(sql string) error {
+	for _, d := range p.dialects {
+		if v := p.classify(sql, d); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// classify lexes sql under one dialect and checks every statement.
+func (p *SQLPolicy) classify(sql string, d lexDialect) *ReadOnlyViolation {
+	toks, lexErr := lexSQL(sql, d)
+	if lexErr != nil {
+		return &ReadOnlyViolation{
+			Reason:  lexErr.reason,
+			Token:   lexErr.what,
+			Offset:  lexErr.offset,
+			Dialect: d.name,
+		}
+	}
+
+	stmts := splitStatements(toks)
+	if len(stmts) == 0 {
+		return &ReadOnlyViolation{Reason: ReasonEmpty, Dialect: d.name}
+	}
+	for i, stmt := range stmts {
+		if v := p.classifyStatement(stmt); v != nil {
+			v.Statement = i + 1
+			v.Dialect = d.name
+			return v
+		}
+	}
+	return nil
+}
+
+// splitStatements drops whitespace and comments and splits the remaining
+// tokens on semicolons. Empty statements are discarded.
+func splitStatements(toks []token) [][]token {
+	var stmts [][]token
+	var cur []token
+	for _, t := range toks {
+		switch t.kind {
+		case tokWhitespace, tokComment:
+			continue
+		case tokSemicolon:
+			if len(cur) > 0 {
+				stmts = append(stmts, cur)
+			}
+			cur = nil
+		default:
+			cur = append(cur, t)
+		}
+	}
+	if len(cur) > 0 {
+		stmts = append(stmts, cur)
+	}
+	return stmts
+}
+
+// classifyStatement checks a single statement's leading keyword, keywords and
+// function calls.
+func (p *SQLPolicy) classifyStatement(stmt []token) *ReadOnlyViolation {
+	// Skip leading parentheses, e.g. "(SELECT 1) UNION (SELECT 2)".
+	first := 0
+	for first < len(stmt) && stmt[first].kind == tokPunct && stmt[first].text == "(" {
+		first++
+	}
+	if first == len(stmt) || stmt[first].kind != tokWord || !containsFold(readOnlyStatements, stmt[first].text) {
+		t := stmt[min(first, len(stmt)-1)]
+		return &ReadOnlyViolation{Reason: ReasonStatementType, Token: strings.ToUpper(t.text), Offset: t.offset}
+	}
+
+	for i, t := range stmt {
+		if t.kind == tokWord && (containsFold(blockedOperations, t.text) || containsFold(p.blockedKeywords, t.text)) {
+			return &ReadOnlyViolation{Reason: ReasonBlockedKeyword, Token: strings.ToUpper(t.text), Offset: t.offset}
+		}
+		if name, ok := calledFunction(stmt, i); ok && p.isBlockedFunction(name) {
+			return &ReadOnlyViolation{Reason: ReasonBlockedFunction, Token: strings.ToLower(name), Offset: t.offset}
 		}
 	}
 	return nil
 }
 
-// stripComments removes SQL comments from the query.
-func stripComments(sql string) string {
-	result := multiLineComment.ReplaceAllString(sql, " ")
-	result = singleLineComment.ReplaceAllString(result, " ")
-	return strings.TrimSpace(result)
+// calledFunction returns the function name at stmt[i] if an argument list
+// follows it. The name may be a word, a word in T-SQL brackets, or a quoted
+// identifier, which is unquoted; PostgreSQL U&"..." escapes are decoded.
+// Names are later compared ignoring case, which is at least as strict as the
+// case folding of any engine, quoted or not.
+func calledFunction(stmt []token, i int) (string, bool) {
+	t := stmt[i]
+	next := i + 1
+	var name string
+	switch t.kind {
+	case tokWord:
+		name = t.text
+		if i > 0 && stmt[i-1].text == "[" && next < len(stmt) && stmt[next].text == "]" {
+			next++
+		}
+	case tokQuotedIdent:
+		name = unquoteIdent(t.text)
+		if i >= 2 && stmt[i-1].text == "&" && strings.EqualFold(stmt[i-2].text, "U") {
+			escape := `\`
+			if next+1 < len(stmt) && strings.EqualFold(stmt[next].text, "UESCAPE") && stmt[next+1].kind == tokString {
+				escape = strings.Trim(stmt[next+1].text, "'")
+				next += 2
+			}
+			name = decodeUnicodeEscapes(name, escape)
+		}
+	default:
+		return "", false
+	}
+	return name, next < len(stmt) && stmt[next].text == "("
+}
+
+// unquoteIdent strips the quotes of a quoted identifier and undoubles the
+// quotes inside it.
+func unquoteIdent(text string) string {
+	q := text[:1]
+	inner := strings.TrimSuffix(text[1:], q)
+	return strings.ReplaceAll(inner, q+q, q)
+}
+
+// decodeUnicodeEscapes decodes the escapes of a PostgreSQL U&"..." identifier:
+// the escape character followed by four hex digits, or by + and six hex
+// digits, and a doubled escape character. Malformed escapes are left as is.
+func decodeUnicodeEscapes(s, escape string) string {
+	if len(escape) != 1 {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != escape[0] {
+			sb.WriteByte(s[i])
+			continue
+		}
+		rest := s[i+1:]
+		digits := 4
+		if strings.HasPrefix(rest, "+") {
+			rest, digits = rest[1:], 6
+		}
+		switch {
+		case strings.HasPrefix(rest, escape):
+			sb.WriteString(escape)
+			i++
+		case len(rest) >= digits:
+			r, err := strconv.ParseUint(rest[:digits], 16, 32)
+			if err != nil {
+				sb.WriteByte(s[i])
+				continue
+			}
+			sb.WriteRune(rune(r))
+			i += len(s[i+1:]) - len(rest) + digits
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
+
+func (p *SQLPolicy) isBlockedFunction(name string) bool {
+	if containsFold(p.blockedFunctions, name) {
+		return true
+	}
+	for _, prefix := range p.blockedFunctionPrefixes {
+		if len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
 }
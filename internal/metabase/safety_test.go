@@ -1,6 +1,11 @@
 package metabase
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -52,9 +57,69 @@ func TestValidateReadOnlySQL(t *testing.T) {
 		{name: "nested comment with block", sql: "SELECT * /* DROP TABLE */ FROM users", wantErr: false},
 
 		// Edge cases
-		{name: "select into is blocked by insert check", sql: "SELECT * INTO new_table FROM users", wantErr: false},
+		{name: "select into creates a table", sql: "SELECT * INTO new_table FROM users", wantErr: true, errMsg: "INTO"},
 		{name: "select containing delete as column name", sql: "SELECT deleted FROM users", wantErr: false},
 		{name: "substring containing insert", sql: "SELECT reinsertion FROM users", wantErr: false},
+
+		// Keywords inside literals and quoted identifiers
+		{name: "keyword in string literal", sql: "SELECT 'please update me' AS msg", wantErr: false},
+		{name: "keyword in double quoted identifier", sql: `SELECT "DELETE" FROM audit`, wantErr: false},
+		{name: "identifier with keyword prefix", sql: "SELECT created_by, updated_at FROM users", wantErr: false},
+		{name: "doubled quote in string", sql: "SELECT 'it''s; DROP TABLE users' FROM t", wantErr: false},
+		{name: "dollar quoted string", sql: "SELECT $$ DROP TABLE users $$ AS s", wantErr: true, errMsg: "DROP"},
+		{name: "escape string", sql: `SELECT E'it''s' FROM t`, wantErr: false},
+		{name: "positional parameter", sql: "SELECT * FROM users WHERE id = $1", wantErr: false},
+		{name: "keyword in line comment before newline", sql: "SELECT 1 -- DROP TABLE users\nFROM t", wantErr: false},
+
+		// Statement classification
+		{name: "trailing semicolon", sql: "SELECT 1;", wantErr: false},
+		{name: "multiple read statements", sql: "SELECT 1; SELECT 2;", wantErr: false},
+		{name: "parenthesized union", sql: "(SELECT 1) UNION (SELECT 2)", wantErr: false},
+		{name: "values", sql: "VALUES (1, 2), (3, 4)", wantErr: false},
+		{name: "describe", sql: "DESCRIBE users", wantErr: false},
+		{name: "leading empty statements", sql: "; ; SELECT 1", wantErr: false},
+		{name: "select then copy", sql: "SELECT 1; COPY users TO '/tmp/users.csv'", wantErr: true, errMsg: "COPY (statement 2)"},
+		{name: "copy", sql: "COPY users TO PROGRAM 'rm -rf /'", wantErr: true, errMsg: "COPY"},
+		{name: "set", sql: "SET search_path = evil", wantErr: true, errMsg: "SET"},
+		{name: "vacuum", sql: "VACUUM FULL", wantErr: true, errMsg: "VACUUM"},
+		{name: "transaction wrapper", sql: "BEGIN; SELECT 1; COMMIT", wantErr: true, errMsg: "BEGIN"},
+		{name: "bare parenthesis", sql: "(", wantErr: true, errMsg: "("},
+		{name: "data modifying CTE", sql: "WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", wantErr: true, errMsg: "DELETE"},
+		{name: "explain analyze write", sql: "EXPLAIN ANALYZE UPDATE users SET name = 'x'", wantErr: true, errMsg: "UPDATE"},
+		{name: "select for update", sql: "SELECT * FROM users FOR UPDATE", wantErr: true, errMsg: "UPDATE"},
+		{name: "number glued to keyword", sql: "SELECT 1 UNION SELECT 2DELETE FROM users", wantErr: true, errMsg: "DELETE"},
+
+		// Blocked functions
+		{name: "terminate backend", sql: "SELECT pg_terminate_backend(pid) FROM pg_stat_activity", wantErr: true, errMsg: "pg_terminate_backend"},
+		{name: "qualified blocked function", sql: "SELECT pg_catalog.pg_cancel_backend(1)", wantErr: true, errMsg: "pg_cancel_backend"},
+		{name: "blocked function with space", sql: "SELECT lo_export (1, '/tmp/x')", wantErr: true, errMsg: "lo_export"},
+		{name: "blocked function name as column", sql: "SELECT load_file FROM t", wantErr: false},
+		{name: "quoted blocked function", sql: `SELECT "pg_sleep"(10)`, wantErr: true, errMsg: "pg_sleep"},
+		{name: "quoted qualified blocked function", sql: `SELECT "pg_catalog"."pg_terminate_backend"(1)`, wantErr: true, errMsg: "pg_terminate_backend"},
+		{name: "quoted blocked function with write", sql: `SELECT "dblink_exec"('conn', 'DROP TABLE t')`, wantErr: true, errMsg: "dblink_exec"},
+		{name: "unicode quoted blocked function", sql: `SELECT U&"pg_sleep"(1)`, wantErr: true, errMsg: "pg_sleep"},
+		{name: "unicode escaped blocked function", sql: `SELECT U&"\0070g_sleep"(1)`, wantErr: true, errMsg: "pg_sleep"},
+		{name: "unicode escaped blocked function with uescape", sql: `SELECT U&"!0070g_sleep" UESCAPE '!' (1)`, wantErr: true, errMsg: "pg_sleep"},
+		{name: "backtick blocked function", sql: "SELECT `sleep`(10)", wantErr: true, errMsg: "sleep"},
+		{name: "bracketed blocked function", sql: "SELECT * FROM [openrowset]('SQLNCLI', 'x', 'SELECT 1')", wantErr: true, errMsg: "openrowset"},
+		{name: "quoted blocked function name as column", sql: `SELECT "pg_sleep" FROM t`, wantErr: false},
+
+		// Dialect ambiguities: the query must be read-only under every dialect
+		{name: "backslash hides statement", sql: `SELECT 'a\'; DELETE FROM users; --'`, wantErr: true, errMsg: "DELETE"},
+		{name: "mysql dash without space", sql: "SELECT 1 --x; DELETE FROM users", wantErr: true, errMsg: "DELETE"},
+		{name: "flat comment ends early", sql: "/* /* */ DELETE FROM users */ SELECT 1", wantErr: true, errMsg: "DELETE"},
+		{name: "nested comment", sql: "SELECT 1 /* outer /* inner */ still comment */", wantErr: false},
+		{name: "hash is not always a comment", sql: "SELECT 1 # 2; DROP TABLE users", wantErr: true, errMsg: "DROP"},
+		{name: "dollar quotes are not universal", sql: "SELECT $$; DELETE FROM users; $$", wantErr: true, errMsg: "DELETE"},
+		{name: "bigquery raw string", sql: `SELECT r'\'; DELETE FROM users; --'`, wantErr: true, errMsg: "DELETE"},
+		{name: "mysql executable comment", sql: "SELECT 1 /*! ; DELETE FROM users */", wantErr: true, errMsg: "executable comment"},
+		{name: "unicode separator", sql: "SELECT 1;\u00a0DELETE FROM users", wantErr: true, errMsg: "statement 2"},
+
+		// Unparseable input
+		{name: "unterminated string", sql: "SELECT 'abc", wantErr: true, errMsg: "unterminated string literal"},
+		{name: "unterminated comment", sql: "SELECT 1 /* DELETE", wantErr: true, errMsg: "unterminated comment"},
+		{name: "unterminated identifier", sql: `SELECT "abc`, wantErr: true, errMsg: "unterminated"},
+		{name: "unterminated dollar quote", sql: "SELECT $tag$ abc", wantErr: true, errMsg: "unterminated"},
 	}
 
 	for _, tt := range tests {
@@ -70,3 +135,344 @@ func TestValidateReadOnlySQL(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateReadOnlySQL_Reasons(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       string
+		reason    ViolationReason
+		token     string
+		statement int
+	}{
+		{name: "empty", sql: "", reason: ReasonEmpty},
+		{name: "only comments", sql: "-- nothing here\n/* or here */ ;", reason: ReasonEmpty},
+		{name: "statement type", sql: "INSERT INTO t VALUES (1)", reason: ReasonStatementType, token: "INSERT", statement: 1},
+		{name: "embedded keyword", sql: "SELECT 1; WITH x AS (UPDATE t SET a = 1) SELECT 1", reason: ReasonBlockedKeyword, token: "UPDATE", statement: 2},
+		{name: "function", sql: "SELECT PG_RELOAD_CONF()", reason: ReasonBlockedFunction, token: "pg_reload_conf", statement: 1},
+		{name: "unterminated", sql: "SELECT 'x", reason: ReasonUnterminated, token: "string literal"},
+		{name: "unsupported", sql: "SELECT /*!50000 1 */", reason: ReasonUnsupportedSyntax, token: "executable comment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateReadOnlySQL(tt.sql)
+			var v *ReadOnlyViolation
+			require.ErrorAs(t, err, &v)
+			assert.Equal(t, tt.reason, v.Reason)
+			assert.Equal(t, tt.token, v.Token)
+			assert.Equal(t, tt.statement, v.Statement)
+		})
+	}
+}
+
+func TestPolicyForEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		engine  string
+		sql     string
+		wantErr bool
+		errMsg  string
+	}{
+		// PostgreSQL
+		{name: "postgres dollar quote", engine: "postgres", sql: "SELECT $$ DROP TABLE users $$", wantErr: false},
+		{name: "postgres select into", engine: "postgres", sql: "SELECT * INTO backup FROM users", wantErr: true, errMsg: "INTO"},
+		{name: "postgres pg_sleep", engine: "postgres", sql: "SELECT pg_sleep(60)", wantErr: true, errMsg: "pg_sleep"},
+		{name: "postgres quoted pg_sleep", engine: "postgres", sql: `SELECT "pg_sleep"(10)`, wantErr: true, errMsg: "pg_sleep"},
+		{name: "postgres quoted dblink_exec", engine: "postgres", sql: `SELECT "dblink_exec"('conn', 'DROP TABLE t')`, wantErr: true, errMsg: "dblink_exec"},
+		{name: "postgres unicode pg_sleep", engine: "postgres", sql: `SELECT U&"pg_sleep"(1)`, wantErr: true, errMsg: "pg_sleep"},
+		{name: "postgres unicode escaped pg_sleep", engine: "postgres", sql: `SELECT U&"\+000070g_sleep"(1)`, wantErr: true, errMsg: "pg_sleep"},
+		{name: "postgres quoted column", engine: "postgres", sql: `SELECT "pg_sleep" FROM t`, wantErr: false},
+		{name: "postgres dblink", engine: "postgres", sql: "SELECT * FROM dblink('host=x', 'DELETE FROM t') AS t(a int)", wantErr: true, errMsg: "dblink"},
+		{name: "postgres query_to_xml", engine: "postgres", sql: "SELECT query_to_xml('DELETE FROM t RETURNING 1', true, true, '')", wantErr: true, errMsg: "query_to_xml"},
+		{name: "postgres copy", engine: "postgres", sql: "COPY users TO '/tmp/u'", wantErr: true, errMsg: "COPY"},
+		{name: "postgres legacy backslash", engine: "postgres", sql: `SELECT 'a\'; DELETE FROM users; --'`, wantErr: true, errMsg: "DELETE"},
+		{name: "redshift uses postgres rules", engine: "redshift", sql: "SELECT pg_terminate_backend(1)", wantErr: true, errMsg: "pg_terminate_backend"},
+
+		// MySQL
+		{name: "mysql backtick keyword", engine: "mysql", sql: "SELECT `delete` FROM t", wantErr: false},
+		{name: "mysql hash comment", engine: "mysql", sql: "SELECT 1 # DROP TABLE users", wantErr: false},
+		{name: "mysql into outfile", engine: "mysql", sql: "SELECT * FROM users INTO OUTFILE '/tmp/u'", wantErr: true, errMsg: "INTO"},
+		{name: "mysql load data", engine: "mysql", sql: "LOAD DATA INFILE '/tmp/u' INTO TABLE users", wantErr: true, errMsg: "LOAD"},
+		{name: "mysql sleep", engine: "mysql", sql: "SELECT SLEEP(10)", wantErr: true, errMsg: "sleep"},
+		{name: "mysql backtick sleep", engine: "mysql", sql: "SELECT `sleep`(10)", wantErr: true, errMsg: "sleep"},
+		{name: "mysql ansi quoted sleep", engine: "mysql", sql: `SELECT "SLEEP"(10)`, wantErr: true, errMsg: "sleep"},
+		{name: "mysql benchmark", engine: "mysql", sql: "SELECT BENCHMARK(1000000, MD5('a'))", wantErr: true, errMsg: "benchmark"},
+		{name: "mysql no backslash escapes mode", engine: "mysql", sql: `SELECT 'a\'; DELETE FROM users; -- '`, wantErr: true, errMsg: "DELETE"},
+
+		// BigQuery
+		{name: "bigquery backtick table", engine: "bigquery-cloud-sdk", sql: "SELECT * FROM `project.dataset.table`", wantErr: false},
+		{name: "bigquery triple quoted", engine: "bigquery-cloud-sdk", sql: `SELECT '''it's; DROP'''`, wantErr: false},
+		{name: "bigquery export data", engine: "bigquery-cloud-sdk", sql: "EXPORT DATA OPTIONS(uri='gs://b/*.csv') AS SELECT 1", wantErr: true, errMsg: "EXPORT"},
+
+		// Snowflake
+		{name: "snowflake put", engine: "snowflake", sql: "PUT file:///tmp/x @stage", wantErr: true, errMsg: "PUT"},
+		{name: "snowflake system function", engine: "snowflake", sql: "SELECT SYSTEM$CANCEL_ALL_QUERIES(1)", wantErr: true, errMsg: "system$cancel_all_queries"},
+		{name: "snowflake quoted system function", engine: "snowflake", sql: `SELECT "SYSTEM$CANCEL_ALL_QUERIES"(1)`, wantErr: true, errMsg: "system$cancel_all_queries"},
+		{name: "snowflake variable", engine: "snowflake", sql: "SELECT $var$ FROM t", wantErr: false},
+
+		// SQL Server
+		{name: "sqlserver waitfor", engine: "sqlserver", sql: "SELECT 1 WAITFOR DELAY '00:00:10'", wantErr: true, errMsg: "WAITFOR"},
+		{name: "sqlserver openrowset", engine: "sqlserver", sql: "SELECT * FROM OPENROWSET('SQLNCLI', 'x', 'SELECT 1')", wantErr: true, errMsg: "openrowset"},
+		{name: "sqlserver quoted openquery", engine: "sqlserver", sql: `SELECT * FROM "OPENQUERY"(srv, 'SELECT 1')`, wantErr: true, errMsg: "openquery"},
+		{name: "sqlserver bracketed xp_cmdshell", engine: "sqlserver", sql: "SELECT [xp_cmdshell]('dir')", wantErr: true, errMsg: "xp_cmdshell"},
+
+		// H2
+		{name: "h2 file_write", engine: "h2", sql: "SELECT FILE_WRITE('x', '/tmp/x')", wantErr: true, errMsg: "file_write"},
+		{name: "h2 quoted file_write", engine: "h2", sql: `SELECT "FILE_WRITE"('x', '/tmp/x')`, wantErr: true, errMsg: "file_write"},
+
+		// SQLite
+		{name: "sqlite quoted load_extension", engine: "sqlite", sql: `SELECT "load_extension"('/tmp/x.so')`, wantErr: true, errMsg: "load_extension"},
+
+		// Unknown engines fall back to the strictest policy
+		{name: "unknown engine", engine: "presto-jdbc", sql: "SELECT SLEEP(1)", wantErr: true, errMsg: "sleep"},
+		{name: "empty engine", engine: "", sql: "SELECT `delete` FROM t", wantErr: true, errMsg: "DELETE"},
+		{name: "engine case insensitive", engine: "Postgres", sql: "SELECT $$x$$", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PolicyForEngine(tt.engine).Validate(tt.sql)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPolicyForEngine_Strict(t *testing.T) {
+	assert.Equal(t, "strict", PolicyForEngine("mongo").Name)
+	assert.Equal(t, "postgres", PolicyForEngine("postgres").Name)
+}
+
+func TestValidateNativeQuery_EnginePolicy(t *testing.T) {
+	var lookups atomic.Int32
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/database/1":
+			lookups.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(Database{ID: 1, Engine: "mysql"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	validate := func(databaseID int, sql string) error {
+		return ValidateNativeQuery(context.Background(), client, databaseID, &NativeQuery{Query: sql}, nil)
+	}
+
+	// MySQL rules allow backtick-quoted keywords; the strict policy does not.
+	require.NoError(t, validate(1, "SELECT `delete` FROM t"))
+	require.NoError(t, validate(1, "SELECT `update` FROM t"))
+	assert.Equal(t, int32(1), lookups.Load(), "engine lookup should be cached")
+
+	err := validate(2, "SELECT `delete` FROM t")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "DELETE")
+}
+
+func TestNativeQueryFromDatasetQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		wantDB int
+		wantOK bool
+		want   string
+		tags   int
+	}{
+		{name: "legacy native", query: `{"type":"native","database":3,"native":{"query":"SELECT 1","template-tags":{"x":{}}}}`,
+			wantDB: 3, wantOK: true, want: "SELECT 1", tags: 1},
+		{name: "stage native", query: `{"lib/type":"mbql/query","database":4,"stages":[{"lib/type":"mbql.stage/native","native":"DELETE FROM t"}]}`,
+			wantDB: 4, wantOK: true, want: "DELETE FROM t"},
+		{name: "mbql", query: `{"type":"query","database":5,"query":{"source-table":2}}`, wantDB: 5},
+		{name: "stage mbql", query: `{"database":6,"stages":[{"source-table":2}]}`, wantDB: 6},
+		{name: "empty", query: `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dq map[string]any
+			require.NoError(t, json.Unmarshal([]byte(tt.query), &dq))
+			db, native, ok := NativeQueryFromDatasetQuery(dq)
+			assert.Equal(t, tt.wantDB, db)
+			require.Equal(t, tt.wantOK, ok)
+			if ok {
+				assert.Equal(t, tt.want, native.Query)
+				assert.Len(t, native.TemplateTags, tt.tags)
+			}
+		})
+	}
+}
+
+func TestValidateNativeQuery(t *testing.T) {
+	var compiles atomic.Int32
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/database/1":
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(Database{ID: 1, Engine: "postgres"})
+		case "/api/dataset/native":
+			compiles.Add(1)
+			var body DatasetQueryRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			w.Header().Set("Content-Type", "application/json")
+			switch {
+			case strings.Contains(body.Native.Query, "{{snippet: purge}}"):
+				_ = json.NewEncoder(w).Encode(NativeForm{Query: "SELECT 1; DELETE FROM users"})
+			case strings.Contains(body.Native.Query, "{{broken}}"):
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"message":"missing required parameter"}`))
+			default:
+				_ = json.NewEncoder(w).Encode(NativeForm{Query: "SELECT * FROM users WHERE id = 1"})
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tags := map[string]any{"x": map[string]any{"type": "text"}}
+
+	require.NoError(t, client.ValidateNativeQuery(context.Background(), 1, &NativeQuery{Query: "SELECT 1"}, nil))
+	assert.Equal(t, int32(0), compiles.Load(), "queries without template tags are not compiled")
+
+	require.NoError(t, client.ValidateNativeQuery(context.Background(), 1, &NativeQuery{Query: "SELECT * FROM users WHERE id = {{x}}", TemplateTags: tags}, nil))
+	assert.Equal(t, int32(1), compiles.Load())
+
+	err := client.ValidateNativeQuery(context.Background(), 1, &NativeQuery{Query: "DELETE FROM users"}, nil)
+	var violation *ReadOnlyViolation
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, "DELETE", violation.Token)
+
+	err = client.ValidateNativeQuery(context.Background(), 1, &NativeQuery{Query: "SELECT * FROM {{snippet: purge}}", TemplateTags: tags}, nil)
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, "DELETE", violation.Token)
+
+	err = client.ValidateNativeQuery(context.Background(), 1, &NativeQuery{Query: "SELECT {{broken}}", TemplateTags: tags}, nil)
+	require.Error(t, err)
+	assert.NotErrorAs(t, err, &violation)
+	assert.Contains(t, err.Error(), "template tag substitution")
+}
+
+func TestValidateDatasetQuery(t *testing.T) {
+	cards := map[string]string{
+		"10": `{"type":"native","database":1,"native":{"query":"DELETE FROM users"}}`,
+		"11": `{"type":"query","database":1,"query":{"source-table":"card__10"}}`,
+		"12": `{"type":"native","database":1,"native":{"query":"SELECT 1"}}`,
+		"13": `{"type":"query","database":1,"query":{"source-table":"card__13"}}`,
+	}
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/database/1" {
+			_ = json.NewEncoder(w).Encode(Database{ID: 1, Engine: "postgres"})
+			return
+		}
+		id, found := strings.CutPrefix(r.URL.Path, "/api/card/")
+		query, ok := cards[id]
+		if !found || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":` + id + `,"dataset_query":` + query + `}`))
+	})
+
+	tests := []struct {
+		name      string
+		query     string
+		violation string
+		errMsg    string
+	}{
+		{name: "mbql", query: `{"type":"query","database":1,"query":{"source-table":2}}`},
+		{name: "native", query: `{"type":"native","database":1,"native":{"query":"DROP TABLE users"}}`, violation: "DROP"},
+		{name: "native source query", query: `{"type":"query","database":1,"query":{"source-query":{"native":"DELETE FROM users"}}}`, violation: "DELETE"},
+		{name: "nested native source query", query: `{"type":"query","database":1,"query":{"source-query":{"source-query":{"native":"SELECT 1; DROP TABLE users"}}}}`, violation: "DROP"},
+		{name: "join native source query", query: `{"type":"query","database":1,"query":{"source-table":2,"joins":[{"source-query":{"native":"SELECT pg_sleep(10)"}}]}}`, violation: "pg_sleep"},
+		{name: "read-only native source query", query: `{"type":"query","database":1,"query":{"source-query":{"native":"SELECT 1"}}}`},
+		{name: "stage native", query: `{"database":1,"stages":[{"lib/type":"mbql.stage/native","native":"DELETE FROM users"},{"source-table":2}]}`, violation: "DELETE"},
+		{name: "read-only source card", query: `{"type":"query","database":1,"query":{"source-table":"card__12"}}`},
+		{name: "native source card", query: `{"type":"query","database":1,"query":{"source-table":"card__10"}}`, violation: "DELETE", errMsg: "source card 10"},
+		{name: "nested source card", query: `{"type":"query","database":1,"query":{"source-table":"card__11"}}`, violation: "DELETE", errMsg: "source card 11: source card 10"},
+		{name: "join source card", query: `{"type":"query","database":1,"query":{"source-table":2,"joins":[{"source-table":"card__10"}]}}`, violation: "DELETE"},
+		{name: "stage source card", query: `{"database":1,"stages":[{"source-card":10}]}`, violation: "DELETE"},
+		{name: "self-referencing source card", query: `{"type":"query","database":1,"query":{"source-table":"card__13"}}`},
+		{name: "unknown source card", query: `{"type":"query","database":1,"query":{"source-table":"card__99"}}`, errMsg: "could not verify source card 99"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dq map[string]any
+			require.NoError(t, json.Unmarshal([]byte(tt.query), &dq))
+			err := ValidateDatasetQuery(context.Background(), client, dq, nil)
+			var violation *ReadOnlyViolation
+			switch {
+			case tt.violation != "":
+				require.ErrorAs(t, err, &violation)
+				assert.Contains(t, err.Error(), tt.violation)
+			case tt.errMsg != "":
+				require.Error(t, err)
+				assert.NotErrorAs(t, err, &violation)
+			default:
+				require.NoError(t, err)
+			}
+			if tt.errMsg != "" {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+
+	t.Run("mbql query", func(t *testing.T) {
+		err := ValidateMBQLQuery(context.Background(), client, 1, map[string]any{"source-query": map[string]any{"native": "DELETE FROM users"}})
+		var violation *ReadOnlyViolation
+		require.ErrorAs(t, err, &violation)
+		require.NoError(t, ValidateMBQLQuery(context.Background(), client, 1, map[string]any{"source-table": float64(2)}))
+	})
+}
+
+func FuzzValidateReadOnlySQL(f *testing.F) {
+	seeds := []string{
+		"SELECT * FROM users",
+		"WITH cte AS (SELECT 1) SELECT * FROM cte",
+		`SELECT 'a''b', "c""d", ` + "`e`" + `, $$f$$, $t$g$t$, E'h\'i'`,
+		"SELECT 1 -- c\n; SELECT 2 /* d /* e */ f */",
+		`SELECT r'\', '''x''', """y"""`,
+		"SELECT 1 # c\n",
+		"DELETE FROM users",
+		"SELECT 1; DROP TABLE users",
+		`SELECT "pg_sleep"(10)`,
+		`SELECT "dblink_exec"('conn', 'DROP TABLE t')`,
+		`SELECT U&"pg_sleep"(1)`,
+		`SELECT U&"\0070g_sleep"(1), U&"!+000070g_sleep" UESCAPE '!' (1)`,
+		"SELECT `sleep`(1), [openrowset](1)",
+	}
+	for _, s := range seeds {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, sql string) {
+		err := ValidateReadOnlySQL(sql)
+
+		for _, d := range allLexDialects {
+			toks, lexErr := lexSQL(sql, d)
+			if lexErr != nil {
+				continue
+			}
+			var sb strings.Builder
+			for _, tok := range toks {
+				sb.WriteString(tok.text)
+			}
+			if sb.String() != sql {
+				t.Fatalf("%s: tokens do not reproduce input %q", d.name, sql)
+			}
+		}
+
+		if err != nil {
+			return
+		}
+		// Text appended after an accepted query is lexed at the top level
+		// under every dialect, so a trailing write statement must be caught.
+		if ValidateReadOnlySQL(sql+"\n;DELETE FROM users") == nil {
+			t.Fatalf("write statement appended to %q was accepted", sql)
+		}
+	})
+}
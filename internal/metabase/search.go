@@ -1,16 +1,21 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
-// Search searches across all entities.
-func (c *Client) Search(query string, models []string) (*SearchResponse, error) {
+// Search searches across all entities and returns a page of the results.
+func (c *Client) Search(ctx context.Context, query string, models []string, page Page) (*Paged[SearchResult], error) {
 	var result SearchResponse
 	req := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		SetQueryParam("q", query)
 	for _, m := range models {
-		req.SetQueryParam("models", m)
+		req.QueryParam.Add("models", m)
 	}
+	page.apply(req)
 	resp, err := req.Get("/api/search")
 	if err != nil {
 		return nil, fmt.Errorf("search: %w", err)
@@ -18,5 +23,5 @@ func (c *Client) Search(query string, models []string) (*SearchResponse, error)
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
-	return &result, nil
+	return serverPage(result.Data, result.Total, page), nil
 }
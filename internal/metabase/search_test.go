@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -21,7 +22,7 @@ func TestSearch(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	result, err := client.Search("revenue", nil)
+	result, err := client.Search(context.Background(), "revenue", nil, Page{})
 	require.NoError(t, err)
 	assert.Equal(t, 1, result.Total)
 	assert.Len(t, result.Data, 1)
@@ -1,11 +1,15 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListSettings returns all Metabase settings.
-func (c *Client) ListSettings() ([]Setting, error) {
+func (c *Client) ListSettings(ctx context.Context) ([]Setting, error) {
 	var result []Setting
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/setting")
 	if err != nil {
@@ -18,9 +22,10 @@ func (c *Client) ListSettings() ([]Setting, error) {
 }
 
 // GetSetting returns a specific setting by key.
-func (c *Client) GetSetting(key string) (any, error) {
+func (c *Client) GetSetting(ctx context.Context, key string) (any, error) {
 	var result any
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/setting/%s", key))
 	if err != nil {
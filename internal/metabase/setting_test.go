@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -18,7 +19,7 @@ func TestListSettings(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	settings, err := client.ListSettings()
+	settings, err := client.ListSettings(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, settings, 1)
 }
@@ -30,7 +31,7 @@ func TestGetSetting(t *testing.T) {
 		_, _ = w.Write([]byte(`"My Metabase"`))
 	})
 
-	val, err := client.GetSetting("site-name")
+	val, err := client.GetSetting(context.Background(), "site-name")
 	require.NoError(t, err)
 	assert.Equal(t, "My Metabase", val)
 }
@@ -0,0 +1,435 @@
+package metabase
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind classifies a lexical token of a SQL query.
+type tokenKind int
+
+const (
+	tokWhitespace  tokenKind = iota
+	tokComment               // -- line, # line, // line or /* block */ comment
+	tokWord                  // unquoted identifier or keyword
+	tokQuotedIdent           // "ident" or `ident`
+	tokString                // 'literal', E'literal', $tag$literal$tag$, '''literal'''
+	tokNumber                // numeric literal
+	tokParam                 // positional parameter such as $1
+	tokPunct                 // operators, parentheses and other punctuation
+	tokSemicolon             // statement separator
+)
+
+// token is a single lexical token. Concatenating the text of all tokens
+// returned by lexSQL reproduces the input exactly.
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+// lexDialect describes the lexical features of a SQL dialect that decide
+// which parts of a query are opaque to the classifier (literals, quoted
+// identifiers and comments). Getting these wrong in the permissive direction
+// would let a write statement hide inside what the lexer believes is a
+// string or a comment, so ambiguous constructs are resolved by lexing the
+// same query under several dialects.
+type lexDialect struct {
+	name               string
+	nestedComments     bool // /* /* */ */ nests (PostgreSQL)
+	backslashEscapes   bool // \' escapes a quote inside quoted text (MySQL, BigQuery, Snowflake)
+	escapeStrings      bool // E'...' literals honour backslash escapes (PostgreSQL)
+	dollarQuotes       bool // $$...$$ literals
+	taggedDollarQuotes bool // $tag$...$tag$ literals (PostgreSQL)
+	backtickIdents     bool // `ident` (MySQL, BigQuery)
+	doubleQuoteStrings bool // "..." is a string literal rather than an identifier
+	tripleQuotes       bool // '''...''' and """...""" literals (BigQuery)
+	rawStrings         bool // r'...' literals ignore backslashes (BigQuery)
+	hashComments       bool // # starts a line comment (MySQL, BigQuery)
+	slashComments      bool // // starts a line comment (Snowflake)
+	dashCommentSpace   bool // -- only starts a comment when followed by whitespace (MySQL)
+	executableComments bool // /*! ... */ is executed by the server (MySQL)
+}
+
+var (
+	ansiDialect = lexDialect{name: "ansi"}
+
+	postgresDialect = lexDialect{
+		name:               "postgres",
+		nestedComments:     true,
+		escapeStrings:      true,
+		dollarQuotes:       true,
+		taggedDollarQuotes: true,
+	}
+
+	mysqlDialect = lexDialect{
+		name:               "mysql",
+		backslashEscapes:   true,
+		backtickIdents:     true,
+		doubleQuoteStrings: true,
+		hashComments:       true,
+		dashCommentSpace:   true,
+		executableComments: true,
+	}
+
+	bigqueryDialect = lexDialect{
+		name:               "bigquery",
+		backslashEscapes:   true,
+		backtickIdents:     true,
+		doubleQuoteStrings: true,
+		tripleQuotes:       true,
+		rawStrings:         true,
+		hashComments:       true,
+	}
+
+	snowflakeDialect = lexDialect{
+		name:             "snowflake",
+		backslashEscapes: true,
+		dollarQuotes:     true,
+		slashComments:    true,
+	}
+)
+
+// Variants for engines whose lexical rules depend on server configuration or
+// that are only partially covered by the dialects above.
+var (
+	// postgresLegacyDialect covers standard_conforming_strings=off (and
+	// Redshift), where backslashes escape quotes in plain string literals.
+	postgresLegacyDialect = lexDialect{
+		name:               "postgres-legacy",
+		nestedComments:     true,
+		backslashEscapes:   true,
+		escapeStrings:      true,
+		dollarQuotes:       true,
+		taggedDollarQuotes: true,
+	}
+
+	// mysqlANSIDialect covers the NO_BACKSLASH_ESCAPES and ANSI_QUOTES modes.
+	mysqlANSIDialect = lexDialect{
+		name:               "mysql-ansi",
+		backtickIdents:     true,
+		hashComments:       true,
+		dashCommentSpace:   true,
+		executableComments: true,
+	}
+
+	tsqlDialect = lexDialect{
+		name:           "tsql",
+		nestedComments: true,
+	}
+
+	h2Dialect = lexDialect{
+		name:         "h2",
+		dollarQuotes: true,
+	}
+)
+
+// allLexDialects is used when the engine behind a query is unknown. A query
+// must classify as read-only under every one of them to be accepted.
+var allLexDialects = []lexDialect{
+	ansiDialect,
+	postgresDialect,
+	mysqlDialect,
+	bigqueryDialect,
+	snowflakeDialect,
+	postgresLegacyDialect,
+	mysqlANSIDialect,
+	tsqlDialect,
+	h2Dialect,
+}
+
+// lexError describes why a query could not be tokenized.
+type lexError struct {
+	reason ViolationReason
+	what   string
+	offset int
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	d    lexDialect
+	toks []token
+}
+
+// lexSQL splits src into tokens according to the given dialect.
+func lexSQL(src string, d lexDialect) ([]token, *lexError) {
+	l := &lexer{src: src, d: d}
+	for l.pos < len(l.src) {
+		if err := l.next(); err != nil {
+			return nil, err
+		}
+	}
+	return l.toks, nil
+}
+
+func (l *lexer) next() *lexError {
+	start := l.pos
+	c := l.src[l.pos]
+
+	switch {
+	case isSpace(c):
+		for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+			l.pos++
+		}
+		l.emit(tokWhitespace, start)
+
+	case c == '-' && l.peek(1) == '-' && (!l.d.dashCommentSpace || l.pos+2 >= len(l.src) || isSpace(l.peek(2))),
+		c == '#' && l.d.hashComments,
+		c == '/' && l.peek(1) == '/' && l.d.slashComments:
+		l.skipLine()
+		l.emit(tokComment, start)
+
+	case c == '/' && l.peek(1) == '*':
+		if l.d.executableComments && l.peek(2) == '!' {
+			return &lexError{reason: ReasonUnsupportedSyntax, what: "executable comment", offset: start}
+		}
+		if !l.blockComment() {
+			return &lexError{reason: ReasonUnterminated, what: "comment", offset: start}
+		}
+		l.emit(tokComment, start)
+
+	case c == '\'' || (c == '"' && l.d.doubleQuoteStrings):
+		if !l.stringLiteral(c, l.d.backslashEscapes) {
+			return &lexError{reason: ReasonUnterminated, what: "string literal", offset: start}
+		}
+		l.emit(tokString, start)
+
+	case c == '"':
+		if !l.quoted('"', false) {
+			return &lexError{reason: ReasonUnterminated, what: "quoted identifier", offset: start}
+		}
+		l.emit(tokQuotedIdent, start)
+
+	case c == '`' && l.d.backtickIdents:
+		if !l.quoted('`', false) {
+			return &lexError{reason: ReasonUnterminated, what: "quoted identifier", offset: start}
+		}
+		l.emit(tokQuotedIdent, start)
+
+	case (c == 'E' || c == 'e') && l.peek(1) == '\'' && l.d.escapeStrings:
+		l.pos++
+		if !l.quoted('\'', true) {
+			return &lexError{reason: ReasonUnterminated, what: "string literal", offset: start}
+		}
+		l.emit(tokString, start)
+
+	case l.d.rawStrings && l.rawPrefixLen() > 0:
+		l.pos += l.rawPrefixLen()
+		if !l.stringLiteral(l.src[l.pos], false) {
+			return &lexError{reason: ReasonUnterminated, what: "string literal", offset: start}
+		}
+		l.emit(tokString, start)
+
+	case c == '$' && l.d.dollarQuotes:
+		if tag, ok := l.dollarTag(); ok {
+			l.pos += len(tag)
+			end := strings.Index(l.src[l.pos:], tag)
+			if end < 0 {
+				return &lexError{reason: ReasonUnterminated, what: "dollar-quoted string", offset: start}
+			}
+			l.pos += end + len(tag)
+			l.emit(tokString, start)
+			return nil
+		}
+		l.dollarParamOrPunct(start)
+
+	case c == '$':
+		l.dollarParamOrPunct(start)
+
+	case isDigit(c) || (c == '.' && isDigit(l.peek(1))):
+		l.number()
+		l.emit(tokNumber, start)
+
+	case isWordStart(c):
+		for l.pos < len(l.src) && isWordPart(l.src[l.pos]) {
+			l.pos++
+		}
+		l.emit(tokWord, start)
+
+	case c == ';':
+		l.pos++
+		l.emit(tokSemicolon, start)
+
+	case c >= utf8.RuneSelf:
+		// Non-ASCII characters are deliberately treated as punctuation rather
+		// than identifier characters: some engines treat Unicode spaces as
+		// separators, and splitting here can only expose more keywords.
+		_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		l.pos += size
+		l.emit(tokPunct, start)
+
+	default:
+		l.pos++
+		l.emit(tokPunct, start)
+	}
+	return nil
+}
+
+func (l *lexer) emit(kind tokenKind, start int) {
+	l.toks = append(l.toks, token{kind: kind, text: l.src[start:l.pos], offset: start})
+}
+
+// peek returns the byte n positions ahead, or 0 past the end of input.
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.src) {
+		return l.src[l.pos+n]
+	}
+	return 0
+}
+
+func (l *lexer) skipLine() {
+	for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+		l.pos++
+	}
+}
+
+// blockComment consumes a /* */ comment, honouring nesting when the dialect
+// supports it. It reports false if the comment is not terminated.
+func (l *lexer) blockComment() bool {
+	l.pos += 2
+	depth := 1
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], "*/"):
+			l.pos += 2
+			depth--
+			if depth == 0 {
+				return true
+			}
+		case l.d.nestedComments && strings.HasPrefix(l.src[l.pos:], "/*"):
+			l.pos += 2
+			depth++
+		default:
+			l.pos++
+		}
+	}
+	return false
+}
+
+// stringLiteral consumes a single- or triple-quoted literal starting with q.
+func (l *lexer) stringLiteral(q byte, backslash bool) bool {
+	triple := strings.Repeat(string(q), 3)
+	if l.d.tripleQuotes && strings.HasPrefix(l.src[l.pos:], triple) {
+		l.pos += 3
+		for l.pos < len(l.src) {
+			switch {
+			case backslash && l.src[l.pos] == '\\':
+				l.pos += 2
+			case strings.HasPrefix(l.src[l.pos:], triple):
+				l.pos += 3
+				return true
+			default:
+				l.pos++
+			}
+		}
+		l.pos = len(l.src)
+		return false
+	}
+	return l.quoted(q, backslash)
+}
+
+// quoted consumes text enclosed in q, where a doubled q is an escaped quote
+// and, if backslash is set, a backslash escapes the following byte.
+func (l *lexer) quoted(q byte, backslash bool) bool {
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case backslash && c == '\\':
+			l.pos += 2
+		case c == q && l.peek(1) == q:
+			l.pos += 2
+		case c == q:
+			l.pos++
+			return true
+		default:
+			l.pos++
+		}
+	}
+	l.pos = len(l.src)
+	return false
+}
+
+// rawPrefixLen returns the length of a BigQuery raw/bytes string prefix
+// (r, rb, br) directly followed by a quote, or 0.
+func (l *lexer) rawPrefixLen() int {
+	for _, p := range []string{"rb", "br", "r"} {
+		if len(l.src)-l.pos > len(p) && strings.EqualFold(l.src[l.pos:l.pos+len(p)], p) {
+			if q := l.src[l.pos+len(p)]; q == '\'' || q == '"' {
+				return len(p)
+			}
+		}
+	}
+	return 0
+}
+
+// dollarTag returns the opening delimiter of a dollar-quoted string at the
+// current position ($$ or $tag$), if there is one.
+func (l *lexer) dollarTag() (string, bool) {
+	i := l.pos + 1
+	if l.d.taggedDollarQuotes && i < len(l.src) && isWordStart(l.src[i]) {
+		for i < len(l.src) && isWordPart(l.src[i]) && l.src[i] != '$' {
+			i++
+		}
+	}
+	if i < len(l.src) && l.src[i] == '$' {
+		return l.src[l.pos : i+1], true
+	}
+	return "", false
+}
+
+func (l *lexer) dollarParamOrPunct(start int) {
+	l.pos++
+	if isDigit(l.peek(0)) {
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		l.emit(tokParam, start)
+		return
+	}
+	l.emit(tokPunct, start)
+}
+
+// number consumes digits with an optional fraction and exponent. Letters
+// following a number start a new word so that "1DELETE" still exposes the
+// keyword.
+func (l *lexer) number() {
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.peek(0) == '.' {
+		l.pos++
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	if c := l.peek(0); c == 'e' || c == 'E' {
+		n := 1
+		if s := l.peek(1); s == '+' || s == '-' {
+			n = 2
+		}
+		if isDigit(l.peek(n)) {
+			l.pos += n
+			for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+				l.pos++
+			}
+		}
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || isDigit(c) || c == '$'
+}
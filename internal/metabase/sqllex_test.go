@@ -0,0 +1,75 @@
+package metabase
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		dialect lexDialect
+		want    []tokenKind
+	}{
+		{name: "select", sql: "SELECT a, 1.5e3 FROM t;", dialect: ansiDialect,
+			want: []tokenKind{tokWord, tokWhitespace, tokWord, tokPunct, tokWhitespace, tokNumber, tokWhitespace, tokWord, tokWhitespace, tokWord, tokSemicolon}},
+		{name: "ansi backslash is literal", sql: `'a\'`, dialect: ansiDialect, want: []tokenKind{tokString}},
+		{name: "mysql backslash escapes", sql: `'a\'b'`, dialect: mysqlDialect, want: []tokenKind{tokString}},
+		{name: "postgres escape string", sql: `E'a\'b'`, dialect: postgresDialect, want: []tokenKind{tokString}},
+		{name: "postgres tagged dollar quote", sql: "$x$ ' $x$", dialect: postgresDialect, want: []tokenKind{tokString}},
+		{name: "postgres parameter", sql: "$12", dialect: postgresDialect, want: []tokenKind{tokParam}},
+		{name: "snowflake variable", sql: "$x$", dialect: snowflakeDialect, want: []tokenKind{tokPunct, tokWord}},
+		{name: "postgres nested comment", sql: "/* a /* b */ c */", dialect: postgresDialect, want: []tokenKind{tokComment}},
+		{name: "ansi flat comment", sql: "/* a /* b */c", dialect: ansiDialect, want: []tokenKind{tokComment, tokWord}},
+		{name: "mysql double dash needs space", sql: "--x", dialect: mysqlDialect, want: []tokenKind{tokPunct, tokPunct, tokWord}},
+		{name: "mysql hash comment", sql: "# x\nSELECT", dialect: mysqlDialect, want: []tokenKind{tokComment, tokWhitespace, tokWord}},
+		{name: "bigquery backtick", sql: "`a``b`", dialect: bigqueryDialect, want: []tokenKind{tokQuotedIdent}},
+		{name: "bigquery triple quote", sql: `'''a'b'''`, dialect: bigqueryDialect, want: []tokenKind{tokString}},
+		{name: "bigquery raw string", sql: `r'\'`, dialect: bigqueryDialect, want: []tokenKind{tokString}},
+		{name: "snowflake slash comment", sql: "// x", dialect: snowflakeDialect, want: []tokenKind{tokComment}},
+		{name: "double quoted identifier", sql: `"a""b"`, dialect: ansiDialect, want: []tokenKind{tokQuotedIdent}},
+		{name: "unicode is punctuation", sql: "é", dialect: ansiDialect, want: []tokenKind{tokPunct}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toks, err := lexSQL(tt.sql, tt.dialect)
+			require.Nil(t, err)
+			kinds := make([]tokenKind, len(toks))
+			text := ""
+			for i, tok := range toks {
+				kinds[i] = tok.kind
+				text += tok.text
+			}
+			assert.Equal(t, tt.want, kinds)
+			assert.Equal(t, tt.sql, text)
+		})
+	}
+}
+
+func TestLexSQL_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		dialect lexDialect
+		reason  ViolationReason
+		offset  int
+	}{
+		{name: "unterminated string", sql: "SELECT 'a", dialect: ansiDialect, reason: ReasonUnterminated, offset: 7},
+		{name: "trailing backslash", sql: `'a\`, dialect: mysqlDialect, reason: ReasonUnterminated},
+		{name: "unterminated nested comment", sql: "/* /* */", dialect: postgresDialect, reason: ReasonUnterminated},
+		{name: "executable comment", sql: "SELECT /*!1*/", dialect: mysqlDialect, reason: ReasonUnsupportedSyntax, offset: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := lexSQL(tt.sql, tt.dialect)
+			require.NotNil(t, err)
+			assert.Equal(t, tt.reason, err.reason)
+			assert.Equal(t, tt.offset, err.offset)
+		})
+	}
+}
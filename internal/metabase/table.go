@@ -1,11 +1,15 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListTables returns all tables for a given database.
-func (c *Client) ListTables(databaseID int) ([]Table, error) {
+func (c *Client) ListTables(ctx context.Context, databaseID int) ([]Table, error) {
 	var result []Table
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/database/%d/metadata/tables", databaseID))
 	if err != nil {
@@ -18,9 +22,10 @@ func (c *Client) ListTables(databaseID int) ([]Table, error) {
 }
 
 // GetTable returns a table by ID.
-func (c *Client) GetTable(id int) (*Table, error) {
+func (c *Client) GetTable(ctx context.Context, id int) (*Table, error) {
 	var result Table
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/table/%d", id))
 	if err != nil {
@@ -33,9 +38,10 @@ func (c *Client) GetTable(id int) (*Table, error) {
 }
 
 // GetTableMetadata returns table metadata including all fields.
-func (c *Client) GetTableMetadata(id int) (*Table, error) {
+func (c *Client) GetTableMetadata(ctx context.Context, id int) (*Table, error) {
 	var result Table
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		SetQueryParam("include_hidden_fields", "true").
 		Get(fmt.Sprintf("/api/table/%d/query_metadata", id))
@@ -49,9 +55,10 @@ func (c *Client) GetTableMetadata(id int) (*Table, error) {
 }
 
 // GetTableForeignKeys returns foreign key relationships for a table.
-func (c *Client) GetTableForeignKeys(id int) ([]ForeignKey, error) {
+func (c *Client) GetTableForeignKeys(ctx context.Context, id int) ([]ForeignKey, error) {
 	var result []ForeignKey
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/table/%d/fks", id))
 	if err != nil {
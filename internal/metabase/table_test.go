@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -20,7 +21,7 @@ func TestListTables(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	tables, err := client.ListTables(1)
+	tables, err := client.ListTables(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Len(t, tables, 2)
 }
@@ -33,7 +34,7 @@ func TestGetTable(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	tbl, err := client.GetTable(1)
+	tbl, err := client.GetTable(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "USERS", tbl.Name)
 }
@@ -50,7 +51,7 @@ func TestGetTableMetadata(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	tbl, err := client.GetTableMetadata(1)
+	tbl, err := client.GetTableMetadata(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Len(t, tbl.Fields, 2)
 }
@@ -65,7 +66,7 @@ func TestGetTableForeignKeys(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	fks, err := client.GetTableForeignKeys(1)
+	fks, err := client.GetTableForeignKeys(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Len(t, fks, 1)
 }
@@ -1,11 +1,14 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // ListTimelines returns all timelines.
-func (c *Client) ListTimelines(collectionID *int) ([]Timeline, error) {
+func (c *Client) ListTimelines(ctx context.Context, collectionID *int) ([]Timeline, error) {
 	var result []Timeline
-	req := c.httpClient.R().SetResult(&result)
+	req := c.httpClient.R().SetContext(ctx).SetResult(&result)
 	if collectionID != nil {
 		req.SetQueryParam("collection_id", fmt.Sprintf("%d", *collectionID))
 	}
@@ -20,9 +23,10 @@ func (c *Client) ListTimelines(collectionID *int) ([]Timeline, error) {
 }
 
 // GetTimeline returns a timeline by ID.
-func (c *Client) GetTimeline(id int) (*Timeline, error) {
+func (c *Client) GetTimeline(ctx context.Context, id int) (*Timeline, error) {
 	var result Timeline
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		SetQueryParam("include", "events").
 		Get(fmt.Sprintf("/api/timeline/%d", id))
@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -18,7 +19,7 @@ func TestListTimelines(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	timelines, err := client.ListTimelines(nil)
+	timelines, err := client.ListTimelines(context.Background(), nil)
 	require.NoError(t, err)
 	assert.Len(t, timelines, 1)
 }
@@ -35,7 +36,7 @@ func TestGetTimeline(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	tl, err := client.GetTimeline(1)
+	tl, err := client.GetTimeline(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "Releases", tl.Name)
 	assert.Len(t, tl.Events, 1)
@@ -25,15 +25,18 @@ type Card struct {
 
 // Dashboard represents a Metabase dashboard.
 type Dashboard struct {
-	ID                    int              `json:"id,omitempty"`
-	Name                  string           `json:"name,omitempty"`
-	Description           *string          `json:"description,omitempty"`
-	CollectionID          *int             `json:"collection_id,omitempty"`
-	Parameters            []map[string]any `json:"parameters,omitempty"`
-	Archived              *bool            `json:"archived,omitempty"`
-	EnableEmbedding       *bool            `json:"enable_embedding,omitempty"`
-	EmbeddingParams       map[string]any   `json:"embedding_params,omitempty"`
-	DashCards             []DashCard       `json:"dashcards,omitempty"`
+	ID              int              `json:"id,omitempty"`
+	Name            string           `json:"name,omitempty"`
+	Description     *string          `json:"description,omitempty"`
+	CollectionID    *int             `json:"collection_id,omitempty"`
+	Parameters      []map[string]any `json:"parameters,omitempty"`
+	Archived        *bool            `json:"archived,omitempty"`
+	EnableEmbedding *bool            `json:"enable_embedding,omitempty"`
+	EmbeddingParams map[string]any   `json:"embedding_params,omitempty"`
+	DashCards       []DashCard       `json:"dashcards,omitempty"`
+	// OrderedCards holds the cards of a dashboard on Metabase before v0.47.
+	// GetDashboard moves them to DashCards.
+	OrderedCards          []DashCard       `json:"ordered_cards,omitempty"`
 	Tabs                  []map[string]any `json:"tabs,omitempty"`
 	CreatorID             *int             `json:"creator_id,omitempty"`
 	CreatedAt             *time.Time       `json:"created_at,omitempty"`
@@ -143,6 +146,8 @@ type DatasetQueryRequest struct {
 	Type     string         `json:"type"`
 	Native   *NativeQuery   `json:"native,omitempty"`
 	Query    map[string]any `json:"query,omitempty"`
+	// Parameters holds values for template tags, as sent to /api/card/:id/query.
+	Parameters []any `json:"parameters,omitempty"`
 }
 
 // NativeQuery represents a native SQL query.
@@ -1,28 +1,33 @@
 package metabase
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
-// ListUsers returns all users.
-func (c *Client) ListUsers() ([]User, error) {
+// ListUsers returns a page of the users.
+func (c *Client) ListUsers(ctx context.Context, page Page) (*Paged[User], error) {
 	var result struct {
-		Data []User `json:"data"`
+		Data  []User `json:"data"`
+		Total int    `json:"total"`
 	}
-	resp, err := c.httpClient.R().
-		SetResult(&result).
-		Get("/api/user")
+	req := c.httpClient.R().SetContext(ctx).SetResult(&result)
+	page.apply(req)
+	resp, err := req.Get("/api/user")
 	if err != nil {
 		return nil, fmt.Errorf("list users: %w", err)
 	}
 	if err := checkResponse(resp); err != nil {
 		return nil, err
 	}
-	return result.Data, nil
+	return serverPage(result.Data, result.Total, page), nil
 }
 
 // GetUser returns a user by ID.
-func (c *Client) GetUser(id int) (*User, error) {
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
 	var result User
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get(fmt.Sprintf("/api/user/%d", id))
 	if err != nil {
@@ -35,9 +40,10 @@ func (c *Client) GetUser(id int) (*User, error) {
 }
 
 // GetCurrentUser returns the currently authenticated user.
-func (c *Client) GetCurrentUser() (*User, error) {
+func (c *Client) GetCurrentUser(ctx context.Context) (*User, error) {
 	var result User
 	resp, err := c.httpClient.R().
+		SetContext(ctx).
 		SetResult(&result).
 		Get("/api/user/current")
 	if err != nil {
@@ -1,6 +1,7 @@
 package metabase
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"testing"
@@ -10,17 +11,21 @@ import (
 )
 
 func TestListUsers(t *testing.T) {
-	_, client := newTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+	_, client := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
 		w.Header().Set("Content-Type", "application/json")
 		err := json.NewEncoder(w).Encode(map[string]any{
-			"data": []User{{ID: 1, Email: "admin@test.com"}},
+			"data":  []User{{ID: 1, Email: "admin@test.com"}},
+			"total": 1,
 		})
 		require.NoError(t, err)
 	})
 
-	users, err := client.ListUsers()
+	users, err := client.ListUsers(context.Background(), Page{Limit: 10})
 	require.NoError(t, err)
-	assert.Len(t, users, 1)
+	assert.Len(t, users.Data, 1)
+	_, more := users.Next()
+	assert.False(t, more)
 }
 
 func TestGetUser(t *testing.T) {
@@ -31,7 +36,7 @@ func TestGetUser(t *testing.T) {
 		require.NoError(t, err)
 	})
 
-	user, err := client.GetUser(1)
+	user, err := client.GetUser(context.Background(), 1)
 	require.NoError(t, err)
 	assert.Equal(t, "admin@test.com", user.Email)
 }
@@ -42,7 +47,7 @@ func TestGetCurrentUser(t *testing.T) {
 	})
 
 	// newTestServer returns a valid User for /api/user/current
-	user, err := client.GetCurrentUser()
+	user, err := client.GetCurrentUser(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, "test@test.com", user.Email)
 }
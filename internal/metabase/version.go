@@ -0,0 +1,181 @@
+package metabase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Version is a Metabase version tag such as v0.50.3 (open source) or
+// v1.50.3 (enterprise). Metabase numbers its releases with the second
+// component, so v0.50.3 and v1.50.3 have the same API.
+type Version struct {
+	Tag        string
+	Enterprise bool
+	// Release is the Metabase release, e.g. 50, or 0 if Tag could not be
+	// parsed, as for development builds.
+	Release int
+	Patch   int
+}
+
+// ParseVersion parses a Metabase version tag. A tag that is not of the form
+// vX.Y[.Z...] gives a Version with Release 0.
+func ParseVersion(tag string) Version {
+	v := Version{Tag: tag}
+	parts := strings.Split(strings.TrimPrefix(tag, "v"), ".")
+	if len(parts) < 2 {
+		return v
+	}
+	edition, err1 := strconv.Atoi(parts[0])
+	release, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return v
+	}
+	v.Enterprise = edition >= 1
+	v.Release = release
+	if len(parts) > 2 {
+		// Patch tags may carry suffixes such as "3-beta".
+		digits := strings.TrimRightFunc(parts[2], func(r rune) bool { return r < '0' || r > '9' })
+		v.Patch, _ = strconv.Atoi(digits)
+	}
+	return v
+}
+
+// Known reports whether the version could be parsed.
+func (v Version) Known() bool {
+	return v.Release > 0
+}
+
+// AtLeast reports whether v is release or later. Unknown versions are taken
+// to be the latest.
+func (v Version) AtLeast(release int) bool {
+	return !v.Known() || v.Release >= release
+}
+
+// String returns the version tag.
+func (v Version) String() string {
+	if v.Tag == "" {
+		return "unknown version"
+	}
+	return v.Tag
+}
+
+// Capability names an API behavior that differs between Metabase releases.
+type Capability string
+
+const (
+	// CapDashcards means dashboards list their cards as dashcards, and
+	// cards are added, moved and removed by updating the dashboard (v0.47+).
+	// Before, they were ordered_cards, changed through
+	// /api/dashboard/:id/cards.
+	CapDashcards Capability = "dashcards"
+	// CapLegacyAlerts means alerts are managed through /api/alert (up to
+	// v0.53).
+	CapLegacyAlerts Capability = "legacy-alerts"
+	// CapNotifications means alerts are managed through /api/notification
+	// (v0.54+).
+	CapNotifications Capability = "notifications"
+)
+
+// capabilities returns the capabilities of a Metabase version.
+func capabilities(v Version) []Capability {
+	var caps []Capability
+	if v.AtLeast(47) {
+		caps = append(caps, CapDashcards)
+	}
+	if v.AtLeast(54) {
+		caps = append(caps, CapNotifications)
+	} else {
+		caps = append(caps, CapLegacyAlerts)
+	}
+	return caps
+}
+
+// ServerInfo describes a Metabase instance.
+type ServerInfo struct {
+	Version      Version
+	Capabilities []Capability
+	// Features lists the enabled paid features (token-features), such as
+	// "sandboxes" or "audit_app".
+	Features []string
+}
+
+// Has reports whether the instance has capability c.
+func (s *ServerInfo) Has(c Capability) bool {
+	return slices.Contains(s.Capabilities, c)
+}
+
+// UnsupportedError is returned for an operation the Metabase version of
+// the instance does not offer.
+type UnsupportedError struct {
+	Operation string
+	Version   Version
+	// Hint optionally points to an alternative.
+	Hint string
+}
+
+// Error implements error.
+func (e *UnsupportedError) Error() string {
+	msg := fmt.Sprintf("%s is not supported on Metabase %s", e.Operation, e.Version)
+	if e.Hint != "" {
+		msg += "; " + e.Hint
+	}
+	return msg
+}
+
+// ServerInfo returns the version, capabilities and features of the
+// Metabase instance, read from /api/session/properties on first use.
+func (c *Client) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	if c.info != nil {
+		return c.info, nil
+	}
+
+	var props struct {
+		Version struct {
+			Tag string `json:"tag"`
+		} `json:"version"`
+		TokenFeatures map[string]bool `json:"token-features"`
+	}
+	resp, err := c.httpClient.R().
+		SetContext(ctx).
+		SetResult(&props).
+		Get("/api/session/properties")
+	if err != nil {
+		return nil, fmt.Errorf("get server info: %w", err)
+	}
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	version := ParseVersion(props.Version.Tag)
+	info := &ServerInfo{Version: version, Capabilities: capabilities(version)}
+	for feature, enabled := range props.TokenFeatures {
+		if enabled {
+			info.Features = append(info.Features, feature)
+		}
+	}
+	slices.Sort(info.Features)
+	if !version.Known() {
+		c.logger.Warn().Str("version", version.Tag).Msg("unrecognized metabase version, assuming the latest API")
+	}
+	c.logger.Info().Str("version", version.String()).Msg("detected metabase version")
+	c.info = info
+	return info, nil
+}
+
+// require returns an *UnsupportedError for operation unless the instance
+// has capability capability.
+func (c *Client) require(ctx context.Context, capability Capability, operation, hint string) error {
+	info, err := c.ServerInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if !info.Has(capability) {
+		return &UnsupportedError{Operation: operation, Version: info.Version, Hint: hint}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package metabase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		tag        string
+		release    int
+		patch      int
+		enterprise bool
+		known      bool
+	}{
+		{tag: "v0.46.6", release: 46, patch: 6, known: true},
+		{tag: "v1.50.3", release: 50, patch: 3, enterprise: true, known: true},
+		{tag: "v0.52.0-beta", release: 52, known: true},
+		{tag: "v0.49", release: 49, known: true},
+		{tag: "v0.49.3.1", release: 49, patch: 3, known: true},
+		{tag: "vLOCAL_DEV"},
+		{tag: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			v := ParseVersion(tt.tag)
+			assert.Equal(t, tt.release, v.Release)
+			assert.Equal(t, tt.patch, v.Patch)
+			assert.Equal(t, tt.enterprise, v.Enterprise)
+			assert.Equal(t, tt.known, v.Known())
+		})
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want []Capability
+	}{
+		{tag: "v0.46.6", want: []Capability{CapLegacyAlerts}},
+		{tag: "v0.47.0", want: []Capability{CapDashcards, CapLegacyAlerts}},
+		{tag: "v1.53.9", want: []Capability{CapDashcards, CapLegacyAlerts}},
+		{tag: "v0.54.1", want: []Capability{CapDashcards, CapNotifications}},
+		{tag: "vUNKNOWN", want: []Capability{CapDashcards, CapNotifications}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			assert.Equal(t, tt.want, capabilities(ParseVersion(tt.tag)))
+		})
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/session/properties", r.URL.Path)
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"version":{"tag":"v1.50.3","hash":"abc"},"token-features":{"sandboxes":true,"audit_app":true,"whitelabel":false}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "key", "", "", zerolog.Nop(), WithoutStartupCheck())
+	require.NoError(t, err)
+
+	info, err := client.ServerInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "v1.50.3", info.Version.String())
+	assert.True(t, info.Version.Enterprise)
+	assert.True(t, info.Has(CapDashcards))
+	assert.False(t, info.Has(CapNotifications))
+	assert.Equal(t, []string{"audit_app", "sandboxes"}, info.Features)
+
+	_, err = client.ServerInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load(), "server info is read once")
+}
+
+func TestServerInfo_DetectedAtStartup(t *testing.T) {
+	var requests atomic.Int32
+	_, client := newTestServer(t, func(http.ResponseWriter, *http.Request) {
+		requests.Add(1)
+	})
+	info, err := client.ServerInfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 46, info.Version.Release)
+	assert.Zero(t, requests.Load())
+}
@@ -0,0 +1,285 @@
+// Package percaller serves the MCP streamable HTTP transport with Metabase
+// credentials supplied by each caller, so that every user sees only what
+// Metabase's own permissions allow them to see.
+package percaller
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+
+	"github.com/anaryk/metabase-mcp-server/internal/config"
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+	"github.com/anaryk/metabase-mcp-server/internal/tools"
+)
+
+// Headers carrying the caller's Metabase credentials.
+const (
+	APIKeyHeader  = "X-Metabase-Api-Key"
+	SessionHeader = "X-Metabase-Session"
+)
+
+// sessionIDHeader is the streamable HTTP transport's session header.
+const sessionIDHeader = "Mcp-Session-Id"
+
+// Options configures a Handler.
+type Options struct {
+	// Instances are the Metabase instances callers can reach. Their
+	// configured credentials are ignored.
+	Instances       []config.Instance
+	DefaultInstance string
+	// NewServer creates an MCP server with tools bound to instances.
+	NewServer func(instances *tools.Instances) *mcp.Server
+	// SessionTimeout closes sessions idle for this long. Zero disables it.
+	SessionTimeout time.Duration
+	// ClientOptions are applied to every per-caller Metabase client.
+	ClientOptions []metabase.Option
+	Logger        zerolog.Logger
+}
+
+// Handler creates a separate MCP server and set of Metabase clients for each
+// MCP session, authenticated with the credentials of the caller that opened
+// it. Later requests of the session must carry the same credentials. The
+// clients are released when the session ends.
+type Handler struct {
+	opts  Options
+	inner *mcp.StreamableHTTPHandler
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is the state kept per MCP session.
+type session struct {
+	fingerprint [sha256.Size]byte
+	clients     []*metabase.Client
+}
+
+// pending carries a session being created from ServeHTTP to the inner
+// handler's getServer callback and back.
+type pending struct {
+	instances *tools.Instances
+	// session is the MCP session of the server created for the request,
+	// recorded when it receives its first message.
+	session atomic.Pointer[mcp.ServerSession]
+}
+
+type pendingKey struct{}
+
+// NewHandler creates a Handler.
+func NewHandler(opts Options) *Handler {
+	h := &Handler{opts: opts, sessions: make(map[string]*session)}
+	h.inner = mcp.NewStreamableHTTPHandler(func(r *http.Request) *mcp.Server {
+		p, _ := r.Context().Value(pendingKey{}).(*pending)
+		if p == nil {
+			return nil
+		}
+		server := opts.NewServer(p.instances)
+		server.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+			return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+				if ss, ok := req.GetSession().(*mcp.ServerSession); ok {
+					p.session.CompareAndSwap(nil, ss)
+				}
+				return next(ctx, method, req)
+			}
+		})
+		return server
+	}, &mcp.StreamableHTTPOptions{SessionTimeout: opts.SessionTimeout})
+	return h
+}
+
+// credentials are the Metabase credentials presented with a request.
+type credentials struct {
+	apiKey       string
+	sessionToken string
+}
+
+func credentialsFrom(r *http.Request) credentials {
+	return credentials{
+		apiKey:       r.Header.Get(APIKeyHeader),
+		sessionToken: r.Header.Get(SessionHeader),
+	}
+}
+
+func (c credentials) empty() bool {
+	return c.apiKey == "" && c.sessionToken == ""
+}
+
+func (c credentials) fingerprint() [sha256.Size]byte {
+	return sha256.Sum256([]byte(c.apiKey + "\x00" + c.sessionToken))
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	creds := credentialsFrom(r)
+	if creds.empty() {
+		http.Error(w, "missing Metabase credentials: send an "+APIKeyHeader+" or "+SessionHeader+" header", http.StatusUnauthorized)
+		return
+	}
+
+	if id := r.Header.Get(sessionIDHeader); id != "" {
+		h.mu.Lock()
+		sess := h.sessions[id]
+		h.mu.Unlock()
+		if sess == nil {
+			// Only sessions opened through this handler carry credentials;
+			// the caller must start a new one.
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		fp := creds.fingerprint()
+		if subtle.ConstantTimeCompare(fp[:], sess.fingerprint[:]) != 1 {
+			http.Error(w, "Metabase credentials do not match the session", http.StatusForbidden)
+			return
+		}
+		h.inner.ServeHTTP(w, r)
+		return
+	}
+
+	instances, clients := h.connect(r.Context(), creds)
+	if instances == nil {
+		http.Error(w, "Metabase rejected the supplied credentials", http.StatusUnauthorized)
+		return
+	}
+
+	p := &pending{instances: instances}
+	ctx := context.WithValue(r.Context(), pendingKey{}, p)
+	// The session is recorded as soon as its ID is sent, so that the
+	// caller's next request is checked against it.
+	var tracked bool
+	sw := &sessionWriter{ResponseWriter: w, onHeader: func() {
+		ss := p.session.Load()
+		if id := w.Header().Get(sessionIDHeader); id != "" && ss != nil && ss.ID() == id {
+			h.track(id, ss, creds, clients)
+			tracked = true
+		}
+	}}
+	h.inner.ServeHTTP(sw, r.WithContext(ctx))
+	sw.header()
+	if !tracked {
+		// No session was created, e.g. the request was not an initialize
+		// request. A session the inner handler opened without this handler
+		// learning of it is closed, as its requests would be refused.
+		if ss := p.session.Load(); ss != nil {
+			_ = ss.Close()
+		}
+		closeAll(clients)
+	}
+}
+
+// sessionWriter calls onHeader once, just before the response headers are
+// written.
+type sessionWriter struct {
+	http.ResponseWriter
+	onHeader func()
+	done     bool
+}
+
+func (w *sessionWriter) header() {
+	if !w.done {
+		w.done = true
+		w.onHeader()
+	}
+}
+
+func (w *sessionWriter) WriteHeader(code int) {
+	w.header()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.header()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) Flush() {
+	w.header()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// connect creates a client per instance with the caller's credentials and
+// keeps those that Metabase accepts. It returns nil if none does.
+func (h *Handler) connect(ctx context.Context, creds credentials) (*tools.Instances, []*metabase.Client) {
+	instances := tools.NewInstances()
+	var clients []*metabase.Client
+	for _, inst := range h.opts.Instances {
+		logger := h.opts.Logger.With().Str("instance", inst.Name).Logger()
+		opts := append(slices.Clone(h.opts.ClientOptions), metabase.WithoutStartupCheck())
+		if creds.apiKey == "" {
+			opts = append(opts, metabase.WithSessionToken(creds.sessionToken))
+		}
+		client, err := metabase.NewClient(inst.MetabaseURL, creds.apiKey, "", "", logger, opts...)
+		if err != nil {
+			logger.Warn().Err(err).Msg("creating per-caller metabase client failed")
+			continue
+		}
+		user, err := client.GetCurrentUser(ctx)
+		if err != nil {
+			logger.Info().Err(err).Msg("caller credentials not accepted by metabase instance")
+			client.Close()
+			continue
+		}
+		logger.Info().Str("metabase_user", user.Email).Msg("per-caller session connected")
+		instances.Add(inst.Name, client)
+		clients = append(clients, client)
+	}
+	if len(clients) == 0 {
+		return nil, nil
+	}
+	// The default may be unavailable to this caller; the first instance
+	// that accepted the credentials is used then.
+	_ = instances.SetDefault(h.opts.DefaultInstance)
+	return instances, clients
+}
+
+// track records a new session and releases its clients when the MCP
+// session ends, whether closed by the client or by the idle timeout.
+func (h *Handler) track(id string, ss *mcp.ServerSession, creds credentials, clients []*metabase.Client) {
+	h.mu.Lock()
+	h.sessions[id] = &session{fingerprint: creds.fingerprint(), clients: clients}
+	h.mu.Unlock()
+
+	go func() {
+		_ = ss.Wait()
+		h.release(id)
+	}()
+}
+
+// release forgets a session and closes its clients.
+func (h *Handler) release(id string) {
+	h.mu.Lock()
+	sess := h.sessions[id]
+	delete(h.sessions, id)
+	h.mu.Unlock()
+	if sess != nil {
+		closeAll(sess.clients)
+		h.opts.Logger.Debug().Str("session_id", id).Msg("per-caller session closed")
+	}
+}
+
+// ActiveSessions returns the number of open sessions.
+func (h *Handler) ActiveSessions() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.sessions)
+}
+
+func closeAll(clients []*metabase.Client) {
+	for _, c := range clients {
+		c.Close()
+	}
+}
@@ -0,0 +1,215 @@
+package percaller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anaryk/metabase-mcp-server/internal/config"
+	"github.com/anaryk/metabase-mcp-server/internal/tools"
+)
+
+// headerTransport adds fixed headers to every request.
+type headerTransport struct {
+	headers map[string]string
+}
+
+func (h headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for k, v := range h.headers {
+		r.Header.Set(k, v)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// newMetabase starts a fake Metabase that accepts the API keys and session
+// tokens of users, keyed by credential, and records the credentials it saw.
+func newMetabase(t *testing.T, users map[string]string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	mb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred := r.Header.Get("X-Api-Key")
+		if cred == "" {
+			cred = r.Header.Get("X-Metabase-Session")
+		}
+		mu.Lock()
+		seen = append(seen, cred)
+		mu.Unlock()
+		email, ok := users[cred]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"id": 1, "email": email})
+	}))
+	t.Cleanup(mb.Close)
+	return mb, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func newTestHandler(t *testing.T, mbURL string) (*Handler, *httptest.Server) {
+	t.Helper()
+	logger := zerolog.Nop()
+	h := NewHandler(Options{
+		Instances:       []config.Instance{{Name: "default", MetabaseURL: mbURL}},
+		DefaultInstance: "default",
+		NewServer: func(instances *tools.Instances) *mcp.Server {
+			server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+			tools.RegisterAll(server, instances, logger, tools.Options{})
+			return server
+		},
+		Logger: logger,
+	})
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return h, srv
+}
+
+func connect(t *testing.T, url string, headers map[string]string) (*mcp.ClientSession, error) {
+	t.Helper()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+	return client.Connect(context.Background(), &mcp.StreamableClientTransport{
+		Endpoint:   url,
+		HTTPClient: &http.Client{Transport: headerTransport{headers: headers}},
+	}, nil)
+}
+
+func TestHandler_CallerCredentials(t *testing.T) {
+	mb, seen := newMetabase(t, map[string]string{
+		"alice-key":   "alice@example.com",
+		"bob-session": "bob@example.com",
+	})
+	_, srv := newTestHandler(t, mb.URL)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		email   string
+		wantErr bool
+	}{
+		{name: "api key", headers: map[string]string{APIKeyHeader: "alice-key"}, email: "alice@example.com"},
+		{name: "session token", headers: map[string]string{SessionHeader: "bob-session"}, email: "bob@example.com"},
+		{name: "rejected by metabase", headers: map[string]string{APIKeyHeader: "mallory-key"}, wantErr: true},
+		{name: "no credentials", headers: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, err := connect(t, srv.URL, tt.headers)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = session.Close() })
+
+			result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "get_current_user"})
+			require.NoError(t, err)
+			require.False(t, result.IsError)
+			text := result.Content[0].(*mcp.TextContent).Text
+			assert.Contains(t, text, tt.email)
+		})
+	}
+
+	// Metabase only ever saw the callers' own credentials.
+	for _, cred := range seen() {
+		assert.Contains(t, []string{"alice-key", "bob-session", "mallory-key"}, cred)
+	}
+}
+
+func TestHandler_CredentialsBoundToSession(t *testing.T) {
+	mb, _ := newMetabase(t, map[string]string{
+		"alice-key": "alice@example.com",
+		"bob-key":   "bob@example.com",
+	})
+	_, srv := newTestHandler(t, mb.URL)
+
+	session, err := connect(t, srv.URL, map[string]string{APIKeyHeader: "alice-key"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+
+	// Reusing alice's session ID with bob's credentials is refused.
+	body := `{"jsonrpc":"2.0","id":99,"method":"tools/list"}`
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set(sessionIDHeader, session.ID())
+	req.Header.Set(APIKeyHeader, "bob-key")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestHandler_ReleasesClosedSessions(t *testing.T) {
+	mb, _ := newMetabase(t, map[string]string{"alice-key": "alice@example.com"})
+	h, srv := newTestHandler(t, mb.URL)
+
+	session, err := connect(t, srv.URL, map[string]string{APIKeyHeader: "alice-key"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, h.ActiveSessions())
+
+	require.NoError(t, session.Close())
+	assert.Eventually(t, func() bool { return h.ActiveSessions() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHandler_UnknownSession(t *testing.T) {
+	mb, seen := newMetabase(t, map[string]string{"alice-key": "alice@example.com"})
+	h, srv := newTestHandler(t, mb.URL)
+
+	session, err := connect(t, srv.URL, map[string]string{APIKeyHeader: "alice-key"})
+	require.NoError(t, err)
+	id := session.ID()
+	require.NoError(t, session.Close())
+	require.Eventually(t, func() bool { return h.ActiveSessions() == 0 }, 5*time.Second, 10*time.Millisecond)
+	before := len(seen())
+
+	for _, id := range []string{"made-up", id} {
+		for _, method := range []string{http.MethodPost, http.MethodGet, http.MethodDelete} {
+			body := `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+			req, err := http.NewRequest(method, srv.URL, strings.NewReader(body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "application/json, text/event-stream")
+			req.Header.Set(sessionIDHeader, id)
+			req.Header.Set(APIKeyHeader, "alice-key")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode, "%s %s", method, id)
+		}
+	}
+	assert.Len(t, seen(), before, "unknown sessions must not reach Metabase")
+}
+
+func TestHandler_SessionKeptUntilClosed(t *testing.T) {
+	mb, _ := newMetabase(t, map[string]string{"alice-key": "alice@example.com"})
+	h, srv := newTestHandler(t, mb.URL)
+
+	session, err := connect(t, srv.URL, map[string]string{APIKeyHeader: "alice-key"})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+
+	for range 3 {
+		result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "get_current_user"})
+		require.NoError(t, err)
+		require.False(t, result.IsError)
+	}
+	assert.Equal(t, 1, h.ActiveSessions())
+}
@@ -9,46 +9,34 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerActionTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_actions", "List actions for a model",
-		inputSchema(map[string]any{
-			"model_id": map[string]any{"type": "number", "description": "The model ID"},
-		}, []string{"model_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "model_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("model_id", id).Msg("listing actions")
-			actions, err := client.ListActions(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(actions)
-		})
+// actionFields are the action fields list_actions returns by default.
+var actionFields = []string{"id", "name", "model_id", "type"}
 
-	addTool(server, "get_action", "Get action details by ID",
-		inputSchema(map[string]any{
-			"action_id": map[string]any{"type": "number", "description": "The action ID"},
-		}, []string{"action_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "action_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("action_id", id).Msg("getting action")
-			action, err := client.GetAction(id)
+type listActionsArgs struct {
+	ModelID int `json:"model_id" jsonschema:"The model ID"`
+	fieldsArgs
+}
+
+type actionIDArgs struct {
+	ActionID int `json:"action_id" jsonschema:"The action ID"`
+}
+
+func registerActionTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_actions", "List actions for a model",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args listActionsArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
+			logger.Debug().Int("model_id", args.ModelID).Msg("listing actions")
+			actions, err := client.ListActions(ctx, args.ModelID)
 			if err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			return marshalResult(action)
+			result, err := projectedItems(actions, args.Fields, actionFields)
+			return nil, result, err
+		}, withFields[metabase.Action](actionFields))
+
+	addTool(r, "get_action", "Get action details by ID",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args actionIDArgs) (*mcp.CallToolResult, *metabase.Action, error) {
+			logger.Debug().Int("action_id", args.ActionID).Msg("getting action")
+			action, err := client.GetAction(ctx, args.ActionID)
+			return nil, action, err
 		})
 }
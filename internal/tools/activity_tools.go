@@ -9,26 +9,37 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerActivityTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "get_activity", "Get recent activity log",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			logger.Debug().Msg("getting activity")
-			activity, err := client.GetActivity()
+// activityFields are the activity item fields get_activity returns by default.
+var activityFields = []string{"id", "topic", "user_id", "model", "model_id", "timestamp"}
+
+type activityArgs struct {
+	pageArgs
+	fieldsArgs
+}
+
+func registerActivityTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "get_activity", "Get the recent activity log, a page at a time",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args activityArgs) (*mcp.CallToolResult, *listResult[map[string]any], error) {
+			page, err := args.page()
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(activity)
-		})
-
-	addTool(server, "get_recent_views", "Get recently viewed items",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			logger.Debug().Msg("getting recent views")
-			items, err := client.GetRecentViews()
+			logger.Debug().Int("limit", page.Limit).Int("offset", page.Offset).Msg("getting activity")
+			activity, err := client.GetActivity(ctx, page)
+			if err != nil {
+				return nil, nil, err
+			}
+			projected, err := projectPage(activity, args.Fields, activityFields)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(items)
+			return nil, pagedResult(projected, "activity items"), nil
+		}, withFields[metabase.ActivityItem](activityFields))
+
+	addTool(r, "get_recent_views", "Get recently viewed items",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, _ struct{}) (*mcp.CallToolResult, itemsResult[metabase.RecentItem], error) {
+			logger.Debug().Msg("getting recent views")
+			recent, err := client.GetRecentViews(ctx)
+			return nil, items(recent), err
 		})
 }
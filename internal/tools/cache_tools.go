@@ -9,14 +9,13 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerCacheTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "invalidate_cache", "Invalidate the Metabase cache",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func registerCacheTools(r *registrar, logger zerolog.Logger) {
+	addWriteTool(r, "invalidate_cache", "Invalidate the Metabase cache",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, _ struct{}) (*mcp.CallToolResult, messageResult, error) {
 			logger.Debug().Msg("invalidating cache")
-			if err := client.InvalidateCache(); err != nil {
-				return errResult(err)
+			if err := client.InvalidateCache(ctx); err != nil {
+				return nil, messageResult{}, err
 			}
-			return textResult("Cache invalidated successfully"), nil
+			return done("Cache invalidated successfully")
 		})
 }
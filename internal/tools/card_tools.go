@@ -2,6 +2,9 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rs/zerolog"
@@ -9,155 +12,198 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerCardTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_cards", "List all saved questions/cards in Metabase",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			logger.Debug().Msg("listing cards")
-			cards, err := client.ListCards()
+// cardFields are the card fields list_cards returns by default.
+var cardFields = []string{"id", "name", "collection_id", "display", "updated_at"}
+
+type listCardsArgs struct {
+	pageArgs
+	fieldsArgs
+}
+
+type cardIDArgs struct {
+	CardID int `json:"card_id" jsonschema:"The card ID"`
+}
+
+type createCardArgs struct {
+	Name                  string         `json:"name" jsonschema:"Card name"`
+	DatasetQuery          map[string]any `json:"dataset_query" jsonschema:"The query definition (native or MBQL)"`
+	Display               string         `json:"display" jsonschema:"Display type (table, bar, line, pie, scalar, etc.)"`
+	CollectionID          *int           `json:"collection_id,omitempty" jsonschema:"Collection ID to put the card in"`
+	Description           *string        `json:"description,omitempty" jsonschema:"Card description"`
+	VisualizationSettings map[string]any `json:"visualization_settings,omitempty" jsonschema:"Visualization settings"`
+}
+
+type updateCardArgs struct {
+	CardID                int            `json:"card_id" jsonschema:"The card ID to update"`
+	Name                  string         `json:"name,omitempty" jsonschema:"New name"`
+	Description           *string        `json:"description,omitempty" jsonschema:"New description"`
+	DatasetQuery          map[string]any `json:"dataset_query,omitempty" jsonschema:"New query definition"`
+	Display               string         `json:"display,omitempty" jsonschema:"New display type"`
+	Archived              *bool          `json:"archived,omitempty" jsonschema:"Whether to archive the card"`
+	CollectionID          *int           `json:"collection_id,omitempty" jsonschema:"New collection ID"`
+	VisualizationSettings map[string]any `json:"visualization_settings,omitempty" jsonschema:"New visualization settings"`
+	EnableEmbedding       *bool          `json:"enable_embedding,omitempty" jsonschema:"Enable embedding"`
+	EmbeddingParams       map[string]any `json:"embedding_params,omitempty" jsonschema:"Embedding parameters"`
+}
+
+type executeCardQueryArgs struct {
+	CardID     int            `json:"card_id" jsonschema:"The card ID"`
+	Parameters map[string]any `json:"parameters,omitempty" jsonschema:"Optional query parameters"`
+	MaxRows    *int           `json:"max_rows,omitempty"`
+	formatArgs
+}
+
+func registerCardTools(r *registrar, logger zerolog.Logger, opts Options) {
+	addTool(r, "list_cards", "List the saved questions/cards in Metabase, a page at a time",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args listCardsArgs) (*mcp.CallToolResult, *listResult[map[string]any], error) {
+			page, err := args.page()
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(cards)
-		})
-
-	addTool(server, "get_card", "Get a saved question/card by ID",
-		inputSchema(map[string]any{
-			"card_id": map[string]any{"type": "number", "description": "The card ID"},
-		}, []string{"card_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+			logger.Debug().Int("limit", page.Limit).Int("offset", page.Offset).Msg("listing cards")
+			cards, err := client.ListCards(ctx, page)
+			if err != nil {
+				return nil, nil, err
 			}
-			id, err := intArg(args, "card_id")
+			projected, err := projectPage(cards, args.Fields, cardFields)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			logger.Debug().Int("card_id", id).Msg("getting card")
-			card, err := client.GetCard(id)
+			return linked(pagedResult(projected, "cards"), itemLinks(ctx, r, cards.Data, func(c metabase.Card) (string, int, string) {
+				return "card", c.ID, c.Name
+			})...)
+		}, withFields[metabase.Card](cardFields))
+
+	addTool(r, "get_card", "Get a saved question/card by ID",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args cardIDArgs) (*mcp.CallToolResult, *metabase.Card, error) {
+			logger.Debug().Int("card_id", args.CardID).Msg("getting card")
+			card, err := client.GetCard(ctx, args.CardID)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(card)
+			return linked(card, r.link(ctx, "card", card.ID, card.Name))
 		})
 
-	addTool(server, "create_card", "Create a new saved question/card",
-		inputSchema(map[string]any{
-			"name":                   map[string]any{"type": "string", "description": "Card name"},
-			"dataset_query":          map[string]any{"type": "object", "description": "The query definition (native or MBQL)"},
-			"display":                map[string]any{"type": "string", "description": "Display type (table, bar, line, pie, scalar, etc.)"},
-			"collection_id":          map[string]any{"type": "number", "description": "Collection ID to put the card in"},
-			"description":            map[string]any{"type": "string", "description": "Card description"},
-			"visualization_settings": map[string]any{"type": "object", "description": "Visualization settings"},
-		}, []string{"name", "dataset_query", "display"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			name, _ := stringArg(args, "name")
+	addWriteTool(r, "create_card", "Create a new saved question/card",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args createCardArgs) (*mcp.CallToolResult, *metabase.Card, error) {
 			card := &metabase.Card{
-				Name:                  name,
-				DatasetQuery:          mapArg(args, "dataset_query"),
-				Display:               args["display"].(string),
-				CollectionID:          optionalIntArg(args, "collection_id"),
-				Description:           optionalStringArg(args, "description"),
-				VisualizationSettings: mapArg(args, "visualization_settings"),
-			}
-			logger.Debug().Str("name", name).Msg("creating card")
-			result, err := client.CreateCard(card)
+				Name:                  args.Name,
+				DatasetQuery:          args.DatasetQuery,
+				Display:               args.Display,
+				CollectionID:          args.CollectionID,
+				Description:           args.Description,
+				VisualizationSettings: args.VisualizationSettings,
+			}
+			if card.DatasetQuery != nil {
+				err := metabase.ValidateDatasetQuery(ctx, client, card.DatasetQuery, nil)
+				if err := checkReadOnly(logger, err, false); err != nil {
+					return nil, nil, err
+				}
+			}
+			logger.Debug().Str("name", args.Name).Msg("creating card")
+			result, err := client.CreateCard(ctx, card)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
+			return linked(result, r.link(ctx, "card", result.ID, result.Name))
 		})
 
-	addTool(server, "update_card", "Update an existing saved question/card",
-		inputSchema(map[string]any{
-			"card_id":                map[string]any{"type": "number", "description": "The card ID to update"},
-			"name":                   map[string]any{"type": "string", "description": "New name"},
-			"description":            map[string]any{"type": "string", "description": "New description"},
-			"dataset_query":          map[string]any{"type": "object", "description": "New query definition"},
-			"display":                map[string]any{"type": "string", "description": "New display type"},
-			"archived":               map[string]any{"type": "boolean", "description": "Whether to archive the card"},
-			"collection_id":          map[string]any{"type": "number", "description": "New collection ID"},
-			"visualization_settings": map[string]any{"type": "object", "description": "New visualization settings"},
-			"enable_embedding":       map[string]any{"type": "boolean", "description": "Enable embedding"},
-			"embedding_params":       map[string]any{"type": "object", "description": "Embedding parameters"},
-		}, []string{"card_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "card_id")
-			if err != nil {
-				return errResult(err)
-			}
+	addWriteTool(r, "update_card", "Update an existing saved question/card",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args updateCardArgs) (*mcp.CallToolResult, *metabase.Card, error) {
 			card := &metabase.Card{
-				Description:           optionalStringArg(args, "description"),
-				DatasetQuery:          mapArg(args, "dataset_query"),
-				Archived:              optionalBoolArg(args, "archived"),
-				CollectionID:          optionalIntArg(args, "collection_id"),
-				VisualizationSettings: mapArg(args, "visualization_settings"),
-				EnableEmbedding:       optionalBoolArg(args, "enable_embedding"),
-				EmbeddingParams:       mapArg(args, "embedding_params"),
-			}
-			if n, ok := args["name"].(string); ok {
-				card.Name = n
-			}
-			if d, ok := args["display"].(string); ok {
-				card.Display = d
-			}
-			logger.Debug().Int("card_id", id).Msg("updating card")
-			result, err := client.UpdateCard(id, card)
+				Name:                  args.Name,
+				Description:           args.Description,
+				DatasetQuery:          args.DatasetQuery,
+				Display:               args.Display,
+				Archived:              args.Archived,
+				CollectionID:          args.CollectionID,
+				VisualizationSettings: args.VisualizationSettings,
+				EnableEmbedding:       args.EnableEmbedding,
+				EmbeddingParams:       args.EmbeddingParams,
+			}
+			if card.DatasetQuery != nil {
+				err := metabase.ValidateDatasetQuery(ctx, client, card.DatasetQuery, nil)
+				if err := checkReadOnly(logger, err, false); err != nil {
+					return nil, nil, err
+				}
+			}
+			logger.Debug().Int("card_id", args.CardID).Msg("updating card")
+			result, err := client.UpdateCard(ctx, args.CardID, card)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
+			return linked(result, r.link(ctx, "card", result.ID, result.Name))
 		})
 
-	addTool(server, "delete_card", "Delete (archive) a saved question/card",
-		inputSchema(map[string]any{
-			"card_id": map[string]any{"type": "number", "description": "The card ID to delete"},
-		}, []string{"card_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "card_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("card_id", id).Msg("deleting card")
-			if err := client.DeleteCard(id); err != nil {
-				return errResult(err)
+	addWriteTool(r, "delete_card", "Delete (archive) a saved question/card",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args cardIDArgs) (*mcp.CallToolResult, messageResult, error) {
+			logger.Debug().Int("card_id", args.CardID).Msg("deleting card")
+			if err := client.DeleteCard(ctx, args.CardID); err != nil {
+				return nil, messageResult{}, err
 			}
-			return textResult("Card deleted successfully"), nil
+			return done("Card deleted successfully")
 		})
 
-	addTool(server, "execute_card_query", "Run a saved question's query and return results",
-		inputSchema(map[string]any{
-			"card_id":    map[string]any{"type": "number", "description": "The card ID"},
-			"parameters": map[string]any{"type": "object", "description": "Optional query parameters"},
-		}, []string{"card_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+	addTool(r, "execute_card_query", "Run a saved question's query and return results",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args executeCardQueryArgs) (*mcp.CallToolResult, *columnarResult, error) {
+			limit, err := opts.rowLimit(args.MaxRows)
+			if err != nil {
+				return nil, nil, err
 			}
-			id, err := intArg(args, "card_id")
+			// Cards may have been saved with write SQL outside this server,
+			// so the stored query is checked before every run.
+			card, err := client.GetCard(ctx, args.CardID)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
+			}
+			values, _ := args.Parameters["parameters"].([]any)
+			err = metabase.ValidateDatasetQuery(ctx, client, card.DatasetQuery, values)
+			if err := checkReadOnly(logger.With().Int("card_id", args.CardID).Logger(), err, true); err != nil {
+				return nil, nil, fmt.Errorf("card %d: %w", args.CardID, err)
 			}
-			params := mapArg(args, "parameters")
-			logger.Debug().Int("card_id", id).Msg("executing card query")
-			result, err := client.ExecuteCardQuery(id, params)
+			logger.Debug().Int("card_id", args.CardID).Msg("executing card query")
+			result, err := runCardQuery(ctx, client, card, args.Parameters, values, logger)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
-		})
+			return formatResult(truncateResult(result, limit, false), args.Format)
+		}, opts.withMaxRows(), withFormat())
+}
+
+// runCardQuery runs the query of card as it was checked, rather than the
+// card, whose query could be replaced between the check and the run.
+// Callers who may run the question but not query its database directly run
+// the card itself; its query is fetched again afterwards and the results are
+// discarded if it changed. A query changed and changed back during the run
+// goes unnoticed, as do changes to the source questions it uses, which
+// Metabase resolves when it runs the query.
+func runCardQuery(ctx context.Context, client metabase.API, card *metabase.Card, parameters map[string]any, values []any, logger zerolog.Logger) (*metabase.DatasetQueryResponse, error) {
+	data, err := json.Marshal(card.DatasetQuery)
+	if err != nil {
+		return nil, fmt.Errorf("card %d: encoding query: %w", card.ID, err)
+	}
+	var dsReq metabase.DatasetQueryRequest
+	if err := json.Unmarshal(data, &dsReq); err != nil {
+		return nil, fmt.Errorf("card %d: decoding query: %w", card.ID, err)
+	}
+	dsReq.Parameters = values
+	result, err := client.ExecuteQuery(ctx, &dsReq)
+	if !metabase.IsForbidden(err) {
+		return result, err
+	}
+
+	logger.Debug().Err(err).Int("card_id", card.ID).Msg("query not permitted, running the card")
+	result, err = client.ExecuteCardQuery(ctx, card.ID, parameters)
+	if err != nil {
+		return nil, err
+	}
+	after, err := client.GetCard(ctx, card.ID)
+	if err != nil {
+		return nil, fmt.Errorf("card %d: could not verify that the query did not change while it ran: %w", card.ID, err)
+	}
+	if !reflect.DeepEqual(after.DatasetQuery, card.DatasetQuery) {
+		logger.Warn().Int("card_id", card.ID).Msg("card query changed while it ran, discarding results")
+		return nil, fmt.Errorf("card %d: the query changed while it ran; run it again to check the new query", card.ID)
+	}
+	return result, nil
 }
@@ -10,121 +10,108 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerCollectionTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_collections", "List all collections",
-		inputSchema(map[string]any{
-			"namespace": map[string]any{"type": "string", "description": "Optional namespace filter"},
-		}, nil),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			_ = parseArgs(req, &args)
-			ns := ""
-			if s := optionalStringArg(args, "namespace"); s != nil {
-				ns = *s
-			}
+// collectionFields are the collection fields list_collections returns by default.
+var collectionFields = []string{"id", "name", "parent_id", "archived"}
+
+// collectionItemFields are the item fields list_collection_items returns by
+// default.
+var collectionItemFields = []string{"id", "name", "model"}
+
+type listCollectionsArgs struct {
+	Namespace string `json:"namespace,omitempty" jsonschema:"Optional namespace filter"`
+	fieldsArgs
+}
+
+type collectionIDArgs struct {
+	CollectionID any `json:"collection_id" jsonschema:"Collection ID (number or 'root')"`
+}
+
+type createCollectionArgs struct {
+	Name        string  `json:"name" jsonschema:"Collection name"`
+	Description *string `json:"description,omitempty" jsonschema:"Collection description"`
+	ParentID    *int    `json:"parent_id,omitempty" jsonschema:"Parent collection ID"`
+	Color       *string `json:"color,omitempty" jsonschema:"Collection color (hex)"`
+}
+
+type updateCollectionArgs struct {
+	CollectionID int     `json:"collection_id" jsonschema:"Collection ID to update"`
+	Name         string  `json:"name,omitempty" jsonschema:"New name"`
+	Description  *string `json:"description,omitempty" jsonschema:"New description"`
+	Color        *string `json:"color,omitempty" jsonschema:"New color"`
+	Archived     *bool   `json:"archived,omitempty" jsonschema:"Whether to archive"`
+}
+
+type listCollectionItemsArgs struct {
+	collectionIDArgs
+	Models []string `json:"models,omitempty" jsonschema:"Filter by model types: card, dashboard, collection, etc."`
+	pageArgs
+	fieldsArgs
+}
+
+func registerCollectionTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_collections", "List all collections",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args listCollectionsArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
 			logger.Debug().Msg("listing collections")
-			collections, err := client.ListCollections(ns)
+			collections, err := client.ListCollections(ctx, args.Namespace)
 			if err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			return marshalResult(collections)
-		})
+			result, err := projectedItems(collections, args.Fields, collectionFields)
+			return nil, result, err
+		}, withFields[metabase.Collection](collectionFields))
 
-	addTool(server, "get_collection", "Get collection details by ID",
-		inputSchema(map[string]any{
-			"collection_id": map[string]any{"type": "string", "description": "Collection ID (number or 'root')"},
-		}, []string{"collection_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id := fmt.Sprintf("%v", args["collection_id"])
+	addTool(r, "get_collection", "Get collection details by ID",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args collectionIDArgs) (*mcp.CallToolResult, *metabase.Collection, error) {
+			id := fmt.Sprint(args.CollectionID)
 			logger.Debug().Str("collection_id", id).Msg("getting collection")
-			col, err := client.GetCollection(id)
-			if err != nil {
-				return errResult(err)
+			col, err := client.GetCollection(ctx, id)
+			return nil, col, err
+		}, withTypes("collection_id", "integer", "string"))
+
+	addWriteTool(r, "create_collection", "Create a new collection",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args createCollectionArgs) (*mcp.CallToolResult, *metabase.Collection, error) {
+			col := &metabase.Collection{
+				Name:        args.Name,
+				Description: args.Description,
+				ParentID:    args.ParentID,
+				Color:       args.Color,
 			}
-			return marshalResult(col)
+			logger.Debug().Str("name", args.Name).Msg("creating collection")
+			result, err := client.CreateCollection(ctx, col)
+			return nil, result, err
 		})
 
-	addTool(server, "create_collection", "Create a new collection",
-		inputSchema(map[string]any{
-			"name":        map[string]any{"type": "string", "description": "Collection name"},
-			"description": map[string]any{"type": "string", "description": "Collection description"},
-			"parent_id":   map[string]any{"type": "number", "description": "Parent collection ID"},
-			"color":       map[string]any{"type": "string", "description": "Collection color (hex)"},
-		}, []string{"name"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			name, _ := stringArg(args, "name")
+	addWriteTool(r, "update_collection", "Update a collection",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args updateCollectionArgs) (*mcp.CallToolResult, *metabase.Collection, error) {
 			col := &metabase.Collection{
-				Name:        name,
-				Description: optionalStringArg(args, "description"),
-				ParentID:    optionalIntArg(args, "parent_id"),
-				Color:       optionalStringArg(args, "color"),
+				Name:        args.Name,
+				Description: args.Description,
+				Color:       args.Color,
+				Archived:    args.Archived,
 			}
-			logger.Debug().Str("name", name).Msg("creating collection")
-			result, err := client.CreateCollection(col)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(result)
+			logger.Debug().Int("collection_id", args.CollectionID).Msg("updating collection")
+			result, err := client.UpdateCollection(ctx, args.CollectionID, col)
+			return nil, result, err
 		})
 
-	addTool(server, "update_collection", "Update a collection",
-		inputSchema(map[string]any{
-			"collection_id": map[string]any{"type": "number", "description": "Collection ID to update"},
-			"name":          map[string]any{"type": "string", "description": "New name"},
-			"description":   map[string]any{"type": "string", "description": "New description"},
-			"color":         map[string]any{"type": "string", "description": "New color"},
-			"archived":      map[string]any{"type": "boolean", "description": "Whether to archive"},
-		}, []string{"collection_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "collection_id")
+	addTool(r, "list_collection_items", "List items in a collection with optional model filter, a page at a time",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args listCollectionItemsArgs) (*mcp.CallToolResult, *listResult[map[string]any], error) {
+			id := fmt.Sprint(args.CollectionID)
+			page, err := args.page()
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			col := &metabase.Collection{
-				Description: optionalStringArg(args, "description"),
-				Color:       optionalStringArg(args, "color"),
-				Archived:    optionalBoolArg(args, "archived"),
-			}
-			if n, ok := args["name"].(string); ok {
-				col.Name = n
-			}
-			logger.Debug().Int("collection_id", id).Msg("updating collection")
-			result, err := client.UpdateCollection(id, col)
+			logger.Debug().Str("collection_id", id).Int("limit", page.Limit).Int("offset", page.Offset).Msg("listing collection items")
+			items, err := client.ListCollectionItems(ctx, id, args.Models, page)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
-		})
-
-	addTool(server, "list_collection_items", "List items in a collection with optional model filter",
-		inputSchema(map[string]any{
-			"collection_id": map[string]any{"type": "string", "description": "Collection ID (number or 'root')"},
-			"models":        map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Filter by model types: card, dashboard, collection, etc."},
-		}, []string{"collection_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id := fmt.Sprintf("%v", args["collection_id"])
-			models := stringSliceArg(args, "models")
-			logger.Debug().Str("collection_id", id).Msg("listing collection items")
-			items, err := client.ListCollectionItems(id, models)
+			projected, err := projectPage(items, args.Fields, collectionItemFields)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(items)
-		})
+			return linked(pagedResult(projected, "items"), itemLinks(ctx, r, items.Data, func(it metabase.CollectionItem) (string, int, string) {
+				return it.Model, it.ID, it.Name
+			})...)
+		}, withFields[metabase.CollectionItem](collectionItemFields), withTypes("collection_id", "integer", "string"))
 }
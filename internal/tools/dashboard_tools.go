@@ -2,8 +2,6 @@ package tools
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rs/zerolog"
@@ -11,267 +9,174 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerDashboardTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_dashboards", "List all dashboards",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// dashboardFields are the dashboard fields list_dashboards returns by default.
+var dashboardFields = []string{"id", "name", "collection_id", "updated_at"}
+
+type dashboardIDArgs struct {
+	DashboardID int `json:"dashboard_id" jsonschema:"The dashboard ID"`
+}
+
+type createDashboardArgs struct {
+	Name         string           `json:"name" jsonschema:"Dashboard name"`
+	Description  *string          `json:"description,omitempty" jsonschema:"Dashboard description"`
+	CollectionID *int             `json:"collection_id,omitempty" jsonschema:"Collection ID"`
+	Parameters   []map[string]any `json:"parameters,omitempty" jsonschema:"Dashboard filter parameters"`
+}
+
+type updateDashboardArgs struct {
+	DashboardID  int     `json:"dashboard_id" jsonschema:"The dashboard ID to update"`
+	Name         string  `json:"name,omitempty" jsonschema:"New name"`
+	Description  *string `json:"description,omitempty" jsonschema:"New description"`
+	Archived     *bool   `json:"archived,omitempty" jsonschema:"Whether to archive"`
+	CollectionID *int    `json:"collection_id,omitempty" jsonschema:"New collection ID"`
+}
+
+type addCardToDashboardArgs struct {
+	DashboardID       int              `json:"dashboard_id" jsonschema:"Dashboard ID"`
+	CardID            int              `json:"card_id" jsonschema:"Card ID to add"`
+	Row               int              `json:"row,omitempty" jsonschema:"Row position (default: 0)"`
+	Col               int              `json:"col,omitempty" jsonschema:"Column position (default: 0)"`
+	SizeX             *int             `json:"size_x,omitempty" jsonschema:"Width in grid units (default: 6)"`
+	SizeY             *int             `json:"size_y,omitempty" jsonschema:"Height in grid units (default: 4)"`
+	Series            []map[string]any `json:"series,omitempty" jsonschema:"Series to overlay"`
+	ParameterMappings []map[string]any `json:"parameter_mappings,omitempty" jsonschema:"Parameter mappings"`
+}
+
+type removeCardFromDashboardArgs struct {
+	DashboardID int `json:"dashboard_id" jsonschema:"Dashboard ID"`
+	DashCardID  int `json:"dashcard_id" jsonschema:"Dashcard ID to remove"`
+}
+
+type updateDashboardCardsArgs struct {
+	DashboardID int                 `json:"dashboard_id" jsonschema:"Dashboard ID"`
+	Cards       []metabase.DashCard `json:"cards" jsonschema:"Array of dashcard objects with id, row, col, size_x, size_y"`
+}
+
+type copyDashboardArgs struct {
+	DashboardID  int     `json:"dashboard_id" jsonschema:"Dashboard ID to copy"`
+	Name         string  `json:"name" jsonschema:"Name for the copy"`
+	Description  *string `json:"description,omitempty" jsonschema:"Description for the copy"`
+	CollectionID *int    `json:"collection_id,omitempty" jsonschema:"Target collection ID"`
+}
+
+func registerDashboardTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_dashboards", "List all dashboards",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args fieldsArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
 			logger.Debug().Msg("listing dashboards")
-			dashboards, err := client.ListDashboards()
+			dashboards, err := client.ListDashboards(ctx)
 			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(dashboards)
-		})
-
-	addTool(server, "get_dashboard", "Get a dashboard by ID including all cards and layout",
-		inputSchema(map[string]any{
-			"dashboard_id": map[string]any{"type": "number", "description": "The dashboard ID"},
-		}, []string{"dashboard_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			id, err := intArg(args, "dashboard_id")
+			result, err := projectedItems(dashboards, args.Fields, dashboardFields)
 			if err != nil {
-				return errResult(err)
+				return nil, result, err
 			}
-			logger.Debug().Int("dashboard_id", id).Msg("getting dashboard")
-			dash, err := client.GetDashboard(id)
+			return linked(result, itemLinks(ctx, r, dashboards, func(d metabase.Dashboard) (string, int, string) {
+				return "dashboard", d.ID, d.Name
+			})...)
+		}, withFields[metabase.Dashboard](dashboardFields))
+
+	addTool(r, "get_dashboard", "Get a dashboard by ID including all cards and layout",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args dashboardIDArgs) (*mcp.CallToolResult, *metabase.Dashboard, error) {
+			logger.Debug().Int("dashboard_id", args.DashboardID).Msg("getting dashboard")
+			dash, err := client.GetDashboard(ctx, args.DashboardID)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(dash)
+			return linked(dash, r.link(ctx, "dashboard", dash.ID, dash.Name))
 		})
 
-	addTool(server, "create_dashboard", "Create a new dashboard",
-		inputSchema(map[string]any{
-			"name":          map[string]any{"type": "string", "description": "Dashboard name"},
-			"description":   map[string]any{"type": "string", "description": "Dashboard description"},
-			"collection_id": map[string]any{"type": "number", "description": "Collection ID"},
-			"parameters":    map[string]any{"type": "array", "description": "Dashboard filter parameters"},
-		}, []string{"name"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			name, _ := stringArg(args, "name")
+	addWriteTool(r, "create_dashboard", "Create a new dashboard",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args createDashboardArgs) (*mcp.CallToolResult, *metabase.Dashboard, error) {
 			dash := &metabase.Dashboard{
-				Name:         name,
-				Description:  optionalStringArg(args, "description"),
-				CollectionID: optionalIntArg(args, "collection_id"),
-			}
-			if p, ok := args["parameters"]; ok {
-				if params, ok := p.([]any); ok {
-					for _, param := range params {
-						if m, ok := param.(map[string]any); ok {
-							dash.Parameters = append(dash.Parameters, m)
-						}
-					}
-				}
+				Name:         args.Name,
+				Description:  args.Description,
+				CollectionID: args.CollectionID,
+				Parameters:   args.Parameters,
 			}
-			logger.Debug().Str("name", name).Msg("creating dashboard")
-			result, err := client.CreateDashboard(dash)
+			logger.Debug().Str("name", args.Name).Msg("creating dashboard")
+			result, err := client.CreateDashboard(ctx, dash)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
+			return linked(result, r.link(ctx, "dashboard", result.ID, result.Name))
 		})
 
-	addTool(server, "update_dashboard", "Update dashboard properties",
-		inputSchema(map[string]any{
-			"dashboard_id":  map[string]any{"type": "number", "description": "The dashboard ID to update"},
-			"name":          map[string]any{"type": "string", "description": "New name"},
-			"description":   map[string]any{"type": "string", "description": "New description"},
-			"archived":      map[string]any{"type": "boolean", "description": "Whether to archive"},
-			"collection_id": map[string]any{"type": "number", "description": "New collection ID"},
-		}, []string{"dashboard_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "dashboard_id")
-			if err != nil {
-				return errResult(err)
-			}
+	addWriteTool(r, "update_dashboard", "Update dashboard properties",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args updateDashboardArgs) (*mcp.CallToolResult, *metabase.Dashboard, error) {
 			dash := &metabase.Dashboard{
-				Description:  optionalStringArg(args, "description"),
-				Archived:     optionalBoolArg(args, "archived"),
-				CollectionID: optionalIntArg(args, "collection_id"),
+				Name:         args.Name,
+				Description:  args.Description,
+				Archived:     args.Archived,
+				CollectionID: args.CollectionID,
 			}
-			if n, ok := args["name"].(string); ok {
-				dash.Name = n
-			}
-			logger.Debug().Int("dashboard_id", id).Msg("updating dashboard")
-			result, err := client.UpdateDashboard(id, dash)
+			logger.Debug().Int("dashboard_id", args.DashboardID).Msg("updating dashboard")
+			result, err := client.UpdateDashboard(ctx, args.DashboardID, dash)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
+			return linked(result, r.link(ctx, "dashboard", result.ID, result.Name))
 		})
 
-	addTool(server, "delete_dashboard", "Delete a dashboard",
-		inputSchema(map[string]any{
-			"dashboard_id": map[string]any{"type": "number", "description": "The dashboard ID to delete"},
-		}, []string{"dashboard_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "dashboard_id")
-			if err != nil {
-				return errResult(err)
+	addWriteTool(r, "delete_dashboard", "Delete a dashboard",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args dashboardIDArgs) (*mcp.CallToolResult, messageResult, error) {
+			logger.Debug().Int("dashboard_id", args.DashboardID).Msg("deleting dashboard")
+			if err := client.DeleteDashboard(ctx, args.DashboardID); err != nil {
+				return nil, messageResult{}, err
 			}
-			logger.Debug().Int("dashboard_id", id).Msg("deleting dashboard")
-			if err := client.DeleteDashboard(id); err != nil {
-				return errResult(err)
-			}
-			return textResult("Dashboard deleted successfully"), nil
+			return done("Dashboard deleted successfully")
 		})
 
-	addTool(server, "add_card_to_dashboard", "Add a card to a dashboard with position and size",
-		inputSchema(map[string]any{
-			"dashboard_id":       map[string]any{"type": "number", "description": "Dashboard ID"},
-			"card_id":            map[string]any{"type": "number", "description": "Card ID to add"},
-			"row":                map[string]any{"type": "number", "description": "Row position (default: 0)"},
-			"col":                map[string]any{"type": "number", "description": "Column position (default: 0)"},
-			"size_x":             map[string]any{"type": "number", "description": "Width in grid units (default: 6)"},
-			"size_y":             map[string]any{"type": "number", "description": "Height in grid units (default: 4)"},
-			"series":             map[string]any{"type": "array", "description": "Series to overlay"},
-			"parameter_mappings": map[string]any{"type": "array", "description": "Parameter mappings"},
-		}, []string{"dashboard_id", "card_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			dashID, err := intArg(args, "dashboard_id")
-			if err != nil {
-				return errResult(err)
-			}
-			cardID, err := intArg(args, "card_id")
-			if err != nil {
-				return errResult(err)
-			}
+	addWriteTool(r, "add_card_to_dashboard", "Add a card to a dashboard with position and size",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args addCardToDashboardArgs) (*mcp.CallToolResult, *metabase.DashCard, error) {
 			dc := &metabase.DashCard{
-				CardID: &cardID,
-				SizeX:  6,
-				SizeY:  4,
-			}
-			if v := optionalIntArg(args, "row"); v != nil {
-				dc.Row = *v
-			}
-			if v := optionalIntArg(args, "col"); v != nil {
-				dc.Col = *v
-			}
-			if v := optionalIntArg(args, "size_x"); v != nil {
-				dc.SizeX = *v
-			}
-			if v := optionalIntArg(args, "size_y"); v != nil {
-				dc.SizeY = *v
-			}
-			if series, ok := args["series"].([]any); ok {
-				for _, s := range series {
-					if m, ok := s.(map[string]any); ok {
-						dc.Series = append(dc.Series, m)
-					}
-				}
-			}
-			if mappings, ok := args["parameter_mappings"].([]any); ok {
-				for _, pm := range mappings {
-					if m, ok := pm.(map[string]any); ok {
-						dc.ParameterMappings = append(dc.ParameterMappings, m)
-					}
-				}
-			}
-			logger.Debug().Int("dashboard_id", dashID).Int("card_id", cardID).Msg("adding card to dashboard")
-			result, err := client.AddCardToDashboard(dashID, dc)
+				CardID:            &args.CardID,
+				Row:               args.Row,
+				Col:               args.Col,
+				SizeX:             6,
+				SizeY:             4,
+				Series:            args.Series,
+				ParameterMappings: args.ParameterMappings,
+			}
+			if args.SizeX != nil {
+				dc.SizeX = *args.SizeX
+			}
+			if args.SizeY != nil {
+				dc.SizeY = *args.SizeY
+			}
+			logger.Debug().Int("dashboard_id", args.DashboardID).Int("card_id", args.CardID).Msg("adding card to dashboard")
+			result, err := client.AddCardToDashboard(ctx, args.DashboardID, dc)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
+			return nil, result, nil
 		})
 
-	addTool(server, "remove_card_from_dashboard", "Remove a card from a dashboard",
-		inputSchema(map[string]any{
-			"dashboard_id": map[string]any{"type": "number", "description": "Dashboard ID"},
-			"dashcard_id":  map[string]any{"type": "number", "description": "Dashcard ID to remove"},
-		}, []string{"dashboard_id", "dashcard_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+	addWriteTool(r, "remove_card_from_dashboard", "Remove a card from a dashboard",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args removeCardFromDashboardArgs) (*mcp.CallToolResult, messageResult, error) {
+			logger.Debug().Int("dashboard_id", args.DashboardID).Int("dashcard_id", args.DashCardID).Msg("removing card from dashboard")
+			if err := client.RemoveCardFromDashboard(ctx, args.DashboardID, args.DashCardID); err != nil {
+				return nil, messageResult{}, err
 			}
-			dashID, err := intArg(args, "dashboard_id")
-			if err != nil {
-				return errResult(err)
-			}
-			dcID, err := intArg(args, "dashcard_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("dashboard_id", dashID).Int("dashcard_id", dcID).Msg("removing card from dashboard")
-			if err := client.RemoveCardFromDashboard(dashID, dcID); err != nil {
-				return errResult(err)
-			}
-			return textResult("Card removed from dashboard successfully"), nil
+			return done("Card removed from dashboard successfully")
 		})
 
-	addTool(server, "update_dashboard_cards", "Update layout/positions of cards on a dashboard",
-		inputSchema(map[string]any{
-			"dashboard_id": map[string]any{"type": "number", "description": "Dashboard ID"},
-			"cards":        map[string]any{"type": "array", "description": "Array of dashcard objects with id, row, col, size_x, size_y"},
-		}, []string{"dashboard_id", "cards"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			dashID, err := intArg(args, "dashboard_id")
-			if err != nil {
-				return errResult(err)
+	addWriteTool(r, "update_dashboard_cards", "Update layout/positions of cards on a dashboard",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args updateDashboardCardsArgs) (*mcp.CallToolResult, messageResult, error) {
+			logger.Debug().Int("dashboard_id", args.DashboardID).Int("card_count", len(args.Cards)).Msg("updating dashboard cards")
+			if err := client.UpdateDashboardCards(ctx, args.DashboardID, args.Cards); err != nil {
+				return nil, messageResult{}, err
 			}
-			cardsRaw, ok := args["cards"].([]any)
-			if !ok {
-				return errResult(fmt.Errorf("cards must be an array"))
-			}
-			var cards []metabase.DashCard
-			rawJSON, _ := json.Marshal(cardsRaw)
-			if err := json.Unmarshal(rawJSON, &cards); err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("dashboard_id", dashID).Int("card_count", len(cards)).Msg("updating dashboard cards")
-			if err := client.UpdateDashboardCards(dashID, cards); err != nil {
-				return errResult(err)
-			}
-			return textResult("Dashboard cards updated successfully"), nil
+			return done("Dashboard cards updated successfully")
 		})
 
-	addTool(server, "copy_dashboard", "Copy a dashboard to a new collection",
-		inputSchema(map[string]any{
-			"dashboard_id":  map[string]any{"type": "number", "description": "Dashboard ID to copy"},
-			"name":          map[string]any{"type": "string", "description": "Name for the copy"},
-			"description":   map[string]any{"type": "string", "description": "Description for the copy"},
-			"collection_id": map[string]any{"type": "number", "description": "Target collection ID"},
-		}, []string{"dashboard_id", "name"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "dashboard_id")
-			if err != nil {
-				return errResult(err)
-			}
-			name, _ := stringArg(args, "name")
-			logger.Debug().Int("dashboard_id", id).Str("name", name).Msg("copying dashboard")
-			result, err := client.CopyDashboard(id, name, optionalStringArg(args, "description"), optionalIntArg(args, "collection_id"))
+	addWriteTool(r, "copy_dashboard", "Copy a dashboard to a new collection",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args copyDashboardArgs) (*mcp.CallToolResult, *metabase.Dashboard, error) {
+			logger.Debug().Int("dashboard_id", args.DashboardID).Str("name", args.Name).Msg("copying dashboard")
+			result, err := client.CopyDashboard(ctx, args.DashboardID, args.Name, args.Description, args.CollectionID)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
+			return linked(result, r.link(ctx, "dashboard", result.ID, result.Name))
 		})
 }
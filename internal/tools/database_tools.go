@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rs/zerolog"
@@ -9,77 +10,73 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerDatabaseTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_databases", "List all connected databases",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// databaseFields are the database fields list_databases returns by default.
+var databaseFields = []string{"id", "name", "engine"}
+
+type databaseIDArgs struct {
+	DatabaseID int `json:"database_id" jsonschema:"The database ID"`
+}
+
+type syncDatabaseArgs struct {
+	DatabaseID int `json:"database_id" jsonschema:"The database ID to sync"`
+	asyncArgs
+}
+
+// syncOutput is the result of sync_database: a message once the sync is
+// triggered, or in async mode the job triggering it.
+type syncOutput struct {
+	*messageResult
+	startedJob
+}
+
+func registerDatabaseTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_databases", "List all connected databases",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args fieldsArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
 			logger.Debug().Msg("listing databases")
-			dbs, err := client.ListDatabases()
+			dbs, err := client.ListDatabases(ctx)
 			if err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			return marshalResult(dbs)
-		})
+			result, err := projectedItems(dbs, args.Fields, databaseFields)
+			return nil, result, err
+		}, withFields[metabase.Database](databaseFields))
 
-	addTool(server, "get_database", "Get database details by ID",
-		inputSchema(map[string]any{
-			"database_id": map[string]any{"type": "number", "description": "The database ID"},
-		}, []string{"database_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "database_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("database_id", id).Msg("getting database")
-			db, err := client.GetDatabase(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(db)
+	addTool(r, "get_database", "Get database details by ID",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args databaseIDArgs) (*mcp.CallToolResult, *metabase.Database, error) {
+			logger.Debug().Int("database_id", args.DatabaseID).Msg("getting database")
+			db, err := client.GetDatabase(ctx, args.DatabaseID)
+			return nil, db, err
 		})
 
-	addTool(server, "get_database_metadata", "Get full metadata for a database including tables, fields, and types. Essential for understanding the schema before building queries.",
-		inputSchema(map[string]any{
-			"database_id": map[string]any{"type": "number", "description": "The database ID"},
-		}, []string{"database_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "database_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("database_id", id).Msg("getting database metadata")
-			db, err := client.GetDatabaseMetadata(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(db)
+	addTool(r, "get_database_metadata", "Get full metadata for a database including tables, fields, and types. Essential for understanding the schema before building queries.",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args databaseIDArgs) (*mcp.CallToolResult, *metabase.Database, error) {
+			logger.Debug().Int("database_id", args.DatabaseID).Msg("getting database metadata")
+			db, err := client.GetDatabaseMetadata(ctx, args.DatabaseID)
+			return nil, db, err
 		})
 
-	addTool(server, "sync_database", "Trigger a schema sync for a database",
-		inputSchema(map[string]any{
-			"database_id": map[string]any{"type": "number", "description": "The database ID to sync"},
-		}, []string{"database_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+	addWriteTool(r, "sync_database", "Trigger a schema sync for a database",
+		func(ctx context.Context, req *mcp.CallToolRequest, client metabase.API, args syncDatabaseArgs) (*mcp.CallToolResult, *syncOutput, error) {
+			run := func(ctx context.Context) (*mcp.CallToolResult, *syncOutput, error) {
+				p := r.progress(ctx, req)
+				logger.Debug().Int("database_id", args.DatabaseID).Msg("syncing database")
+				before := r.schemaSnapshot(ctx, client, args.DatabaseID)
+				err := p.wait(fmt.Sprintf("Triggering a sync of database %d", args.DatabaseID), func() error {
+					return client.SyncDatabase(ctx, args.DatabaseID)
+				})
+				if err != nil {
+					return nil, nil, err
+				}
+				// The sync runs in the background; subscribers to the schema
+				// are notified once it has changed it.
+				r.watchSync(ctx, client, args.DatabaseID, before, logger)
+				res, msg, _ := done("Database sync triggered successfully")
+				return res, &syncOutput{messageResult: &msg}, nil
 			}
-			id, err := intArg(args, "database_id")
-			if err != nil {
-				return errResult(err)
+			if args.Async {
+				job, err := startJob(ctx, r, req, "sync_database", run)
+				return nil, &syncOutput{startedJob: job}, err
 			}
-			logger.Debug().Int("database_id", id).Msg("syncing database")
-			if err := client.SyncDatabase(id); err != nil {
-				return errResult(err)
-			}
-			return textResult("Database sync triggered successfully"), nil
-		})
+			return run(ctx)
+		}, withAsync())
 }
@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -10,109 +11,205 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerDatasetTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "execute_query", "Execute a native SQL or MBQL query against a database. IMPORTANT: Only read-only (SELECT) queries are allowed - write operations are blocked.",
-		inputSchema(map[string]any{
-			"database_id":   map[string]any{"type": "number", "description": "The database ID to query"},
-			"query_type":    map[string]any{"type": "string", "description": "Query type: 'native' for SQL or 'query' for MBQL", "enum": []string{"native", "query"}},
-			"native_query":  map[string]any{"type": "string", "description": "SQL query string (for native type)"},
-			"mbql_query":    map[string]any{"type": "object", "description": "MBQL query object (for query type)"},
-			"template_tags": map[string]any{"type": "object", "description": "Template tags for parameterized native queries"},
-		}, []string{"database_id", "query_type"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+type executeQueryArgs struct {
+	DatabaseID   int            `json:"database_id" jsonschema:"The database ID to query"`
+	QueryType    string         `json:"query_type" jsonschema:"Query type: 'native' for SQL or 'query' for MBQL"`
+	NativeQuery  string         `json:"native_query,omitempty" jsonschema:"SQL query string (for native type)"`
+	MBQLQuery    map[string]any `json:"mbql_query,omitempty" jsonschema:"MBQL query object (for query type)"`
+	TemplateTags map[string]any `json:"template_tags,omitempty" jsonschema:"Template tags for parameterized native queries"`
+	MaxRows      *int           `json:"max_rows,omitempty"`
+	formatArgs
+	asyncArgs
+}
+
+type exportQueryArgs struct {
+	DatabaseID   int            `json:"database_id" jsonschema:"The database ID"`
+	QueryType    string         `json:"query_type" jsonschema:"Query type: 'native' or 'query'"`
+	NativeQuery  string         `json:"native_query,omitempty" jsonschema:"SQL query (for native type)"`
+	MBQLQuery    map[string]any `json:"mbql_query,omitempty" jsonschema:"MBQL query (for query type)"`
+	ExportFormat string         `json:"export_format" jsonschema:"Export format"`
+	asyncArgs
+}
+
+// queryOutput is the result of execute_query: the rows, or in async mode
+// the job fetching them.
+type queryOutput struct {
+	*columnarResult
+	startedJob
+}
+
+// exportResult describes the exported query results, which are returned as
+// text.
+type exportResult struct {
+	Format string `json:"format"`
+	// Size is the length of the export in bytes.
+	Size int `json:"size"`
+}
+
+// exportOutput is the result of export_query_results: the export, or in
+// async mode the job fetching it.
+type exportOutput struct {
+	*exportResult
+	startedJob
+}
+
+func registerDatasetTools(r *registrar, logger zerolog.Logger, opts Options) {
+	addTool(r, "execute_query", "Execute a native SQL or MBQL query against a database. IMPORTANT: Only read-only (SELECT) queries are allowed - write operations are blocked.",
+		func(ctx context.Context, req *mcp.CallToolRequest, client metabase.API, args executeQueryArgs) (*mcp.CallToolResult, *queryOutput, error) {
+			limit, err := opts.rowLimit(args.MaxRows)
+			if err != nil {
+				return nil, nil, err
 			}
-			dbID, err := intArg(args, "database_id")
+			// The query is checked before it is run or queued as a job, so
+			// that async calls fail the same way as others.
+			dsReq, err := checkedQuery(ctx, r.progress(ctx, req), client, logger, args.DatabaseID, args.QueryType, args.NativeQuery, args.MBQLQuery, args.TemplateTags)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			queryType, _ := stringArg(args, "query_type")
 
-			dsReq := &metabase.DatasetQueryRequest{
-				Database: dbID,
-				Type:     queryType,
+			// One row more than the limit is fetched so that truncation
+			// can be detected.
+			limited, wrapped := false, false
+			if dsReq.Native != nil {
+				dsReq.Native.Query, limited = metabase.LimitNativeQuery(ctx, client, args.DatabaseID, args.NativeQuery, limit+1)
+				wrapped = limited
+			} else {
+				limited = limitMBQL(dsReq.Query, limit+1)
 			}
 
-			if queryType == "native" {
-				sql, _ := stringArg(args, "native_query")
-				if sql == "" {
-					return errResult(fmt.Errorf("native_query is required for native query type"))
-				}
-				// Enforce read-only SQL
-				if err := metabase.ValidateReadOnlySQL(sql); err != nil {
-					logger.Warn().Str("query", sql).Msg("blocked write query attempt")
-					return errResult(err)
+			run := func(ctx context.Context) (*mcp.CallToolResult, *queryOutput, error) {
+				p := r.progress(ctx, req)
+				logger.Debug().Int("database_id", args.DatabaseID).Str("type", args.QueryType).Int("limit", limit).Bool("limited", limited).Msg("executing query")
+				var result *metabase.DatasetQueryResponse
+				err := p.wait(fmt.Sprintf("Running the query on database %d", args.DatabaseID), func() (err error) {
+					result, err = client.ExecuteQuery(ctx, dsReq)
+					// Wrapping breaks queries returning duplicate column
+					// names that LimitNativeSQL cannot see, such as SELECT *
+					// over a join, on MySQL or H2. Only those are run again
+					// as given, which fetches every row Metabase returns;
+					// the rows beyond the limit are dropped here.
+					if wrapped && metabase.IsLimitFailure(err) {
+						logger.Debug().Err(err).Int("database_id", args.DatabaseID).Msg("limited query failed, running it unlimited")
+						dsReq.Native.Query, limited = args.NativeQuery, false
+						result, err = client.ExecuteQuery(ctx, dsReq)
+					}
+					return err
+				})
+				if err != nil {
+					return nil, nil, err
 				}
-				dsReq.Native = &metabase.NativeQuery{
-					Query:        sql,
-					TemplateTags: mapArg(args, "template_tags"),
-				}
-			} else {
-				mbql := mapArg(args, "mbql_query")
-				if mbql == nil {
-					return errResult(fmt.Errorf("mbql_query is required for query type"))
-				}
-				dsReq.Query = mbql
+				res, cols, err := formatResult(truncateResult(result, limit, limited), args.Format)
+				return res, &queryOutput{columnarResult: cols}, err
+			}
+			if args.Async {
+				job, err := startJob(ctx, r, req, "execute_query", run)
+				return nil, &queryOutput{startedJob: job}, err
 			}
+			return run(ctx)
+		}, withEnum("query_type", "native", "query"), opts.withMaxRows(), withFormat(), withAsync())
 
-			logger.Debug().Int("database_id", dbID).Str("type", queryType).Msg("executing query")
-			result, err := client.ExecuteQuery(dsReq)
+	addTool(r, "export_query_results", "Export query results as CSV, JSON, or XLSX. Only read-only queries are allowed.",
+		func(ctx context.Context, req *mcp.CallToolRequest, client metabase.API, args exportQueryArgs) (*mcp.CallToolResult, *exportOutput, error) {
+			dsReq, err := checkedQuery(ctx, r.progress(ctx, req), client, logger, args.DatabaseID, args.QueryType, args.NativeQuery, args.MBQLQuery, nil)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
-		})
-
-	addTool(server, "export_query_results", "Export query results as CSV, JSON, or XLSX. Only read-only queries are allowed.",
-		inputSchema(map[string]any{
-			"database_id":   map[string]any{"type": "number", "description": "The database ID"},
-			"query_type":    map[string]any{"type": "string", "description": "Query type: 'native' or 'query'", "enum": []string{"native", "query"}},
-			"native_query":  map[string]any{"type": "string", "description": "SQL query (for native type)"},
-			"mbql_query":    map[string]any{"type": "object", "description": "MBQL query (for query type)"},
-			"export_format": map[string]any{"type": "string", "description": "Export format", "enum": []string{"csv", "json", "xlsx"}},
-		}, []string{"database_id", "query_type", "export_format"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+
+			run := func(ctx context.Context) (*mcp.CallToolResult, *exportOutput, error) {
+				p := r.progress(ctx, req)
+				logger.Debug().Int("database_id", args.DatabaseID).Str("format", args.ExportFormat).Msg("exporting query results")
+				var data []byte
+				err := p.wait(fmt.Sprintf("Exporting the results as %s", args.ExportFormat), func() (err error) {
+					data, err = client.ExportQueryResults(ctx, dsReq, args.ExportFormat)
+					return err
+				})
+				if err != nil {
+					return nil, nil, err
+				}
+				return textResult(string(data)), &exportOutput{exportResult: &exportResult{Format: args.ExportFormat, Size: len(data)}}, nil
 			}
-			dbID, err := intArg(args, "database_id")
-			if err != nil {
-				return errResult(err)
+			if args.Async {
+				job, err := startJob(ctx, r, req, "export_query_results", run)
+				return nil, &exportOutput{startedJob: job}, err
 			}
-			queryType, _ := stringArg(args, "query_type")
-			format, _ := stringArg(args, "export_format")
+			return run(ctx)
+		}, withEnum("query_type", "native", "query"), withEnum("export_format", "csv", "json", "xlsx"), withAsync())
+}
 
-			dsReq := &metabase.DatasetQueryRequest{
-				Database: dbID,
-				Type:     queryType,
-			}
+// checkedQuery builds the request for an ad-hoc native or MBQL query and
+// checks that it is read-only.
+func checkedQuery(ctx context.Context, p *progress, client metabase.API, logger zerolog.Logger, databaseID int, queryType, nativeQuery string, mbqlQuery, templateTags map[string]any) (*metabase.DatasetQueryRequest, error) {
+	dsReq := &metabase.DatasetQueryRequest{
+		Database: databaseID,
+		Type:     queryType,
+	}
+	if queryType == "native" {
+		if nativeQuery == "" {
+			return nil, fmt.Errorf("native_query is required for native query type")
+		}
+		dsReq.Native = &metabase.NativeQuery{
+			Query:        nativeQuery,
+			TemplateTags: templateTags,
+		}
+		// Enforce read-only SQL
+		p.step("Checking that the query is read-only")
+		if err := enforceReadOnly(ctx, client, logger, databaseID, dsReq.Native, nil, true); err != nil {
+			return nil, err
+		}
+		return dsReq, nil
+	}
 
-			if queryType == "native" {
-				sql, _ := stringArg(args, "native_query")
-				if sql == "" {
-					return errResult(fmt.Errorf("native_query is required for native query type"))
-				}
-				if err := metabase.ValidateReadOnlySQL(sql); err != nil {
-					logger.Warn().Str("query", sql).Msg("blocked write query attempt in export")
-					return errResult(err)
-				}
-				dsReq.Native = &metabase.NativeQuery{Query: sql}
-			} else {
-				mbql := mapArg(args, "mbql_query")
-				if mbql == nil {
-					return errResult(fmt.Errorf("mbql_query is required for query type"))
-				}
-				dsReq.Query = mbql
-			}
+	if mbqlQuery == nil {
+		return nil, fmt.Errorf("mbql_query is required for query type")
+	}
+	// MBQL can run native SQL through source queries and saved questions
+	// used as source tables.
+	p.step("Checking that the query is read-only")
+	err := metabase.ValidateMBQLQuery(ctx, client, databaseID, mbqlQuery)
+	if err := checkReadOnly(logger.With().Int("database_id", databaseID).Logger(), err, true); err != nil {
+		return nil, err
+	}
+	dsReq.Query = mbqlQuery
+	return dsReq, nil
+}
 
-			logger.Debug().Int("database_id", dbID).Str("format", format).Msg("exporting query results")
-			data, err := client.ExportQueryResults(dsReq, format)
-			if err != nil {
-				return errResult(err)
-			}
-			return textResult(string(data)), nil
-		})
+// limitMBQL caps the limit clause of an MBQL query at n. It reports whether
+// the query's limit is now n, i.e. whether the result size says nothing about
+// the number of matching rows beyond n.
+func limitMBQL(query map[string]any, n int) bool {
+	if existing, ok := query["limit"].(float64); ok && int(existing) < n {
+		return false
+	}
+	query["limit"] = n
+	return true
+}
+
+// enforceReadOnly validates a native query, including its template-tag
+// substituted form, against the read-only policy of its database; see
+// checkReadOnly for strict.
+func enforceReadOnly(ctx context.Context, client metabase.API, logger zerolog.Logger, databaseID int, native *metabase.NativeQuery, parameters []any, strict bool) error {
+	err := metabase.ValidateNativeQuery(ctx, client, databaseID, native, parameters)
+	return checkReadOnly(logger.With().Int("database_id", databaseID).Str("query", native.Query).Logger(), err, strict)
+}
+
+// checkReadOnly handles the outcome of a read-only check. Violations are
+// logged as blocked write attempts. When strict is false, a failure to verify
+// the query (e.g. to compile a required parameter without a value while
+// saving a card) is logged and tolerated; the query is checked again with
+// real parameter values when it is executed.
+func checkReadOnly(logger zerolog.Logger, err error, strict bool) error {
+	if err == nil {
+		return nil
+	}
+	var violation *metabase.ReadOnlyViolation
+	if errors.As(err, &violation) {
+		logger.Warn().Str("reason", string(violation.Reason)).Msg("blocked write query attempt")
+		return err
+	}
+	if !strict {
+		logger.Warn().Err(err).Msg("could not verify query, deferring check to execution")
+		return nil
+	}
+	logger.Warn().Err(err).Msg("blocked unverifiable query")
+	return err
 }
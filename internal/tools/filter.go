@@ -0,0 +1,88 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+)
+
+// Categories lists the tool categories that EnableTools and DisableTools
+// patterns can name.
+var Categories = []string{
+	"instances", "cards", "dashboards", "collections", "databases", "tables",
+	"fields", "queries", "users", "permissions", "search", "alerts",
+	"settings", "activity", "actions", "timelines", "cache", "jobs",
+}
+
+// toolFilter decides which tools are registered.
+type toolFilter struct {
+	enable   []string
+	disable  []string
+	readOnly bool
+
+	// matched records the patterns that matched at least one tool.
+	matched map[string]bool
+}
+
+func newToolFilter(opts Options) *toolFilter {
+	return &toolFilter{
+		enable:   opts.EnableTools,
+		disable:  opts.DisableTools,
+		readOnly: opts.ReadOnly,
+		matched:  make(map[string]bool),
+	}
+}
+
+// allows reports whether a tool is registered.
+func (f *toolFilter) allows(name, category string, readOnly bool) bool {
+	enabled := len(f.enable) == 0
+	if f.match(f.enable, name, category) {
+		enabled = true
+	}
+	if f.match(f.disable, name, category) {
+		enabled = false
+	}
+	return enabled && (readOnly || !f.readOnly)
+}
+
+// match reports whether any of patterns matches the tool. It checks every
+// pattern, so that unmatched ones can be reported.
+func (f *toolFilter) match(patterns []string, name, category string) bool {
+	found := false
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok || p == category {
+			f.matched[p] = true
+			found = true
+		}
+	}
+	return found
+}
+
+// EnabledTools returns the names of the tools RegisterAll registers with
+// opts. It fails if a pattern in EnableTools or DisableTools is malformed or
+// matches no tool, which usually means it is misspelled.
+func EnabledTools(opts Options) ([]string, error) {
+	for _, p := range slices.Concat(opts.EnableTools, opts.DisableTools) {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid tool pattern %q: %w", p, err)
+		}
+	}
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server"}, nil)
+	r := registerAll(server, NewInstances(), zerolog.Nop(), opts)
+
+	var unmatched []string
+	for _, p := range slices.Concat(opts.EnableTools, opts.DisableTools) {
+		if !r.filter.matched[p] {
+			unmatched = append(unmatched, p)
+		}
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("tool patterns match no tool: %s (categories: %s)", strings.Join(unmatched, ", "), strings.Join(Categories, ", "))
+	}
+	return r.registered, nil
+}
@@ -0,0 +1,260 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// Formats of query results.
+const (
+	// FormatCSV renders rows as CSV with a header of column display names.
+	FormatCSV = "csv"
+	// FormatMarkdown renders rows as a markdown table.
+	FormatMarkdown = "markdown"
+	// FormatJSON renders rows as compact JSON, one array of values per
+	// column.
+	FormatJSON = "json"
+	// FormatRaw returns the Metabase response as is, with column metadata.
+	FormatRaw = "raw"
+)
+
+// resultFormats are the values of the format argument; the first is the
+// default, being the shortest.
+var resultFormats = []string{FormatCSV, FormatMarkdown, FormatJSON, FormatRaw}
+
+// formatArgs is the format argument of query tools.
+type formatArgs struct {
+	Format string `json:"format,omitempty" jsonschema:"Result format: 'csv' (default), a 'markdown' table, column-oriented compact 'json', or the 'raw' Metabase response with full column metadata"`
+}
+
+// withFormat restricts the format argument to the result formats.
+func withFormat() schemaOption {
+	return withEnum("format", resultFormats...)
+}
+
+// formatResult renders a query result in format, by default CSV. For CSV
+// and markdown, a truncation notice follows the table as separate content.
+// The structured result is the columnar form whatever the format.
+func formatResult(result *queryResult, format string) (*mcp.CallToolResult, *columnarResult, error) {
+	data := result.Data
+	cols := columnar(result)
+	var text string
+	switch format {
+	case FormatRaw:
+		out, err := json.Marshal(result)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshaling result: %w", err)
+		}
+		return textResult(string(out)), cols, nil
+	case FormatJSON:
+		out, err := json.Marshal(cols)
+		if err != nil {
+			return nil, nil, fmt.Errorf("marshaling result: %w", err)
+		}
+		return textResult(string(out)), cols, nil
+	case FormatMarkdown:
+		text = markdownTable(data.Cols, data.Rows)
+	default:
+		var err error
+		if text, err = csvTable(data.Cols, data.Rows); err != nil {
+			return nil, nil, fmt.Errorf("writing CSV: %w", err)
+		}
+	}
+	out := textResult(text)
+	if result.Notice != "" {
+		out.Content = append(out.Content, &mcp.TextContent{Text: result.Notice})
+	}
+	return out, cols, nil
+}
+
+// nullText is how the text formats show a null, so that it stays distinct
+// from an empty string.
+const nullText = "NULL"
+
+// cellText renders the value of col in row at i for the text formats.
+func cellText(col metabase.DatasetCol, row []any, i int) string {
+	if i >= len(row) || row[i] == nil {
+		return nullText
+	}
+	return formatValue(col, row[i])
+}
+
+// columnHeader returns the name a column is shown under.
+func columnHeader(col metabase.DatasetCol) string {
+	if col.DisplayName != "" {
+		return col.DisplayName
+	}
+	return col.Name
+}
+
+func csvTable(cols []metabase.DatasetCol, rows [][]any) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	record := make([]string, len(cols))
+	for i, col := range cols {
+		record[i] = columnHeader(col)
+	}
+	if err := w.Write(record); err != nil {
+		return "", err
+	}
+	for _, row := range rows {
+		for i, col := range cols {
+			record[i] = cellText(col, row, i)
+		}
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// markdownCell escapes what would break a markdown table cell.
+var markdownCell = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+func markdownTable(cols []metabase.DatasetCol, rows [][]any) string {
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" " + markdownCell.Replace(cell) + " |")
+		}
+		b.WriteString("\n")
+	}
+	cells := make([]string, len(cols))
+	for i, col := range cols {
+		cells[i] = columnHeader(col)
+	}
+	writeRow(cells)
+	for i := range cells {
+		cells[i] = "---"
+	}
+	writeRow(cells)
+	for _, row := range rows {
+		for i, col := range cols {
+			cells[i] = cellText(col, row, i)
+		}
+		writeRow(cells)
+	}
+	return b.String()
+}
+
+// columnarResult is a query result with its rows turned into columns.
+type columnarResult struct {
+	Columns   []resultColumn `json:"columns"`
+	RowCount  int            `json:"row_count"`
+	Truncated bool           `json:"truncated,omitempty"`
+	Notice    string         `json:"notice,omitempty"`
+}
+
+type resultColumn struct {
+	Name string `json:"name"`
+	// Type is the base type without its "type/" prefix.
+	Type   string `json:"type,omitempty"`
+	Values []any  `json:"values"`
+}
+
+func columnar(result *queryResult) *columnarResult {
+	data := result.Data
+	out := &columnarResult{
+		Columns:   make([]resultColumn, len(data.Cols)),
+		RowCount:  result.RowCount,
+		Truncated: result.Truncated,
+		Notice:    result.Notice,
+	}
+	for i, col := range data.Cols {
+		values := make([]any, len(data.Rows))
+		for j, row := range data.Rows {
+			if i < len(row) {
+				values[j] = jsonValue(col, row[i])
+			}
+		}
+		out.Columns[i] = resultColumn{Name: columnHeader(col), Type: strings.TrimPrefix(col.BaseType, "type/"), Values: values}
+	}
+	return out
+}
+
+// jsonValue is formatValue for JSON output: numbers, booleans and nulls
+// stay JSON values.
+func jsonValue(col metabase.DatasetCol, v any) any {
+	switch v := v.(type) {
+	case nil, bool:
+		return v
+	case float64:
+		return roundFloat(v)
+	default:
+		return formatValue(col, v)
+	}
+}
+
+// formatValue renders a non-null value of col as text, by the column's base
+// type: dates without their midnight time, and numbers without exponents
+// or floating-point noise.
+func formatValue(col metabase.DatasetCol, v any) string {
+	switch v := v.(type) {
+	case string:
+		if isTemporal(col.BaseType) {
+			return formatTime(col.BaseType, v)
+		}
+		return v
+	case float64:
+		return strconv.FormatFloat(roundFloat(v), 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// roundFloat rounds f to 15 significant digits, the precision a float64
+// holds, dropping noise such as that of 0.1+0.2.
+func roundFloat(f float64) float64 {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	if err != nil {
+		return f
+	}
+	return rounded
+}
+
+func isTemporal(baseType string) bool {
+	switch baseType {
+	case "type/Date", "type/DateTime", "type/DateTimeWithTZ", "type/DateTimeWithLocalTZ",
+		"type/DateTimeWithZoneOffset", "type/DateTimeWithZoneID", "type/Instant", "type/Time", "type/TimeWithTZ":
+		return true
+	}
+	return false
+}
+
+// formatTime shortens the ISO 8601 timestamps Metabase returns: dates and
+// times at midnight lose the time, other times their fractional seconds, and
+// UTC times their offset. Values that do not parse are returned as is.
+func formatTime(baseType, s string) string {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		if t, err = time.Parse("2006-01-02T15:04:05.999999999", s); err != nil {
+			return s
+		}
+	}
+	if baseType == "type/Date" || t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format(time.DateOnly)
+	}
+	if _, offset := t.Zone(); offset == 0 {
+		return t.Format(time.DateTime)
+	}
+	return t.Format("2006-01-02 15:04:05-07:00")
+}
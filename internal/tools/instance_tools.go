@@ -0,0 +1,157 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// Instances holds the Metabase clients tools can run against, by name.
+type Instances struct {
+	names       []string
+	clients     map[string]metabase.API
+	defaultName string
+}
+
+// NewInstances creates an empty instance set.
+func NewInstances() *Instances {
+	return &Instances{clients: make(map[string]metabase.API)}
+}
+
+// SingleInstance returns an instance set holding only client, named "default".
+func SingleInstance(client metabase.API) *Instances {
+	i := NewInstances()
+	i.Add("default", client)
+	return i
+}
+
+// Add registers a client under name. The first instance added is the
+// default until SetDefault is called.
+func (i *Instances) Add(name string, client metabase.API) {
+	if _, ok := i.clients[name]; !ok {
+		i.names = append(i.names, name)
+	}
+	i.clients[name] = client
+	if i.defaultName == "" {
+		i.defaultName = name
+	}
+}
+
+// SetDefault selects the instance used when a tool call names none.
+func (i *Instances) SetDefault(name string) error {
+	if _, ok := i.clients[name]; !ok {
+		return fmt.Errorf("unknown instance %q", name)
+	}
+	i.defaultName = name
+	return nil
+}
+
+// Get returns the client of the named instance, or of the default instance
+// if name is empty.
+func (i *Instances) Get(name string) (metabase.API, error) {
+	if name == "" {
+		name = i.defaultName
+	}
+	client, ok := i.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown instance %q (available: %s)", name, strings.Join(i.names, ", "))
+	}
+	return client, nil
+}
+
+// Names returns the instance names in the order they were added.
+func (i *Instances) Names() []string {
+	return i.names
+}
+
+// Default returns the name of the default instance.
+func (i *Instances) Default() string {
+	return i.defaultName
+}
+
+type instanceKey struct{}
+
+// withInstance returns ctx carrying the name of the instance a tool runs
+// against.
+func withInstance(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, instanceKey{}, name)
+}
+
+// instanceFromContext returns the name of the instance a tool runs
+// against, or "" outside tool calls.
+func instanceFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(instanceKey{}).(string)
+	return name
+}
+
+// instanceInfo describes an instance in list_instances output.
+type instanceInfo struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Default   bool   `json:"default"`
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// serverInfo describes a Metabase instance in get_server_info output.
+type serverInfo struct {
+	URL     string `json:"url"`
+	Version string `json:"version"`
+	// Edition is "oss" or "enterprise", or empty for unrecognized versions.
+	Edition      string                `json:"edition,omitempty"`
+	Capabilities []metabase.Capability `json:"capabilities"`
+	Features     []string              `json:"features"`
+}
+
+func registerInstanceTools(r *registrar, logger zerolog.Logger) {
+	addServerTool(r, "list_instances", "List the Metabase instances this server can query, with their availability. Pass a name as the instance argument of other tools.",
+		func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, itemsResult[instanceInfo], error) {
+			logger.Debug().Msg("listing instances")
+			infos := make([]instanceInfo, 0, len(r.instances.Names()))
+			for _, name := range r.instances.Names() {
+				client, _ := r.instances.Get(name)
+				info := instanceInfo{
+					Name:      name,
+					URL:       client.BaseURL(),
+					Default:   name == r.instances.Default(),
+					Available: true,
+				}
+				if err := client.HealthCheck(ctx); err != nil {
+					info.Available = false
+					info.Error = err.Error()
+				}
+				infos = append(infos, info)
+			}
+			return nil, items(infos), nil
+		})
+
+	addTool(r, "get_server_info", "Get the Metabase version of an instance, the API capabilities that depend on it, and the enabled paid features",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, _ struct{}) (*mcp.CallToolResult, *serverInfo, error) {
+			logger.Debug().Msg("getting server info")
+			info, err := client.ServerInfo(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			out := &serverInfo{
+				URL:          client.BaseURL(),
+				Version:      info.Version.String(),
+				Capabilities: info.Capabilities,
+				Features:     info.Features,
+			}
+			if info.Version.Known() {
+				out.Edition = "oss"
+				if info.Version.Enterprise {
+					out.Edition = "enterprise"
+				}
+			}
+			if out.Features == nil {
+				out.Features = []string{}
+			}
+			return nil, out, nil
+		})
+}
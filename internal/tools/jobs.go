@@ -0,0 +1,400 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+)
+
+// Job defaults applied when NewJobs is given zero values.
+const (
+	DefaultJobWorkers = 4
+	DefaultJobTTL     = time.Hour
+)
+
+// maxQueuedJobs bounds the jobs of one session waiting for a worker.
+const maxQueuedJobs = 100
+
+// Job states.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// Jobs runs the tool calls that ask for async mode in the background, a
+// bounded number at a time, and keeps their results until they expire.
+// One Jobs may serve several servers; each job is visible only to the
+// server it was started on, and is cancelled when the session that started
+// it ends.
+type Jobs struct {
+	ttl     time.Duration
+	workers chan struct{}
+
+	mu   sync.Mutex
+	jobs map[string]*job
+	// queued counts the jobs of each session waiting for a worker.
+	queued map[*mcp.ServerSession]int
+	// watched are the sessions whose end is awaited to cancel their jobs.
+	watched map[*mcp.ServerSession]bool
+}
+
+// job is a tool call running in the background.
+type job struct {
+	owner   *registrar
+	session *mcp.ServerSession
+	cancel  context.CancelFunc
+	status  jobStatus
+	result  *mcp.CallToolResult
+}
+
+// jobStatus describes a job in tool results.
+type jobStatus struct {
+	ID     string `json:"id"`
+	Tool   string `json:"tool"`
+	Status string `json:"status" jsonschema:"queued, running, succeeded, failed or cancelled"`
+	// Progress is the last step the job reported.
+	Progress   string     `json:"progress,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// NewJobs creates a job runner that runs up to workers jobs at once and
+// keeps finished jobs for ttl. Zero values select the defaults.
+func NewJobs(workers int, ttl time.Duration) *Jobs {
+	if workers <= 0 {
+		workers = DefaultJobWorkers
+	}
+	if ttl <= 0 {
+		ttl = DefaultJobTTL
+	}
+	return &Jobs{
+		ttl:     ttl,
+		workers: make(chan struct{}, workers),
+		jobs:    make(map[string]*job),
+		queued:  make(map[*mcp.ServerSession]int),
+		watched: make(map[*mcp.ServerSession]bool),
+	}
+}
+
+// start runs work as a job of owner, started by session. The job keeps the
+// values of ctx but not its cancellation, as it outlives the tool call that
+// starts it; it is cancelled when session ends instead.
+func (j *Jobs) start(ctx context.Context, owner *registrar, session *mcp.ServerSession, tool string, work func(context.Context) *mcp.CallToolResult) (*jobStatus, error) {
+	ctx, cancelCtx := context.WithCancel(context.WithoutCancel(ctx))
+	cancel := cancelCtx
+	if owner.shutdown != nil {
+		stop := context.AfterFunc(owner.shutdown, cancelCtx)
+		cancel = func() {
+			stop()
+			cancelCtx()
+		}
+	}
+	jb := &job{
+		owner:   owner,
+		session: session,
+		cancel:  cancel,
+		status:  jobStatus{ID: newJobID(), Tool: tool, Status: jobQueued, CreatedAt: time.Now().UTC()},
+	}
+
+	j.mu.Lock()
+	if j.queued[session] >= maxQueuedJobs {
+		j.mu.Unlock()
+		cancel()
+		return nil, errors.New("too many jobs are waiting to run; try again later")
+	}
+	j.queued[session]++
+	j.jobs[jb.status.ID] = jb
+	status := jb.status
+	watch := session != nil && !j.watched[session]
+	if watch {
+		j.watched[session] = true
+	}
+	j.mu.Unlock()
+
+	if watch {
+		go func() {
+			_ = session.Wait()
+			j.endSession(session)
+		}()
+	}
+	go j.run(ctx, jb, work)
+	return &status, nil
+}
+
+// endSession cancels the unfinished jobs of a session that has ended, as
+// the Metabase clients they run with may be closed with it.
+func (j *Jobs) endSession(session *mcp.ServerSession) {
+	j.mu.Lock()
+	delete(j.watched, session)
+	var jobs []*job
+	for _, jb := range j.jobs {
+		if jb.session == session && jb.status.FinishedAt == nil {
+			jobs = append(jobs, jb)
+		}
+	}
+	j.mu.Unlock()
+	for _, jb := range jobs {
+		j.finish(jb, jobCancelled, nil)
+		jb.cancel()
+	}
+}
+
+// dequeue records that a job no longer waits for a worker. j.mu must be
+// held.
+func (j *Jobs) dequeue(jb *job) {
+	if j.queued[jb.session]--; j.queued[jb.session] <= 0 {
+		delete(j.queued, jb.session)
+	}
+}
+
+// run waits for a worker and runs a job's work.
+func (j *Jobs) run(ctx context.Context, jb *job, work func(context.Context) *mcp.CallToolResult) {
+	defer jb.cancel()
+	select {
+	case j.workers <- struct{}{}:
+	case <-ctx.Done():
+		j.mu.Lock()
+		j.dequeue(jb)
+		j.mu.Unlock()
+		j.finish(jb, jobCancelled, nil)
+		return
+	}
+	defer func() { <-j.workers }()
+
+	j.mu.Lock()
+	j.dequeue(jb)
+	if jb.status.Status != jobQueued {
+		// Cancelled while waiting.
+		j.mu.Unlock()
+		return
+	}
+	now := time.Now().UTC()
+	jb.status.Status = jobRunning
+	jb.status.StartedAt = &now
+	j.mu.Unlock()
+
+	result := work(withJob(ctx, jb))
+	switch {
+	case ctx.Err() != nil:
+		j.finish(jb, jobCancelled, nil)
+	case result.IsError:
+		j.finish(jb, jobFailed, result)
+	default:
+		j.finish(jb, jobSucceeded, result)
+	}
+}
+
+// finish records the outcome of a job, unless it already has one, and
+// schedules its removal.
+func (j *Jobs) finish(jb *job, state string, result *mcp.CallToolResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if jb.status.FinishedAt != nil {
+		return
+	}
+	now := time.Now().UTC()
+	expires := now.Add(j.ttl)
+	jb.status.Status = state
+	jb.status.FinishedAt = &now
+	jb.status.ExpiresAt = &expires
+	jb.result = result
+	if state == jobFailed {
+		jb.status.Error = resultText(result)
+	}
+	time.AfterFunc(j.ttl, func() {
+		j.mu.Lock()
+		delete(j.jobs, jb.status.ID)
+		j.mu.Unlock()
+	})
+}
+
+// setProgress records the last step a job reported.
+func (j *Jobs) setProgress(jb *job, msg string) {
+	j.mu.Lock()
+	jb.status.Progress = msg
+	j.mu.Unlock()
+}
+
+// get returns the status and, once it has finished, the result of a job
+// of owner.
+func (j *Jobs) get(owner *registrar, id string) (*jobStatus, *mcp.CallToolResult, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jb, ok := j.jobs[id]
+	if !ok || jb.owner != owner {
+		return nil, nil, fmt.Errorf("unknown job %q; finished jobs are kept for %s", id, j.ttl)
+	}
+	status := jb.status
+	return &status, jb.result, nil
+}
+
+// cancelJob stops a job of owner that has not finished yet.
+func (j *Jobs) cancelJob(owner *registrar, id string) (*jobStatus, error) {
+	j.mu.Lock()
+	jb, ok := j.jobs[id]
+	j.mu.Unlock()
+	if !ok || jb.owner != owner {
+		return nil, fmt.Errorf("unknown job %q; finished jobs are kept for %s", id, j.ttl)
+	}
+	j.finish(jb, jobCancelled, nil)
+	jb.cancel()
+	status, _, err := j.get(owner, id)
+	return status, err
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "job-" + hex.EncodeToString(b)
+}
+
+type jobKey struct{}
+
+// withJob returns ctx carrying the job a tool call runs as.
+func withJob(ctx context.Context, jb *job) context.Context {
+	return context.WithValue(ctx, jobKey{}, jb)
+}
+
+// jobFromContext returns the job a tool call runs as, or nil if it runs in
+// the foreground.
+func jobFromContext(ctx context.Context) *job {
+	jb, _ := ctx.Value(jobKey{}).(*job)
+	return jb
+}
+
+// asyncArgs is the argument of tools that can run as jobs.
+type asyncArgs struct {
+	Async bool `json:"async,omitempty" jsonschema:"Run in the background and return a job at once; poll get_job_status and fetch the outcome with get_job_result"`
+}
+
+// startedJob is part of the result of tools that can run as jobs. In
+// async mode it is all the result holds.
+type startedJob struct {
+	Job *jobStatus `json:"job,omitempty" jsonschema:"The job started in async mode"`
+}
+
+// withAsync allows the result of a tool that can run as a job to hold only
+// the job.
+func withAsync() schemaOption {
+	return func(_, out *jsonschema.Schema) {
+		out.Required = nil
+	}
+}
+
+// startJob runs a tool's work as a job of r, started by the session of req.
+func startJob[Out any](ctx context.Context, r *registrar, req *mcp.CallToolRequest, tool string, work func(context.Context) (*mcp.CallToolResult, Out, error)) (startedJob, error) {
+	var session *mcp.ServerSession
+	if req != nil {
+		session = req.Session
+	}
+	status, err := r.jobs.start(ctx, r, session, tool, func(ctx context.Context) *mcp.CallToolResult {
+		res, out, err := work(ctx)
+		return callResult(res, out, toolError(err))
+	})
+	if err != nil {
+		return startedJob{}, err
+	}
+	r.logger.Debug().Str("tool", tool).Str("job", status.ID).Msg("job started")
+	return startedJob{Job: status}, nil
+}
+
+// callResult turns the outcome of a tool handler into the result the
+// server would send for it: an error result for err, and otherwise res with
+// out as its structured content and, if res has none, its text.
+func callResult[Out any](res *mcp.CallToolResult, out Out, err error) *mcp.CallToolResult {
+	if err != nil {
+		res = textResult(err.Error())
+		res.IsError = true
+		return res
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		res = textResult(fmt.Sprintf("marshaling result: %v", err))
+		res.IsError = true
+		return res
+	}
+	if res == nil {
+		res = &mcp.CallToolResult{}
+	}
+	res.StructuredContent = json.RawMessage(data)
+	if res.Content == nil {
+		res.Content = []mcp.Content{&mcp.TextContent{Text: string(data)}}
+	}
+	return res
+}
+
+// resultText returns the text of a tool result.
+func resultText(res *mcp.CallToolResult) string {
+	var text string
+	for _, c := range res.Content {
+		if t, ok := c.(*mcp.TextContent); ok {
+			if text != "" {
+				text += "\n"
+			}
+			text += t.Text
+		}
+	}
+	return text
+}
+
+type jobIDArgs struct {
+	JobID string `json:"job_id" jsonschema:"The job ID returned in async mode"`
+}
+
+// jobResult is the result of get_job_result: the job and the structured
+// result of the tool call it ran.
+type jobResult struct {
+	Job    *jobStatus `json:"job"`
+	Result any        `json:"result,omitempty"`
+}
+
+func registerJobTools(r *registrar, logger zerolog.Logger) {
+	addServerTool(r, "get_job_status", "Get the status and last progress step of a job started in async mode",
+		func(_ context.Context, _ *mcp.CallToolRequest, args jobIDArgs) (*mcp.CallToolResult, *jobStatus, error) {
+			logger.Debug().Str("job", args.JobID).Msg("getting job status")
+			status, _, err := r.jobs.get(r, args.JobID)
+			return nil, status, err
+		})
+
+	addServerTool(r, "get_job_result", "Get the result of a finished job, as the tool that started it would have returned it",
+		func(_ context.Context, _ *mcp.CallToolRequest, args jobIDArgs) (*mcp.CallToolResult, *jobResult, error) {
+			logger.Debug().Str("job", args.JobID).Msg("getting job result")
+			status, result, err := r.jobs.get(r, args.JobID)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch status.Status {
+			case jobQueued, jobRunning:
+				return nil, nil, fmt.Errorf("job %s is %s; check get_job_status until it has finished", status.ID, status.Status)
+			case jobCancelled:
+				return nil, nil, fmt.Errorf("job %s was cancelled", status.ID)
+			}
+			out := &jobResult{Job: status}
+			if result.StructuredContent != nil {
+				out.Result = result.StructuredContent
+			}
+			return &mcp.CallToolResult{Content: result.Content, IsError: result.IsError}, out, nil
+		})
+
+	addServerTool(r, "cancel_job", "Cancel a job started in async mode that has not finished",
+		func(_ context.Context, _ *mcp.CallToolRequest, args jobIDArgs) (*mcp.CallToolResult, *jobStatus, error) {
+			logger.Debug().Str("job", args.JobID).Msg("cancelling job")
+			status, err := r.jobs.cancelJob(r, args.JobID)
+			return nil, status, err
+		})
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// Page sizes of list tools.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// pageArgs are the limit, offset and cursor arguments of list tools that
+// return a page at a time.
+type pageArgs struct {
+	Limit  *int   `json:"limit,omitempty" jsonschema:"Maximum number of items to return (default 50, at most 500)"`
+	Offset *int   `json:"offset,omitempty" jsonschema:"Number of items to skip (default 0)"`
+	Cursor string `json:"cursor,omitempty" jsonschema:"The next_cursor of a previous call, to get the following page"`
+}
+
+// page returns the page selected by the arguments. A cursor replaces offset
+// and, unless limit is given, limit.
+func (a pageArgs) page() (metabase.Page, error) {
+	page := metabase.Page{Limit: DefaultPageSize}
+	if a.Cursor != "" {
+		var err error
+		if page, err = decodeCursor(a.Cursor); err != nil {
+			return page, err
+		}
+	} else if a.Offset != nil {
+		if *a.Offset < 0 {
+			return page, fmt.Errorf("offset must not be negative")
+		}
+		page.Offset = *a.Offset
+	}
+	if a.Limit != nil {
+		if *a.Limit < 1 {
+			return page, fmt.Errorf("limit must be at least 1")
+		}
+		page.Limit = *a.Limit
+	}
+	page.Limit = min(page.Limit, MaxPageSize)
+	return page, nil
+}
+
+// encodeCursor returns the opaque continuation token for page.
+func encodeCursor(page metabase.Page) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d", page.Offset, page.Limit))
+}
+
+func decodeCursor(cursor string) (metabase.Page, error) {
+	var page metabase.Page
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		_, err = fmt.Sscanf(string(data), "%d:%d", &page.Offset, &page.Limit)
+	}
+	if err != nil || page.Offset < 0 || page.Limit < 1 {
+		return metabase.Page{}, fmt.Errorf("invalid cursor %q; pass the next_cursor of a previous call", cursor)
+	}
+	return page, nil
+}
+
+// listResult is a page of a list as returned to the client.
+type listResult[T any] struct {
+	Data   []T `json:"data"`
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	// NextCursor continues the list; it is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+	Notice     string `json:"notice,omitempty"`
+}
+
+// pagedResult returns a page of a list of items, such as "cards", with a
+// hint on how to get the next page.
+func pagedResult[T any](p *metabase.Paged[T], items string) *listResult[T] {
+	result := &listResult[T]{Data: p.Data, Total: p.Total, Offset: p.Offset, Limit: p.Limit}
+	if result.Data == nil {
+		result.Data = []T{}
+	}
+	if next, ok := p.Next(); ok {
+		result.NextCursor = encodeCursor(next)
+		result.Notice = fmt.Sprintf("%d-%d of %d %s shown; pass next_cursor as cursor for more", p.Offset+1, p.Offset+len(p.Data), p.Total, items)
+	}
+	return result
+}
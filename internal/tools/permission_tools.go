@@ -9,47 +9,36 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerPermissionTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_permission_groups", "List all permission groups",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// permissionGroupFields are the permission group fields list_permission_groups returns by default.
+var permissionGroupFields = []string{"id", "name"}
+
+type groupIDArgs struct {
+	GroupID int `json:"group_id" jsonschema:"The permission group ID"`
+}
+
+func registerPermissionTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_permission_groups", "List all permission groups",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args fieldsArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
 			logger.Debug().Msg("listing permission groups")
-			groups, err := client.ListPermissionGroups()
+			groups, err := client.ListPermissionGroups(ctx)
 			if err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			return marshalResult(groups)
-		})
+			result, err := projectedItems(groups, args.Fields, permissionGroupFields)
+			return nil, result, err
+		}, withFields[metabase.PermissionGroup](permissionGroupFields))
 
-	addTool(server, "get_permission_group", "Get permission group details with members",
-		inputSchema(map[string]any{
-			"group_id": map[string]any{"type": "number", "description": "The permission group ID"},
-		}, []string{"group_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "group_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("group_id", id).Msg("getting permission group")
-			group, err := client.GetPermissionGroup(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(group)
+	addTool(r, "get_permission_group", "Get permission group details with members",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args groupIDArgs) (*mcp.CallToolResult, *metabase.PermissionGroup, error) {
+			logger.Debug().Int("group_id", args.GroupID).Msg("getting permission group")
+			group, err := client.GetPermissionGroup(ctx, args.GroupID)
+			return nil, group, err
 		})
 
-	addTool(server, "get_permissions_graph", "Get the full permissions graph showing all group permissions",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	addTool(r, "get_permissions_graph", "Get the full permissions graph showing all group permissions",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, _ struct{}) (*mcp.CallToolResult, map[string]any, error) {
 			logger.Debug().Msg("getting permissions graph")
-			graph, err := client.GetPermissionsGraph()
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(graph)
+			graph, err := client.GetPermissionsGraph(ctx)
+			return nil, graph, err
 		})
 }
@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// progressInterval is how often a long Metabase call reports that it is
+// still waiting.
+var progressInterval = 5 * time.Second
+
+// progress reports the steps of a long-running tool call: as MCP progress
+// notifications when the client sent a progress token, and as the progress
+// of the call's job when it runs as one.
+type progress struct {
+	ctx     context.Context
+	session *mcp.ServerSession
+	token   any
+	jobs    *Jobs
+	job     *job
+
+	mu    sync.Mutex
+	count float64
+}
+
+// progress returns the progress reporter of a tool call. Jobs do not
+// notify, as the call that started them has returned.
+func (r *registrar) progress(ctx context.Context, req *mcp.CallToolRequest) *progress {
+	p := &progress{ctx: ctx}
+	if jb := jobFromContext(ctx); jb != nil {
+		p.jobs, p.job = r.jobs, jb
+		return p
+	}
+	if req != nil && req.Params != nil && req.Session != nil {
+		if token := req.Params.GetProgressToken(); token != nil {
+			p.session, p.token = req.Session, token
+		}
+	}
+	return p
+}
+
+// enabled reports whether anyone receives the steps.
+func (p *progress) enabled() bool {
+	return p.job != nil || p.token != nil
+}
+
+// step reports that the call has moved on to msg. No total is given, as
+// Metabase does not tell how long a query will take.
+func (p *progress) step(msg string) {
+	if !p.enabled() {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count++
+	if p.job != nil {
+		p.jobs.setProgress(p.job, msg)
+		return
+	}
+	// A client that goes away stops receiving notifications; the call
+	// itself carries on.
+	_ = p.session.NotifyProgress(p.ctx, &mcp.ProgressNotificationParams{
+		ProgressToken: p.token,
+		Progress:      p.count,
+		Message:       msg,
+	})
+}
+
+// wait reports msg and runs call, reporting every progressInterval that it
+// is still waiting.
+func (p *progress) wait(msg string, call func() error) error {
+	p.step(msg)
+	if !p.enabled() {
+		return call()
+	}
+	start := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p.step(fmt.Sprintf("%s (%s elapsed)", msg, time.Since(start).Round(time.Second)))
+			}
+		}
+	}()
+	err := call()
+	close(done)
+	wg.Wait()
+	return err
+}
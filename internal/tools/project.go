@@ -0,0 +1,123 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// allFields selects every field of list items.
+const allFields = "*"
+
+// fieldsArgs is the fields argument of list tools.
+type fieldsArgs struct {
+	Fields []string `json:"fields,omitempty" jsonschema:"Fields of each item to return; [\"*\"] returns every field"`
+}
+
+// withFields describes the fields argument of a list tool of T items, with
+// defaults the fields returned when it is not given, and lets the items of
+// its result have any of the fields of T.
+func withFields[T any](defaults []string) schemaOption {
+	return func(in, out *jsonschema.Schema) {
+		in.Properties["fields"].Description = fmt.Sprintf(`Fields of each item to return (default %s); ["*"] returns every field. Use the get_ tools for full detail of a single item`,
+			strings.Join(defaults, ", "))
+		item, err := jsonschema.For[T](nil)
+		if err != nil {
+			panic(fmt.Sprintf("item schema: %v", err))
+		}
+		item.Required = nil
+		for _, p := range item.Properties {
+			nullable(p)
+		}
+		out.Properties["data"].Items = item
+	}
+}
+
+// fieldsArg returns the selected fields, or defaults if none are. It
+// returns nil for every field.
+func fieldsArg[T any](fields, defaults []string) ([]string, error) {
+	if len(fields) == 0 {
+		fields = defaults
+	}
+	if slices.Contains(fields, allFields) {
+		return nil, nil
+	}
+	known := jsonFields(reflect.TypeFor[T]())
+	for _, f := range fields {
+		if !slices.Contains(known, f) {
+			return nil, fmt.Errorf("unknown field %q; available fields: %s", f, strings.Join(known, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// jsonFields returns the JSON names of the fields of struct type t.
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// project returns items with only the selected fields, by default
+// defaults.
+func project[T any](items []T, fields, defaults []string) ([]map[string]any, error) {
+	fields, err := fieldsArg[T](fields, defaults)
+	if err != nil {
+		return nil, err
+	}
+	projected := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("projecting fields: %w", err)
+		}
+		var m map[string]any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("projecting fields: %w", err)
+		}
+		if fields != nil {
+			maps.DeleteFunc(m, func(k string, _ any) bool { return !slices.Contains(fields, k) })
+		}
+		projected = append(projected, m)
+	}
+	return projected, nil
+}
+
+// projectPage is project for a page of a list.
+func projectPage[T any](p *metabase.Paged[T], fields, defaults []string) (*metabase.Paged[map[string]any], error) {
+	data, err := project(p.Data, fields, defaults)
+	if err != nil {
+		return nil, err
+	}
+	return &metabase.Paged[map[string]any]{Data: data, Total: p.Total, Limit: p.Limit, Offset: p.Offset}, nil
+}
+
+// projectedItems returns a whole list of items with only the selected
+// fields.
+func projectedItems[T any](list []T, fields, defaults []string) (itemsResult[map[string]any], error) {
+	projected, err := project(list, fields, defaults)
+	if err != nil {
+		return itemsResult[map[string]any]{}, err
+	}
+	return items(projected), nil
+}
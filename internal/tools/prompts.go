@@ -0,0 +1,350 @@
+package tools
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// builtinPrompts holds the prompts every server offers, in the format of
+// prompt files.
+//
+//go:embed prompts/*.yaml
+var builtinPrompts embed.FS
+
+// Prompt is a prompt template, read from a YAML file such as:
+//
+//	name: weekly_review
+//	description: Review a card's numbers for the past week
+//	arguments:
+//	  - name: card_id
+//	    description: The card ID
+//	    required: true
+//	template: |
+//	  Review the past week of this card:
+//	  {{card .card_id}}
+//
+// The template is a Go text/template whose data maps each argument name to
+// its value, "" if not given. Its functions fetch live context from
+// Metabase when the prompt is requested:
+//
+//	database ID       the tables of a database, as DDL
+//	table ID          a table, as DDL
+//	card ID           a card's collection, SQL and parameters, as markdown
+//	dashboard ID      a dashboard's parameters and layout, as markdown
+//	events FROM TO    timeline events between two dates, as a markdown list
+type Prompt struct {
+	Name        string           `yaml:"name"`
+	Title       string           `yaml:"title"`
+	Description string           `yaml:"description"`
+	Arguments   []PromptArgument `yaml:"arguments"`
+	Template    string           `yaml:"template"`
+
+	tmpl *template.Template
+}
+
+// PromptArgument is an argument of a Prompt.
+type PromptArgument struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// promptName is the form of prompt and argument names, which templates
+// refer to as {{.name}}.
+var promptName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadPrompts reads the prompts defined by the .yaml and .yml files of dir.
+// A file's prompt is named after the file unless it has a name.
+func LoadPrompts(dir string) ([]Prompt, error) {
+	prompts, err := loadPrompts(os.DirFS(dir))
+	if err != nil {
+		return nil, fmt.Errorf("loading prompts from %s: %w", dir, err)
+	}
+	return prompts, nil
+}
+
+func loadPrompts(fsys fs.FS) ([]Prompt, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	slices.Sort(files)
+
+	var prompts []Prompt
+	seen := map[string]string{}
+	for _, file := range files {
+		p, err := readPrompt(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if other, ok := seen[p.Name]; ok {
+			return nil, fmt.Errorf("%s: prompt %q is also defined in %s", file, p.Name, other)
+		}
+		seen[p.Name] = file
+		prompts = append(prompts, p)
+	}
+	return prompts, nil
+}
+
+func readPrompt(fsys fs.FS, file string) (Prompt, error) {
+	var p Prompt
+	f, err := fsys.Open(file)
+	if err != nil {
+		return p, err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return p, err
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(file, path.Ext(file))
+	}
+	if !promptName.MatchString(p.Name) {
+		return p, fmt.Errorf("invalid prompt name %q; use letters, digits and underscores", p.Name)
+	}
+	if strings.TrimSpace(p.Template) == "" {
+		return p, errors.New("template is empty")
+	}
+	args := map[string]bool{}
+	for _, a := range p.Arguments {
+		if !promptName.MatchString(a.Name) || a.Name == "instance" {
+			return p, fmt.Errorf("invalid argument name %q", a.Name)
+		}
+		if args[a.Name] {
+			return p, fmt.Errorf("duplicate argument %q", a.Name)
+		}
+		args[a.Name] = true
+	}
+	// The functions are replaced by ones bound to the request when the
+	// prompt is rendered.
+	p.tmpl, err = template.New(p.Name).Option("missingkey=error").Funcs(promptFuncs(context.Background(), nil, resourceURI{})).Parse(p.Template)
+	if err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// registerPrompts adds the built-in prompts and extra, which replace the
+// built-in prompts of the same name.
+func registerPrompts(r *registrar, logger zerolog.Logger, extra []Prompt) {
+	var prompts []Prompt
+	dir, err := fs.Sub(builtinPrompts, "prompts")
+	if err == nil {
+		prompts, err = loadPrompts(dir)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("built-in prompts: %v", err))
+	}
+	for _, p := range extra {
+		prompts = slices.DeleteFunc(prompts, func(b Prompt) bool { return b.Name == p.Name })
+		prompts = append(prompts, p)
+	}
+	for _, p := range prompts {
+		r.addPrompt(p, logger)
+	}
+}
+
+// addPrompt adds a prompt rendered against the instance named by its
+// instance argument, which it gains when more than one instance is
+// configured.
+func (r *registrar) addPrompt(p Prompt, logger zerolog.Logger) {
+	prompt := &mcp.Prompt{Name: p.Name, Title: p.Title, Description: p.Description}
+	for _, a := range p.Arguments {
+		prompt.Arguments = append(prompt.Arguments, &mcp.PromptArgument{Name: a.Name, Description: a.Description, Required: a.Required})
+	}
+	if names := r.instances.Names(); len(names) > 1 {
+		prompt.Arguments = append(prompt.Arguments, &mcp.PromptArgument{
+			Name:        "instance",
+			Description: fmt.Sprintf("Metabase instance to use (default %q): one of %s", r.instances.Default(), strings.Join(names, ", ")),
+		})
+	}
+	r.server.AddPrompt(prompt, func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		given := req.Params.Arguments
+		instance := given["instance"]
+		client, err := r.instances.Get(instance)
+		if err != nil {
+			return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: err.Error()}
+		}
+		if instance == "" {
+			instance = r.instances.Default()
+		}
+		data := make(map[string]string, len(p.Arguments))
+		for _, a := range p.Arguments {
+			v := given[a.Name]
+			if a.Required && v == "" {
+				return nil, &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: "missing required argument: " + a.Name}
+			}
+			data[a.Name] = v
+		}
+		logger.Debug().Str("prompt", p.Name).Msg("rendering prompt")
+
+		tmpl, err := p.tmpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := tmpl.Funcs(promptFuncs(ctx, client, r.resourceURIFor("card", 0, "", instance))).Execute(&b, data); err != nil {
+			var apiErr *metabase.APIError
+			if errors.As(err, &apiErr) {
+				return nil, fmt.Errorf("prompt %s: %s", p.Name, describeAPIError(apiErr))
+			}
+			return nil, fmt.Errorf("prompt %s: %w", p.Name, err)
+		}
+		return &mcp.GetPromptResult{
+			Description: p.Description,
+			Messages: []*mcp.PromptMessage{
+				{Role: "user", Content: &mcp.TextContent{Text: strings.TrimSpace(b.String())}},
+			},
+		}, nil
+	})
+}
+
+// promptFuncs returns the template functions that fetch context from
+// client. cardURI is the URI of its cards' resources, without an ID.
+func promptFuncs(ctx context.Context, client metabase.API, cardURI resourceURI) template.FuncMap {
+	return template.FuncMap{
+		"database": func(id any) (string, error) {
+			dbID, err := templateID(id)
+			if err != nil {
+				return "", err
+			}
+			db, err := client.GetDatabaseMetadata(ctx, dbID)
+			if err != nil {
+				return "", err
+			}
+			return databaseDDL(db), nil
+		},
+		"table": func(id any) (string, error) {
+			tableID, err := templateID(id)
+			if err != nil {
+				return "", err
+			}
+			table, err := client.GetTableMetadata(ctx, tableID)
+			if err != nil {
+				return "", err
+			}
+			var b strings.Builder
+			writeTableDDL(&b, table, foreignKeyTargets(ctx, client, table))
+			return b.String(), nil
+		},
+		"card": func(id any) (string, error) {
+			cardID, err := templateID(id)
+			if err != nil {
+				return "", err
+			}
+			card, err := client.GetCard(ctx, cardID)
+			if err != nil {
+				return "", err
+			}
+			return cardSummary(ctx, client, card), nil
+		},
+		"dashboard": func(id any) (string, error) {
+			dashID, err := templateID(id)
+			if err != nil {
+				return "", err
+			}
+			dash, err := client.GetDashboard(ctx, dashID)
+			if err != nil {
+				return "", err
+			}
+			return dashboardSummary(ctx, client, dash, cardURI), nil
+		},
+		"events": func(from, to string) (string, error) {
+			return timelineEvents(ctx, client, from, to)
+		},
+	}
+}
+
+// templateID parses the ID given to a template function, such as an
+// argument value.
+func templateID(v any) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case string:
+		id, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("invalid ID %q", v)
+		}
+		return id, nil
+	default:
+		return 0, fmt.Errorf("invalid ID %v", v)
+	}
+}
+
+// timelineEvents lists the events of every timeline from one date to
+// another, both included, oldest first.
+func timelineEvents(ctx context.Context, client metabase.API, from, to string) (string, error) {
+	start, err := time.Parse(time.DateOnly, strings.TrimSpace(from))
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q; use YYYY-MM-DD", from)
+	}
+	end, err := time.Parse(time.DateOnly, strings.TrimSpace(to))
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q; use YYYY-MM-DD", to)
+	}
+	end = end.AddDate(0, 0, 1)
+
+	timelines, err := client.ListTimelines(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	type event struct {
+		at   time.Time
+		line string
+	}
+	var events []event
+	for _, tl := range timelines {
+		if tl.Archived != nil && *tl.Archived {
+			continue
+		}
+		full, err := client.GetTimeline(ctx, tl.ID)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range full.Events {
+			at, err := time.Parse(time.RFC3339Nano, e.Timestamp)
+			if err != nil || (e.Archived != nil && *e.Archived) || at.Before(start) || !at.Before(end) {
+				continue
+			}
+			line := fmt.Sprintf("- %s: %s (%s)", formatTime("type/DateTimeWithTZ", e.Timestamp), e.Name, full.Name)
+			if e.Description != nil && *e.Description != "" {
+				line += ": " + oneLine(*e.Description)
+			}
+			events = append(events, event{at, line})
+		}
+	}
+	if len(events) == 0 {
+		return "No timeline events.", nil
+	}
+	slices.SortStableFunc(events, func(a, b event) int { return a.at.Compare(b.at) })
+	lines := make([]string, len(events))
+	for i, e := range events {
+		lines[i] = e.line
+	}
+	return strings.Join(lines, "\n"), nil
+}
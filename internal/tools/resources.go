@@ -0,0 +1,451 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// resourceScheme is the URI scheme of Metabase resources.
+const resourceScheme = "metabase"
+
+// resourceHandler renders the Metabase object with the given ID as text.
+type resourceHandler func(ctx context.Context, client metabase.API, id int) (string, error)
+
+// resourceURI is a parsed metabase:// URI, such as
+// metabase://database/1/schema or metabase://table/5?instance=prod.
+type resourceURI struct {
+	// Kind is the type of object: "database" or "table".
+	Kind string
+	ID   int
+	// Suffix is the path after the ID, e.g. "/schema".
+	Suffix   string
+	Instance string
+}
+
+func parseResourceURI(uri string) (resourceURI, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != resourceScheme {
+		return resourceURI{}, fmt.Errorf("not a %s:// URI: %q", resourceScheme, uri)
+	}
+	idPart, suffix, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return resourceURI{}, fmt.Errorf("invalid ID in %q", uri)
+	}
+	if suffix != "" {
+		suffix = "/" + suffix
+	}
+	return resourceURI{Kind: u.Host, ID: id, Suffix: suffix, Instance: u.Query().Get("instance")}, nil
+}
+
+// String returns the URI, with the instance only when more than one is
+// configured.
+func (u resourceURI) String() string {
+	s := fmt.Sprintf("%s://%s/%d%s", resourceScheme, u.Kind, u.ID, u.Suffix)
+	if u.Instance != "" {
+		s += "?instance=" + url.QueryEscape(u.Instance)
+	}
+	return s
+}
+
+// resourceURIFor returns the URI of an object of the named instance.
+func (r *registrar) resourceURIFor(kind string, id int, suffix, instance string) resourceURI {
+	u := resourceURI{Kind: kind, ID: id, Suffix: suffix}
+	if len(r.instances.Names()) > 1 {
+		u.Instance = instance
+		if u.Instance == "" {
+			u.Instance = r.instances.Default()
+		}
+	}
+	return u
+}
+
+// EnableResourceSubscriptions lets clients of a server created with opts
+// subscribe to the metabase:// resources RegisterAll adds. Subscribers are
+// notified once a sync started by sync_database has changed a schema.
+func EnableResourceSubscriptions(opts *mcp.ServerOptions) {
+	opts.SubscribeHandler = func(_ context.Context, req *mcp.SubscribeRequest) error {
+		_, err := parseResourceURI(req.Params.URI)
+		return err
+	}
+	opts.UnsubscribeHandler = func(context.Context, *mcp.UnsubscribeRequest) error {
+		return nil
+	}
+}
+
+// subscriptions tracks the resource URIs the sessions of a server
+// subscribed to. A session's subscriptions are dropped when it ends.
+type subscriptions struct {
+	mu       sync.Mutex
+	sessions map[*mcp.ServerSession]map[string]bool
+}
+
+func (s *subscriptions) subscribe(session *mcp.ServerSession, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sessions == nil {
+		s.sessions = make(map[*mcp.ServerSession]map[string]bool)
+	}
+	uris, ok := s.sessions[session]
+	if !ok {
+		uris = make(map[string]bool)
+		s.sessions[session] = uris
+		go func() {
+			_ = session.Wait()
+			s.mu.Lock()
+			delete(s.sessions, session)
+			s.mu.Unlock()
+		}()
+	}
+	uris[uri] = true
+}
+
+func (s *subscriptions) unsubscribe(session *mcp.ServerSession, uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions[session], uri)
+}
+
+// list returns the URIs any session subscribed to.
+func (s *subscriptions) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, uris := range s.sessions {
+		maps.Copy(seen, uris)
+	}
+	return slices.Sorted(maps.Keys(seen))
+}
+
+func registerResources(r *registrar, logger zerolog.Logger) {
+	r.addResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "database_schema",
+		Title:       "Database schema",
+		URITemplate: "metabase://database/{id}/schema{?instance}",
+		Description: "The tables of a database as DDL-like text, with field types, semantic types and foreign keys",
+		MIMEType:    "text/plain",
+	}, "database", "/schema", func(ctx context.Context, client metabase.API, id int) (string, error) {
+		logger.Debug().Int("database_id", id).Msg("reading database schema resource")
+		db, err := client.GetDatabaseMetadata(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return databaseDDL(db), nil
+	})
+
+	r.addResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "table",
+		Title:       "Table",
+		URITemplate: "metabase://table/{id}{?instance}",
+		Description: "A table as DDL-like text, with field types, semantic types and foreign keys",
+		MIMEType:    "text/plain",
+	}, "table", "", func(ctx context.Context, client metabase.API, id int) (string, error) {
+		logger.Debug().Int("table_id", id).Msg("reading table resource")
+		table, err := client.GetTableMetadata(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		writeTableDDL(&b, table, foreignKeyTargets(ctx, client, table))
+		return b.String(), nil
+	})
+
+	registerSummaryResources(r, logger)
+
+	// resources/list offers the schema of every database the caller may
+	// see, which Metabase filters by their permissions.
+	r.server.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			result, err := next(ctx, method, req)
+			if err != nil {
+				return result, err
+			}
+			switch method {
+			case "resources/list":
+				// The databases follow the static resources, on their
+				// first page.
+				params, _ := req.GetParams().(*mcp.ListResourcesParams)
+				if list, ok := result.(*mcp.ListResourcesResult); ok && (params == nil || params.Cursor == "") {
+					list.Resources = append(list.Resources, r.databaseResources(ctx, logger)...)
+				}
+			case "resources/subscribe":
+				sub := req.(*mcp.SubscribeRequest)
+				r.subscriptions.subscribe(sub.Session, sub.Params.URI)
+			case "resources/unsubscribe":
+				unsub := req.(*mcp.UnsubscribeRequest)
+				r.subscriptions.unsubscribe(unsub.Session, unsub.Params.URI)
+			}
+			return result, nil
+		}
+	})
+}
+
+// addResourceTemplate adds a template for the URIs of kind objects, with
+// suffix after their ID.
+func (r *registrar) addResourceTemplate(t *mcp.ResourceTemplate, kind, suffix string, handler resourceHandler) {
+	r.server.AddResourceTemplate(t, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		uri := req.Params.URI
+		parsed, err := parseResourceURI(uri)
+		if err != nil || parsed.Kind != kind || parsed.Suffix != suffix {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		client, err := r.instances.Get(parsed.Instance)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Instance == "" {
+			parsed.Instance = r.instances.Default()
+		}
+		text, err := handler(withInstance(ctx, parsed.Instance), client, parsed.ID)
+		if metabase.IsNotFound(err) {
+			return nil, mcp.ResourceNotFoundError(uri)
+		}
+		var apiErr *metabase.APIError
+		if errors.As(err, &apiErr) {
+			return nil, errors.New(describeAPIError(apiErr))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{
+			{URI: uri, MIMEType: t.MIMEType, Text: text},
+		}}, nil
+	})
+}
+
+// databaseResources lists the schema resources of the databases of every
+// instance. Instances that fail are left out.
+func (r *registrar) databaseResources(ctx context.Context, logger zerolog.Logger) []*mcp.Resource {
+	var resources []*mcp.Resource
+	for _, name := range r.instances.Names() {
+		client, _ := r.instances.Get(name)
+		dbs, err := client.ListDatabases(ctx)
+		if err != nil {
+			logger.Warn().Err(err).Str("instance", name).Msg("listing database resources failed")
+			continue
+		}
+		for _, db := range dbs {
+			resources = append(resources, &mcp.Resource{
+				URI:         r.resourceURIFor("database", db.ID, "/schema", name).String(),
+				Name:        db.Name + " schema",
+				Description: fmt.Sprintf("Tables and fields of the %s database %q", db.Engine, db.Name),
+				MIMEType:    "text/plain",
+			})
+		}
+	}
+	return resources
+}
+
+// Metabase syncs a database in the background and does not tell when it is
+// done, so watchSync polls the schema every syncPollInterval for up to
+// syncWatchTimeout.
+var (
+	syncPollInterval = 5 * time.Second
+	syncWatchTimeout = 10 * time.Minute
+)
+
+// schemaSnapshot returns the schema of a database as its resource renders
+// it, or "" if there are no subscribers to notify of changes or the schema
+// cannot be read.
+func (r *registrar) schemaSnapshot(ctx context.Context, client metabase.API, databaseID int) string {
+	if len(r.subscriptions.list()) == 0 {
+		return ""
+	}
+	db, err := client.GetDatabaseMetadata(ctx, databaseID)
+	if err != nil {
+		return ""
+	}
+	return databaseDDL(db)
+}
+
+// watchSync notifies subscribers once the sync of a database has changed its
+// schema from before, as returned by schemaSnapshot when the sync was
+// started, and the schema has stopped changing. It returns at once; the
+// watch ends early when nobody is subscribed any more or the server shuts
+// down.
+func (r *registrar) watchSync(ctx context.Context, client metabase.API, databaseID int, before string, logger zerolog.Logger) {
+	if len(r.subscriptions.list()) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := func() bool { return true }
+	if r.shutdown != nil {
+		stop = context.AfterFunc(r.shutdown, cancel)
+	}
+	go func() {
+		defer stop()
+		defer cancel()
+		ticker := time.NewTicker(syncPollInterval)
+		defer ticker.Stop()
+		deadline := time.After(syncWatchTimeout)
+		last := before
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-deadline:
+				if last != before {
+					r.schemaChanged(ctx, client, databaseID, logger)
+				}
+				return
+			case <-ticker.C:
+			}
+			if len(r.subscriptions.list()) == 0 {
+				return
+			}
+			db, err := client.GetDatabaseMetadata(ctx, databaseID)
+			if err != nil {
+				logger.Debug().Err(err).Int("database_id", databaseID).Msg("polling schema after sync failed")
+				continue
+			}
+			current := databaseDDL(db)
+			if current != before && current == last {
+				logger.Debug().Int("database_id", databaseID).Msg("schema changed by sync")
+				r.schemaChanged(ctx, client, databaseID, logger)
+				return
+			}
+			last = current
+		}
+	}()
+}
+
+// schemaChanged notifies subscribers to the schema of a database, and to
+// its tables, of the instance of the tool call.
+func (r *registrar) schemaChanged(ctx context.Context, client metabase.API, databaseID int, logger zerolog.Logger) {
+	schema := r.resourceURIFor("database", databaseID, "/schema", instanceFromContext(ctx))
+	for _, uri := range r.subscriptions.list() {
+		parsed, err := parseResourceURI(uri)
+		if err != nil || parsed.Instance != schema.Instance {
+			continue
+		}
+		switch {
+		case parsed.Kind == "database" && parsed.ID == databaseID:
+		case parsed.Kind == "table":
+			table, err := client.GetTable(ctx, parsed.ID)
+			if err != nil || table.DBID != databaseID {
+				continue
+			}
+		default:
+			continue
+		}
+		if err := r.server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri}); err != nil {
+			logger.Warn().Err(err).Str("uri", uri).Msg("notifying resource subscribers failed")
+		}
+	}
+}
+
+// fieldRefs names fields by ID for foreign keys, e.g. "PUBLIC.PEOPLE(ID)".
+type fieldRefs map[int]string
+
+// databaseDDL renders the tables of db, as returned by GetDatabaseMetadata.
+func databaseDDL(db *metabase.Database) string {
+	refs := fieldRefs{}
+	for _, t := range db.Tables {
+		for _, f := range t.Fields {
+			refs[f.ID] = fmt.Sprintf("%s(%s)", qualifiedName(&t), f.Name)
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- database %d: %s (%s)\n", db.ID, db.Name, db.Engine)
+	for i := range db.Tables {
+		b.WriteString("\n")
+		writeTableDDL(&b, &db.Tables[i], refs)
+	}
+	return b.String()
+}
+
+// foreignKeyTargets names the fields the foreign keys of table point at,
+// looking up the fields and tables outside table. Targets that cannot be
+// looked up are left out.
+func foreignKeyTargets(ctx context.Context, client metabase.API, table *metabase.Table) fieldRefs {
+	refs := fieldRefs{}
+	for _, f := range table.Fields {
+		refs[f.ID] = fmt.Sprintf("%s(%s)", qualifiedName(table), f.Name)
+	}
+	tables := map[int]*metabase.Table{table.ID: table}
+	for _, f := range table.Fields {
+		if f.FKTargetFieldID == nil {
+			continue
+		}
+		if _, ok := refs[*f.FKTargetFieldID]; ok {
+			continue
+		}
+		target, err := client.GetField(ctx, *f.FKTargetFieldID)
+		if err != nil {
+			continue
+		}
+		t, ok := tables[target.TableID]
+		if !ok {
+			if t, err = client.GetTable(ctx, target.TableID); err != nil {
+				continue
+			}
+			tables[target.TableID] = t
+		}
+		refs[target.ID] = fmt.Sprintf("%s(%s)", qualifiedName(t), target.Name)
+	}
+	return refs
+}
+
+func qualifiedName(t *metabase.Table) string {
+	if t.Schema != nil && *t.Schema != "" {
+		return *t.Schema + "." + t.Name
+	}
+	return t.Name
+}
+
+// writeTableDDL renders a table as a CREATE TABLE statement with a comment
+// per field giving its ID and semantic type, e.g.
+//
+//	CREATE TABLE PUBLIC.ORDERS ( -- table 3 "Orders"
+//	  USER_ID INTEGER REFERENCES PUBLIC.PEOPLE(ID), -- field 12, FK
+//	);
+func writeTableDDL(b *strings.Builder, t *metabase.Table, refs fieldRefs) {
+	fmt.Fprintf(b, "CREATE TABLE %s ( -- table %d", qualifiedName(t), t.ID)
+	if t.DisplayName != nil && *t.DisplayName != "" {
+		fmt.Fprintf(b, " %q", *t.DisplayName)
+	}
+	if t.Description != nil && *t.Description != "" {
+		b.WriteString(": " + oneLine(*t.Description))
+	}
+	b.WriteString("\n")
+	for _, f := range t.Fields {
+		typ := f.DatabaseType
+		if typ == "" {
+			typ = strings.TrimPrefix(f.BaseType, "type/")
+		}
+		fmt.Fprintf(b, "  %s %s", f.Name, typ)
+		if f.FKTargetFieldID != nil {
+			if ref, ok := refs[*f.FKTargetFieldID]; ok {
+				b.WriteString(" REFERENCES " + ref)
+			} else {
+				fmt.Fprintf(b, " REFERENCES field %d", *f.FKTargetFieldID)
+			}
+		}
+		fmt.Fprintf(b, ", -- field %d", f.ID)
+		if f.SemanticType != nil && *f.SemanticType != "" {
+			b.WriteString(", " + strings.TrimPrefix(*f.SemanticType, "type/"))
+		}
+		if f.Description != nil && *f.Description != "" {
+			b.WriteString(": " + oneLine(*f.Description))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(");\n")
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -9,24 +9,34 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerSearchTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "search", "Search across all Metabase entities (cards, dashboards, collections, tables)",
-		inputSchema(map[string]any{
-			"query":  map[string]any{"type": "string", "description": "Search query string"},
-			"models": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Filter by model types: card, dashboard, collection, table, database, action"},
-		}, []string{"query"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+// searchFields are the search result fields search returns by default.
+var searchFields = []string{"id", "name", "model", "collection_id"}
+
+type searchArgs struct {
+	Query  string   `json:"query" jsonschema:"Search query string"`
+	Models []string `json:"models,omitempty" jsonschema:"Filter by model types: card, dashboard, collection, table, database, action"`
+	pageArgs
+	fieldsArgs
+}
+
+func registerSearchTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "search", "Search across all Metabase entities (cards, dashboards, collections, tables), a page of results at a time",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args searchArgs) (*mcp.CallToolResult, *listResult[map[string]any], error) {
+			page, err := args.page()
+			if err != nil {
+				return nil, nil, err
+			}
+			logger.Debug().Str("query", args.Query).Int("limit", page.Limit).Int("offset", page.Offset).Msg("searching")
+			result, err := client.Search(ctx, args.Query, args.Models, page)
+			if err != nil {
+				return nil, nil, err
 			}
-			query, _ := stringArg(args, "query")
-			models := stringSliceArg(args, "models")
-			logger.Debug().Str("query", query).Msg("searching")
-			result, err := client.Search(query, models)
+			projected, err := projectPage(result, args.Fields, searchFields)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(result)
-		})
+			return linked(pagedResult(projected, "results"), itemLinks(ctx, r, result.Data, func(s metabase.SearchResult) (string, int, string) {
+				return s.Model, s.ID, s.Name
+			})...)
+		}, withFields[metabase.SearchResult](searchFields))
 }
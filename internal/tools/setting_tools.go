@@ -9,33 +9,32 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerSettingTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_settings", "List all Metabase settings (admin only)",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// settingFields are the setting fields list_settings returns by default.
+var settingFields = []string{"key", "value"}
+
+type settingKeyArgs struct {
+	Key string `json:"key" jsonschema:"Setting key (e.g. 'site-name', 'admin-email')"`
+}
+
+func registerSettingTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_settings", "List all Metabase settings (admin only)",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args fieldsArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
 			logger.Debug().Msg("listing settings")
-			settings, err := client.ListSettings()
+			settings, err := client.ListSettings(ctx)
 			if err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			return marshalResult(settings)
-		})
+			result, err := projectedItems(settings, args.Fields, settingFields)
+			return nil, result, err
+		}, withFields[metabase.Setting](settingFields))
 
-	addTool(server, "get_setting", "Get a specific Metabase setting value",
-		inputSchema(map[string]any{
-			"key": map[string]any{"type": "string", "description": "Setting key (e.g. 'site-name', 'admin-email')"},
-		}, []string{"key"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			key, _ := stringArg(args, "key")
-			logger.Debug().Str("key", key).Msg("getting setting")
-			val, err := client.GetSetting(key)
+	addTool(r, "get_setting", "Get a specific Metabase setting value",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args settingKeyArgs) (*mcp.CallToolResult, *metabase.Setting, error) {
+			logger.Debug().Str("key", args.Key).Msg("getting setting")
+			val, err := client.GetSetting(ctx, args.Key)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(val)
+			return nil, &metabase.Setting{Key: args.Key, Value: val}, nil
 		})
 }
@@ -0,0 +1,232 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/rs/zerolog"
+
+	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+)
+
+// maxCollectionDepth bounds the walk up a collection's parents.
+const maxCollectionDepth = 10
+
+func registerSummaryResources(r *registrar, logger zerolog.Logger) {
+	r.addResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "card",
+		Title:       "Card",
+		URITemplate: "metabase://card/{id}{?instance}",
+		Description: "A saved question: its collection, display, SQL and parameters, as markdown",
+		MIMEType:    "text/markdown",
+	}, "card", "", func(ctx context.Context, client metabase.API, id int) (string, error) {
+		logger.Debug().Int("card_id", id).Msg("reading card resource")
+		card, err := client.GetCard(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return cardSummary(ctx, client, card), nil
+	})
+
+	r.addResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "dashboard",
+		Title:       "Dashboard",
+		URITemplate: "metabase://dashboard/{id}{?instance}",
+		Description: "A dashboard: its collection, parameters and the layout of its cards, as markdown",
+		MIMEType:    "text/markdown",
+	}, "dashboard", "", func(ctx context.Context, client metabase.API, id int) (string, error) {
+		logger.Debug().Int("dashboard_id", id).Msg("reading dashboard resource")
+		dash, err := client.GetDashboard(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return dashboardSummary(ctx, client, dash, r.resourceURIFor("card", 0, "", instanceFromContext(ctx))), nil
+	})
+}
+
+// link returns a resource_link to the metabase:// resource of a card or
+// dashboard of the instance of the tool call.
+func (r *registrar) link(ctx context.Context, kind string, id int, name string) *mcp.ResourceLink {
+	return &mcp.ResourceLink{
+		URI:      r.resourceURIFor(kind, id, "", instanceFromContext(ctx)).String(),
+		Name:     name,
+		Title:    fmt.Sprintf("%s %d: %s", kind, id, name),
+		MIMEType: "text/markdown",
+	}
+}
+
+// itemLinks returns links to the cards and dashboards among items, such as
+// search results; item returns the model, ID and name of each.
+func itemLinks[T any](ctx context.Context, r *registrar, items []T, item func(T) (model string, id int, name string)) []*mcp.ResourceLink {
+	var links []*mcp.ResourceLink
+	for _, it := range items {
+		model, id, name := item(it)
+		switch model {
+		case "card", "dataset", "metric":
+			links = append(links, r.link(ctx, "card", id, name))
+		case "dashboard":
+			links = append(links, r.link(ctx, "dashboard", id, name))
+		}
+	}
+	return links
+}
+
+// linked returns out, as JSON text followed by links, as the result of a
+// tool.
+func linked[T any](out T, links ...*mcp.ResourceLink) (*mcp.CallToolResult, T, error) {
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, out, fmt.Errorf("marshaling result: %w", err)
+	}
+	result := textResult(string(data))
+	for _, l := range links {
+		result.Content = append(result.Content, l)
+	}
+	return result, out, nil
+}
+
+// collectionPath names a collection and its parents, e.g.
+// "Our analytics / Sales / Drafts". Collections that cannot be read are
+// shown by ID.
+func collectionPath(ctx context.Context, client metabase.API, id *int) string {
+	var names []string
+	seen := map[int]bool{}
+	for id != nil && !seen[*id] && len(names) < maxCollectionDepth {
+		seen[*id] = true
+		c, err := client.GetCollection(ctx, strconv.Itoa(*id))
+		if err != nil {
+			names = append(names, fmt.Sprintf("collection %d", *id))
+			break
+		}
+		names = append(names, c.Name)
+		id = c.ParentID
+	}
+	names = append(names, "Our analytics")
+	slices.Reverse(names)
+	return strings.Join(names, " / ")
+}
+
+// cardSummary renders a card as markdown. The SQL of MBQL cards is their
+// native form as compiled by Metabase, or the MBQL if that fails.
+func cardSummary(ctx context.Context, client metabase.API, card *metabase.Card) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", card.Name)
+	fmt.Fprintf(&b, "Card %d in %s", card.ID, collectionPath(ctx, client, card.CollectionID))
+	if card.Display != "" {
+		fmt.Fprintf(&b, ", shown as %s", card.Display)
+	}
+	b.WriteString(".\n")
+	if card.Description != nil && *card.Description != "" {
+		b.WriteString("\n" + *card.Description + "\n")
+	}
+
+	var query metabase.DatasetQueryRequest
+	if data, err := json.Marshal(card.DatasetQuery); err == nil {
+		_ = json.Unmarshal(data, &query)
+	}
+	b.WriteString("\n## Query\n\n")
+	switch {
+	case query.Native != nil:
+		fmt.Fprintf(&b, "Native query on database %d:\n\n```sql\n%s\n```\n", query.Database, strings.TrimSpace(query.Native.Query))
+	case query.Query != nil:
+		if form, err := client.CompileNativeQuery(ctx, &query); err == nil && form.Query != "" {
+			fmt.Fprintf(&b, "Query builder question on database %d, which runs:\n\n```sql\n%s\n```\n", query.Database, strings.TrimSpace(form.Query))
+		} else {
+			mbql, _ := json.Marshal(query.Query)
+			fmt.Fprintf(&b, "Query builder question on database %d:\n\n```json\n%s\n```\n", query.Database, mbql)
+		}
+	default:
+		b.WriteString("None.\n")
+	}
+
+	if query.Native != nil && len(query.Native.TemplateTags) > 0 {
+		b.WriteString("\n## Parameters\n\n")
+		for _, name := range slices.Sorted(maps.Keys(query.Native.TemplateTags)) {
+			tag, _ := query.Native.TemplateTags[name].(map[string]any)
+			fmt.Fprintf(&b, "- `%s`", name)
+			var details []string
+			if t, _ := tag["type"].(string); t != "" {
+				details = append(details, t)
+			}
+			if d, _ := tag["display-name"].(string); d != "" {
+				details = append(details, strconv.Quote(d))
+			}
+			if len(details) > 0 {
+				b.WriteString(" (" + strings.Join(details, ", ") + ")")
+			}
+			if required, _ := tag["required"].(bool); required {
+				b.WriteString(", required")
+			}
+			if def, ok := tag["default"]; ok && def != nil {
+				data, _ := json.Marshal(def)
+				fmt.Fprintf(&b, ", default %s", data)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// dashboardSummary renders a dashboard as markdown. cardURI is the URI of
+// its cards' resources, without an ID.
+func dashboardSummary(ctx context.Context, client metabase.API, dash *metabase.Dashboard, cardURI resourceURI) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", dash.Name)
+	fmt.Fprintf(&b, "Dashboard %d in %s.\n", dash.ID, collectionPath(ctx, client, dash.CollectionID))
+	if dash.Description != nil && *dash.Description != "" {
+		b.WriteString("\n" + *dash.Description + "\n")
+	}
+
+	if len(dash.Parameters) > 0 {
+		b.WriteString("\n## Parameters\n\n")
+		for _, p := range dash.Parameters {
+			name, _ := p["name"].(string)
+			slug, _ := p["slug"].(string)
+			typ, _ := p["type"].(string)
+			fmt.Fprintf(&b, "- %s (`%s`, %s)\n", name, slug, typ)
+		}
+	}
+
+	dashcards := dash.DashCards
+	if len(dashcards) == 0 {
+		dashcards = dash.OrderedCards
+	}
+	b.WriteString("\n## Layout\n\n")
+	if len(dashcards) == 0 {
+		b.WriteString("No cards.\n")
+		return b.String()
+	}
+	dashcards = slices.Clone(dashcards)
+	slices.SortStableFunc(dashcards, func(a, b metabase.DashCard) int {
+		if a.Row != b.Row {
+			return a.Row - b.Row
+		}
+		return a.Col - b.Col
+	})
+	b.WriteString("Cards by position on the 24-column grid, as row, column: width x height.\n\n")
+	names := map[int]string{}
+	for _, dc := range dashcards {
+		fmt.Fprintf(&b, "- %d, %d: %dx%d ", dc.Row, dc.Col, dc.SizeX, dc.SizeY)
+		if dc.CardID == nil {
+			b.WriteString("text or heading\n")
+			continue
+		}
+		name, ok := names[*dc.CardID]
+		if !ok {
+			name = fmt.Sprintf("card %d", *dc.CardID)
+			if card, err := client.GetCard(ctx, *dc.CardID); err == nil {
+				name = card.Name
+			}
+			names[*dc.CardID] = name
+		}
+		cardURI.ID = *dc.CardID
+		fmt.Fprintf(&b, "%s (%s)\n", name, cardURI)
+	}
+	return b.String()
+}
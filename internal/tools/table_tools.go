@@ -9,88 +9,48 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerTableTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_tables", "List all tables for a database",
-		inputSchema(map[string]any{
-			"database_id": map[string]any{"type": "number", "description": "The database ID"},
-		}, []string{"database_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "database_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("database_id", id).Msg("listing tables")
-			tables, err := client.ListTables(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(tables)
-		})
+// tableFields are the table fields list_tables returns by default.
+var tableFields = []string{"id", "name", "display_name", "schema", "db_id"}
 
-	addTool(server, "get_table", "Get table details by ID",
-		inputSchema(map[string]any{
-			"table_id": map[string]any{"type": "number", "description": "The table ID"},
-		}, []string{"table_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "table_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("table_id", id).Msg("getting table")
-			table, err := client.GetTable(id)
+type listTablesArgs struct {
+	databaseIDArgs
+	fieldsArgs
+}
+
+type tableIDArgs struct {
+	TableID int `json:"table_id" jsonschema:"The table ID"`
+}
+
+func registerTableTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_tables", "List all tables for a database",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args listTablesArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
+			logger.Debug().Int("database_id", args.DatabaseID).Msg("listing tables")
+			tables, err := client.ListTables(ctx, args.DatabaseID)
 			if err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			return marshalResult(table)
+			result, err := projectedItems(tables, args.Fields, tableFields)
+			return nil, result, err
+		}, withFields[metabase.Table](tableFields))
+
+	addTool(r, "get_table", "Get table details by ID",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args tableIDArgs) (*mcp.CallToolResult, *metabase.Table, error) {
+			logger.Debug().Int("table_id", args.TableID).Msg("getting table")
+			table, err := client.GetTable(ctx, args.TableID)
+			return nil, table, err
 		})
 
-	addTool(server, "get_table_metadata", "Get table metadata with all fields and foreign keys. Essential for understanding table structure before building queries.",
-		inputSchema(map[string]any{
-			"table_id": map[string]any{"type": "number", "description": "The table ID"},
-		}, []string{"table_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "table_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("table_id", id).Msg("getting table metadata")
-			table, err := client.GetTableMetadata(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(table)
+	addTool(r, "get_table_metadata", "Get table metadata with all fields and foreign keys. Essential for understanding table structure before building queries.",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args tableIDArgs) (*mcp.CallToolResult, *metabase.Table, error) {
+			logger.Debug().Int("table_id", args.TableID).Msg("getting table metadata")
+			table, err := client.GetTableMetadata(ctx, args.TableID)
+			return nil, table, err
 		})
 
-	addTool(server, "get_table_fks", "Get foreign key relationships for a table",
-		inputSchema(map[string]any{
-			"table_id": map[string]any{"type": "number", "description": "The table ID"},
-		}, []string{"table_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "table_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("table_id", id).Msg("getting table foreign keys")
-			fks, err := client.GetTableForeignKeys(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(fks)
+	addTool(r, "get_table_fks", "Get foreign key relationships for a table",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args tableIDArgs) (*mcp.CallToolResult, itemsResult[metabase.ForeignKey], error) {
+			logger.Debug().Int("table_id", args.TableID).Msg("getting table foreign keys")
+			fks, err := client.GetTableForeignKeys(ctx, args.TableID)
+			return nil, items(fks), err
 		})
 }
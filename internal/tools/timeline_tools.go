@@ -9,41 +9,34 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerTimelineTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_timelines", "List all timelines with optional collection filter",
-		inputSchema(map[string]any{
-			"collection_id": map[string]any{"type": "number", "description": "Optional collection ID filter"},
-		}, nil),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			_ = parseArgs(req, &args)
-			colID := optionalIntArg(args, "collection_id")
+// timelineFields are the timeline fields list_timelines returns by default.
+var timelineFields = []string{"id", "name", "collection_id", "default", "archived"}
+
+type listTimelinesArgs struct {
+	CollectionID *int `json:"collection_id,omitempty" jsonschema:"Optional collection ID filter"`
+	fieldsArgs
+}
+
+type timelineIDArgs struct {
+	TimelineID int `json:"timeline_id" jsonschema:"The timeline ID"`
+}
+
+func registerTimelineTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_timelines", "List all timelines with optional collection filter",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args listTimelinesArgs) (*mcp.CallToolResult, itemsResult[map[string]any], error) {
 			logger.Debug().Msg("listing timelines")
-			timelines, err := client.ListTimelines(colID)
+			timelines, err := client.ListTimelines(ctx, args.CollectionID)
 			if err != nil {
-				return errResult(err)
+				return nil, itemsResult[map[string]any]{}, err
 			}
-			return marshalResult(timelines)
-		})
+			result, err := projectedItems(timelines, args.Fields, timelineFields)
+			return nil, result, err
+		}, withFields[metabase.Timeline](timelineFields))
 
-	addTool(server, "get_timeline", "Get timeline by ID with events",
-		inputSchema(map[string]any{
-			"timeline_id": map[string]any{"type": "number", "description": "The timeline ID"},
-		}, []string{"timeline_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
-			}
-			id, err := intArg(args, "timeline_id")
-			if err != nil {
-				return errResult(err)
-			}
-			logger.Debug().Int("timeline_id", id).Msg("getting timeline")
-			tl, err := client.GetTimeline(id)
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(tl)
+	addTool(r, "get_timeline", "Get timeline by ID with events",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args timelineIDArgs) (*mcp.CallToolResult, *metabase.Timeline, error) {
+			logger.Debug().Int("timeline_id", args.TimelineID).Msg("getting timeline")
+			tl, err := client.GetTimeline(ctx, args.TimelineID)
+			return nil, tl, err
 		})
 }
@@ -3,45 +3,157 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
 
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rs/zerolog"
 
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-// RegisterAll registers all Metabase tools on the given MCP server.
-func RegisterAll(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	registerCardTools(server, client, logger)
-	registerDashboardTools(server, client, logger)
-	registerCollectionTools(server, client, logger)
-	registerDatabaseTools(server, client, logger)
-	registerTableTools(server, client, logger)
-	registerFieldTools(server, client, logger)
-	registerDatasetTools(server, client, logger)
-	registerUserTools(server, client, logger)
-	registerPermissionTools(server, client, logger)
-	registerSearchTools(server, client, logger)
-	registerAlertTools(server, client, logger)
-	registerSettingTools(server, client, logger)
-	registerActivityTools(server, client, logger)
-	registerActionTools(server, client, logger)
-	registerTimelineTools(server, client, logger)
-	registerCacheTools(server, client, logger)
-}
-
-// marshalResult marshals a value to JSON and returns it as a CallToolResult.
-func marshalResult(v any) (*mcp.CallToolResult, error) {
-	data, err := json.MarshalIndent(v, "", "  ")
-	if err != nil {
-		return nil, fmt.Errorf("marshaling result: %w", err)
+// Default row limits applied when Options leaves them unset.
+const (
+	DefaultRowLimit    = 200
+	DefaultMaxRowLimit = 2000
+)
+
+// Options configures tool behavior that is set by the server operator rather
+// than by tool arguments.
+type Options struct {
+	// RowLimit is the number of rows query tools return unless the caller
+	// asks for a different max_rows.
+	RowLimit int
+	// MaxRowLimit is the largest max_rows a caller may request.
+	MaxRowLimit int
+
+	// EnableTools, if not empty, restricts the registered tools to those
+	// matching one of its patterns. A pattern is a category name (see
+	// Categories) or a glob on tool names, such as "get_*".
+	EnableTools []string
+	// DisableTools excludes the tools matching any of its patterns.
+	DisableTools []string
+	// ReadOnly registers only tools that do not modify Metabase.
+	ReadOnly bool
+
+	// Prompts are offered besides the built-in prompts, replacing those of
+	// the same name; see LoadPrompts.
+	Prompts []Prompt
+
+	// Jobs runs the tool calls made in async mode. Servers sharing it share
+	// its workers. If nil, each server gets its own with the defaults.
+	Jobs *Jobs
+
+	// Shutdown, if set, aborts in-flight tool calls when it is done. Tool
+	// calls are otherwise only cancelled by the client, as HTTP sessions
+	// outlive the requests that carry them.
+	Shutdown context.Context
+}
+
+// withDefaults fills unset fields with their defaults.
+func (o Options) withDefaults() Options {
+	if o.RowLimit <= 0 {
+		o.RowLimit = DefaultRowLimit
 	}
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{Text: string(data)},
-		},
-	}, nil
+	if o.MaxRowLimit <= 0 {
+		o.MaxRowLimit = DefaultMaxRowLimit
+	}
+	if o.MaxRowLimit < o.RowLimit {
+		o.MaxRowLimit = o.RowLimit
+	}
+	if o.Jobs == nil {
+		o.Jobs = NewJobs(0, 0)
+	}
+	return o
+}
+
+// RegisterAll registers all Metabase tools, the metabase:// resources and
+// the prompts on the given MCP server. Each tool runs against the instance named by its
+// instance argument, or the default instance.
+// Tools excluded by the EnableTools, DisableTools and ReadOnly options are
+// not registered.
+func RegisterAll(server *mcp.Server, instances *Instances, logger zerolog.Logger, opts Options) {
+	registerAll(server, instances, logger, opts)
+}
+
+func registerAll(server *mcp.Server, instances *Instances, logger zerolog.Logger, opts Options) *registrar {
+	opts = opts.withDefaults()
+	r := &registrar{server: server, instances: instances, logger: logger, filter: newToolFilter(opts), shutdown: opts.Shutdown, jobs: opts.Jobs}
+	r.group("instances", func() { registerInstanceTools(r, logger) })
+	r.group("cards", func() { registerCardTools(r, logger, opts) })
+	r.group("dashboards", func() { registerDashboardTools(r, logger) })
+	r.group("collections", func() { registerCollectionTools(r, logger) })
+	r.group("databases", func() { registerDatabaseTools(r, logger) })
+	r.group("tables", func() { registerTableTools(r, logger) })
+	r.group("fields", func() { registerFieldTools(r, logger) })
+	r.group("queries", func() { registerDatasetTools(r, logger, opts) })
+	r.group("users", func() { registerUserTools(r, logger) })
+	r.group("permissions", func() { registerPermissionTools(r, logger) })
+	r.group("search", func() { registerSearchTools(r, logger) })
+	r.group("alerts", func() { registerAlertTools(r, logger) })
+	r.group("settings", func() { registerSettingTools(r, logger) })
+	r.group("activity", func() { registerActivityTools(r, logger) })
+	r.group("actions", func() { registerActionTools(r, logger) })
+	r.group("timelines", func() { registerTimelineTools(r, logger) })
+	r.group("cache", func() { registerCacheTools(r, logger) })
+	r.group("jobs", func() { registerJobTools(r, logger) })
+	r.argumentErrors()
+	registerResources(r, logger)
+	registerPrompts(r, logger, opts.Prompts)
+	return r
+}
+
+// rowLimit returns the number of rows a query tool should return, honouring
+// the optional max_rows argument up to the configured ceiling.
+func (o Options) rowLimit(maxRows *int) (int, error) {
+	if maxRows == nil {
+		return o.RowLimit, nil
+	}
+	if *maxRows < 1 {
+		return 0, fmt.Errorf("max_rows must be at least 1")
+	}
+	return min(*maxRows, o.MaxRowLimit), nil
+}
+
+// withMaxRows describes the max_rows argument of query tools.
+func (o Options) withMaxRows() schemaOption {
+	return func(in, _ *jsonschema.Schema) {
+		in.Properties["max_rows"].Description = fmt.Sprintf("Maximum number of rows to return (default %d, at most %d)", o.RowLimit, o.MaxRowLimit)
+	}
+}
+
+// queryResult is a query response with truncation details added.
+type queryResult struct {
+	*metabase.DatasetQueryResponse
+	Truncated bool   `json:"truncated,omitempty"`
+	Notice    string `json:"notice,omitempty"`
+}
+
+// truncateResult cuts resp down to limit rows. limited reports whether the
+// query itself was capped at limit+1 rows, in which case row_count is not
+// the real total and the notice says so. row_count is left as reported by
+// Metabase.
+func truncateResult(resp *metabase.DatasetQueryResponse, limit int, limited bool) *queryResult {
+	result := &queryResult{DatasetQueryResponse: resp}
+	total := max(resp.RowCount, len(resp.Data.Rows))
+	if len(resp.Data.Rows) <= limit {
+		return result
+	}
+	resp.Data.Rows = resp.Data.Rows[:limit]
+	result.Truncated = true
+	if limited && total <= limit+1 {
+		result.Notice = fmt.Sprintf("truncated, %d of more than %d rows shown", limit, limit)
+	} else {
+		result.Notice = fmt.Sprintf("truncated, %d of %d rows shown", limit, total)
+	}
+	result.Notice += "; narrow the query, aggregate, or pass a larger max_rows"
+	return result
 }
 
 // textResult creates a CallToolResult with a text message.
@@ -53,144 +165,306 @@ func textResult(msg string) *mcp.CallToolResult {
 	}
 }
 
-// errResult creates a CallToolResult representing an error.
-func errResult(err error) (*mcp.CallToolResult, error) {
-	return &mcp.CallToolResult{
-		Content: []mcp.Content{
-			&mcp.TextContent{Text: err.Error()},
-		},
-		IsError: true,
-	}, nil
+// messageResult is the structured result of tools that return no Metabase
+// object.
+type messageResult struct {
+	Message string `json:"message"`
 }
 
-// inputSchema creates a JSON schema object for tool input.
-func inputSchema(properties map[string]any, required []string) json.RawMessage {
-	schema := map[string]any{
-		"type":       "object",
-		"properties": properties,
-	}
-	if len(required) > 0 {
-		schema["required"] = required
+// done returns msg as the result of a tool that returns no Metabase object.
+func done(msg string) (*mcp.CallToolResult, messageResult, error) {
+	return textResult(msg), messageResult{Message: msg}, nil
+}
+
+// itemsResult is a whole list as returned to the client.
+type itemsResult[T any] struct {
+	Data []T `json:"data"`
+}
+
+// items returns a whole list of items.
+func items[T any](data []T) itemsResult[T] {
+	if data == nil {
+		data = []T{}
 	}
-	data, _ := json.Marshal(schema)
-	return data
+	return itemsResult[T]{Data: data}
 }
 
-// parseArgs unmarshals the tool arguments from the request.
-func parseArgs(req *mcp.CallToolRequest, v any) error {
-	if req.Params.Arguments == nil {
+// toolError replaces Metabase API errors by a short description the model
+// can act on.
+func toolError(err error) error {
+	if err == nil {
 		return nil
 	}
-	return json.Unmarshal(req.Params.Arguments, v)
+	msg := err.Error()
+	var apiErr *metabase.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		msg = strings.Replace(msg, apiErr.Error(), describeAPIError(apiErr), 1)
+	case errors.Is(err, metabase.ErrCircuitOpen):
+		msg = "Metabase is unavailable after repeated failures; try again later"
+	default:
+		return err
+	}
+	return errors.New(msg)
 }
 
-// intArg extracts an integer argument from the parsed args map.
-func intArg(args map[string]any, key string) (int, error) {
-	v, ok := args[key]
-	if !ok {
-		return 0, fmt.Errorf("missing required argument: %s", key)
+// describeAPIError summarizes a Metabase API error, e.g. "card 42 not
+// found", leaving out response bodies.
+func describeAPIError(e *metabase.APIError) string {
+	res := e.Resource()
+	var msg string
+	switch {
+	case e.QueryFailed() && metabase.IsForbidden(e):
+		msg = "permission denied running the query"
+	case e.QueryFailed():
+		msg = "query failed"
+	case metabase.IsNotFound(e):
+		if res != "" {
+			return res + " not found"
+		}
+		return fmt.Sprintf("not found: %s %s", e.Method, e.Endpoint)
+	case metabase.IsUnauthorized(e):
+		return "Metabase rejected the credentials (status 401); check the API key or session"
+	case metabase.IsForbidden(e):
+		msg = "permission denied"
+	case e.StatusCode == http.StatusBadRequest:
+		msg = "invalid request"
+	case metabase.IsRetryable(e):
+		msg = fmt.Sprintf("Metabase is unavailable (status %d)", e.StatusCode)
+	default:
+		msg = fmt.Sprintf("Metabase error (status %d)", e.StatusCode)
+	}
+	if res != "" && !e.QueryFailed() {
+		msg += " for " + res
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
 	}
-	// JSON numbers are float64
-	f, ok := v.(float64)
-	if !ok {
-		return 0, fmt.Errorf("argument %s must be a number", key)
+	if len(e.Errors) > 0 {
+		msg += ": " + e.FieldErrors()
 	}
-	return int(f), nil
+	if metabase.IsRetryable(e) {
+		msg += "; try again later"
+	}
+	return msg
 }
 
-// optionalIntArg extracts an optional integer argument.
-func optionalIntArg(args map[string]any, key string) *int {
-	v, ok := args[key]
-	if !ok || v == nil {
-		return nil
-	}
-	f, ok := v.(float64)
-	if !ok {
-		return nil
+// toolHandler handles a tool call with arguments In against the Metabase
+// instance selected by the call's instance argument. It returns the
+// structured result out, which is also the text content unless it returns a
+// result with content of its own.
+type toolHandler[In, Out any] func(ctx context.Context, req *mcp.CallToolRequest, client metabase.API, in In) (*mcp.CallToolResult, Out, error)
+
+// schemaOption adjusts the input and output schemas derived from the
+// argument and result types of a tool.
+type schemaOption func(in, out *jsonschema.Schema)
+
+// withEnum restricts the string argument name to values.
+func withEnum(name string, values ...string) schemaOption {
+	return func(in, _ *jsonschema.Schema) {
+		for _, v := range values {
+			in.Properties[name].Enum = append(in.Properties[name].Enum, v)
+		}
 	}
-	i := int(f)
-	return &i
 }
 
-// stringArg extracts a string argument.
-func stringArg(args map[string]any, key string) (string, error) {
-	v, ok := args[key]
-	if !ok {
-		return "", fmt.Errorf("missing required argument: %s", key)
+// withTypes sets the JSON types the argument name accepts, for arguments
+// such as collection IDs that may be a number or a string.
+func withTypes(name string, types ...string) schemaOption {
+	return func(in, _ *jsonschema.Schema) {
+		in.Properties[name].Type = ""
+		in.Properties[name].Types = types
 	}
-	s, ok := v.(string)
-	if !ok {
-		return "", fmt.Errorf("argument %s must be a string", key)
+}
+
+// registrar adds tools to an MCP server, routing each call to an instance.
+type registrar struct {
+	server    *mcp.Server
+	instances *Instances
+	logger    zerolog.Logger
+	filter    *toolFilter
+	shutdown  context.Context
+	jobs      *Jobs
+
+	// category is the category of the tools being added.
+	category string
+	// registered lists the names of the tools added, in order.
+	registered []string
+	// subscriptions are the resources clients subscribed to.
+	subscriptions subscriptions
+}
+
+// group adds the tools of one category.
+func (r *registrar) group(category string, register func()) {
+	r.category = category
+	register()
+	r.category = ""
+}
+
+// addTool adds a tool whose input and output schemas are derived from In
+// and Out. When more than one instance is configured, the input schema
+// gains an optional instance argument. The tool must not modify Metabase;
+// use addWriteTool for tools that do.
+func addTool[In, Out any](r *registrar, name, description string, handler toolHandler[In, Out], options ...schemaOption) {
+	addInstanceTool(r, name, description, true, handler, options)
+}
+
+// addWriteTool adds a tool that modifies Metabase. Such tools are left out
+// in read-only mode.
+func addWriteTool[In, Out any](r *registrar, name, description string, handler toolHandler[In, Out], options ...schemaOption) {
+	addInstanceTool(r, name, description, false, handler, options)
+}
+
+func addInstanceTool[In, Out any](r *registrar, name, description string, readOnly bool, handler toolHandler[In, Out], options []schemaOption) {
+	if names := r.instances.Names(); len(names) > 1 {
+		options = append(options, withInstanceProperty(names, r.instances.Default()))
 	}
-	return s, nil
+	add(r, name, description, readOnly, func(ctx context.Context, req *mcp.CallToolRequest, in In) (*mcp.CallToolResult, Out, error) {
+		var sel struct {
+			Instance string `json:"instance"`
+		}
+		// The arguments were validated against the schema already.
+		_ = json.Unmarshal(req.Params.Arguments, &sel)
+		client, err := r.instances.Get(sel.Instance)
+		if err != nil {
+			var zero Out
+			return nil, zero, err
+		}
+		if sel.Instance == "" {
+			sel.Instance = r.instances.Default()
+		}
+		r.logCall(name, req)
+		result, out, err := handler(withInstance(ctx, sel.Instance), req, client, in)
+		return result, out, toolError(err)
+	}, options)
 }
 
-// optionalStringArg extracts an optional string argument.
-func optionalStringArg(args map[string]any, key string) *string {
-	v, ok := args[key]
-	if !ok || v == nil {
-		return nil
+// addServerTool adds a read-only tool that is not tied to a single instance.
+func addServerTool[In, Out any](r *registrar, name, description string, handler mcp.ToolHandlerFor[In, Out]) {
+	add(r, name, description, true, handler, nil)
+}
+
+// add registers a tool on the server unless the filter excludes it.
+func add[In, Out any](r *registrar, name, description string, readOnly bool, handler mcp.ToolHandlerFor[In, Out], options []schemaOption) {
+	if !r.filter.allows(name, r.category, readOnly) {
+		return
 	}
-	s, ok := v.(string)
-	if !ok {
-		return nil
+	in, out := toolSchemas[In, Out]()
+	for _, o := range options {
+		o(in, out)
+	}
+	tool := &mcp.Tool{
+		Name:         name,
+		Description:  description,
+		InputSchema:  in,
+		OutputSchema: out,
 	}
-	return &s
+	if readOnly {
+		tool.Annotations = &mcp.ToolAnnotations{ReadOnlyHint: true}
+	}
+	if r.shutdown != nil {
+		inner := handler
+		handler = func(ctx context.Context, req *mcp.CallToolRequest, in In) (*mcp.CallToolResult, Out, error) {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			defer context.AfterFunc(r.shutdown, cancel)()
+			return inner(ctx, req, in)
+		}
+	}
+	mcp.AddTool(r.server, tool, handler)
+	r.registered = append(r.registered, name)
 }
 
-// optionalBoolArg extracts an optional boolean argument.
-func optionalBoolArg(args map[string]any, key string) *bool {
-	v, ok := args[key]
-	if !ok || v == nil {
-		return nil
+// toolSchemas derives the input schema of a tool from its argument type In
+// and the output schema from its result type Out. Lists and maps in results
+// may be null, as Go marshals nil ones.
+func toolSchemas[In, Out any]() (in, out *jsonschema.Schema) {
+	in, err := jsonschema.For[In](nil)
+	if err != nil {
+		panic(fmt.Sprintf("input schema: %v", err))
 	}
-	b, ok := v.(bool)
-	if !ok {
-		return nil
+	outType := reflect.TypeFor[Out]()
+	if outType.Kind() == reflect.Pointer {
+		outType = outType.Elem()
 	}
-	return &b
+	out, err = jsonschema.ForType(outType, &jsonschema.ForOptions{})
+	if err != nil {
+		panic(fmt.Sprintf("output schema: %v", err))
+	}
+	for _, s := range out.Properties {
+		nullable(s)
+	}
+	return in, out
 }
 
-// stringSliceArg extracts an optional string slice from the args.
-func stringSliceArg(args map[string]any, key string) []string {
-	v, ok := args[key]
-	if !ok || v == nil {
-		return nil
+// nullable allows null for the lists and maps in s.
+func nullable(s *jsonschema.Schema) {
+	if s == nil {
+		return
 	}
-	arr, ok := v.([]any)
-	if !ok {
-		return nil
+	if s.Type == "array" || s.Type == "object" {
+		s.Types = []string{"null", s.Type}
+		s.Type = ""
 	}
-	result := make([]string, 0, len(arr))
-	for _, item := range arr {
-		if s, ok := item.(string); ok {
-			result = append(result, s)
-		}
+	nullable(s.Items)
+	if s.AdditionalProperties != nil {
+		nullable(s.AdditionalProperties)
+	}
+	for _, p := range s.Properties {
+		nullable(p)
 	}
-	return result
 }
 
-// mapArg extracts an optional map argument.
-func mapArg(args map[string]any, key string) map[string]any {
-	v, ok := args[key]
-	if !ok || v == nil {
-		return nil
+// logCall records authenticated tool calls, so that actions taken over the
+// HTTP transport can be attributed to the caller's token.
+func (r *registrar) logCall(name string, req *mcp.CallToolRequest) {
+	if req.Extra == nil || req.Extra.TokenInfo == nil {
+		return
 	}
-	m, ok := v.(map[string]any)
-	if !ok {
-		return nil
+	r.logger.Info().Str("tool", name).Str("caller", req.Extra.TokenInfo.UserID).Msg("tool call")
+}
+
+// withInstanceProperty adds the instance argument to an input schema.
+func withInstanceProperty(names []string, defaultName string) schemaOption {
+	return func(in, _ *jsonschema.Schema) {
+		prop := &jsonschema.Schema{
+			Type:        "string",
+			Description: fmt.Sprintf("Metabase instance to use (default %q); see list_instances", defaultName),
+		}
+		for _, name := range names {
+			prop.Enum = append(prop.Enum, name)
+		}
+		if in.Properties == nil {
+			in.Properties = map[string]*jsonschema.Schema{}
+		}
+		in.Properties["instance"] = prop
 	}
-	return m
 }
 
-// addTool is a convenience wrapper to add a tool with a raw JSON input schema.
-func addTool(server *mcp.Server, name, description string, schema json.RawMessage, handler func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error)) {
-	server.AddTool(
-		&mcp.Tool{
-			Name:        name,
-			Description: description,
-			InputSchema: schema,
-		},
-		handler,
-	)
+// argumentErrors reports tool arguments that fail validation against the
+// input schema as tool errors, which the model can correct, rather than as
+// protocol errors.
+func (r *registrar) argumentErrors() {
+	r.server.AddReceivingMiddleware(func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			result, err := next(ctx, method, req)
+			var wireErr *jsonrpc.Error
+			if method != "tools/call" || !errors.As(err, &wireErr) || wireErr.Code != jsonrpc.CodeInvalidParams {
+				return result, err
+			}
+			params, ok := req.GetParams().(*mcp.CallToolParamsRaw)
+			if !ok || !slices.Contains(r.registered, params.Name) {
+				return result, err
+			}
+			msg := strings.TrimPrefix(err.Error(), wireErr.Error()+": ")
+			for _, prefix := range []string{`validating "arguments": `, "validating root: "} {
+				msg = strings.TrimPrefix(msg, prefix)
+			}
+			result = &mcp.CallToolResult{
+				Content: []mcp.Content{&mcp.TextContent{Text: "invalid arguments: " + msg}},
+				IsError: true,
+			}
+			return result, nil
+		}
+	})
 }
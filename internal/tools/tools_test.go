@@ -1,18 +1,33 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/anaryk/metabase-mcp-server/internal/httpauth"
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
+	"github.com/anaryk/metabase-mcp-server/internal/metabase/metabasefake"
+	"github.com/anaryk/metabase-mcp-server/internal/metabase/metabasetest"
 )
 
 func setupTestServer(t *testing.T, handler http.HandlerFunc) (*mcp.Server, *mcp.ClientSession) {
@@ -29,14 +44,23 @@ func setupTestServer(t *testing.T, handler http.HandlerFunc) (*mcp.Server, *mcp.
 	t.Cleanup(mbServer.Close)
 
 	logger := zerolog.Nop()
-	client, err := metabase.NewClient(mbServer.URL, "test-api-key", "", "", logger)
+	client, err := metabase.NewClient(mbServer.URL, "test-api-key", "", "", logger,
+		metabase.WithRetry(metabase.RetryPolicy{MaxRetries: 1, MinWait: time.Millisecond, MaxWait: time.Millisecond}))
 	require.NoError(t, err)
 
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "metabase-mcp-server",
 		Version: "test",
 	}, nil)
-	RegisterAll(server, client, logger)
+	RegisterAll(server, SingleInstance(client), logger, Options{})
+
+	return server, connectTestSession(t, server)
+}
+
+// connectTestSession runs server on an in-memory transport and returns a
+// connected client session.
+func connectTestSession(t *testing.T, server *mcp.Server) *mcp.ClientSession {
+	t.Helper()
 
 	sTransport, cTransport := mcp.NewInMemoryTransports()
 	mcpClient := mcp.NewClient(&mcp.Implementation{
@@ -53,7 +77,7 @@ func setupTestServer(t *testing.T, handler http.HandlerFunc) (*mcp.Server, *mcp.
 	require.NoError(t, err)
 	t.Cleanup(func() { _ = session.Close() })
 
-	return server, session
+	return session
 }
 
 func TestListTools(t *testing.T) {
@@ -89,12 +113,117 @@ func TestListTools(t *testing.T) {
 		"list_actions", "get_action",
 		"list_timelines", "get_timeline",
 		"invalidate_cache",
+		"list_instances", "get_server_info",
 	}
 	for _, name := range expectedTools {
 		assert.True(t, toolNames[name], "missing tool: %s", name)
 	}
 }
 
+func TestEnabledTools(t *testing.T) {
+	all, err := EnabledTools(Options{})
+	require.NoError(t, err)
+	assert.Contains(t, all, "delete_card")
+	assert.Contains(t, all, "list_instances")
+
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		exact   bool
+		exclude []string
+		wantErr string
+	}{
+		{
+			name:  "category",
+			opts:  Options{EnableTools: []string{"cards"}},
+			want:  []string{"list_cards", "get_card", "create_card", "update_card", "delete_card", "execute_card_query"},
+			exact: true,
+		},
+		{
+			name: "glob and category",
+			opts: Options{EnableTools: []string{"get_*", "search"}},
+			want: []string{"get_card", "get_dashboard", "get_current_user", "search"},
+		},
+		{
+			name:    "disable wins over enable",
+			opts:    Options{EnableTools: []string{"cards"}, DisableTools: []string{"delete_*", "update_card"}},
+			want:    []string{"list_cards", "create_card"},
+			exclude: []string{"delete_card", "update_card"},
+		},
+		{
+			name:    "read-only",
+			opts:    Options{ReadOnly: true},
+			want:    []string{"list_instances", "get_card", "execute_query", "execute_card_query", "get_permissions_graph"},
+			exclude: []string{"create_card", "update_card", "delete_card", "delete_dashboard", "copy_dashboard", "sync_database", "create_alert", "invalidate_cache"},
+		},
+		{
+			name:    "read-only with enable list",
+			opts:    Options{ReadOnly: true, EnableTools: []string{"dashboards"}},
+			want:    []string{"list_dashboards", "get_dashboard"},
+			exclude: []string{"create_dashboard", "add_card_to_dashboard"},
+		},
+		{
+			name:    "misspelled pattern",
+			opts:    Options{DisableTools: []string{"delete-card"}},
+			wantErr: `tool patterns match no tool: delete-card`,
+		},
+		{
+			name:    "malformed glob",
+			opts:    Options{EnableTools: []string{"get_[*"}},
+			wantErr: `invalid tool pattern "get_[*"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EnabledTools(tt.opts)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, name := range tt.want {
+				assert.Contains(t, got, name)
+			}
+			for _, name := range tt.exclude {
+				assert.NotContains(t, got, name)
+			}
+			if tt.exact {
+				assert.ElementsMatch(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRegisterAll_ReadOnly(t *testing.T) {
+	mb := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(mb.Close)
+	client, err := metabase.NewClient(mb.URL, "test-api-key", "", "", zerolog.Nop(), metabase.WithoutStartupCheck())
+	require.NoError(t, err)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), zerolog.Nop(), Options{ReadOnly: true})
+	session := connectTestSession(t, server)
+
+	result, err := session.ListTools(context.Background(), nil)
+	require.NoError(t, err)
+	want, err := EnabledTools(Options{ReadOnly: true})
+	require.NoError(t, err)
+	require.Len(t, result.Tools, len(want))
+	for _, tool := range result.Tools {
+		require.NotNil(t, tool.Annotations, tool.Name)
+		assert.True(t, tool.Annotations.ReadOnlyHint, tool.Name)
+	}
+
+	_, err = session.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "delete_card",
+		Arguments: map[string]any{"id": 1},
+	})
+	require.Error(t, err, "delete_card is not registered in read-only mode")
+}
+
 func TestExecuteQuery_ReadOnly(t *testing.T) {
 	_, session := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/api/dataset" {
@@ -151,6 +280,515 @@ func TestExecuteQuery_ReadOnly(t *testing.T) {
 	})
 	require.NoError(t, err)
 	assert.True(t, result.IsError)
+
+	// Native SQL nested in MBQL is checked too
+	for _, tool := range []string{"execute_query", "export_query_results"} {
+		args := map[string]any{
+			"database_id": 1,
+			"query_type":  "query",
+			"mbql_query":  map[string]any{"source-query": map[string]any{"native": "DELETE FROM users"}},
+		}
+		if tool == "export_query_results" {
+			args["export_format"] = "csv"
+		}
+		result, err = session.CallTool(ctx, &mcp.CallToolParams{Name: tool, Arguments: args})
+		require.NoError(t, err)
+		assert.True(t, result.IsError, tool)
+		assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "DELETE", tool)
+	}
+}
+
+func TestExecuteQuery_RowLimit(t *testing.T) {
+	var lastQuery metabase.DatasetQueryRequest
+	_, session := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/database/1":
+			_ = json.NewEncoder(w).Encode(metabase.Database{ID: 1, Engine: "postgres"})
+		case "/api/dataset":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&lastQuery))
+			rows := make([][]any, 5)
+			for i := range rows {
+				rows[i] = []any{i}
+			}
+			_ = json.NewEncoder(w).Encode(metabase.DatasetQueryResponse{
+				Status:   "completed",
+				RowCount: len(rows),
+				Data: metabase.DatasetData{
+					Cols: []metabase.DatasetCol{{Name: "id", DisplayName: "ID", BaseType: "type/Integer"}},
+					Rows: rows,
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	ctx := context.Background()
+	decode := func(result *mcp.CallToolResult) map[string]any {
+		t.Helper()
+		require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+		var out map[string]any
+		require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &out))
+		return out
+	}
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name: "execute_query",
+		Arguments: map[string]any{
+			"database_id":  1,
+			"query_type":   "native",
+			"native_query": "SELECT id FROM users;",
+			"max_rows":     3,
+			"format":       "raw",
+		},
+	})
+	require.NoError(t, err)
+	out := decode(result)
+	assert.Equal(t, "SELECT * FROM (\nSELECT id FROM users\n) AS mcp_limited LIMIT 4", lastQuery.Native.Query)
+	assert.Equal(t, true, out["truncated"])
+	assert.Equal(t, float64(5), out["row_count"])
+	assert.Len(t, out["data"].(map[string]any)["rows"], 3)
+	assert.Contains(t, out["notice"], "truncated, 3 of 5 rows shown")
+
+	// Requests above the ceiling are clamped; MBQL gets a limit clause.
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name: "execute_query",
+		Arguments: map[string]any{
+			"database_id": 1,
+			"query_type":  "query",
+			"mbql_query":  map[string]any{"source-table": 2},
+			"max_rows":    1000000,
+			"format":      "raw",
+		},
+	})
+	require.NoError(t, err)
+	out = decode(result)
+	assert.Equal(t, float64(DefaultMaxRowLimit+1), lastQuery.Query["limit"])
+	assert.Nil(t, out["truncated"])
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name: "execute_query",
+		Arguments: map[string]any{
+			"database_id":  1,
+			"query_type":   "native",
+			"native_query": "SELECT 1",
+			"max_rows":     0,
+		},
+	})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+}
+
+func TestExecuteQuery_RowLimitFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		// limitedError is the failure of the limited query.
+		limitedError string
+		wantRerun    bool
+	}{
+		{name: "duplicate columns", limitedError: "Duplicate column name 'id'", wantRerun: true},
+		{name: "syntax error", limitedError: "You have an error in your SQL syntax"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries []string
+			_, session := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/api/database/1":
+					_ = json.NewEncoder(w).Encode(metabase.Database{ID: 1, Engine: "mysql"})
+				case "/api/dataset":
+					var req metabase.DatasetQueryRequest
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+					queries = append(queries, req.Native.Query)
+					if strings.Contains(req.Native.Query, "mcp_limited") {
+						w.WriteHeader(http.StatusAccepted)
+						_ = json.NewEncoder(w).Encode(map[string]any{"status": "failed", "error": tt.limitedError, "error_type": "invalid-query"})
+						return
+					}
+					_ = json.NewEncoder(w).Encode(metabase.DatasetQueryResponse{
+						Status:   "completed",
+						RowCount: 3,
+						Data: metabase.DatasetData{
+							Cols: []metabase.DatasetCol{
+								{Name: "id", DisplayName: "ID", BaseType: "type/Integer"},
+								{Name: "id", DisplayName: "ID", BaseType: "type/Integer"},
+							},
+							Rows: [][]any{{1, 10}, {2, 20}, {3, 30}},
+						},
+					})
+				default:
+					w.WriteHeader(http.StatusOK)
+				}
+			})
+
+			sql := "SELECT * FROM a JOIN b ON a.b_id = b.id"
+			result, err := session.CallTool(context.Background(), &mcp.CallToolParams{
+				Name: "execute_query",
+				Arguments: map[string]any{
+					"database_id":  1,
+					"query_type":   "native",
+					"native_query": sql,
+					"max_rows":     2,
+					"format":       "json",
+				},
+			})
+			require.NoError(t, err)
+			require.NotEmpty(t, queries)
+			assert.Contains(t, queries[0], "mcp_limited")
+
+			if !tt.wantRerun {
+				require.True(t, result.IsError)
+				assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, tt.limitedError)
+				assert.Len(t, queries, 1, "other failures are not run again without the limit")
+				return
+			}
+			require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+			require.Len(t, queries, 2)
+			assert.Equal(t, sql, queries[1], "the query is run as given when the limit breaks it")
+
+			out := result.StructuredContent.(map[string]any)
+			assert.Equal(t, true, out["truncated"])
+			cols := out["columns"].([]any)
+			require.Len(t, cols, 2)
+			assert.Equal(t, []any{float64(1), float64(2)}, cols[0].(map[string]any)["values"])
+			assert.Equal(t, []any{float64(10), float64(20)}, cols[1].(map[string]any)["values"])
+		})
+	}
+}
+
+func TestTruncateResult(t *testing.T) {
+	rows := func(n int) [][]any {
+		r := make([][]any, n)
+		for i := range r {
+			r[i] = []any{i}
+		}
+		return r
+	}
+	tests := []struct {
+		name      string
+		rows      int
+		rowCount  int
+		limited   bool
+		wantRows  int
+		wantNote  string
+		truncated bool
+	}{
+		{name: "under limit", rows: 2, rowCount: 2, wantRows: 2},
+		{name: "at limit", rows: 3, rowCount: 3, limited: true, wantRows: 3},
+		{name: "limited query", rows: 4, rowCount: 4, limited: true, wantRows: 3, truncated: true,
+			wantNote: "truncated, 3 of more than 3 rows shown"},
+		{name: "full result", rows: 10, rowCount: 10, wantRows: 3, truncated: true,
+			wantNote: "truncated, 3 of 10 rows shown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &metabase.DatasetQueryResponse{RowCount: tt.rowCount, Data: metabase.DatasetData{Rows: rows(tt.rows)}}
+			got := truncateResult(resp, 3, tt.limited)
+			assert.Len(t, got.Data.Rows, tt.wantRows)
+			assert.Equal(t, tt.truncated, got.Truncated)
+			assert.Equal(t, tt.rowCount, got.RowCount)
+			if tt.wantNote == "" {
+				assert.Empty(t, got.Notice)
+			} else {
+				assert.Contains(t, got.Notice, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestCardTools_ReadOnly(t *testing.T) {
+	var runs, creates atomic.Int32
+	_, session := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/card" && r.Method == http.MethodPost:
+			creates.Add(1)
+			_ = json.NewEncoder(w).Encode(metabase.Card{ID: 10, Name: "ok"})
+		case r.URL.Path == "/api/card/7" && r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(metabase.Card{ID: 7, DatasetQuery: map[string]any{
+				"type": "native", "database": 1,
+				"native": map[string]any{"query": "DELETE FROM users"},
+			}})
+		case r.URL.Path == "/api/card/8" && r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(metabase.Card{ID: 8, DatasetQuery: map[string]any{
+				"type": "native", "database": 1,
+				"native": map[string]any{
+					"query":         "SELECT * FROM {{snippet: purge}}",
+					"template-tags": map[string]any{"snippet: purge": map[string]any{"type": "snippet"}},
+				},
+			}})
+		case r.URL.Path == "/api/card/9" && r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(metabase.Card{ID: 9, DatasetQuery: map[string]any{
+				"type": "native", "database": 1,
+				"native": map[string]any{"query": "SELECT 1"},
+			}})
+		case r.URL.Path == "/api/card/11" && r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(metabase.Card{ID: 11, DatasetQuery: map[string]any{
+				"type": "query", "database": 1,
+				"query": map[string]any{"source-table": "card__7"},
+			}})
+		case r.URL.Path == "/api/dataset/native":
+			_ = json.NewEncoder(w).Encode(metabase.NativeForm{Query: "SELECT 1; DELETE FROM users"})
+		case r.URL.Path == "/api/dataset" || strings.HasSuffix(r.URL.Path, "/query"):
+			runs.Add(1)
+			_ = json.NewEncoder(w).Encode(metabase.DatasetQueryResponse{Status: "completed"})
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+
+	ctx := context.Background()
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		require.NoError(t, err)
+		return result
+	}
+
+	result := call("create_card", map[string]any{
+		"name":    "purge",
+		"display": "table",
+		"dataset_query": map[string]any{
+			"type": "native", "database": 1,
+			"native": map[string]any{"query": "DELETE FROM users"},
+		},
+	})
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "blocked operation")
+	assert.Equal(t, int32(0), creates.Load())
+
+	result = call("create_card", map[string]any{
+		"name":    "count",
+		"display": "scalar",
+		"dataset_query": map[string]any{
+			"type": "native", "database": 1,
+			"native": map[string]any{"query": "SELECT COUNT(*) FROM users"},
+		},
+	})
+	assert.False(t, result.IsError)
+	assert.Equal(t, int32(1), creates.Load())
+
+	result = call("update_card", map[string]any{
+		"card_id": 9,
+		"dataset_query": map[string]any{
+			"database": 1,
+			"stages":   []any{map[string]any{"native": "DROP TABLE users"}},
+		},
+	})
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "DROP")
+
+	result = call("execute_card_query", map[string]any{"card_id": 7})
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "card 7")
+
+	result = call("create_card", map[string]any{
+		"name":    "nested purge",
+		"display": "table",
+		"dataset_query": map[string]any{
+			"type": "query", "database": 1,
+			"query": map[string]any{"source-query": map[string]any{"native": "DELETE FROM users"}},
+		},
+	})
+	assert.True(t, result.IsError, "native source queries are checked")
+	assert.Equal(t, int32(1), creates.Load())
+
+	result = call("update_card", map[string]any{
+		"card_id": 9,
+		"dataset_query": map[string]any{
+			"type": "query", "database": 1,
+			"query": map[string]any{"source-table": "card__7"},
+		},
+	})
+	assert.True(t, result.IsError, "source cards are checked")
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "source card 7")
+
+	result = call("execute_card_query", map[string]any{"card_id": 11})
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "card 11: source card 7")
+
+	result = call("execute_card_query", map[string]any{"card_id": 8})
+	assert.True(t, result.IsError, "snippet expanding to write SQL must be refused")
+	assert.Equal(t, int32(0), runs.Load(), "blocked cards must not reach Metabase")
+
+	result = call("execute_card_query", map[string]any{"card_id": 9})
+	assert.False(t, result.IsError)
+	assert.Equal(t, int32(1), runs.Load())
+}
+
+func TestExecuteCardQuery_RunsCheckedQuery(t *testing.T) {
+	// The card holds SELECT 1 when it is checked and DELETE from then on,
+	// as if it were edited between the check and the run.
+	tests := []struct {
+		name string
+		// datasetStatus is the status of running the query directly.
+		datasetStatus int
+		wantErr       string
+		wantRuns      []string
+	}{
+		{name: "query run as checked", datasetStatus: http.StatusOK, wantRuns: []string{"/api/dataset SELECT 1"}},
+		{name: "card changed while it ran", datasetStatus: http.StatusForbidden, wantErr: "card 5: the query changed while it ran", wantRuns: []string{"/api/card/5/query"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetches atomic.Int32
+			var runs []string
+			_, session := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/api/card/5":
+					sql := "SELECT 1"
+					if fetches.Add(1) > 1 {
+						sql = "DELETE FROM users"
+					}
+					_ = json.NewEncoder(w).Encode(metabase.Card{ID: 5, DatasetQuery: map[string]any{
+						"type": "native", "database": 1,
+						"native": map[string]any{"query": sql},
+					}})
+				case "/api/dataset":
+					var req metabase.DatasetQueryRequest
+					require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+					if tt.datasetStatus != http.StatusOK {
+						w.WriteHeader(tt.datasetStatus)
+						_, _ = w.Write([]byte(`"You don't have permissions to do that."`))
+						return
+					}
+					runs = append(runs, r.URL.Path+" "+req.Native.Query)
+					_ = json.NewEncoder(w).Encode(metabase.DatasetQueryResponse{Status: "completed"})
+				case "/api/card/5/query":
+					runs = append(runs, r.URL.Path)
+					_ = json.NewEncoder(w).Encode(metabase.DatasetQueryResponse{Status: "completed"})
+				default:
+					w.WriteHeader(http.StatusOK)
+				}
+			})
+
+			result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "execute_card_query", Arguments: map[string]any{"card_id": 5}})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRuns, runs)
+			if tt.wantErr != "" {
+				require.True(t, result.IsError)
+				assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, tt.wantErr)
+				return
+			}
+			require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+		})
+	}
+}
+
+func TestMultipleInstances(t *testing.T) {
+	newInstance := func(dbName string, healthy bool) *metabase.Client {
+		mb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !healthy {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/api/user/current":
+				_, _ = w.Write([]byte(`{"id":1,"email":"test@test.com"}`))
+			case "/api/database":
+				_ = json.NewEncoder(w).Encode(map[string]any{"data": []metabase.Database{{ID: 1, Name: dbName}}})
+			}
+		}))
+		t.Cleanup(mb.Close)
+		client, err := metabase.NewClient(mb.URL, "key", "", "", zerolog.Nop(), metabase.WithoutStartupCheck())
+		require.NoError(t, err)
+		return client
+	}
+
+	instances := NewInstances()
+	instances.Add("eu", newInstance("EU Warehouse", true))
+	instances.Add("us", newInstance("US Warehouse", true))
+	instances.Add("apac", newInstance("", false))
+	require.NoError(t, instances.SetDefault("us"))
+	require.Error(t, instances.SetDefault("mars"))
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, instances, zerolog.Nop(), Options{})
+	session := connectTestSession(t, server)
+	ctx := context.Background()
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	for _, tool := range tools.Tools {
+		props, _ := tool.InputSchema.(map[string]any)["properties"].(map[string]any)
+		switch tool.Name {
+		case "list_instances", "get_job_status", "get_job_result", "cancel_job":
+			assert.NotContains(t, props, "instance", tool.Name)
+			continue
+		}
+		assert.Contains(t, props, "instance", tool.Name)
+	}
+
+	callText := func(args map[string]any) (string, bool) {
+		t.Helper()
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "list_databases", Arguments: args})
+		require.NoError(t, err)
+		return result.Content[0].(*mcp.TextContent).Text, result.IsError
+	}
+
+	text, isErr := callText(nil)
+	assert.False(t, isErr)
+	assert.Contains(t, text, "US Warehouse", "default instance")
+
+	text, isErr = callText(map[string]any{"instance": "eu"})
+	assert.False(t, isErr)
+	assert.Contains(t, text, "EU Warehouse")
+
+	text, isErr = callText(map[string]any{"instance": "mars"})
+	assert.True(t, isErr)
+	assert.Contains(t, text, "invalid arguments")
+	assert.Contains(t, text, "instance")
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "list_instances"})
+	require.NoError(t, err)
+	var list itemsResult[instanceInfo]
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &list))
+	infos := list.Data
+	require.Len(t, infos, 3)
+	assert.Equal(t, "eu", infos[0].Name)
+	assert.True(t, infos[0].Available)
+	assert.True(t, infos[1].Default)
+	assert.False(t, infos[2].Available)
+	assert.Contains(t, infos[2].Error, "502")
+}
+
+func TestGetServerInfo(t *testing.T) {
+	_, session := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/session/properties", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"version":{"tag":"v1.49.8"},"token-features":{"sandboxes":true,"sso_jwt":false}}`))
+	})
+
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "get_server_info"})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	var info serverInfo
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &info))
+	assert.Equal(t, "v1.49.8", info.Version)
+	assert.Equal(t, "enterprise", info.Edition)
+	assert.Equal(t, []metabase.Capability{metabase.CapDashcards, metabase.CapLegacyAlerts}, info.Capabilities)
+	assert.Equal(t, []string{"sandboxes"}, info.Features)
+}
+
+func TestToolErrors_UnsupportedVersion(t *testing.T) {
+	_, session := setupTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/session/properties", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"version":{"tag":"v0.54.2"}}`))
+	})
+
+	result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "list_alerts"})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, "the alert API is not supported on Metabase v0.54.2; manage alerts in Metabase's notification settings",
+		result.Content[0].(*mcp.TextContent).Text)
 }
 
 func TestListDatabases(t *testing.T) {
@@ -226,7 +864,7 @@ func TestStreamableHTTPTransport(t *testing.T) {
 		Name:    "metabase-mcp-server",
 		Version: "test",
 	}, nil)
-	RegisterAll(server, client, logger)
+	RegisterAll(server, SingleInstance(client), logger, Options{})
 
 	// Start an HTTP server with StreamableHTTPHandler
 	handler := mcp.NewStreamableHTTPHandler(func(_ *http.Request) *mcp.Server {
@@ -255,3 +893,1159 @@ func TestStreamableHTTPTransport(t *testing.T) {
 	require.NoError(t, err)
 	assert.GreaterOrEqual(t, len(result.Tools), 45, "expected at least 45 tools via streamable HTTP")
 }
+
+// bearerTransport adds an Authorization header to every request.
+type bearerTransport struct {
+	token string
+}
+
+func (b bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+b.token)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestStreamableHTTPTransport_Authenticated(t *testing.T) {
+	mbServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":1,"email":"test@test.com"}`))
+	}))
+	t.Cleanup(mbServer.Close)
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	client, err := metabase.NewClient(mbServer.URL, "test-api-key", "", "", logger)
+	require.NoError(t, err)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), logger, Options{})
+
+	tokenFile := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("alice:alice-0123456789abcdef\n"), 0o600))
+	tokens, err := httpauth.LoadStaticTokens(tokenFile)
+	require.NoError(t, err)
+	handler := httpauth.NewVerifier(tokens, nil, logger).Middleware(mcp.NewStreamableHTTPHandler(func(_ *http.Request) *mcp.Server {
+		return server
+	}, nil))
+	httpServer := httptest.NewServer(handler)
+	t.Cleanup(httpServer.Close)
+
+	ctx := context.Background()
+	connect := func(token string) (*mcp.ClientSession, error) {
+		mcpClient := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, nil)
+		return mcpClient.Connect(ctx, &mcp.StreamableClientTransport{
+			Endpoint:   httpServer.URL,
+			HTTPClient: &http.Client{Transport: bearerTransport{token: token}},
+		}, nil)
+	}
+
+	_, err = connect("wrong-0123456789abcdef")
+	require.Error(t, err)
+
+	session, err := connect("alice-0123456789abcdef")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "get_current_user"})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Contains(t, logs.String(), `"tool":"get_current_user","caller":"alice"`)
+}
+
+// newSlowClient returns a client for a Metabase whose queries hang until the
+// request is aborted; aborted is closed when that happens.
+func newSlowClient(t *testing.T) (client *metabase.Client, aborted <-chan struct{}) {
+	t.Helper()
+	done := make(chan struct{})
+	var once sync.Once
+	mb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices a closed connection once the body is read.
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			once.Do(func() { close(done) })
+		case <-time.After(10 * time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(mb.Close)
+	client, err := metabase.NewClient(mb.URL, "test-api-key", "", "", zerolog.Nop(), metabase.WithoutStartupCheck())
+	require.NoError(t, err)
+	return client, done
+}
+
+// mbqlQuery is an execute_query call that reaches Metabase without a
+// database lookup.
+var mbqlQuery = &mcp.CallToolParams{
+	Name: "execute_query",
+	Arguments: map[string]any{
+		"database_id": 1,
+		"query_type":  "query",
+		"mbql_query":  map[string]any{"source-table": 1},
+	},
+}
+
+func TestToolCall_ClientCancellation(t *testing.T) {
+	client, aborted := newSlowClient(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), zerolog.Nop(), Options{})
+	session := connectTestSession(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := session.CallTool(ctx, mbqlQuery)
+	require.Error(t, err)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metabase request was not aborted after the client cancelled the call")
+	}
+}
+
+func TestToolCall_ShutdownCancellation(t *testing.T) {
+	client, aborted := newSlowClient(t)
+	shutdown, stop := context.WithCancel(context.Background())
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), zerolog.Nop(), Options{Shutdown: shutdown})
+	session := connectTestSession(t, server)
+
+	results := make(chan *mcp.CallToolResult, 1)
+	go func() {
+		result, err := session.CallTool(context.Background(), mbqlQuery)
+		assert.NoError(t, err)
+		results <- result
+	}()
+	time.Sleep(100 * time.Millisecond)
+	stop()
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metabase request was not aborted on shutdown")
+	}
+	select {
+	case result := <-results:
+		require.NotNil(t, result)
+		assert.True(t, result.IsError)
+		assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "context canceled")
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool call did not return after shutdown")
+	}
+}
+
+func TestToolErrors_Concise(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		call   *mcp.CallToolParams
+		want   string
+	}{
+		{
+			name:   "not found",
+			status: http.StatusNotFound,
+			body:   "Not found.",
+			call:   &mcp.CallToolParams{Name: "get_card", Arguments: map[string]any{"card_id": 42}},
+			want:   "card 42 not found",
+		},
+		{
+			name:   "permission denied",
+			status: http.StatusForbidden,
+			body:   "You don't have permissions to do that.",
+			call:   &mcp.CallToolParams{Name: "delete_dashboard", Arguments: map[string]any{"dashboard_id": 3}},
+			want:   "permission denied for dashboard 3: You don't have permissions to do that.",
+		},
+		{
+			name:   "validation errors",
+			status: http.StatusBadRequest,
+			body:   `{"errors":{"name":"value must be a non-blank string."}}`,
+			call:   &mcp.CallToolParams{Name: "update_collection", Arguments: map[string]any{"collection_id": 9, "name": ""}},
+			want:   "invalid request for collection 9: name: value must be a non-blank string.",
+		},
+		{
+			name:   "unavailable",
+			status: http.StatusBadGateway,
+			body:   "<html><body>Bad Gateway</body></html>",
+			call:   &mcp.CallToolParams{Name: "list_cards"},
+			want:   "Metabase is unavailable (status 502): Bad Gateway; try again later",
+		},
+		{
+			name:   "query failed",
+			status: http.StatusAccepted,
+			body:   `{"status":"failed","error":"Table \"ORDERZ\" not found","error_type":"invalid-query","data":{"rows":[],"cols":[]}}`,
+			call: &mcp.CallToolParams{Name: "execute_query", Arguments: map[string]any{
+				"database_id": 1, "query_type": "query", "mbql_query": map[string]any{"source-table": 1},
+			}},
+			want: `query failed: Table "ORDERZ" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, session := setupTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+				if strings.HasPrefix(tt.body, "{") {
+					w.Header().Set("Content-Type", "application/json")
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			})
+
+			result, err := session.CallTool(context.Background(), tt.call)
+			require.NoError(t, err)
+			assert.True(t, result.IsError)
+			assert.Equal(t, tt.want, result.Content[0].(*mcp.TextContent).Text)
+		})
+	}
+}
+
+func TestToolErrors_CircuitOpen(t *testing.T) {
+	var calls atomic.Int32
+	_, session := setupTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	var text string
+	for range 4 {
+		result, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "list_cards"})
+		require.NoError(t, err)
+		require.True(t, result.IsError)
+		text = result.Content[0].(*mcp.TextContent).Text
+	}
+	assert.Equal(t, "Metabase is unavailable after repeated failures; try again later", text)
+	assert.Equal(t, int32(metabase.DefaultBreakerPolicy.Threshold), calls.Load())
+}
+
+// setupFakeServer serves the tools against an in-memory Metabase seeded
+// with the sample data.
+func setupFakeServer(t *testing.T, opts Options) (*metabasetest.Fake, *metabasetest.Sample, *mcp.ClientSession) {
+	t.Helper()
+
+	fake, sample := metabasetest.NewSample()
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(fake), zerolog.Nop(), opts)
+	return fake, sample, connectTestSession(t, server)
+}
+
+func TestCardTools_Fake(t *testing.T) {
+	fake, sample, session := setupFakeServer(t, Options{})
+	ctx := context.Background()
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		require.NoError(t, err)
+		return result
+	}
+
+	result := call("create_card", map[string]any{
+		"name":    "Texans",
+		"display": "table",
+		"dataset_query": map[string]any{
+			"database": sample.Database.ID,
+			"type":     "native",
+			"native":   map[string]any{"query": "SELECT NAME, STATE FROM PEOPLE"},
+		},
+	})
+	require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+	var card metabase.Card
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &card))
+
+	result = call("execute_card_query", map[string]any{"card_id": card.ID, "max_rows": 2})
+	require.False(t, result.IsError)
+	lines := strings.Split(strings.TrimSpace(result.Content[0].(*mcp.TextContent).Text), "\n")
+	assert.Len(t, lines, 3, "a header and two rows")
+	require.Len(t, result.Content, 2)
+	assert.Contains(t, result.Content[1].(*mcp.TextContent).Text, "truncated, 2 of 3 rows shown")
+
+	// Write SQL is refused before it reaches Metabase.
+	result = call("update_card", map[string]any{
+		"card_id": card.ID,
+		"dataset_query": map[string]any{
+			"database": sample.Database.ID,
+			"type":     "native",
+			"native":   map[string]any{"query": "DELETE FROM PEOPLE"},
+		},
+	})
+	assert.True(t, result.IsError)
+	stored, err := fake.GetCard(ctx, card.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT NAME, STATE FROM PEOPLE", stored.DatasetQuery["native"].(map[string]any)["query"])
+
+	result = call("delete_card", map[string]any{"card_id": card.ID})
+	require.False(t, result.IsError)
+	result = call("get_card", map[string]any{"card_id": card.ID})
+	assert.True(t, result.IsError)
+	assert.Equal(t, fmt.Sprintf("card %d not found", card.ID), result.Content[0].(*mcp.TextContent).Text)
+}
+
+func TestDashboardTools_Fake(t *testing.T) {
+	_, sample, session := setupFakeServer(t, Options{})
+	ctx := context.Background()
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "copy_dashboard",
+		Arguments: map[string]any{"dashboard_id": sample.Dashboard.ID, "name": "Sales copy"},
+	})
+	require.NoError(t, err)
+	require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+	var copied metabase.Dashboard
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &copied))
+	assert.Equal(t, "Sales copy", copied.Name)
+	assert.Len(t, copied.DashCards, 2)
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{
+		Name:      "list_collection_items",
+		Arguments: map[string]any{"collection_id": "root"},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "Sales copy")
+}
+
+// TestEndToEnd_FakeMetabase runs the tools over HTTP against the fake
+// Metabase server, through a real client.
+func TestEndToEnd_FakeMetabase(t *testing.T) {
+	_, ts := metabasefake.NewTestServer(t, nil)
+	client, err := metabase.NewClient(ts.URL, "", "analyst@example.com", "fake-password", zerolog.Nop())
+	require.NoError(t, err)
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), zerolog.Nop(), Options{})
+	session := connectTestSession(t, server)
+	ctx := context.Background()
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{
+		Name: "execute_query",
+		Arguments: map[string]any{
+			"database_id":  1,
+			"query_type":   "native",
+			"native_query": "SELECT TITLE, PRICE FROM PRODUCTS",
+			"max_rows":     3,
+			"format":       "markdown",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+	table := result.Content[0].(*mcp.TextContent).Text
+	assert.True(t, strings.HasPrefix(table, "| TITLE | PRICE |\n| --- | --- |\n"), table)
+	assert.Len(t, strings.Split(strings.TrimSpace(table), "\n"), 5, "a header, a separator and three rows")
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "get_dashboard", Arguments: map[string]any{"dashboard_id": 1}})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "Sales overview")
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "get_card", Arguments: map[string]any{"card_id": 99}})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, "card 99 not found", result.Content[0].(*mcp.TextContent).Text)
+}
+
+func TestListTools_Pagination(t *testing.T) {
+	_, _, session := setupFakeServer(t, Options{})
+	ctx := context.Background()
+	list := func(name string, args map[string]any) (listResult[map[string]any], *mcp.CallToolResult) {
+		t.Helper()
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		require.NoError(t, err)
+		var page listResult[map[string]any]
+		if !result.IsError {
+			require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &page))
+		}
+		return page, result
+	}
+
+	page, _ := list("list_cards", map[string]any{"limit": 1})
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "Recent orders", page.Data[0]["name"])
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, "1-1 of 2 cards shown; pass next_cursor as cursor for more", page.Notice)
+	require.NotEmpty(t, page.NextCursor)
+
+	page, _ = list("list_cards", map[string]any{"cursor": page.NextCursor})
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "Products", page.Data[0]["name"])
+	assert.Equal(t, 1, page.Offset)
+	assert.Empty(t, page.NextCursor)
+	assert.Empty(t, page.Notice)
+
+	page, _ = list("search", map[string]any{"query": "product", "offset": 1})
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "PRODUCTS", page.Data[0]["name"])
+	assert.Equal(t, DefaultPageSize, page.Limit)
+
+	page, _ = list("list_users", map[string]any{"limit": 10000})
+	assert.Equal(t, MaxPageSize, page.Limit)
+
+	_, result := list("list_collection_items", map[string]any{"collection_id": "root", "cursor": "bogus"})
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "invalid cursor")
+}
+
+func TestFormatResult(t *testing.T) {
+	result := &queryResult{
+		DatasetQueryResponse: &metabase.DatasetQueryResponse{
+			RowCount: 4,
+			Data: metabase.DatasetData{
+				Cols: []metabase.DatasetCol{
+					{Name: "created_at", DisplayName: "Created At", BaseType: "type/DateTime"},
+					{Name: "day", DisplayName: "Day", BaseType: "type/Date"},
+					{Name: "total", BaseType: "type/Float"},
+					{Name: "note", DisplayName: "Note", BaseType: "type/Text"},
+				},
+				Rows: [][]any{
+					{"2024-01-15T10:30:00.123Z", "2024-01-15T00:00:00Z", 0.1 + 0.2, "a|b"},
+					{"2024-01-16T08:00:00+02:00", "2024-01-16", 1e21, nil},
+					{nil, "2024-01-17", nil, ""},
+				},
+			},
+		},
+		Truncated: true,
+		Notice:    "truncated, 3 of 4 rows shown",
+	}
+
+	tests := []struct {
+		format     string
+		want       string
+		wantNotice bool
+	}{
+		{format: FormatCSV, wantNotice: true, want: "Created At,Day,total,Note\n" +
+			"2024-01-15 10:30:00,2024-01-15,0.3,a|b\n" +
+			"2024-01-16 08:00:00+02:00,2024-01-16,1000000000000000000000,NULL\n" +
+			"NULL,2024-01-17,NULL,\n"},
+		{format: FormatMarkdown, wantNotice: true, want: "| Created At | Day | total | Note |\n| --- | --- | --- | --- |\n" +
+			"| 2024-01-15 10:30:00 | 2024-01-15 | 0.3 | a\\|b |\n" +
+			"| 2024-01-16 08:00:00+02:00 | 2024-01-16 | 1000000000000000000000 | NULL |\n" +
+			"| NULL | 2024-01-17 | NULL |  |\n"},
+		{format: FormatJSON, want: `{"columns":[` +
+			`{"name":"Created At","type":"DateTime","values":["2024-01-15 10:30:00","2024-01-16 08:00:00+02:00",null]},` +
+			`{"name":"Day","type":"Date","values":["2024-01-15","2024-01-16","2024-01-17"]},` +
+			`{"name":"total","type":"Float","values":[0.3,1e+21,null]},` +
+			`{"name":"Note","type":"Text","values":["a|b",null,""]}],` +
+			`"row_count":4,"truncated":true,"notice":"truncated, 3 of 4 rows shown"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, structured, err := formatResult(result, tt.format)
+			require.NoError(t, err)
+			assert.Equal(t, columnar(result), structured)
+			assert.Equal(t, tt.want, got.Content[0].(*mcp.TextContent).Text)
+			if tt.wantNotice {
+				require.Len(t, got.Content, 2)
+				assert.Equal(t, result.Notice, got.Content[1].(*mcp.TextContent).Text)
+			} else {
+				assert.Len(t, got.Content, 1)
+			}
+		})
+	}
+}
+
+func TestListTools_Fields(t *testing.T) {
+	_, _, session := setupFakeServer(t, Options{})
+	ctx := context.Background()
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		require.NoError(t, err)
+		return result
+	}
+	firstItem := func(result *mcp.CallToolResult) map[string]any {
+		t.Helper()
+		require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+		var page listResult[map[string]any]
+		require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &page))
+		require.NotEmpty(t, page.Data)
+		return page.Data[0]
+	}
+
+	tests := []struct {
+		name     string
+		fields   []any
+		wantKeys []string
+		wantKey  string
+	}{
+		{name: "defaults", wantKeys: cardFields},
+		{name: "selected", fields: []any{"id", "dataset_query"}, wantKeys: []string{"id", "dataset_query"}},
+		{name: "all", fields: []any{"*"}, wantKey: "dataset_query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]any{"limit": 1}
+			if tt.fields != nil {
+				args["fields"] = tt.fields
+			}
+			card := firstItem(call("list_cards", args))
+			if tt.wantKeys != nil {
+				for k := range card {
+					assert.Contains(t, tt.wantKeys, k)
+				}
+				assert.Contains(t, card, "id")
+			}
+			if tt.wantKey != "" {
+				assert.Contains(t, card, tt.wantKey)
+			}
+		})
+	}
+
+	result := call("list_dashboards", nil)
+	require.False(t, result.IsError)
+	var list itemsResult[map[string]any]
+	require.NoError(t, json.Unmarshal([]byte(result.Content[0].(*mcp.TextContent).Text), &list))
+	dashboards := list.Data
+	require.NotEmpty(t, dashboards)
+	assert.NotContains(t, dashboards[0], "dashcards")
+	assert.Contains(t, dashboards[0], "name")
+
+	result = call("list_cards", map[string]any{"fields": []any{"result_metadata", "colour"}})
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, `unknown field "colour"`)
+}
+
+func TestStructuredOutput(t *testing.T) {
+	_, sample, session := setupFakeServer(t, Options{})
+	ctx := context.Background()
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	for _, tool := range tools.Tools {
+		assert.NotNil(t, tool.OutputSchema, tool.Name)
+	}
+
+	field := sample.Orders.Fields[0].ID
+	tests := []struct {
+		tool string
+		args map[string]any
+	}{
+		{tool: "list_cards"},
+		{tool: "get_card", args: map[string]any{"card_id": sample.NativeCard.ID}},
+		{tool: "execute_card_query", args: map[string]any{"card_id": sample.NativeCard.ID}},
+		{tool: "list_dashboards"},
+		{tool: "get_dashboard", args: map[string]any{"dashboard_id": sample.Dashboard.ID}},
+		{tool: "list_collections"},
+		{tool: "get_collection", args: map[string]any{"collection_id": "root"}},
+		{tool: "get_collection", args: map[string]any{"collection_id": 1}},
+		{tool: "list_collection_items", args: map[string]any{"collection_id": 1}},
+		{tool: "list_databases"},
+		{tool: "get_database_metadata", args: map[string]any{"database_id": sample.Database.ID}},
+		{tool: "list_tables", args: map[string]any{"database_id": sample.Database.ID}},
+		{tool: "get_table_metadata", args: map[string]any{"table_id": sample.Orders.ID}},
+		{tool: "get_table_fks", args: map[string]any{"table_id": sample.Orders.ID}},
+		{tool: "get_field", args: map[string]any{"field_id": field}},
+		{tool: "get_field_values", args: map[string]any{"field_id": field}},
+		{tool: "execute_query", args: map[string]any{"database_id": sample.Database.ID, "query_type": "native", "native_query": "SELECT * FROM ORDERS", "format": "json"}},
+		{tool: "list_users"},
+		{tool: "get_current_user"},
+		{tool: "list_permission_groups"},
+		{tool: "get_permissions_graph"},
+		{tool: "search", args: map[string]any{"query": "orders"}},
+		{tool: "list_settings"},
+		{tool: "get_activity"},
+		{tool: "get_recent_views"},
+		{tool: "list_timelines"},
+		{tool: "list_instances"},
+		{tool: "get_server_info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: tt.tool, Arguments: tt.args})
+			require.NoError(t, err)
+			require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+			require.NotNil(t, result.StructuredContent)
+			data, err := json.Marshal(result.StructuredContent)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(string(data), "{"), "structured content is an object")
+		})
+	}
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		for _, tt := range []struct {
+			args map[string]any
+			want string
+		}{
+			{args: map[string]any{}, want: `invalid arguments: required: missing properties: ["card_id"]`},
+			{args: map[string]any{"card_id": "seven"}, want: "invalid arguments: validating /properties/card_id: type"},
+			{args: map[string]any{"card_id": sample.NativeCard.ID, "format": "xml"}, want: "invalid arguments: validating /properties/format: enum"},
+			{args: map[string]any{"card_id": sample.NativeCard.ID, "colour": "red"}, want: `invalid arguments: unexpected additional properties ["colour"]`},
+		} {
+			result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "execute_card_query", Arguments: tt.args})
+			require.NoError(t, err)
+			assert.True(t, result.IsError, tt.args)
+			assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, tt.want)
+		}
+		_, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "no_such_tool"})
+		assert.Error(t, err, "unknown tools are still protocol errors")
+	})
+}
+
+// syncingClient makes a sync add a table to the fake's schema, as Metabase
+// does in the background some time after the sync was started.
+type syncingClient struct {
+	*metabasetest.Fake
+	synced atomic.Bool
+	polls  atomic.Int32
+}
+
+func (c *syncingClient) SyncDatabase(ctx context.Context, id int) error {
+	c.synced.Store(true)
+	return c.Fake.SyncDatabase(ctx, id)
+}
+
+func (c *syncingClient) GetDatabaseMetadata(ctx context.Context, id int) (*metabase.Database, error) {
+	db, err := c.Fake.GetDatabaseMetadata(ctx, id)
+	if err != nil || !c.synced.Load() {
+		return db, err
+	}
+	// The first read after the sync started still sees the old schema.
+	if c.polls.Add(1) > 1 {
+		db.Tables = append(slices.Clone(db.Tables), metabase.Table{ID: 999, Name: "AUDIT", DBID: id})
+	}
+	return db, nil
+}
+
+func TestResources_Schema(t *testing.T) {
+	defer func(interval time.Duration) { syncPollInterval = interval }(syncPollInterval)
+	syncPollInterval = 10 * time.Millisecond
+
+	fake, sample := metabasetest.NewSample()
+	client := &syncingClient{Fake: fake}
+	opts := &mcp.ServerOptions{}
+	EnableResourceSubscriptions(opts)
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, opts)
+	r := registerAll(server, SingleInstance(client), zerolog.Nop(), Options{})
+
+	updated := make(chan string, 1)
+	mcpClient := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+	})
+	sTransport, cTransport := mcp.NewInMemoryTransports()
+	ctx := context.Background()
+	go func() { _ = server.Run(ctx, sTransport) }()
+	session, err := mcpClient.Connect(ctx, cTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+
+	schemaURI := fmt.Sprintf("metabase://database/%d/schema", sample.Database.ID)
+	list, err := session.ListResources(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, list.Resources, 1)
+	assert.Equal(t, schemaURI, list.Resources[0].URI)
+
+	templates, err := session.ListResourceTemplates(ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, templates.ResourceTemplates, 4)
+
+	read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: schemaURI})
+	require.NoError(t, err)
+	schema := read.Contents[0].Text
+	assert.Equal(t, "text/plain", read.Contents[0].MIMEType)
+	assert.Contains(t, schema, "CREATE TABLE PUBLIC.ORDERS (")
+	assert.Contains(t, schema, "  USER_ID INTEGER REFERENCES PUBLIC.PEOPLE(ID), -- field ")
+	assert.Contains(t, schema, ", FK\n")
+
+	read, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: fmt.Sprintf("metabase://table/%d", sample.Orders.ID)})
+	require.NoError(t, err)
+	assert.Contains(t, read.Contents[0].Text, fmt.Sprintf("CREATE TABLE PUBLIC.ORDERS ( -- table %d \"Orders\"\n", sample.Orders.ID))
+	assert.Contains(t, read.Contents[0].Text, "PRODUCT_ID INTEGER REFERENCES PUBLIC.PRODUCTS(ID)")
+
+	_, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: "metabase://table/999"})
+	assert.Error(t, err)
+
+	require.NoError(t, session.Subscribe(ctx, &mcp.SubscribeParams{URI: schemaURI}))
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "sync_database", Arguments: map[string]any{"database_id": sample.Database.ID}})
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	select {
+	case uri := <-updated:
+		assert.Equal(t, schemaURI, uri)
+		assert.GreaterOrEqual(t, client.polls.Load(), int32(3), "subscribers are notified once the schema has changed and settled")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no resource update notification after sync_database")
+	}
+
+	// Subscriptions end with their session.
+	assert.Equal(t, []string{schemaURI}, r.subscriptions.list())
+	require.NoError(t, session.Close())
+	require.Eventually(t, func() bool { return len(r.subscriptions.list()) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestParseResourceURI(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    resourceURI
+		wantErr bool
+	}{
+		{uri: "metabase://database/1/schema", want: resourceURI{Kind: "database", ID: 1, Suffix: "/schema"}},
+		{uri: "metabase://table/5?instance=prod", want: resourceURI{Kind: "table", ID: 5, Instance: "prod"}},
+		{uri: "metabase://table/orders", wantErr: true},
+		{uri: "https://metabase.example.com/table/5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			got, err := parseResourceURI(tt.uri)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.uri, got.String())
+		})
+	}
+}
+
+func TestResources_CardsAndDashboards(t *testing.T) {
+	fake, sample, session := setupFakeServer(t, Options{})
+	ctx := context.Background()
+
+	card, err := fake.CreateCard(ctx, &metabase.Card{
+		Name:         "Orders by state",
+		Display:      "bar",
+		CollectionID: sample.NativeCard.CollectionID,
+		DatasetQuery: map[string]any{
+			"database": sample.Database.ID,
+			"type":     "native",
+			"native": map[string]any{
+				"query":         "SELECT * FROM PEOPLE WHERE STATE = {{state}}",
+				"template-tags": map[string]any{"state": map[string]any{"type": "text", "display-name": "State", "required": true, "default": "TX"}},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: fmt.Sprintf("metabase://card/%d", card.ID)})
+	require.NoError(t, err)
+	text := read.Contents[0].Text
+	assert.Equal(t, "text/markdown", read.Contents[0].MIMEType)
+	assert.Contains(t, text, "# Orders by state\n")
+	assert.Contains(t, text, fmt.Sprintf("Card %d in Our analytics / Examples, shown as bar.", card.ID))
+	assert.Contains(t, text, "```sql\nSELECT * FROM PEOPLE WHERE STATE = {{state}}\n```")
+	assert.Contains(t, text, "- `state` (text, \"State\"), required, default \"TX\"\n")
+
+	read, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: fmt.Sprintf("metabase://dashboard/%d", sample.Dashboard.ID)})
+	require.NoError(t, err)
+	text = read.Contents[0].Text
+	assert.Contains(t, text, "# Sales overview\n")
+	assert.Contains(t, text, "- 0, 0: 12x6 Recent orders (metabase://card/")
+
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "get_card", Arguments: map[string]any{"card_id": card.ID}})
+	require.NoError(t, err)
+	require.Len(t, result.Content, 2)
+	link, ok := result.Content[1].(*mcp.ResourceLink)
+	require.True(t, ok)
+	assert.Equal(t, fmt.Sprintf("metabase://card/%d", card.ID), link.URI)
+	assert.Equal(t, "Orders by state", link.Name)
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "search", Arguments: map[string]any{"query": "orders"}})
+	require.NoError(t, err)
+	var uris []string
+	for _, c := range result.Content[1:] {
+		uris = append(uris, c.(*mcp.ResourceLink).URI)
+	}
+	assert.Contains(t, uris, fmt.Sprintf("metabase://card/%d", card.ID))
+}
+
+// timelineClient adds timelines to the fake, which has none.
+type timelineClient struct {
+	*metabasetest.Fake
+	timelines []metabase.Timeline
+}
+
+func (c *timelineClient) ListTimelines(context.Context, *int) ([]metabase.Timeline, error) {
+	return c.timelines, nil
+}
+
+func (c *timelineClient) GetTimeline(_ context.Context, id int) (*metabase.Timeline, error) {
+	for _, tl := range c.timelines {
+		if tl.ID == id {
+			return &tl, nil
+		}
+	}
+	return nil, &metabase.APIError{StatusCode: http.StatusNotFound, Method: http.MethodGet, Endpoint: fmt.Sprintf("/api/timeline/%d", id)}
+}
+
+func TestPrompts(t *testing.T) {
+	fake, sample := metabasetest.NewSample()
+	archived := true
+	client := &timelineClient{Fake: fake, timelines: []metabase.Timeline{{
+		ID:   1,
+		Name: "Releases",
+		Events: []metabase.TimelineEvent{
+			{Name: "Checkout redesign", Timestamp: "2026-03-10T00:00:00Z"},
+			{Name: "Price change", Timestamp: "2026-03-02T09:30:00Z"},
+			{Name: "Before", Timestamp: "2026-02-28T23:00:00Z"},
+			{Name: "After", Timestamp: "2026-03-16T00:00:00Z"},
+			{Name: "Withdrawn", Timestamp: "2026-03-05T00:00:00Z", Archived: &archived},
+		},
+	}}}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weekly_review.yaml"), []byte(`title: Weekly review
+description: Review a dashboard
+arguments:
+  - name: dashboard_id
+    required: true
+  - name: focus
+template: |
+  Review this dashboard{{if .focus}}, focusing on {{.focus}}{{end}}:
+  {{dashboard .dashboard_id}}
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "explain.yml"), []byte(`name: explain_card
+arguments:
+  - name: card_id
+template: "Briefly: {{card .card_id}}"
+`), 0o600))
+	prompts, err := LoadPrompts(dir)
+	require.NoError(t, err)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), zerolog.Nop(), Options{Prompts: prompts})
+	session := connectTestSession(t, server)
+	ctx := context.Background()
+
+	list, err := session.ListPrompts(ctx, nil)
+	require.NoError(t, err)
+	var names []string
+	for _, p := range list.Prompts {
+		names = append(names, p.Name)
+	}
+	assert.ElementsMatch(t, []string{"build_dashboard", "explain_card", "explore_database", "investigate_metric_drop", "weekly_review"}, names)
+
+	get := func(name string, args map[string]string) string {
+		t.Helper()
+		result, err := session.GetPrompt(ctx, &mcp.GetPromptParams{Name: name, Arguments: args})
+		require.NoError(t, err)
+		require.Len(t, result.Messages, 1)
+		assert.Equal(t, mcp.Role("user"), result.Messages[0].Role)
+		return result.Messages[0].Content.(*mcp.TextContent).Text
+	}
+
+	text := get("explore_database", map[string]string{"database_id": strconv.Itoa(sample.Database.ID)})
+	assert.Contains(t, text, fmt.Sprintf("-- database %d: Sample Database", sample.Database.ID))
+
+	text = get("build_dashboard", map[string]string{"table_id": strconv.Itoa(sample.Orders.ID), "collection_id": "7"})
+	assert.Contains(t, text, "CREATE TABLE")
+	assert.Contains(t, text, "save it with create_card in collection 7. Create the dashboard")
+
+	text = get("investigate_metric_drop", map[string]string{"card_id": strconv.Itoa(sample.NativeCard.ID), "start_date": "2026-03-01", "end_date": "2026-03-15"})
+	assert.Contains(t, text, "# "+sample.NativeCard.Name)
+	assert.Contains(t, text, "- 2026-03-02 09:30:00: Price change (Releases)\n- 2026-03-10: Checkout redesign (Releases)\n\nFirst confirm")
+	assert.NotContains(t, text, "Withdrawn")
+
+	text = get("explain_card", map[string]string{"card_id": strconv.Itoa(sample.NativeCard.ID)})
+	assert.True(t, strings.HasPrefix(text, "Briefly: # "+sample.NativeCard.Name), text)
+
+	text = get("weekly_review", map[string]string{"dashboard_id": strconv.Itoa(sample.Dashboard.ID)})
+	assert.Contains(t, text, "Review this dashboard:\n# Sales overview")
+	assert.Contains(t, text, "(metabase://card/")
+
+	for _, tc := range []struct {
+		name string
+		args map[string]string
+		want string
+	}{
+		{name: "explore_database", want: "missing required argument: database_id"},
+		{name: "explain_card", args: map[string]string{"card_id": "9999"}, want: "card 9999 not found"},
+		{name: "explain_card", args: map[string]string{"card_id": "latest"}, want: `invalid ID "latest"`},
+		{name: "investigate_metric_drop", args: map[string]string{"card_id": "1", "start_date": "March", "end_date": "2026-03-15"}, want: `invalid date "March"`},
+	} {
+		_, err := session.GetPrompt(ctx, &mcp.GetPromptParams{Name: tc.name, Arguments: tc.args})
+		require.Error(t, err, tc.name)
+		assert.Contains(t, err.Error(), tc.want)
+	}
+}
+
+func TestLoadPrompts(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{name: "empty dir", files: map[string]string{"README.md": "not a prompt"}},
+		{name: "unknown key", files: map[string]string{"a.yaml": "template: hi\nargs: []\n"}, want: "a.yaml: yaml: unmarshal errors:\n  line 2: field args not found"},
+		{name: "empty template", files: map[string]string{"a.yaml": "description: nothing\n"}, want: "a.yaml: template is empty"},
+		{name: "bad name", files: map[string]string{"weekly-review.yaml": "template: hi\n"}, want: `invalid prompt name "weekly-review"`},
+		{name: "reserved argument", files: map[string]string{"a.yaml": "template: hi\narguments: [{name: instance}]\n"}, want: `invalid argument name "instance"`},
+		{name: "unknown function", files: map[string]string{"a.yaml": "template: '{{chart 1}}'\n"}, want: `function "chart" not defined`},
+		{name: "duplicate", files: map[string]string{"a.yaml": "name: b\ntemplate: hi\n", "b.yml": "template: hi\n"}, want: `b.yml: prompt "b" is also defined in a.yaml`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+			}
+			prompts, err := LoadPrompts(dir)
+			if tt.want == "" {
+				require.NoError(t, err)
+				assert.Empty(t, prompts)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+// slowQueryClient makes the fake take a while to answer queries.
+type slowQueryClient struct {
+	*metabasetest.Fake
+	delay time.Duration
+}
+
+func (c *slowQueryClient) ExecuteQuery(ctx context.Context, req *metabase.DatasetQueryRequest) (*metabase.DatasetQueryResponse, error) {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return c.Fake.ExecuteQuery(ctx, req)
+}
+
+func TestProgressNotifications(t *testing.T) {
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 20 * time.Millisecond
+
+	fake, sample := metabasetest.NewSample()
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(&slowQueryClient{Fake: fake, delay: 150 * time.Millisecond}), zerolog.Nop(), Options{})
+
+	var mu sync.Mutex
+	var messages []string
+	sTransport, cTransport := mcp.NewInMemoryTransports()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "test"}, &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			assert.Equal(t, "query-1", req.Params.ProgressToken)
+			mu.Lock()
+			messages = append(messages, req.Params.Message)
+			mu.Unlock()
+		},
+	})
+	ctx := context.Background()
+	go func() { _ = server.Run(ctx, sTransport) }()
+	session, err := client.Connect(ctx, cTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = session.Close() })
+
+	// SetProgressToken needs an existing _meta to store the token in.
+	params := &mcp.CallToolParams{Meta: mcp.Meta{}, Name: "execute_query", Arguments: map[string]any{
+		"database_id":  sample.Database.ID,
+		"query_type":   "native",
+		"native_query": "SELECT * FROM ORDERS",
+	}}
+	params.SetProgressToken("query-1")
+	result, err := session.CallTool(ctx, params)
+	require.NoError(t, err)
+	require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+
+	received := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(messages)
+	}
+	require.Eventually(t, func() bool { return len(received()) >= 3 }, time.Second, 10*time.Millisecond)
+	got := received()
+	assert.Equal(t, "Checking that the query is read-only", got[0])
+	assert.Contains(t, got, fmt.Sprintf("Running the query on database %d", sample.Database.ID))
+	assert.Contains(t, got[len(got)-1], "elapsed)")
+
+	// Without a token there are no notifications.
+	_, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "execute_query", Arguments: params.Arguments})
+	require.NoError(t, err)
+	assert.Len(t, received(), len(got))
+}
+
+func TestAsyncJobs(t *testing.T) {
+	_, sample, session := setupFakeServer(t, Options{Jobs: NewJobs(1, 200*time.Millisecond)})
+	ctx := context.Background()
+	call := func(name string, args map[string]any) (*mcp.CallToolResult, map[string]any) {
+		t.Helper()
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		require.NoError(t, err)
+		out, _ := result.StructuredContent.(map[string]any)
+		return result, out
+	}
+	start := func(query string) string {
+		t.Helper()
+		result, out := call("execute_query", map[string]any{
+			"database_id":  sample.Database.ID,
+			"query_type":   "native",
+			"native_query": query,
+			"async":        true,
+		})
+		require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+		job := out["job"].(map[string]any)
+		assert.Contains(t, []any{"queued", "running"}, job["status"])
+		assert.NotContains(t, out, "rows", "async mode returns only the job")
+		return job["id"].(string)
+	}
+	finished := func(id string) map[string]any {
+		t.Helper()
+		var status map[string]any
+		require.Eventually(t, func() bool {
+			result, out := call("get_job_status", map[string]any{"job_id": id})
+			require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+			status = out
+			return out["finished_at"] != nil
+		}, 5*time.Second, 10*time.Millisecond)
+		return status
+	}
+
+	id := start("SELECT * FROM ORDERS")
+	status := finished(id)
+	assert.Equal(t, "succeeded", status["status"])
+	assert.Equal(t, "execute_query", status["tool"])
+	assert.NotEmpty(t, status["expires_at"])
+
+	result, out := call("get_job_result", map[string]any{"job_id": id})
+	require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, id, out["job"].(map[string]any)["id"])
+	assert.Positive(t, out["result"].(map[string]any)["row_count"])
+
+	t.Run("rejected before it is queued", func(t *testing.T) {
+		for _, args := range []map[string]any{
+			{"database_id": sample.Database.ID, "query_type": "native", "native_query": "DELETE FROM ORDERS", "async": true},
+			{"database_id": sample.Database.ID, "query_type": "native", "async": true},
+			{"database_id": sample.Database.ID, "query_type": "query", "async": true},
+		} {
+			for _, tool := range []string{"execute_query", "export_query_results"} {
+				if tool == "export_query_results" {
+					args = maps.Clone(args)
+					args["export_format"] = "csv"
+				}
+				result, out := call(tool, args)
+				assert.True(t, result.IsError, "%s %v", tool, args)
+				assert.NotContains(t, out, "job")
+			}
+		}
+		result, _ := call("execute_query", map[string]any{"database_id": sample.Database.ID, "query_type": "native", "native_query": "DELETE FROM ORDERS", "async": true})
+		assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "blocked operation: DELETE")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		id := start("SELECT * FROM MISSING_TABLE")
+		status := finished(id)
+		assert.Equal(t, "failed", status["status"])
+		assert.NotEmpty(t, status["error"])
+
+		result, out := call("get_job_result", map[string]any{"job_id": id})
+		assert.True(t, result.IsError, "the result is the failed tool call's")
+		assert.Equal(t, status["error"], result.Content[0].(*mcp.TextContent).Text)
+		assert.Equal(t, "failed", out["job"].(map[string]any)["status"])
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		for _, tool := range []string{"get_job_status", "get_job_result", "cancel_job"} {
+			result, _ := call(tool, map[string]any{"job_id": "job-0000000000000000"})
+			assert.True(t, result.IsError, tool)
+			assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, `unknown job "job-0000000000000000"; finished jobs are kept for 200ms`)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		require.Eventually(t, func() bool {
+			result, _ := call("get_job_status", map[string]any{"job_id": id})
+			return result.IsError
+		}, 5*time.Second, 20*time.Millisecond, "finished jobs are removed after the TTL")
+	})
+
+	t.Run("other sessions", func(t *testing.T) {
+		id := start("SELECT * FROM ORDERS")
+		server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+		otherFake, _ := metabasetest.NewSample()
+		RegisterAll(server, SingleInstance(otherFake), zerolog.Nop(), Options{})
+		other := connectTestSession(t, server)
+		result, err := other.CallTool(ctx, &mcp.CallToolParams{Name: "get_job_status", Arguments: map[string]any{"job_id": id}})
+		require.NoError(t, err)
+		assert.True(t, result.IsError, "jobs are visible only to the server that started them")
+	})
+}
+
+func TestAsyncJobs_Cancel(t *testing.T) {
+	client, aborted := newSlowClient(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), zerolog.Nop(), Options{})
+	session := connectTestSession(t, server)
+	ctx := context.Background()
+
+	args := map[string]any{"async": true}
+	for k, v := range mbqlQuery.Arguments.(map[string]any) {
+		args[k] = v
+	}
+	result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "execute_query", Arguments: args})
+	require.NoError(t, err)
+	require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+	id := result.StructuredContent.(map[string]any)["job"].(map[string]any)["id"]
+
+	time.Sleep(100 * time.Millisecond)
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "cancel_job", Arguments: map[string]any{"job_id": id}})
+	require.NoError(t, err)
+	require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+	assert.Equal(t, "cancelled", result.StructuredContent.(map[string]any)["status"])
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metabase request was not aborted after the job was cancelled")
+	}
+
+	result, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "get_job_result", Arguments: map[string]any{"job_id": id}})
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "was cancelled")
+}
+
+func TestAsyncJobs_Sessions(t *testing.T) {
+	client, aborted := newSlowClient(t)
+	server := mcp.NewServer(&mcp.Implementation{Name: "metabase-mcp-server", Version: "test"}, nil)
+	RegisterAll(server, SingleInstance(client), zerolog.Nop(), Options{Jobs: NewJobs(1, time.Minute)})
+	first := connectTestSession(t, server)
+	second := connectTestSession(t, server)
+	ctx := context.Background()
+
+	args := map[string]any{"async": true}
+	for k, v := range mbqlQuery.Arguments.(map[string]any) {
+		args[k] = v
+	}
+	start := func(session *mcp.ClientSession) *mcp.CallToolResult {
+		t.Helper()
+		result, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "execute_query", Arguments: args})
+		require.NoError(t, err)
+		return result
+	}
+	jobID := func(result *mcp.CallToolResult) string {
+		t.Helper()
+		require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+		return result.StructuredContent.(map[string]any)["job"].(map[string]any)["id"].(string)
+	}
+	status := func(id string) string {
+		t.Helper()
+		result, err := second.CallTool(ctx, &mcp.CallToolParams{Name: "get_job_status", Arguments: map[string]any{"job_id": id}})
+		require.NoError(t, err)
+		require.False(t, result.IsError, result.Content[0].(*mcp.TextContent).Text)
+		return result.StructuredContent.(map[string]any)["status"].(string)
+	}
+
+	// The first session's jobs take the only worker and fill its queue.
+	ids := []string{jobID(start(first))}
+	require.Eventually(t, func() bool { return status(ids[0]) == "running" }, 5*time.Second, 10*time.Millisecond)
+	for range maxQueuedJobs {
+		ids = append(ids, jobID(start(first)))
+	}
+	result := start(first)
+	require.True(t, result.IsError)
+	assert.Contains(t, result.Content[0].(*mcp.TextContent).Text, "too many jobs are waiting")
+	other := jobID(start(second))
+	assert.Equal(t, "queued", status(other), "the queue limit applies per session")
+
+	require.NoError(t, first.Close())
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("metabase request was not aborted after the session ended")
+	}
+	for _, id := range ids {
+		require.Eventually(t, func() bool { return status(id) == "cancelled" }, 5*time.Second, 10*time.Millisecond, "jobs end with their session")
+	}
+	assert.Eventually(t, func() bool { return status(other) == "running" }, 5*time.Second, 10*time.Millisecond, "other sessions' jobs go on")
+}
@@ -9,47 +9,48 @@ import (
 	"github.com/anaryk/metabase-mcp-server/internal/metabase"
 )
 
-func registerUserTools(server *mcp.Server, client *metabase.Client, logger zerolog.Logger) {
-	addTool(server, "list_users", "List all Metabase users",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			logger.Debug().Msg("listing users")
-			users, err := client.ListUsers()
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(users)
-		})
+// userFields are the user fields list_users returns by default.
+var userFields = []string{"id", "email", "common_name", "is_active", "is_superuser"}
 
-	addTool(server, "get_user", "Get a user by ID",
-		inputSchema(map[string]any{
-			"user_id": map[string]any{"type": "number", "description": "The user ID"},
-		}, []string{"user_id"}),
-		func(_ context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			var args map[string]any
-			if err := parseArgs(req, &args); err != nil {
-				return errResult(err)
+type listUsersArgs struct {
+	pageArgs
+	fieldsArgs
+}
+
+type userIDArgs struct {
+	UserID int `json:"user_id" jsonschema:"The user ID"`
+}
+
+func registerUserTools(r *registrar, logger zerolog.Logger) {
+	addTool(r, "list_users", "List the Metabase users, a page at a time",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args listUsersArgs) (*mcp.CallToolResult, *listResult[map[string]any], error) {
+			page, err := args.page()
+			if err != nil {
+				return nil, nil, err
 			}
-			id, err := intArg(args, "user_id")
+			logger.Debug().Int("limit", page.Limit).Int("offset", page.Offset).Msg("listing users")
+			users, err := client.ListUsers(ctx, page)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			logger.Debug().Int("user_id", id).Msg("getting user")
-			user, err := client.GetUser(id)
+			projected, err := projectPage(users, args.Fields, userFields)
 			if err != nil {
-				return errResult(err)
+				return nil, nil, err
 			}
-			return marshalResult(user)
+			return nil, pagedResult(projected, "users"), nil
+		}, withFields[metabase.User](userFields))
+
+	addTool(r, "get_user", "Get a user by ID",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, args userIDArgs) (*mcp.CallToolResult, *metabase.User, error) {
+			logger.Debug().Int("user_id", args.UserID).Msg("getting user")
+			user, err := client.GetUser(ctx, args.UserID)
+			return nil, user, err
 		})
 
-	addTool(server, "get_current_user", "Get the currently authenticated user",
-		inputSchema(map[string]any{}, nil),
-		func(_ context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	addTool(r, "get_current_user", "Get the currently authenticated user",
+		func(ctx context.Context, _ *mcp.CallToolRequest, client metabase.API, _ struct{}) (*mcp.CallToolResult, *metabase.User, error) {
 			logger.Debug().Msg("getting current user")
-			user, err := client.GetCurrentUser()
-			if err != nil {
-				return errResult(err)
-			}
-			return marshalResult(user)
+			user, err := client.GetCurrentUser(ctx)
+			return nil, user, err
 		})
 }